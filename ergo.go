@@ -38,13 +38,14 @@ func StartNodeWithContext(ctx context.Context, name string, cookie string, opts
 	}
 
 	if opts.Handshake == nil {
-		handshakeOptions := dist.HandshakeOptions{
-			Cookie:  cookie,
-			Version: dist.DefaultDistHandshakeVersion,
+		handshakeOptions := dist.DistHandshakeOptions{
+			Cookie:      cookie,
+			Version:     dist.DefaultDistHandshakeVersion,
+			FlowControl: opts.FlowControl,
 		}
 		// set default handshake for the node (Erlang Dist Handshake)
 		handshakeTimeout := 5 * time.Second
-		opts.Handshake == dist.CreateHandshake(handshakeTimeout, handshakeOptions)
+		opts.Handshake = dist.CreateDistHandshake(handshakeTimeout, handshakeOptions)
 	}
 
 	if opts.Proto == nil {
@@ -53,9 +54,16 @@ func StartNodeWithContext(ctx context.Context, name string, cookie string, opts
 	}
 
 	if opts.StaticRoutesOnly == false && opts.Resolver == nil {
-		// set default resolver (Erlang EPMD service)
-		enabledServer := ops.ResolverDisableServer == false
-		opts.Resolver = dist.CreateResolver(ctx, enabledServer, opts.ResolverHost, opts.ResolverPort)
+		// set default resolver (Erlang EPMD service). It makes the connections
+		// the same way the node does.
+		resolverOptions := dist.ResolverOptions{
+			EnableServer: opts.ResolverDisableServer == false,
+			Host:         opts.ResolverHost,
+			Port:         opts.ResolverListen,
+			Dialer:       opts.Dialer,
+			DialTimeout:  opts.DialTimeout,
+		}
+		opts.Resolver = dist.CreateResolverWithOptions(ctx, resolverOptions)
 	}
 
 	return node.StartWithContext(ctx, name, cookie, opts)
@@ -14,10 +14,21 @@ type AtomCache struct {
 	cacheMap  map[Atom]int16
 	update    chan Atom
 	lastID    int16
+	size      int16
 	cacheList [maxCacheItems]Atom
 	sync.Mutex
 }
 
+// AtomCacheOptions
+type AtomCacheOptions struct {
+	// Size limits the number of cached atoms. Can't exceed 2048 (the limit of
+	// the distribution protocol). Default 2048
+	Size int
+	// Preload puts the given atoms into the cache on creating, so they are sent
+	// using the cache references starting from the first message
+	Preload []Atom
+}
+
 // CacheItem
 type CacheItem struct {
 	ID      int16
@@ -49,7 +60,7 @@ func (a *AtomCache) Append(atom Atom) {
 	a.Lock()
 	id := a.lastID
 	a.Unlock()
-	if id < maxCacheItems {
+	if id+1 < a.size {
 		a.update <- atom
 	}
 	// otherwise ignore
@@ -65,12 +76,32 @@ func (a *AtomCache) GetLastID() int16 {
 
 // NewAtomCache
 func NewAtomCache(ctx context.Context) *AtomCache {
+	return NewAtomCacheWithOptions(ctx, AtomCacheOptions{})
+}
+
+// NewAtomCacheWithOptions
+func NewAtomCacheWithOptions(ctx context.Context, options AtomCacheOptions) *AtomCache {
 	var id int16
 
 	a := &AtomCache{
 		cacheMap: make(map[Atom]int16),
 		update:   make(chan Atom, 100),
 		lastID:   -1,
+		size:     maxCacheItems,
+	}
+	if options.Size > 0 && options.Size < int(maxCacheItems) {
+		a.size = int16(options.Size)
+	}
+	for _, atom := range options.Preload {
+		if a.lastID+1 >= a.size {
+			break
+		}
+		if _, ok := a.cacheMap[atom]; ok {
+			continue
+		}
+		a.lastID++
+		a.cacheMap[atom] = a.lastID
+		a.cacheList[a.lastID] = atom
 	}
 
 	go func() {
@@ -81,6 +112,10 @@ func NewAtomCache(ctx context.Context) *AtomCache {
 					// already exist
 					continue
 				}
+				if a.lastID+1 >= a.size {
+					// cache is full
+					continue
+				}
 
 				id = a.lastID
 				id++
@@ -107,9 +142,12 @@ func (a *AtomCache) List() [maxCacheItems]Atom {
 	return l
 }
 
-// ListSince
+// ListSince returns the atoms cached since the given id. Must be called under the lock.
 func (a *AtomCache) ListSince(id int16) []Atom {
-	return a.cacheList[id:]
+	if id > a.lastID {
+		return nil
+	}
+	return a.cacheList[id : a.lastID+1]
 }
 
 // TakeListAtomCache
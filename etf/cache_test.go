@@ -32,7 +32,7 @@ func TestAtomCache(t *testing.T) {
 
 	expected := []Atom{"test1", "test2"}
 	result := a.ListSince(0)
-	if reflect.DeepEqual(result, expected) {
+	if !reflect.DeepEqual(result, expected) {
 		t.Fatal("got incorrect result", result)
 	}
 
@@ -41,7 +41,35 @@ func TestAtomCache(t *testing.T) {
 	expectedArray[1] = "test2"
 
 	resultArray := a.List()
-	if reflect.DeepEqual(resultArray, expectedArray) {
+	if !reflect.DeepEqual(resultArray[:], expectedArray) {
 		t.Fatal("got incorrect resultArray", result)
 	}
 }
+
+func TestAtomCachePreload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	options := AtomCacheOptions{
+		Size:    3,
+		Preload: []Atom{"a", "b", "a"},
+	}
+	a := NewAtomCacheWithOptions(ctx, options)
+	if a.GetLastID() != 1 {
+		t.Fatal("LastID != 1", a.GetLastID())
+	}
+
+	a.Append(Atom("c"))
+	time.Sleep(100 * time.Millisecond)
+	// cache is full
+	a.Append(Atom("d"))
+	time.Sleep(100 * time.Millisecond)
+
+	expected := []Atom{"a", "b", "c"}
+	a.Lock()
+	result := a.ListSince(0)
+	a.Unlock()
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatal("got incorrect result", result)
+	}
+}
@@ -39,6 +39,7 @@ var (
 	errMalformedSmallTuple    = fmt.Errorf("Malformed ETF. ettSmallTuple")
 	errMalformedLargeTuple    = fmt.Errorf("Malformed ETF. ettLargeTuple")
 	errMalformedMap           = fmt.Errorf("Malformed ETF. ettMap")
+	errUnsupportedMapKey      = fmt.Errorf("Unsupported ETF. ettMap key must not be a list, tuple or map")
 	errMalformedBinary        = fmt.Errorf("Malformed ETF. ettBinary")
 	errMalformedBitBinary     = fmt.Errorf("Malformed ETF. ettBitBinary")
 	errMalformedPid           = fmt.Errorf("Malformed ETF. ettPid")
@@ -58,6 +59,10 @@ var (
 // DecodeOptions
 type DecodeOptions struct {
 	FlagBigPidRef bool
+
+	// AtomTable enables interning the decoded atoms. Identical atoms share
+	// the same backing string (see NewAtomTable). Disabled if nil.
+	AtomTable *AtomTable
 }
 
 // stackless implementation is speeding up decoding function up to x25 times
@@ -118,7 +123,7 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 				return nil, nil, errMalformedAtomUTF8
 			}
 
-			atom := Atom(packet[2 : n+2])
+			atom := decodeAtom(packet[2:n+2], options.AtomTable)
 			if len([]rune(atom)) > 255 {
 				return nil, nil, errMalformedAtomUTF8
 			}
@@ -141,7 +146,7 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			case "false":
 				term = false
 			default:
-				term = Atom(packet[1 : n+1])
+				term = decodeAtom(packet[1:n+1], options.AtomTable)
 			}
 			packet = packet[n+1:]
 
@@ -503,8 +508,17 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 					break
 				}
 
-				// a key
-				stack.tmp = term
+				// a key. keep the key type distinguishable (see Map)
+				switch key := term.(type) {
+				case []byte:
+					stack.tmp = String(key)
+				case int:
+					stack.tmp = int64(key)
+				case List, ListImproper, Tuple, Map:
+					return nil, nil, errUnsupportedMapKey
+				default:
+					stack.tmp = term
+				}
 				stack.i++
 
 			case ettPid:
@@ -793,3 +807,10 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 	return term, packet, nil
 }
+
+func decodeAtom(b []byte, table *AtomTable) Atom {
+	if table == nil {
+		return Atom(b)
+	}
+	return table.Intern(b)
+}
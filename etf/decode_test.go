@@ -4,6 +4,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ergo-services/ergo/lib"
 )
 
 func TestDecodeAtom(t *testing.T) {
@@ -213,6 +215,45 @@ func TestDecodeMap(t *testing.T) {
 
 }
 
+func TestDecodeMapKeys(t *testing.T) {
+	// #{<<"a">> => 1, 2 => 3, b => 4}
+	packet := []byte{116, 0, 0, 0, 3, 109, 0, 0, 0, 1, 97, 97, 1, 97, 2, 97, 3, 100, 0, 1,
+		98, 97, 4}
+	expected := Map{
+		String("a"): 1,
+		int64(2):    3,
+		Atom("b"):   4,
+	}
+
+	term, _, err := Decode(packet, []Atom{}, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, term) {
+		t.Fatalf("expected %#v, got %#v", expected, term)
+	}
+
+	// binary key is encoded back as a binary
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	if err := Encode(term, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	term, _, err = Decode(b.B, []Atom{}, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, term) {
+		t.Fatalf("expected %#v, got %#v", expected, term)
+	}
+
+	// #{{a} => 1}
+	packet = []byte{116, 0, 0, 0, 1, 104, 1, 100, 0, 1, 97, 97, 1}
+	if _, _, err := Decode(packet, []Atom{}, DecodeOptions{}); err != errUnsupportedMapKey {
+		t.Fatal("expected errUnsupportedMapKey, got", err)
+	}
+}
+
 func TestDecodeBinary(t *testing.T) {
 	expected := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}
 	packet := []byte{ettBinary, 0, 0, 0, 10, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0}
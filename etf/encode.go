@@ -6,6 +6,7 @@ import (
 	"math"
 	"math/big"
 	"reflect"
+	"time"
 
 	"github.com/ergo-services/ergo/lib"
 )
@@ -37,6 +38,14 @@ type EncodeOptions struct {
 	// FlagBigCreation The node understands big node creation tags NEW_PID_EXT,
 	// NEWER_REFERENCE_EXT.
 	FlagBigCreation bool
+
+	// StringAsBinary encodes Go strings as binaries (BINARY_EXT) instead of
+	// the list of chars (STRING_EXT)
+	StringAsBinary bool
+
+	// TimeEncoding defines the way time.Time values are encoded.
+	// Default is TimeEncodingTimestamp ({MegaSecs, Secs, MicroSecs})
+	TimeEncoding TimeEncoding
 }
 
 // Encode
@@ -484,6 +493,10 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 			copy(buf[6:], bytes)
 
 		case string:
+			if options.StringAsBinary {
+				term = []byte(t)
+				goto recasting
+			}
 			lenString := len(t)
 
 			if lenString > 65535 {
@@ -500,6 +513,10 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 			term = []rune(t)
 			goto recasting
 
+		case time.Time:
+			term = timeToTerm(t, options.TimeEncoding)
+			goto recasting
+
 		case String:
 			term = []byte(t)
 			goto recasting
@@ -639,7 +656,7 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 		case ListImproper:
 			if len(t) == 0 {
 				b.AppendByte(ettNil)
-				continue
+				break
 			}
 			lenList := len(t) - 1
 			buf := b.Extend(5)
@@ -656,7 +673,7 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 			lenList := len(t)
 			if lenList == 0 {
 				b.AppendByte(ettNil)
-				continue
+				break
 			}
 			buf := b.Extend(5)
 			buf[0] = ettList
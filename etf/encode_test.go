@@ -215,6 +215,23 @@ func TestEncodeString(t *testing.T) {
 	}
 }
 
+func TestEncodeStringAsBinary(t *testing.T) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	expected := []byte{ettBinary, 0, 0, 0, 5, 72, 101, 108, 108, 111}
+	err := Encode("Hello", b, EncodeOptions{StringAsBinary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(b.B, expected) {
+		fmt.Println("exp", expected)
+		fmt.Println("got", b.B)
+		t.Fatal("incorrect value")
+	}
+}
+
 func TestEncodeAtom(t *testing.T) {
 	b := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(b)
@@ -339,6 +356,26 @@ func TestEncodeList(t *testing.T) {
 		t.Fatal("incorrect value")
 	}
 }
+func TestEncodeListEmpty(t *testing.T) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	expected := []byte{ettNil}
+	for _, term := range []Term{List{}, ListImproper{}} {
+		b.Reset()
+		err := Encode(term, b, EncodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(b.B, expected) {
+			fmt.Println("exp", expected)
+			fmt.Println("got", b.B)
+			t.Fatal("incorrect value")
+		}
+	}
+}
+
 func TestEncodeListImproper(t *testing.T) {
 	b := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(b)
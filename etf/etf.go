@@ -25,7 +25,9 @@ type ListImproper []Term
 // Atom
 type Atom string
 
-// Map
+// Map. Decoded keys keep the Erlang type: atom - Atom, binary - String, integer - int64
+// (*big.Int if it doesn't fit), float - float64. List, tuple and map keys are not
+// supported. Use TermMapIntoStringMap to get the map with the string keys.
 type Map map[Term]Term
 
 // String this type is intended to be used to interact with Erlang. String value encodes as a binary (Erlang type: <<...>>)
@@ -222,6 +224,8 @@ func TermToString(t Term) (s string, ok bool) {
 		s = string(x)
 	case string:
 		s = x
+	case String:
+		s = string(x)
 	case []byte:
 		s = string(x)
 	case List:
@@ -237,6 +241,29 @@ func TermToString(t Term) (s string, ok bool) {
 	return
 }
 
+// TermMapIntoStringMap transforms the map with the string-ish keys (Atom, String,
+// []byte, string or charlist) into the map with the string keys. Returns error if
+// the key can't be converted or the different keys turn into the same string
+// (e.g. the atom 'a' and the binary <<"a">>). Values are kept as is.
+func TermMapIntoStringMap(term Term) (map[string]interface{}, error) {
+	m, ok := term.(Map)
+	if !ok {
+		return nil, fmt.Errorf("can't convert %#v to map", term)
+	}
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		s, ok := TermToString(key)
+		if !ok {
+			return nil, fmt.Errorf("can't convert key %#v to string", key)
+		}
+		if _, exist := result[s]; exist {
+			return nil, fmt.Errorf("duplicate key %q", s)
+		}
+		result[s] = value
+	}
+	return result, nil
+}
+
 // TermProplistIntoStruct transorms given term into the provided struct 'dest'.
 // Proplist is the list of Tuple values with two items { Name , Value },
 // where Name can be string or Atom and Value must be the same type as
@@ -288,6 +315,15 @@ func termIntoStruct(term Term, dest reflect.Value) error {
 		}
 	}
 
+	if dest.Type() == timeType {
+		t, ok := TermToTime(term)
+		if !ok {
+			return NewInvalidTypesError(dest.Type(), term)
+		}
+		dest.Set(reflect.ValueOf(t))
+		return nil
+	}
+
 	switch dest.Kind() {
 	case reflect.Ptr:
 		pdest := reflect.New(dest.Type().Elem())
@@ -423,6 +459,9 @@ func termIntoStruct(term Term, dest reflect.Value) error {
 		case string:
 			dest.SetString(v)
 			return nil
+		case String:
+			dest.SetString(string(v))
+			return nil
 		case Atom:
 			dest.SetString(string(v))
 			return nil
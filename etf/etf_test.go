@@ -301,6 +301,39 @@ func TestTermMapIntoMap(t *testing.T) {
 
 }
 
+func TestTermMapIntoStringMap(t *testing.T) {
+	want := map[string]interface{}{
+		"a": 123,
+		"b": 456,
+		"c": 789,
+	}
+
+	term := Map{
+		String("a"): 123,
+		Atom("b"):   456,
+		"c":         789,
+	}
+
+	dest, err := TermMapIntoStringMap(term)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dest, want) {
+		t.Errorf("%#v: got %#v, want %#v", term, dest, want)
+	}
+
+	// binary and atom keys turn into the same string
+	term[Atom("a")] = 1
+	if _, err := TermMapIntoStringMap(term); err == nil {
+		t.Error("must be failed")
+	}
+
+	// integer key
+	if _, err := TermMapIntoStringMap(Map{int64(1): 1}); err == nil {
+		t.Error("must be failed")
+	}
+}
+
 func TestTermProplistIntoStruct(t *testing.T) {
 	type testStruct struct {
 		A []bool `etf:"a"`
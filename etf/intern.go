@@ -0,0 +1,71 @@
+package etf
+
+import (
+	"sync"
+)
+
+const (
+	// DefaultAtomTableLimit default number of atoms the AtomTable can hold
+	DefaultAtomTableLimit = 4096
+)
+
+// AtomTable keeps the decoded atoms in order to reuse the same backing string
+// for the identical atoms. Number of atoms is limited to prevent unbounded growth
+// of the table (Erlang atoms are never garbage collected, but we don't want to
+// follow this way on decoding the data from the untrusted peer). Atoms are
+// allocated as usual once the limit is reached.
+type AtomTable struct {
+	sync.RWMutex
+	atoms map[string]Atom
+	limit int
+}
+
+// NewAtomTable creates a new atom interning table. Uses DefaultAtomTableLimit if
+// the given limit is less than 1.
+func NewAtomTable(limit int) *AtomTable {
+	if limit < 1 {
+		limit = DefaultAtomTableLimit
+	}
+	return &AtomTable{
+		atoms: make(map[string]Atom),
+		limit: limit,
+	}
+}
+
+// Intern returns the interned atom for the given value.
+func (t *AtomTable) Intern(b []byte) Atom {
+	t.RLock()
+	// the compiler doesn't allocate a string for the map lookup
+	atom, ok := t.atoms[string(b)]
+	t.RUnlock()
+	if ok {
+		return atom
+	}
+
+	atom = Atom(b)
+
+	t.Lock()
+	defer t.Unlock()
+	if a, ok := t.atoms[string(atom)]; ok {
+		// has been added by another goroutine
+		return a
+	}
+	if len(t.atoms) < t.limit {
+		t.atoms[string(atom)] = atom
+	}
+	return atom
+}
+
+// Len returns the number of interned atoms
+func (t *AtomTable) Len() int {
+	t.RLock()
+	defer t.RUnlock()
+	return len(t.atoms)
+}
+
+// Reset removes all the interned atoms
+func (t *AtomTable) Reset() {
+	t.Lock()
+	t.atoms = make(map[string]Atom)
+	t.Unlock()
+}
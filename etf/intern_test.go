@@ -0,0 +1,35 @@
+package etf
+
+import (
+	"testing"
+)
+
+func TestAtomTable(t *testing.T) {
+	table := NewAtomTable(2)
+	options := DecodeOptions{
+		AtomTable: table,
+	}
+
+	packet := []byte{ettSmallAtomUTF8, 3, 97, 98, 99}
+	term1, _, err := Decode(packet, []Atom{}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term2, _, err := Decode(packet, []Atom{}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if term1 != Atom("abc") || term2 != Atom("abc") {
+		t.Fatal("got incorrect result", term1, term2)
+	}
+	if table.Len() != 1 {
+		t.Fatal("atom hasn't been interned")
+	}
+
+	table.Intern([]byte("def"))
+	table.Intern([]byte("ghi"))
+	if table.Len() != 2 {
+		t.Fatal("exceeded limit of the atom table", table.Len())
+	}
+}
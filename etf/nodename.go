@@ -0,0 +1,66 @@
+package etf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	ErrMalformedNodeName = fmt.Errorf("malformed node name (example: node@localhost)")
+)
+
+// NodeName represents the node name in form name@host. Host could be
+// an IPv6 literal enclosed in square brackets (node@[::1])
+type NodeName struct {
+	Name string
+	Host string
+}
+
+// ParseNodeName parses and validates the given node name. Returns ErrMalformedNodeName
+// if the name or host part is empty or the host part has a wrong format.
+func ParseNodeName(nodename string) (NodeName, error) {
+	var nn NodeName
+
+	i := strings.IndexByte(nodename, '@')
+	if i < 1 || i == len(nodename)-1 {
+		return nn, ErrMalformedNodeName
+	}
+	name := nodename[:i]
+	host := nodename[i+1:]
+
+	if strings.ContainsAny(host, "@ \t\r\n") {
+		return nn, ErrMalformedNodeName
+	}
+
+	if host[0] == '[' {
+		// IPv6 literal
+		if host[len(host)-1] != ']' {
+			return nn, ErrMalformedNodeName
+		}
+		host = host[1 : len(host)-1]
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return nn, ErrMalformedNodeName
+		}
+	} else if strings.ContainsAny(host, "[]:") {
+		// IPv6 literal must be enclosed in brackets
+		return nn, ErrMalformedNodeName
+	}
+
+	nn.Name = name
+	nn.Host = host
+	return nn, nil
+}
+
+// String returns the node name in form name@host
+func (nn NodeName) String() string {
+	if strings.IndexByte(nn.Host, ':') >= 0 {
+		return nn.Name + "@[" + nn.Host + "]"
+	}
+	return nn.Name + "@" + nn.Host
+}
+
+// Atom returns the node name as an Atom
+func (nn NodeName) Atom() Atom {
+	return Atom(nn.String())
+}
@@ -0,0 +1,49 @@
+package etf
+
+import (
+	"testing"
+)
+
+func TestParseNodeName(t *testing.T) {
+	valid := []struct {
+		nodename string
+		name     string
+		host     string
+	}{
+		{"node@localhost", "node", "localhost"},
+		{"node@127.0.0.1", "node", "127.0.0.1"},
+		{"node@host.example.com", "node", "host.example.com"},
+		{"node@[::1]", "node", "::1"},
+		{"node@[fe80::1ff:fe23:4567:890a]", "node", "fe80::1ff:fe23:4567:890a"},
+	}
+	for _, v := range valid {
+		nn, err := ParseNodeName(v.nodename)
+		if err != nil {
+			t.Fatalf("%q: %s", v.nodename, err)
+		}
+		if nn.Name != v.name || nn.Host != v.host {
+			t.Fatalf("%q: got %#v", v.nodename, nn)
+		}
+		if nn.String() != v.nodename {
+			t.Fatalf("%q: mismatch String() %q", v.nodename, nn.String())
+		}
+	}
+
+	malformed := []string{
+		"",
+		"node",
+		"node@",
+		"@localhost",
+		"node@host@host",
+		"node@::1",
+		"node@[::1",
+		"node@[localhost]",
+		"node@[127.0.0.1]",
+		"node@local host",
+	}
+	for _, v := range malformed {
+		if _, err := ParseNodeName(v); err != ErrMalformedNodeName {
+			t.Fatalf("%q: expected ErrMalformedNodeName, got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package etf
+
+import (
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// TimeEncoding defines the way time.Time values are encoded
+type TimeEncoding int
+
+const (
+	// TimeEncodingTimestamp encodes time.Time as a tuple {MegaSecs, Secs, MicroSecs}
+	// (the format of erlang:timestamp/0 and os:timestamp/0). Default.
+	TimeEncodingTimestamp TimeEncoding = 0
+	// TimeEncodingNanoseconds encodes time.Time as an integer number of nanoseconds
+	// since the Unix epoch (erlang:system_time(nanosecond)).
+	TimeEncodingNanoseconds TimeEncoding = 1
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func timeToTerm(t time.Time, encoding TimeEncoding) Term {
+	if encoding == TimeEncodingNanoseconds {
+		return t.UnixNano()
+	}
+	secs := t.Unix()
+	return Tuple{secs / 1000000, secs % 1000000, int64(t.Nanosecond() / 1000)}
+}
+
+// TermToTime converts the term encoded with any of TimeEncoding into time.Time.
+// Returns false if the term has a different format.
+func TermToTime(term Term) (time.Time, bool) {
+	switch t := term.(type) {
+	case Tuple:
+		if len(t) != 3 {
+			return time.Time{}, false
+		}
+		var v [3]int64
+		for i := range t {
+			n, ok := termToInt64(t[i])
+			if !ok {
+				return time.Time{}, false
+			}
+			v[i] = n
+		}
+		return time.Unix(v[0]*1000000+v[1], v[2]*1000), true
+
+	default:
+		nanos, ok := termToInt64(term)
+		if !ok {
+			return time.Time{}, false
+		}
+		return time.Unix(0, nanos), true
+	}
+}
+
+func termToInt64(term Term) (int64, bool) {
+	switch n := term.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case *big.Int:
+		if n.IsInt64() {
+			return n.Int64(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,56 @@
+package etf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+func TestEncodeDecodeTime(t *testing.T) {
+	now := time.Unix(1634567890, 123456000)
+
+	encodings := []struct {
+		encoding TimeEncoding
+		expected Term
+	}{
+		{TimeEncodingTimestamp, Tuple{1634, 567890, 123456}},
+		{TimeEncodingNanoseconds, int64(1634567890123456000)},
+	}
+
+	for _, e := range encodings {
+		b := lib.TakeBuffer()
+		if err := Encode(now, b, EncodeOptions{TimeEncoding: e.encoding}); err != nil {
+			t.Fatal(err)
+		}
+		term, _, err := Decode(b.B, []Atom{}, DecodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lib.ReleaseBuffer(b)
+
+		// decoded integers are not typed the same way as the encoded ones
+		value, ok := TermToTime(term)
+		if !ok {
+			t.Fatalf("can't convert %#v to time.Time", term)
+		}
+		if !value.Equal(now) {
+			t.Fatalf("mismatch time: expected %s, got %s", now, value)
+		}
+		if expected, ok := TermToTime(e.expected); !ok || !expected.Equal(now) {
+			t.Fatalf("wrong encoding %d: %#v", e.encoding, term)
+		}
+
+		type withTime struct {
+			A time.Time
+		}
+		var dest withTime
+		if err := TermIntoStruct(Tuple{term}, &dest); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dest.A.UnixNano(), now.UnixNano()) {
+			t.Fatalf("mismatch time: expected %s, got %s", now, dest.A)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package etf
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnsupportedType = fmt.Errorf("Encoding error. Unsupported type")
+)
+
+// Validate walks the given term and checks whether it can be encoded. Returns an
+// error naming the path to the offending value and its type
+// (e.g. "{1}.Field[2]: unsupported type chan int") so the problem is caught before
+// sending the message. Errors on unsupported types wrap ErrUnsupportedType.
+func Validate(term Term) error {
+	return validate(term, "")
+}
+
+func validate(term Term, path string) error {
+	switch t := term.(type) {
+	case bool, int8, uint8, int16, uint16, int32, uint32, int, uint, int64, uint64,
+		big.Int, string, Charlist, time.Time, String,
+		float32, float64, nil, Pid, Alias, Ref, []byte:
+		return nil
+
+	case Atom:
+		if utf8.RuneCountInString(string(t)) > 255 {
+			return fmt.Errorf("%s: %s", validatePath(path), ErrAtomTooLong)
+		}
+		return nil
+
+	case Tuple:
+		for i := range t {
+			if err := validate(t[i], fmt.Sprintf("%s{%d}", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case List:
+		for i := range t {
+			if err := validate(t[i], fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ListImproper:
+		for i := range t {
+			if err := validate(t[i], fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case Map:
+		for k, v := range t {
+			if err := validate(k, fmt.Sprintf("%s#{key %v}", path, k)); err != nil {
+				return err
+			}
+			if err := validate(v, fmt.Sprintf("%s#{%v}", path, k)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case Marshaler:
+		return nil
+	}
+
+	v := reflect.ValueOf(term)
+	switch v.Kind() {
+	case reflect.Struct:
+		vt := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := vt.Field(i)
+			fieldPath := path + "." + field.Name
+			if field.PkgPath != "" {
+				// the encoder can't access the value of unexported field
+				return fmt.Errorf("%s: %w (unexported field of %v)",
+					validatePath(fieldPath), ErrUnsupportedType, vt)
+			}
+			if err := validate(v.Field(i).Interface(), fieldPath); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := validate(v.Index(i).Interface(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key().Interface()
+			if err := validate(k, fmt.Sprintf("%s#{key %v}", path, k)); err != nil {
+				return err
+			}
+			if err := validate(iter.Value().Interface(), fmt.Sprintf("%s#{%v}", path, k)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return validate(v.Elem().Interface(), path)
+	}
+
+	return fmt.Errorf("%s: %w %v", validatePath(path), ErrUnsupportedType, v.Type())
+}
+
+func validatePath(path string) string {
+	if path == "" {
+		return "term"
+	}
+	return "term" + path
+}
@@ -0,0 +1,68 @@
+package etf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	type validStruct struct {
+		A int
+		B string `etf:"b"`
+		C []Atom
+		D map[string]*int
+	}
+	one := 1
+	valid := []Term{
+		nil,
+		123,
+		"hello",
+		Atom("ok"),
+		Tuple{Atom("ok"), List{1, 2.0, []byte{1}}, Map{Atom("k"): Pid{}}},
+		ListImproper{1, 2},
+		validStruct{A: 1, B: "b", C: []Atom{"a"}, D: map[string]*int{"one": &one, "nil": nil}},
+		&validStruct{},
+		[3]int{1, 2, 3},
+	}
+	for _, term := range valid {
+		if err := Validate(term); err != nil {
+			t.Fatalf("term %#v must be valid: %s", term, err)
+		}
+	}
+
+	type withChan struct {
+		A int
+		B chan int
+	}
+	type withUnexported struct {
+		A int
+		b int
+	}
+	invalid := []struct {
+		term Term
+		path string
+	}{
+		{make(chan int), "term: "},
+		{Tuple{1, func() {}}, "term{1}: "},
+		{List{1, Tuple{withChan{}}}, "term[1]{0}.B: "},
+		{Map{Atom("key"): []interface{}{1, make(chan int)}}, "term#{key}[1]: "},
+		{map[string]withUnexported{"x": {}}, "term#{x}.b: "},
+	}
+	for _, v := range invalid {
+		err := Validate(v.term)
+		if err == nil {
+			t.Fatalf("term %#v must be invalid", v.term)
+		}
+		if !errors.Is(err, ErrUnsupportedType) {
+			t.Fatalf("expected ErrUnsupportedType, got %s", err)
+		}
+		if !strings.HasPrefix(err.Error(), v.path) {
+			t.Fatalf("expected path %q, got %q", v.path, err)
+		}
+	}
+
+	if err := Validate(Atom(strings.Repeat("a", 256))); err == nil {
+		t.Fatal("too long atom must be invalid")
+	}
+}
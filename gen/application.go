@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/lib"
 )
 
 type ApplicationStartType = string
@@ -32,6 +33,10 @@ const (
 
 	// EnvKeySpec
 	EnvKeySpec EnvKey = "ergo:AppSpec"
+
+	// EnvKeyApplication keeps the name of the application. The children of the
+	// application get it from their group leader.
+	EnvKeyApplication EnvKey = "ergo:Application"
 )
 
 // ApplicationBehavior interface
@@ -91,9 +96,9 @@ func (a *Application) ProcessInit(p Process, args ...etf.Term) (ProcessState, er
 		}
 	}
 
-	if !a.startChildren(p, spec.Children[:]) {
+	if err := a.startChildren(p, spec.Children[:]); err != nil {
 		a.stopChildren(p.Self(), spec.Children[:], "failed")
-		return ProcessState{}, fmt.Errorf("failed")
+		return ProcessState{}, err
 	}
 
 	behavior, ok := p.Behavior().(ApplicationBehavior)
@@ -134,7 +139,7 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			if ex.From == ps.Self() {
 				childrenStopped := a.stopChildren(terminated, spec.Children, reason)
 				if !childrenStopped {
-					fmt.Printf("Warining: application can't be stopped. Some of the children are still running")
+					lib.LogWithLevel(lib.LogLevelWarning, "[%s] APPLICATION %s can't be stopped. Some of the children are still running", ps.NodeName(), ps.Name())
 					continue
 				}
 				return ex.Reason
@@ -183,6 +188,7 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			}
 
 		case direct := <-chs.Direct:
+			ps.CountReduction()
 			switch direct.Message.(type) {
 			case MessageDirectChildren:
 				pids := []etf.Pid{}
@@ -213,7 +219,8 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			go ps.Exit("normal")
 
 		case <-chs.Mailbox:
-			// do nothing
+			// ignored
+			ps.CountReduction()
 		}
 
 	}
@@ -251,15 +258,15 @@ func (a *Application) stopChildren(from etf.Pid, children []ApplicationChildSpec
 	return childrenStopped
 }
 
-func (a *Application) startChildren(parent Process, children []ApplicationChildSpec) bool {
+func (a *Application) startChildren(parent Process, children []ApplicationChildSpec) error {
 	for i := range children {
 		// i know, it looks weird to use the funcion from supervisor file.
 		// will move it to somewhere else, but let it be there for a while.
-		p := startChild(parent, children[i].Name, children[i].Child, children[i].Args...)
-		if p == nil {
-			return false
+		p, err := spawnChild(parent, children[i].Name, children[i].Child, children[i].Args...)
+		if err != nil {
+			return childError(children[i].Name, children[i].Child, err)
 		}
 		children[i].process = p
 	}
-	return true
+	return nil
 }
@@ -0,0 +1,292 @@
+package gen
+
+import (
+	"fmt"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/lib"
+)
+
+var (
+	ErrEventHandlerExist   = fmt.Errorf("Event handler is already added")
+	ErrEventHandlerUnknown = fmt.Errorf("Unknown event handler")
+)
+
+// EventBehavior interface for the event manager (in fashion of Erlang's gen_event)
+type EventBehavior interface {
+	//
+	// Mandatory callbacks
+	//
+
+	// InitEvent
+	InitEvent(process *EventProcess, args ...etf.Term) error
+
+	//
+	// Optional callbacks
+	//
+
+	// HandleEventCall this callback is invoked on ServerProcess.Call.
+	HandleEventCall(process *EventProcess, from ServerFrom, message etf.Term) (etf.Term, ServerStatus)
+	// HandleEventDirect this callback is invoked on Process.Direct.
+	HandleEventDirect(process *EventProcess, message interface{}) (interface{}, error)
+	// HandleEventCast this callback is invoked on ServerProcess.Cast.
+	HandleEventCast(process *EventProcess, message etf.Term) ServerStatus
+	// HandleEventInfo this callback is invoked on Process.Send.
+	HandleEventInfo(process *EventProcess, message etf.Term) ServerStatus
+}
+
+// EventHandler handles the events notified to the event manager
+type EventHandler interface {
+	// HandleEvent is invoked on the event manager process for every notified event.
+	// Returning non-nil status (EventHandlerStatusRemove) removes this handler from
+	// the event manager.
+	HandleEvent(process *EventProcess, event etf.Term) EventHandlerStatus
+}
+
+// EventHandlerStatus
+type EventHandlerStatus error
+
+var (
+	EventHandlerStatusOK     EventHandlerStatus = nil
+	EventHandlerStatusRemove EventHandlerStatus = fmt.Errorf("remove")
+)
+
+// Event is implementation of EventBehavior. Events can be notified asynchronously
+// by sending the message {notify, Event} (Notify) or synchronously (SyncNotify, or
+// making a Call with the request {sync_notify, Event}).
+type Event struct {
+	Server
+}
+
+// EventProcess
+type EventProcess struct {
+	ServerProcess
+
+	// handlers are invoked in order they were added
+	handlers []eventHandlerItem
+	behavior EventBehavior
+}
+
+type eventHandlerItem struct {
+	name    string
+	handler EventHandler
+}
+
+type eventAddHandler struct {
+	name    string
+	handler EventHandler
+}
+
+type eventRemoveHandler struct {
+	name string
+}
+
+type eventHandlers struct{}
+
+type eventSyncNotify struct {
+	event etf.Term
+}
+
+// Event API
+
+// AddHandler adds the handler with the given name to the event manager
+func (e *Event) AddHandler(p Process, name string, handler EventHandler) error {
+	message := eventAddHandler{
+		name:    name,
+		handler: handler,
+	}
+	_, err := p.Direct(message)
+	return err
+}
+
+// RemoveHandler removes the handler with the given name from the event manager
+func (e *Event) RemoveHandler(p Process, name string) error {
+	message := eventRemoveHandler{
+		name: name,
+	}
+	_, err := p.Direct(message)
+	return err
+}
+
+// Handlers returns the names of the added handlers
+func (e *Event) Handlers(p Process) ([]string, error) {
+	handlers, err := p.Direct(eventHandlers{})
+	if err != nil {
+		return nil, err
+	}
+	return handlers.([]string), nil
+}
+
+// Notify sends the event to the event manager and returns immediately
+func (e *Event) Notify(p Process, event etf.Term) error {
+	return p.Send(p.Self(), etf.Tuple{etf.Atom("notify"), event})
+}
+
+// SyncNotify sends the event to the event manager and waits until all the handlers
+// have handled it
+func (e *Event) SyncNotify(p Process, event etf.Term) error {
+	message := eventSyncNotify{
+		event: event,
+	}
+	_, err := p.Direct(message)
+	return err
+}
+
+//
+// EventProcess methods
+//
+
+// AddHandler adds the handler. Intended to be used within the callbacks
+func (p *EventProcess) AddHandler(name string, handler EventHandler) error {
+	for i := range p.handlers {
+		if p.handlers[i].name == name {
+			return ErrEventHandlerExist
+		}
+	}
+	item := eventHandlerItem{
+		name:    name,
+		handler: handler,
+	}
+	p.handlers = append(p.handlers, item)
+	return nil
+}
+
+// RemoveHandler removes the handler. Intended to be used within the callbacks
+func (p *EventProcess) RemoveHandler(name string) error {
+	for i := range p.handlers {
+		if p.handlers[i].name == name {
+			p.handlers = append(p.handlers[:i], p.handlers[i+1:]...)
+			return nil
+		}
+	}
+	return ErrEventHandlerUnknown
+}
+
+// Handlers returns the names of the added handlers
+func (p *EventProcess) Handlers() []string {
+	names := make([]string, len(p.handlers))
+	for i := range p.handlers {
+		names[i] = p.handlers[i].name
+	}
+	return names
+}
+
+func (p *EventProcess) notify(event etf.Term) {
+	handlers := make([]eventHandlerItem, len(p.handlers))
+	copy(handlers, p.handlers)
+	// the handler might add or remove handlers, so iterate over the copy
+	for _, item := range handlers {
+		if status := item.handler.HandleEvent(p, event); status != EventHandlerStatusOK {
+			lib.Log("[%s] EVENT %s removing handler %q: %s", p.NodeName(), p.Self(), item.name, status)
+			p.RemoveHandler(item.name)
+		}
+	}
+}
+
+//
+// gen.Server callbacks
+//
+
+// Init
+func (e *Event) Init(process *ServerProcess, args ...etf.Term) error {
+	eventProcess := &EventProcess{
+		ServerProcess: *process,
+	}
+	// do not inherit parent State
+	eventProcess.State = nil
+
+	behavior, ok := process.Behavior().(EventBehavior)
+	if !ok {
+		return fmt.Errorf("Event: not an EventBehavior")
+	}
+	eventProcess.behavior = behavior
+
+	if err := behavior.InitEvent(eventProcess, args...); err != nil {
+		return err
+	}
+
+	process.State = eventProcess
+	return nil
+}
+
+// HandleCall
+func (e *Event) HandleCall(process *ServerProcess, from ServerFrom, message etf.Term) (etf.Term, ServerStatus) {
+	eventProcess := process.State.(*EventProcess)
+	if m, ok := message.(etf.Tuple); ok && len(m) == 2 && m[0] == etf.Atom("sync_notify") {
+		eventProcess.notify(m[1])
+		return etf.Atom("ok"), ServerStatusOK
+	}
+	return eventProcess.behavior.HandleEventCall(eventProcess, from, message)
+}
+
+// HandleDirect
+func (e *Event) HandleDirect(process *ServerProcess, message interface{}) (interface{}, error) {
+	eventProcess := process.State.(*EventProcess)
+	switch m := message.(type) {
+	case eventAddHandler:
+		return nil, eventProcess.AddHandler(m.name, m.handler)
+
+	case eventRemoveHandler:
+		return nil, eventProcess.RemoveHandler(m.name)
+
+	case eventHandlers:
+		return eventProcess.Handlers(), nil
+
+	case eventSyncNotify:
+		eventProcess.notify(m.event)
+		return nil, nil
+
+	default:
+		return eventProcess.behavior.HandleEventDirect(eventProcess, message)
+	}
+}
+
+// HandleCast
+func (e *Event) HandleCast(process *ServerProcess, message etf.Term) ServerStatus {
+	eventProcess := process.State.(*EventProcess)
+	return eventProcess.behavior.HandleEventCast(eventProcess, message)
+}
+
+// HandleInfo
+func (e *Event) HandleInfo(process *ServerProcess, message etf.Term) ServerStatus {
+	eventProcess := process.State.(*EventProcess)
+	if m, ok := message.(etf.Tuple); ok && len(m) == 2 && m[0] == etf.Atom("notify") {
+		eventProcess.notify(m[1])
+		return ServerStatusOK
+	}
+	return eventProcess.behavior.HandleEventInfo(eventProcess, message)
+}
+
+// default callbacks
+
+// InitEvent
+func (e *Event) InitEvent(process *EventProcess, args ...etf.Term) error {
+	return nil
+}
+
+// HandleEventCall
+func (e *Event) HandleEventCall(process *EventProcess, from ServerFrom, message etf.Term) (etf.Term, ServerStatus) {
+	// default callback if it wasn't implemented
+	fmt.Printf("HandleEventCall: unhandled message (from %#v) %#v\n", from, message)
+	return etf.Atom("ok"), ServerStatusOK
+}
+
+// HandleEventDirect
+func (e *Event) HandleEventDirect(process *EventProcess, message interface{}) (interface{}, error) {
+	// default callback if it wasn't implemented
+	return nil, ErrUnsupportedRequest
+}
+
+// HandleEventCast
+func (e *Event) HandleEventCast(process *EventProcess, message etf.Term) ServerStatus {
+	// default callback if it wasn't implemented
+	fmt.Printf("HandleEventCast: unhandled message %#v\n", message)
+	return ServerStatusOK
+}
+
+// HandleEventInfo
+func (e *Event) HandleEventInfo(process *EventProcess, message etf.Term) ServerStatus {
+	// default callback if it wasn't implemented
+	fmt.Printf("HandleEventInfo: unhandled message %#v\n", message)
+	return ServerStatusOK
+}
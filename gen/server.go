@@ -69,13 +69,14 @@ type ServerProcess struct {
 	ProcessState
 
 	behavior        ServerBehavior
-	reductions      uint64 // total number of processed messages from mailBox
 	currentFunction string
 	trapExit        bool
 
 	mailbox  <-chan ProcessMailboxMessage
 	original <-chan ProcessMailboxMessage
 	deferred chan ProcessMailboxMessage
+	// deadline of the message being handled (see ProcessMailboxMessage.Deadline)
+	deadline time.Time
 
 	waitReply         *etf.Ref
 	callbackWaitReply chan *etf.Ref
@@ -250,6 +251,8 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 		select {
 		case ex := <-channels.GracefulExit:
 			if !gsp.TrapExit() {
+				// terminate with the error of the linked process
+				gsp.SetExitError(ex.Err)
 				gsp.behavior.Terminate(gsp, ex.Reason)
 				return ex.Reason
 			}
@@ -261,6 +264,7 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			message = MessageExit{
 				Pid:    ex.From,
 				Reason: ex.Reason,
+				Err:    ex.Err,
 			}
 			// We can't write this message to the mailbox directly so use
 			// the common way to send it to itself
@@ -272,22 +276,33 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			return reason
 
 		case msg := <-gsp.mailbox:
+			if gsp.mailbox == gsp.original {
+				// the deferred messages have been acked already
+				gsp.AckPersisted()
+			}
 			gsp.mailbox = gsp.original
+			if msg.Deadline.IsZero() == false && time.Now().After(msg.Deadline) {
+				lib.Log("[%s] GEN_SERVER %s dropped expired message from %s", gsp.NodeName(), gsp.Self(), msg.From)
+				continue
+			}
 			fromPid = msg.From
 			message = msg.Message
+			gsp.deadline = msg.Deadline
 
 		case <-gsp.Context().Done():
 			gsp.behavior.Terminate(gsp, "kill")
 			return "kill"
 
 		case direct := <-channels.Direct:
+			gsp.deadline = time.Time{}
+			gsp.CountReduction()
 			gsp.waitCallbackOrDeferr(direct)
 			continue
 		}
 
 		lib.Log("[%s] GEN_SERVER %s got message from %s", gsp.NodeName(), gsp.Self(), fromPid)
 
-		gsp.reductions++
+		gsp.CountReduction()
 
 		switch m := message.(type) {
 		case etf.Tuple:
@@ -410,14 +425,15 @@ func (gsp *ServerProcess) waitCallbackOrDeferr(message interface{}) {
 	if gsp.waitReply != nil {
 		// already waiting for reply. deferr this message
 		deferred := ProcessMailboxMessage{
-			Message: message,
+			Message:  message,
+			Deadline: gsp.deadline,
 		}
 		select {
 		case gsp.deferred <- deferred:
 			// do nothing
 		default:
-			fmt.Printf("WARNING! deferred mailbox of %s[%q] is full. dropped message %v",
-				gsp.Self(), gsp.Name(), message)
+			lib.LogWithLevel(lib.LogLevelWarning, "[%s] GEN_SERVER deferred mailbox of %s[%q] is full. dropped message %v",
+				gsp.NodeName(), gsp.Self(), gsp.Name(), message)
 		}
 		return
 
@@ -468,6 +484,9 @@ func (gsp *ServerProcess) panicHandler() {
 		pc, fn, line, _ := runtime.Caller(2)
 		fmt.Printf("Warning: Server terminated %s[%q]. Panic reason: %#v at %s[%s:%d]\n",
 			gsp.Self(), gsp.Name(), r, runtime.FuncForPC(pc).Name(), fn, line)
+		if gsp.PanicPolicy(r) == PanicPolicyCrashNode {
+			panic(r)
+		}
 		gsp.stop <- "panic"
 	}
 }
@@ -509,6 +528,7 @@ func (gsp *ServerProcess) handleCall(m handleCallMessage) {
 		gsp.stop <- "normal"
 
 	default:
+		gsp.SetExitError(status)
 		gsp.stop <- status.Error()
 	}
 }
@@ -529,6 +549,7 @@ func (gsp *ServerProcess) handleCast(m handleCastMessage) {
 	case ServerStatusStop:
 		gsp.stop <- "normal"
 	default:
+		gsp.SetExitError(status)
 		gsp.stop <- status.Error()
 	}
 }
@@ -548,6 +569,7 @@ func (gsp *ServerProcess) handleInfo(m handleInfoMessage) {
 	case ServerStatusStop:
 		gsp.stop <- "normal"
 	default:
+		gsp.SetExitError(status)
 		gsp.stop <- status.Error()
 	}
 }
@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
-	//"github.com/ergo-services/ergo/lib"
+	"github.com/ergo-services/ergo/lib"
 )
 
 type StageCancelMode uint
@@ -629,7 +629,7 @@ func handleConsumer(process *StageProcess, subscription StageSubscription, cmd s
 
 		subInternal, ok := process.producers[subscription.ID]
 		if !ok {
-			fmt.Printf("Warning! got %d events for unknown subscription %#v\n", numEvents, subscription)
+			lib.LogWithLevel(lib.LogLevelWarning, "[%s] STAGE %s got %d events for unknown subscription %#v", process.NodeName(), process.Self(), numEvents, subscription)
 			return etf.Atom("ok"), nil
 		}
 		subInternal.count--
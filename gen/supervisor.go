@@ -20,6 +20,12 @@ type SupervisorStrategy struct {
 	Intensity uint16
 	Period    uint16
 	Restart   SupervisorStrategyRestart
+
+	// BackoffBase the first delay before restarting the child process
+	// if Restart is SupervisorStrategyRestartBackoff. Default 1 second.
+	BackoffBase time.Duration
+	// BackoffCap limits the delay before restarting. Default 30 seconds.
+	BackoffCap time.Duration
 }
 
 // SupervisorStrategyType
@@ -37,6 +43,12 @@ const (
 	// SupervisorRestartPeriod
 	SupervisorRestartPeriod = uint16(10)
 
+	// SupervisorBackoffBase
+	SupervisorBackoffBase = time.Second
+
+	// SupervisorBackoffCap
+	SupervisorBackoffCap = 30 * time.Second
+
 	// SupervisorStrategyOneForOne If one child process terminates and is to be restarted, only
 	// that child process is affected. This is the default restart strategy.
 	SupervisorStrategyOneForOne = SupervisorStrategyType("one_for_one")
@@ -73,8 +85,15 @@ const (
 	// than normal, shutdown.
 	SupervisorStrategyRestartTransient = SupervisorStrategyRestart("transient")
 
+	// SupervisorStrategyRestartBackoff child process is always restarted (like permanent)
+	// but with exponentially growing delay between the restarts (BackoffBase, 2*BackoffBase,
+	// 4*BackoffBase ... up to BackoffCap). The delay is reset if the child process
+	// has been running longer than BackoffCap.
+	SupervisorStrategyRestartBackoff = SupervisorStrategyRestart("backoff")
+
 	supervisorChildStateStart    = 0
 	supervisorChildStateRunning  = 1
+	supervisorChildStateBackoff  = 2
 	supervisorChildStateDisabled = -1
 )
 
@@ -86,6 +105,7 @@ type SupervisorSpec struct {
 	Children []SupervisorChildSpec
 	Strategy SupervisorStrategy
 	restarts []int64
+	backoffs uint64
 }
 
 // SupervisorChildSpec
@@ -97,6 +117,10 @@ type SupervisorChildSpec struct {
 	Args    []etf.Term
 	state   supervisorChildState // for internal usage
 	process Process
+
+	started   time.Time
+	backoff   time.Duration
+	backoffID uint64
 }
 
 // Supervisor is implementation of ProcessBehavior interface
@@ -107,6 +131,10 @@ type messageStartChild struct {
 	args []etf.Term
 }
 
+type messageRestartChild struct {
+	id uint64
+}
+
 // ProcessInit
 func (sv *Supervisor) ProcessInit(p Process, args ...etf.Term) (ProcessState, error) {
 	behavior, ok := p.Behavior().(SupervisorBehavior)
@@ -130,7 +158,16 @@ func (sv *Supervisor) ProcessInit(p Process, args ...etf.Term) (ProcessState, er
 func (sv *Supervisor) ProcessLoop(ps ProcessState, started chan<- bool) string {
 	spec := ps.State.(*SupervisorSpec)
 	if spec.Strategy.Type != SupervisorStrategySimpleOneForOne {
-		startChildren(ps, spec)
+		if err := startChildren(ps, spec); err != nil {
+			// the process spawning this supervisor gets this error
+			for i := range spec.Children {
+				if p := spec.Children[i].process; p != nil {
+					p.Exit(err.Error())
+				}
+			}
+			ps.SetExitError(err)
+			return err.Error()
+		}
 	}
 
 	waitTerminatingProcesses := []etf.Pid{}
@@ -156,6 +193,7 @@ func (sv *Supervisor) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			return "kill"
 
 		case direct := <-chs.Direct:
+			ps.CountReduction()
 			value, err := handleDirect(ps, spec, direct.Message)
 			if err != nil {
 				direct.Message = nil
@@ -167,8 +205,11 @@ func (sv *Supervisor) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			direct.Err = nil
 			direct.Reply <- direct
 
-		case <-chs.Mailbox:
-			// do nothing
+		case m := <-chs.Mailbox:
+			ps.CountReduction()
+			if restart, ok := m.Message.(messageRestartChild); ok && m.From == ps.Self() {
+				restartChild(ps, spec, restart.id)
+			}
 		}
 	}
 }
@@ -190,15 +231,15 @@ func (sv *Supervisor) StartChild(supervisor Process, name string, args ...etf.Te
 	return process, nil
 }
 
-func startChildren(supervisor Process, spec *SupervisorSpec) {
+func startChildren(supervisor Process, spec *SupervisorSpec) error {
 	spec.restarts = append(spec.restarts, time.Now().Unix())
 	if len(spec.restarts) > int(spec.Strategy.Intensity) {
 		period := time.Now().Unix() - spec.restarts[0]
 		if period <= int64(spec.Strategy.Period) {
-			fmt.Printf("ERROR: Restart intensity is exceeded (%d restarts for %d seconds)\n",
-				spec.Strategy.Intensity, spec.Strategy.Period)
+			lib.LogWithLevel(lib.LogLevelError, "[%s] SUPERVISOR %s restart intensity is exceeded (%d restarts for %d seconds)",
+				supervisor.NodeName(), supervisor.Self(), spec.Strategy.Intensity, spec.Strategy.Period)
 			supervisor.Kill()
-			return
+			return nil
 		}
 		spec.restarts = spec.restarts[1:]
 	}
@@ -207,19 +248,88 @@ func startChildren(supervisor Process, spec *SupervisorSpec) {
 		switch spec.Children[i].state {
 		case supervisorChildStateDisabled:
 			spec.Children[i].process = nil
-		case supervisorChildStateRunning:
+		case supervisorChildStateRunning, supervisorChildStateBackoff:
 			continue
 		case supervisorChildStateStart:
+			if spec.Strategy.Restart == SupervisorStrategyRestartBackoff && !spec.Children[i].started.IsZero() {
+				// it was started before. restart it with a delay
+				scheduleRestart(supervisor, spec, &spec.Children[i])
+				continue
+			}
 			spec.Children[i].state = supervisorChildStateRunning
-			process := startChild(supervisor, spec.Children[i].Name, spec.Children[i].Child, spec.Children[i].Args...)
+			process, err := spawnChild(supervisor, spec.Children[i].Name, spec.Children[i].Child, spec.Children[i].Args...)
+			if err != nil {
+				return childError(spec.Children[i].Name, spec.Children[i].Child, err)
+			}
 			spec.Children[i].process = process
+			spec.Children[i].started = time.Now()
 		default:
 			panic("Incorrect supervisorChildState")
 		}
 	}
+	return nil
+}
+
+// scheduleRestart sets the backoff state for the child and sends
+// messageRestartChild to the supervisor after the backoff delay
+func scheduleRestart(supervisor Process, spec *SupervisorSpec, child *SupervisorChildSpec) {
+	base := spec.Strategy.BackoffBase
+	if base == 0 {
+		base = SupervisorBackoffBase
+	}
+	limit := spec.Strategy.BackoffCap
+	if limit == 0 {
+		limit = SupervisorBackoffCap
+	}
+
+	// reset the delay if the child has been running long enough
+	if child.backoff == 0 || time.Since(child.started) > limit {
+		child.backoff = base
+	} else {
+		child.backoff *= 2
+	}
+	if child.backoff > limit {
+		child.backoff = limit
+	}
+
+	spec.backoffs++
+	child.state = supervisorChildStateBackoff
+	child.backoffID = spec.backoffs
+	lib.Log("Supervisor %s restarts child in %s", supervisor.Self(), child.backoff)
+	supervisor.SendAfter(supervisor.Self(), messageRestartChild{id: child.backoffID}, child.backoff)
+}
+
+func restartChild(supervisor Process, spec *SupervisorSpec, id uint64) {
+	for i := range spec.Children {
+		child := &spec.Children[i]
+		if child.state != supervisorChildStateBackoff || child.backoffID != id {
+			continue
+		}
+		child.state = supervisorChildStateRunning
+		child.process = startChild(supervisor, child.Name, child.Child, child.Args...)
+		child.started = time.Now()
+		return
+	}
 }
 
 func startChild(supervisor Process, name string, child ProcessBehavior, args ...etf.Term) Process {
+	process, err := spawnChild(supervisor, name, child, args...)
+	if err != nil {
+		panic(childError(name, child, err))
+	}
+	return process
+}
+
+// childError wraps the error of starting child with its name (or type if it has no name)
+func childError(name string, child ProcessBehavior, err error) error {
+	if name == "" {
+		name = fmt.Sprintf("%T", child)
+	}
+	return fmt.Errorf("can't start child %q: %w", name, err)
+}
+
+// spawnChild spawns the child process and links it with the supervisor
+func spawnChild(supervisor Process, name string, child ProcessBehavior, args ...etf.Term) (Process, error) {
 	opts := ProcessOptions{}
 
 	if leader := supervisor.GroupLeader(); leader != nil {
@@ -229,14 +339,13 @@ func startChild(supervisor Process, name string, child ProcessBehavior, args ...
 		opts.GroupLeader = supervisor
 	}
 	process, err := supervisor.Spawn(name, opts, child, args...)
-
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	supervisor.Link(process.Self())
 
-	return process
+	return process, nil
 }
 
 func handleDirect(supervisor Process, spec *SupervisorSpec, message interface{}) (interface{}, error) {
@@ -264,6 +373,7 @@ func handleDirect(supervisor Process, spec *SupervisorSpec, message interface{})
 		childSpec.Name = ""
 		process := startChild(supervisor, childSpec.Name, childSpec.Child, childSpec.Args...)
 		childSpec.process = process
+		childSpec.started = time.Now()
 		spec.Children = append(spec.Children, childSpec)
 		return process, nil
 
@@ -307,7 +417,9 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 		if len(wait) == 0 {
 			// it was the last one. lets restart all terminated children
 			// which hasn't supervisorChildStateDisabled state
-			startChildren(p, spec)
+			if err := startChildren(p, spec); err != nil {
+				panic(err)
+			}
 		}
 
 		return wait
@@ -336,7 +448,9 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 
 				if len(spec.Children) == i+1 && len(wait) == 0 {
 					// it was the last one. nothing to waiting for
-					startChildren(p, spec)
+					if err := startChildren(p, spec); err != nil {
+						panic(err)
+					}
 				}
 				continue
 			}
@@ -369,7 +483,9 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 
 				if len(spec.Children) == i+1 && len(wait) == 0 {
 					// it was the last one. nothing to waiting for
-					startChildren(p, spec)
+					if err := startChildren(p, spec); err != nil {
+						panic(err)
+					}
 				}
 
 				continue
@@ -401,7 +517,9 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 					spec.Children[i].state = supervisorChildStateStart
 				}
 
-				startChildren(p, spec)
+				if err := startChildren(p, spec); err != nil {
+					panic(err)
+				}
 				break
 			}
 		}
@@ -421,8 +539,15 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 					break
 				}
 
+				if spec.Strategy.Restart == SupervisorStrategyRestartBackoff {
+					spec.Children[i].process = nil
+					scheduleRestart(p, spec, &spec.Children[i])
+					break
+				}
+
 				process := startChild(p, spec.Children[i].Name, spec.Children[i].Child, spec.Children[i].Args...)
 				spec.Children[i].process = process
+				spec.Children[i].started = time.Now()
 				break
 			}
 		}
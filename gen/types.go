@@ -13,9 +13,88 @@ var (
 	ErrServerTerminated   = fmt.Errorf("Server terminated")
 )
 
+// Feature defines a feature of the distribution protocol that could be
+// enabled for the connection with the peer (see node.PeerSupports)
+type Feature string
+
+const (
+	FeatureProxy           Feature = "proxy"
+	FeatureCompression     Feature = "compression"
+	FeatureFragmentation   Feature = "fragmentation"
+	FeatureBigCreation     Feature = "big_creation"
+	FeatureBigPidRef       Feature = "big_pid_ref"
+	FeatureHeaderAtomCache Feature = "header_atom_cache"
+	FeatureStringAsBinary  Feature = "string_as_binary"
+	FeatureFlowControl     Feature = "flow_control"
+)
+
+// NodeFlags defines the features enabled on the node (see node.Flags)
+type NodeFlags struct {
+	// Compression enables compression for the outgoing messages by default
+	Compression bool
+	// CompressionDictionary the messages are compressed using the preset dictionary (zlib)
+	CompressionDictionary bool
+	// Proxy enables proxy mode
+	Proxy bool
+	// TLS at least one listener accepts TLS connections
+	TLS bool
+	// TLSStrict the certificates are validated (otherwise self-signed one is generated)
+	TLSStrict bool
+	// StartTLS at least one listener accepts both TLS and plaintext connections
+	StartTLS bool
+	// Fragmentation, BigCreation, BigPidRef, HeaderAtomCache are the defaults
+	// for the connections. The peer might not support them (see node.PeerSupports)
+	Fragmentation   bool
+	BigCreation     bool
+	BigPidRef       bool
+	HeaderAtomCache bool
+	// StringAsBinary encodes Go strings as binaries for all connections
+	StringAsBinary bool
+	// FlowControl enables backpressure for the remote senders
+	FlowControl bool
+	// StaticRoutesOnly disables the resolving service
+	StaticRoutesOnly bool
+	// Cloud enables Ergo Cloud support
+	Cloud bool
+}
+
+// NodeDeltaType defines the kind of the node state change (see NodeDelta)
+type NodeDeltaType string
+
+const (
+	NodeDeltaProcessSpawned    NodeDeltaType = "process_spawned"
+	NodeDeltaProcessTerminated NodeDeltaType = "process_terminated"
+	NodeDeltaNameRegistered    NodeDeltaType = "name_registered"
+	NodeDeltaNameUnregistered  NodeDeltaType = "name_unregistered"
+)
+
+// NodeDelta describes an incremental change of the node state delivered by node.Observe
+type NodeDelta struct {
+	Type NodeDeltaType
+	Pid  etf.Pid
+	// Name is set for NodeDeltaNameRegistered and NodeDeltaNameUnregistered
+	Name string
+}
+
 // EnvKey
 type EnvKey string
 
+// PanicPolicy defines the way of handling the panic happened in the process
+type PanicPolicy int
+
+const (
+	// PanicPolicyIsolate recovers the panic and terminates the process with reason "panic"
+	PanicPolicyIsolate PanicPolicy = 0
+	// PanicPolicyCrashNode propagates the panic crashing the whole node (fail-fast)
+	PanicPolicyCrashNode PanicPolicy = 1
+	// PanicPolicyCallback invokes the PanicHandler to decide what to do
+	PanicPolicyCallback PanicPolicy = 2
+)
+
+// PanicHandler decides how to handle the panic of the process with the given pid
+// and name. Must return PanicPolicyIsolate or PanicPolicyCrashNode.
+type PanicHandler func(pid etf.Pid, name string, reason interface{}) PanicPolicy
+
 // Process
 type Process interface {
 	Core
@@ -25,6 +104,9 @@ type Process interface {
 
 	// RemoteSpawn creates a new process at a remote node. The object name is a regitered behavior on a remote name using RegisterBehavior(...). Init callback of the started remote process will receive gen.RemoteSpawnRequest as an argument.
 	RemoteSpawn(node string, object string, opts RemoteSpawnOptions, args ...etf.Term) (etf.Pid, error)
+	// RemoteSpawnWithContext makes the remote spawn request that can be canceled with the given
+	// context. The process spawned after canceling is terminated with the reason "abandoned".
+	RemoteSpawnWithContext(ctx context.Context, node string, object string, opts RemoteSpawnOptions, args ...etf.Term) (etf.Pid, error)
 	// Name returns process name used on starting.
 	Name() string
 
@@ -40,6 +122,10 @@ type Process interface {
 	// NodeStop stops the node
 	NodeStop()
 
+	// NodeStopReason returns the reason the node is stopping with (see node.StopWithReason).
+	// Returns empty string if the node is running or has been stopped with no reason.
+	NodeStopReason() string
+
 	// NodeUptime returns node lifespan
 	NodeUptime() int64
 
@@ -57,9 +143,21 @@ type Process interface {
 	DirectWithTimeout(request interface{}, timeout int) (interface{}, error)
 
 	// Send sends a message in fashion of 'erlang:send'. The value of 'to' can be a Pid, registered local name
-	// or gen.ProcessID{RegisteredName, NodeName}
+	// or gen.ProcessID{RegisteredName, NodeName}. Sending to itself never blocks: the message is put
+	// into its own mailbox, or dropped with node.ErrProcessMailboxFull if the mailbox is full
+	// (ProcessOptions.OnMailboxFull is invoked on the process' goroutine in this case).
+	// The message is delivered to the local process as is, without copying (large binaries
+	// are shared by all the local recipients), so it must not be modified after sending.
+	// It's encoded only if it's sent to the remote process.
 	Send(to interface{}, message etf.Term) error
 
+	// SendWithReceipt sends a message to the given Pid and returns a reference. The sender
+	// receives MessageDeliveryReceipt with this reference once the message was put into the
+	// mailbox of the local process, or written to the connection with the remote node
+	// (the distribution protocol has no acknowledgement of the delivered messages). It
+	// confirms the message was queued, not processed.
+	SendWithReceipt(to etf.Pid, message etf.Term) (etf.Ref, error)
+
 	// SendAfter starts a timer. When the timer expires, the message sends to the process
 	// identified by 'to'.  'to' can be a Pid, registered local name or
 	// gen.ProcessID{RegisteredName, NodeName}. Returns cancel function in order to discard
@@ -89,6 +187,15 @@ type Process interface {
 	// Env returns value associated with given environment name.
 	Env(name EnvKey) interface{}
 
+	// PanicPolicy returns the panic policy of the node to apply to the panic recovered
+	// in this process. PanicPolicyCallback is resolved by invoking the PanicHandler,
+	// so the returned value is either PanicPolicyIsolate or PanicPolicyCrashNode.
+	PanicPolicy(reason interface{}) PanicPolicy
+
+	// Flush waits until the mailbox of the process is empty or the given timeout
+	// is exceeded. Returns the number of messages left in the mailbox.
+	Flush(timeout time.Duration) int
+
 	// Wait waits until process stopped
 	Wait()
 
@@ -107,6 +214,15 @@ type Process interface {
 	// the process referred to by Pid.
 	Unlink(with etf.Pid)
 
+	// StickyLink creates a link with the local process registered with the given name.
+	// Unlike Link, it keeps relinking every time this name is registered again
+	// (e.g. the process has been restarted by its supervisor). Makes sense for
+	// the processes that trap exits (see Process.SetTrapExit).
+	StickyLink(name string) error
+
+	// StickyUnlink removes the sticky link made by Process.StickyLink
+	StickyUnlink(name string)
+
 	// IsAlive returns whether the process is alive
 	IsAlive() bool
 
@@ -118,12 +234,27 @@ type Process interface {
 	// TrapExit returns whether the trap was enabled on this process
 	TrapExit() bool
 
+	// SetExitError keeps the error this process is going to terminate with (the reason is
+	// err.Error()). The local monitors and links get it in MessageDown.Err and MessageExit.Err,
+	// so they can use errors.Is/errors.As. The remote ones get the reason string only.
+	// Server does it on returning the custom ServerStatus.
+	SetExitError(err error)
+
 	// SetCompression enables/disables compression for the messages sent outside this node
 	SetCompression(enabled bool)
 
 	// Compression returns true if compression is enabled for this process
 	Compression() bool
 
+	// RawMessages returns true if the messages received from the remote nodes are
+	// delivered to this process as MessageRaw (see ProcessOptions.RawMessages)
+	RawMessages() bool
+
+	// SendRaw sends the pre-encoded message (etf.Encode with disabled atom cache) to
+	// the given Pid. It makes no sense to encode the message for the local process, so
+	// it's intended to forward the Data of MessageRaw.
+	SendRaw(to etf.Pid, encoded []byte) error
+
 	// MonitorNode creates monitor between the current process and node. If Node fails or does not exist,
 	// the message {nodedown, Node} is delivered to the process.
 	MonitorNode(name string) etf.Ref
@@ -153,6 +284,10 @@ type Process interface {
 	// Children returns list of children pid (Application, Supervisor)
 	Children() ([]etf.Pid, error)
 
+	// PendingReplies returns the number of sync requests waiting for the reply.
+	// A growing number points to the sync requests that never get answered.
+	PendingReplies() int
+
 	// Links returns list of the process pids this process has linked to.
 	Links() []etf.Pid
 	// Monitors returns list of monitors created this process by pid.
@@ -170,6 +305,13 @@ type Process interface {
 	SendSyncRequest(ref etf.Ref, to interface{}, message etf.Term) error
 	WaitSyncReply(ref etf.Ref, timeout int) (etf.Term, error)
 	ProcessChannels() ProcessChannels
+	// CountReduction increments the reductions counter (see ProcessInfo.Reductions).
+	// It's invoked by the behavior on handling every message or direct request.
+	CountReduction()
+	// AckPersisted trims the message taken from the mailbox from the MailboxPersister
+	// (if it's defined). It's invoked by the behavior right before handling it, so the
+	// message the process crashed on is not replayed on restart.
+	AckPersisted()
 }
 
 // ProcessInfo struct with process details
@@ -179,6 +321,7 @@ type ProcessInfo struct {
 	CurrentFunction string
 	Status          string
 	MessageQueueLen int
+	PendingReplies  int
 	Links           []etf.Pid
 	Monitors        []etf.Pid
 	MonitorsByName  []ProcessID
@@ -187,8 +330,40 @@ type ProcessInfo struct {
 	Dictionary      etf.Map
 	TrapExit        bool
 	GroupLeader     etf.Pid
-	Reductions      uint64
-	Compression     bool
+	// Reductions approximates the work done by the process. Unlike Erlang, where
+	// it's based on the number of executed instructions, it's the number of the
+	// handled messages and direct requests.
+	Reductions  uint64
+	Compression bool
+	Priority    ProcessPriority
+}
+
+// MonitorInfo
+type MonitorInfo struct {
+	Ref       etf.Ref
+	Pid       etf.Pid   // if monitor was created by pid
+	ProcessID ProcessID // if monitor was created by name
+	Node      string    // node the monitored process belongs to
+	IsRemote  bool
+}
+
+// MonitorRecord describes the monitor created by the process By. The target is defined
+// by Pid, ProcessID or the Node only (if the node is monitored).
+type MonitorRecord struct {
+	Ref       etf.Ref
+	By        etf.Pid
+	Pid       etf.Pid
+	ProcessID ProcessID
+	Node      string // node the target belongs to
+	IsRemote  bool
+}
+
+// LinkRecord describes the link between two processes. IsRemote is true if one
+// of them belongs to the remote node.
+type LinkRecord struct {
+	A        etf.Pid
+	B        etf.Pid
+	IsRemote bool
 }
 
 // ProcessOptions
@@ -198,12 +373,68 @@ type ProcessOptions struct {
 	Context context.Context
 	// MailboxSize defines the length of message queue for the process
 	MailboxSize uint16
+	// DirectboxSize defines the length of the queue for the direct requests (see
+	// Process.Direct). The caller waits for the free slot if the queue is full and gets
+	// ErrProcessBusy on the timeout. The reply is always awaited synchronously.
+	// Default is node.DefaultProcessDirectboxSize
+	DirectboxSize uint16
 	// GroupLeader
 	GroupLeader Process
 	// Env set the process environment variables
 	Env map[EnvKey]interface{}
 	// Compression enables compression for the messages sent outside this node
 	Compression bool
+	// OnMailboxFull is invoked if the message is dropped due to the full mailbox.
+	// It runs on the sender's goroutine, so it must not block.
+	OnMailboxFull func(from etf.Pid, message etf.Term)
+	// DedicatedThread locks the goroutine of the process loop to an OS thread
+	// (see runtime.LockOSThread) reducing the scheduling jitter for the latency
+	// sensitive processes. Each such process ties up an OS thread for its lifespan,
+	// so it should be used for a few processes only.
+	DedicatedThread bool
+	// MailboxPersister keeps the messages put into the mailbox in order to replay them
+	// on starting the process again (e.g. after the node crash). Default is nil (no persistence).
+	MailboxPersister MailboxPersister
+	// Priority is a best-effort approximation of the Erlang process priority levels.
+	// There is no control over the Go scheduler, so it only affects the default
+	// mailbox size and the delivery of the messages sent by this process to the
+	// full mailbox (the sender waits a bit instead of dropping the message).
+	// Default is ProcessPriorityNormal.
+	Priority ProcessPriority
+	// RawMessages makes the messages received from the remote nodes be delivered as
+	// MessageRaw with the encoded payload, which is never decoded by the node. Intended
+	// for the proxies and relays forwarding the messages elsewhere (see Process.SendRaw).
+	RawMessages bool
+}
+
+// ProcessPriority
+type ProcessPriority int
+
+const (
+	ProcessPriorityLow    ProcessPriority = -1
+	ProcessPriorityNormal ProcessPriority = 0
+	ProcessPriorityHigh   ProcessPriority = 1
+	ProcessPriorityMax    ProcessPriority = 2
+)
+
+// MailboxPersister defines the storage of the mailbox messages. The messages are persisted
+// in the order of delivering them to the mailbox and trimmed once the process takes them.
+// The messages taken but not handled yet (e.g. due to the node crash) are replayed, so the
+// delivery is at-least-once and the process must tolerate the duplicates. The storage must
+// be bounded by the implementation (e.g. keep the last N messages), only the last
+// MailboxSize messages are replayed. The methods are invoked concurrently.
+type MailboxPersister interface {
+	// Append is invoked right before putting the message into the mailbox. It runs on
+	// the sender's goroutine, so it must not block.
+	Append(message ProcessMailboxMessage) error
+	// Replay returns the persisted messages. It's invoked on spawning the process, the
+	// returned messages are put into the mailbox before any other message. The messages
+	// must be kept in the storage until they are trimmed by Ack.
+	Replay() []ProcessMailboxMessage
+	// Ack drops the given number of the oldest persisted messages. It's invoked once
+	// the process takes the message from the mailbox (see Process.AckPersisted) and
+	// for the persisted messages exceeding MailboxSize on replay.
+	Ack(n int)
 }
 
 // RemoteSpawnOptions defines options for RemoteSpawn method
@@ -220,6 +451,9 @@ type RemoteSpawnOptions struct {
 	Timeout int
 }
 
+// EnvKeyRemoteSpawn keeps RemoteSpawnRequest in the environment of the process spawned by request
+const EnvKeyRemoteSpawn EnvKey = "ergo:RemoteSpawnRequest"
+
 // RemoteSpawnRequest stores in process environment ("ergo:RemoteSpawnRequest") if it was spawned by RemoteSpawn request
 type RemoteSpawnRequest struct {
 	// Name register name
@@ -230,6 +464,8 @@ type RemoteSpawnRequest struct {
 	Ref etf.Ref
 	// Function provided via RemoteSpawnOptions.Function
 	Function string
+	// Args the arguments of the spawning process
+	Args []etf.Term
 }
 
 // ProcessChannels
@@ -243,6 +479,9 @@ type ProcessChannels struct {
 type ProcessMailboxMessage struct {
 	From    etf.Pid
 	Message interface{}
+	// Deadline is set for the message sent with TTL. Zero value means no deadline.
+	// The expired messages are dropped by Server, the other behaviors must check it.
+	Deadline time.Time
 }
 
 // ProcessDirectMessage
@@ -256,6 +495,7 @@ type ProcessDirectMessage struct {
 type ProcessGracefulExitRequest struct {
 	From   etf.Pid
 	Reason string
+	Err    error // the error of the terminated linked process (if it's local)
 }
 
 // ProcessState
@@ -277,6 +517,15 @@ type Core interface {
 	// Returns nil if it doesn't exist (not found) or terminated.
 	ProcessByName(name string) Process
 
+	// ProcessByNameScoped returns Process for the given name registered within the scope
+	// of the application (see node.RegisterNameScoped). Returns nil if it doesn't exist
+	// (not found) or terminated.
+	ProcessByNameScoped(app string, name string) Process
+
+	// WhereIs returns the pid of the process registered with the given name and
+	// true if such name is registered.
+	WhereIs(name string) (etf.Pid, bool)
+
 	// ProcessByPid returns Process for the given Pid.
 	// Returns nil if it doesn't exist (not found) or terminated.
 	ProcessByPid(pid etf.Pid) Process
@@ -288,6 +537,11 @@ type Core interface {
 	// ProcessInfo returns the details about given Pid
 	ProcessInfo(pid etf.Pid) (ProcessInfo, error)
 
+	// ProcessInfoAll returns the details about all the running processes. It's captured
+	// in a single pass taking every lock once, so it's cheaper and more coherent than
+	// calling ProcessInfo for every process.
+	ProcessInfoAll() []ProcessInfo
+
 	// ProcessList returns the list of running processes
 	ProcessList() []Process
 
@@ -318,6 +572,16 @@ type RegisteredBehavior struct {
 	Data     interface{}
 }
 
+// RegistrySnapshot is the snapshot of the node registry (see Node.ExportRegistry)
+type RegistrySnapshot struct {
+	// Names the registered names of the processes
+	Names map[string]etf.Pid
+	// Aliases the aliases of the processes with their owners
+	Aliases map[etf.Alias]etf.Pid
+	// Behaviors the registered behaviors by group
+	Behaviors map[string]map[string]RegisteredBehavior
+}
+
 // ProcessID long notation of registered process {process_name, node_name}
 type ProcessID struct {
 	Name string
@@ -340,6 +604,52 @@ type MessageDown struct {
 	ProcessID ProcessID // if monitor was created by name
 	Pid       etf.Pid
 	Reason    string
+	Err       error // the error the local process terminated with (see Process.SetExitError)
+}
+
+// MessageDeliveryReceipt delivers as a message to Server's HandleInfo callback of the process
+// that sent a message using SendWithReceipt. Queued is true if the message was put into the
+// mailbox of the local process or written to the connection with the remote node. It's false
+// if the connection was lost before the message was written, so the message might be lost.
+type MessageDeliveryReceipt struct {
+	Ref    etf.Ref
+	To     etf.Pid
+	Queued bool
+}
+
+// MessageGroupLeader delivers as a message to Server's HandleInfo callback of the process
+// subscribed to the group (see node.SubscribeGroup) on changing the leader of the group.
+// Leader is empty if the group has no members left.
+type MessageGroupLeader struct {
+	Group    string
+	Leader   etf.Pid
+	Previous etf.Pid
+}
+
+// MessageClusterReady delivers as a message to Server's HandleInfo callback of the process
+// subscribed to the cluster (see node.SubscribeCluster) on changing its readiness.
+// Connected is the list of the cluster nodes connected at this moment.
+type MessageClusterReady struct {
+	Ready     bool
+	Connected []string
+}
+
+// MessageTap delivers as a message to Server's HandleInfo callback of the collector
+// (see node.TapProcess). It keeps a copy of the message received by the tapped process.
+type MessageTap struct {
+	Ref     etf.Ref
+	Pid     etf.Pid // the tapped process
+	From    etf.Pid
+	Message etf.Term
+}
+
+// MessageRaw delivers as a message to Server's HandleInfo callback of the process started
+// with ProcessOptions.RawMessages on receiving a message from the remote node. Data is the
+// message encoded with disabled atom cache. From is empty if the peer didn't provide
+// the sender.
+type MessageRaw struct {
+	From etf.Pid
+	Data []byte
 }
 
 // MessageNodeDown delivers as a message to Server's HandleInfo callback of the process
@@ -352,6 +662,7 @@ type MessageNodeDown struct {
 type MessageExit struct {
 	Pid    etf.Pid
 	Reason string
+	Err    error // the error the local process terminated with (see Process.SetExitError)
 }
 
 // RPC defines rpc function type
@@ -370,6 +681,19 @@ type MessageManageRPC struct {
 // support for your gen.Server actor.
 type MessageDirectChildren struct{}
 
+// MessageDirectInspect type intended to be used in Node.MigrateProcess in order to capture
+// the state of the process. Handle it in your HandleDirect callback returning MessageInspect
+// to enable the migration of your gen.Server actor.
+type MessageDirectInspect struct{}
+
+// MessageInspect is a reply on MessageDirectInspect
+type MessageInspect struct {
+	// Behavior is the name of behavior registered on the target node with ProvideRemoteSpawn
+	Behavior string
+	// State is passed to the Init callback of the spawned process as an argument
+	State etf.Term
+}
+
 // IsMessageDown
 func IsMessageDown(message etf.Term) (MessageDown, bool) {
 	var md MessageDown
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"fmt"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+// HealthCheck is a ready to use process answering the health queries with the
+// Status of the node. Spawn it with a registered name to make it reachable
+// by the remote nodes. The status can be queried
+//   - locally using HealthCheck.Status (Process.Direct)
+//   - making a Call with the request 'health'
+//   - sending the message {health, Pid}, the status is sent back to the Pid
+type HealthCheck struct {
+	gen.Server
+}
+
+// Status
+type Status struct {
+	Node         string
+	Alive        bool
+	Uptime       int64
+	Processes    int
+	Peers        []string
+	Applications []gen.ApplicationInfo
+	// Metrics the snapshot of the node metrics (including the network stats). The remote
+	// nodes get the counters only, since the durations and errors can't be encoded.
+	Metrics node.NodeMetrics
+}
+
+type messageStatus struct{}
+
+// HealthCheck API
+
+// Status returns the status of the node using the given HealthCheck process
+func (hc *HealthCheck) Status(p gen.Process) (Status, error) {
+	status, err := p.Direct(messageStatus{})
+	if err != nil {
+		return Status{}, err
+	}
+	return status.(Status), nil
+}
+
+// Server callbacks
+
+// HandleCall
+func (hc *HealthCheck) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
+	if message != etf.Atom("health") {
+		fmt.Printf("HealthCheck [%s] HandleCall: unhandled message %#v from %#v\n", process.Name(), message, from)
+		return etf.Atom("unknown_request"), gen.ServerStatusOK
+	}
+	return hc.status(process).term(), gen.ServerStatusOK
+}
+
+// HandleDirect
+func (hc *HealthCheck) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	switch message.(type) {
+	case messageStatus:
+		return hc.status(process), nil
+	}
+	return nil, gen.ErrUnsupportedRequest
+}
+
+// HandleInfo
+func (hc *HealthCheck) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	if m, ok := message.(etf.Tuple); ok && len(m) == 2 && m[0] == etf.Atom("health") {
+		if to, ok := m[1].(etf.Pid); ok {
+			process.Send(to, hc.status(process).term())
+			return gen.ServerStatusOK
+		}
+	}
+	fmt.Printf("HealthCheck [%s] HandleInfo: unhandled message %#v\n", process.Name(), message)
+	return gen.ServerStatusOK
+}
+
+func (hc *HealthCheck) status(process *gen.ServerProcess) Status {
+	n := process.Env(node.EnvKeyNode).(node.Node)
+	metrics := n.Metrics()
+	return Status{
+		Node:         n.Name(),
+		Alive:        n.IsAlive(),
+		Uptime:       n.Uptime(),
+		Processes:    metrics.Processes,
+		Peers:        metrics.Nodes,
+		Applications: n.WhichApplications(),
+		Metrics:      metrics,
+	}
+}
+
+// term returns the status to be sent to the remote process
+func (s Status) term() etf.Term {
+	m := s.Metrics
+	return etf.Map{
+		etf.Atom("Node"):         s.Node,
+		etf.Atom("Alive"):        s.Alive,
+		etf.Atom("Uptime"):       s.Uptime,
+		etf.Atom("Processes"):    s.Processes,
+		etf.Atom("Peers"):        s.Peers,
+		etf.Atom("Applications"): s.Applications,
+		etf.Atom("Metrics"): etf.Map{
+			etf.Atom("Names"):               m.Names,
+			etf.Atom("MessagesRouted"):      m.MessagesRouted,
+			etf.Atom("MessagesDropped"):     m.MessagesDropped,
+			etf.Atom("MessagesUndelivered"): m.MessagesUndelivered,
+			etf.Atom("Goroutines"):          m.Goroutines,
+			etf.Atom("HeapAlloc"):           m.HeapAlloc,
+			etf.Atom("NumGC"):               m.NumGC,
+			etf.Atom("Network"): etf.Map{
+				etf.Atom("Connections"):         m.Network.Connections,
+				etf.Atom("MaxConnections"):      m.Network.MaxConnections,
+				etf.Atom("Handshakes"):          m.Network.Handshakes,
+				etf.Atom("RemoteSpawnInFlight"): m.Network.RemoteSpawnInFlight,
+			},
+		},
+	}
+}
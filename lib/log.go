@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LogLevel
+type LogLevel int32
+
+const (
+	// LogLevelDebug is the level of the messages logged with Log. They are shown
+	// with the "ergo.trace" flag only (or the lowered log level, see SetLogLevel).
+	LogLevelDebug   LogLevel = 0
+	LogLevelInfo    LogLevel = 1
+	LogLevelWarning LogLevel = 2
+	LogLevelError   LogLevel = 3
+)
+
+var (
+	logLevel = int32(LogLevelInfo)
+
+	// logComponents is nil if the messages of all the components are shown
+	logComponents      map[string]bool
+	mutexLogComponents sync.RWMutex
+
+	ergoTraceComponents logComponentsFlag
+)
+
+// Log logs the debug message. The component is taken from the message prefix
+// (e.g. "[%s] CORE ..." or "EPMD ...") to filter the messages (see SetLogComponents).
+func Log(f string, a ...interface{}) {
+	LogWithLevel(LogLevelDebug, f, a...)
+}
+
+// LogWithLevel logs the message if the given level is enabled (see SetLogLevel)
+// and the component of the message is not filtered out.
+func LogWithLevel(level LogLevel, f string, a ...interface{}) {
+	if logEnabled(level) == false {
+		return
+	}
+	if logComponentEnabled(logComponent(f)) == false {
+		return
+	}
+	log.Printf(f, a...)
+}
+
+// SetLogLevel sets the minimal level of the logged messages. Default is LogLevelInfo.
+// The "ergo.trace" flag enables LogLevelDebug regardless of this setting.
+func SetLogLevel(level LogLevel) {
+	atomic.StoreInt32(&logLevel, int32(level))
+}
+
+// SetLogComponents makes only the messages of the given components be logged
+// (e.g. "CORE", "EPMD", "NETWORK"). The messages with no component are dropped.
+// Empty list removes the filter.
+func SetLogComponents(components ...string) {
+	var filter map[string]bool
+	for _, c := range components {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if filter == nil {
+			filter = make(map[string]bool)
+		}
+		filter[c] = true
+	}
+	mutexLogComponents.Lock()
+	logComponents = filter
+	mutexLogComponents.Unlock()
+}
+
+func logEnabled(level LogLevel) bool {
+	if ergoTrace && level >= LogLevelDebug {
+		return true
+	}
+	return level >= LogLevel(atomic.LoadInt32(&logLevel))
+}
+
+func logComponentEnabled(component string) bool {
+	mutexLogComponents.RLock()
+	defer mutexLogComponents.RUnlock()
+	if logComponents == nil {
+		return true
+	}
+	return logComponents[component]
+}
+
+// logComponent returns the capitalized word the message starts with (skipping the
+// node name prefix "[%s] "), e.g. "CORE" for "[%s] CORE route message...". Returns
+// empty string if there is no such word.
+func logComponent(f string) string {
+	if strings.HasPrefix(f, "[") {
+		i := strings.Index(f, "] ")
+		if i < 0 {
+			return ""
+		}
+		f = f[i+2:]
+	}
+	for i := 0; i < len(f); i++ {
+		c := f[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+			continue
+		case c >= 'a' && c <= 'z':
+			// regular word
+			return ""
+		}
+		return f[:i]
+	}
+	return f
+}
+
+// logComponentsFlag implements flag.Value for the "ergo.trace.components" flag
+type logComponentsFlag string
+
+func (l *logComponentsFlag) String() string {
+	return string(*l)
+}
+
+func (l *logComponentsFlag) Set(value string) error {
+	*l = logComponentsFlag(value)
+	SetLogComponents(strings.Split(value, ",")...)
+	return nil
+}
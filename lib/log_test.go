@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestLogComponent(t *testing.T) {
+	cases := map[string]string{
+		"[%s] CORE route message by pid (local) %s": "CORE",
+		"[%s] WARNING! mailbox of %s is full":       "WARNING",
+		"EPMD: looking for '%s'. Not found":         "EPMD",
+		"APP_MON: Init %#v":                         "APP_MON",
+		"Request from EPMD client: %v":              "",
+		"[%s":                                       "",
+		"":                                          "",
+	}
+	for f, expected := range cases {
+		if c := logComponent(f); c != expected {
+			t.Fatalf("%q: expected component %q, got %q", f, expected, c)
+		}
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogLevel(LogLevelInfo)
+	defer SetLogComponents()
+
+	Log("[%s] CORE hidden", "node")
+	LogWithLevel(LogLevelWarning, "[%s] CORE warning", "node")
+	if bytes.Contains(out.Bytes(), []byte("hidden")) {
+		t.Fatal("debug message is logged")
+	}
+	if bytes.Contains(out.Bytes(), []byte("warning")) == false {
+		t.Fatal("warning message is not logged")
+	}
+
+	out.Reset()
+	SetLogLevel(LogLevelDebug)
+	SetLogComponents("epmd")
+	Log("[%s] CORE routing", "node")
+	Log("EPMD registering %s", "node")
+	Log("no component")
+	if bytes.Contains(out.Bytes(), []byte("routing")) {
+		t.Fatal("filtered out component is logged")
+	}
+	if bytes.Contains(out.Bytes(), []byte("no component")) {
+		t.Fatal("message with no component is logged")
+	}
+	if bytes.Contains(out.Bytes(), []byte("EPMD registering node")) == false {
+		t.Fatal("message of the enabled component is not logged")
+	}
+
+	out.Reset()
+	SetLogComponents()
+	Log("[%s] CORE routing", "node")
+	if bytes.Contains(out.Bytes(), []byte("CORE routing")) == false {
+		t.Fatal("message is not logged with no filter")
+	}
+}
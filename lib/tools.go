@@ -6,7 +6,6 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"sync"
 	"time"
 )
@@ -44,13 +43,8 @@ var (
 func init() {
 	flag.BoolVar(&ergoTrace, "ergo.trace", false, "enable extended debug info")
 	flag.BoolVar(&ergoNoRecover, "ergo.norecover", false, "disable panic catching")
-}
-
-// Log
-func Log(f string, a ...interface{}) {
-	if ergoTrace {
-		log.Printf(f, a...)
-	}
+	flag.Var(&ergoTraceComponents, "ergo.trace.components",
+		"comma-separated list of the components (e.g. CORE,EPMD) to show the debug info for")
 }
 
 // CatchPanic
@@ -107,6 +101,12 @@ func (b *Buffer) Append(v []byte) {
 	b.B = append(b.B, v...)
 }
 
+// Write implements io.Writer interface
+func (b *Buffer) Write(v []byte) (int, error) {
+	b.B = append(b.B, v...)
+	return len(v), nil
+}
+
 // String
 func (b *Buffer) String() string {
 	return string(b.B)
@@ -0,0 +1,116 @@
+package node
+
+import (
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+)
+
+// cluster keeps the expected set of nodes and the quorum of them that must be
+// connected to consider the cluster ready
+type cluster struct {
+	nodes       map[string]bool
+	quorum      int
+	ready       bool
+	subscribers []etf.Pid
+}
+
+// SetCluster defines the expected set of nodes and the quorum. This node is counted
+// as connected if it belongs to the set.
+func (n *network) SetCluster(nodes []string, quorum int) error {
+	set := make(map[string]bool)
+	for _, name := range nodes {
+		set[name] = true
+	}
+	if quorum < 1 || quorum > len(set) {
+		return ErrClusterQuorum
+	}
+
+	n.mutexCluster.Lock()
+	n.cluster.nodes = set
+	n.cluster.quorum = quorum
+	n.mutexCluster.Unlock()
+
+	n.updateCluster()
+	return nil
+}
+
+// ClusterReady returns true if the quorum of the cluster nodes is connected
+func (n *network) ClusterReady() bool {
+	n.mutexCluster.Lock()
+	defer n.mutexCluster.Unlock()
+	return n.cluster.ready
+}
+
+// SubscribeCluster makes the local process receive gen.MessageClusterReady on changing
+// the readiness of the cluster
+func (n *network) SubscribeCluster(pid etf.Pid) error {
+	if n.router.ProcessByPid(pid) == nil {
+		return ErrProcessUnknown
+	}
+
+	n.mutexCluster.Lock()
+	defer n.mutexCluster.Unlock()
+	for _, subscriber := range n.cluster.subscribers {
+		if subscriber == pid {
+			return ErrTaken
+		}
+	}
+	n.cluster.subscribers = append(n.cluster.subscribers, pid)
+	return nil
+}
+
+// UnsubscribeCluster
+func (n *network) UnsubscribeCluster(pid etf.Pid) {
+	n.mutexCluster.Lock()
+	defer n.mutexCluster.Unlock()
+	for i := range n.cluster.subscribers {
+		if n.cluster.subscribers[i] == pid {
+			n.cluster.subscribers = append(n.cluster.subscribers[:i], n.cluster.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// updateCluster recounts the connected cluster nodes on connecting or disconnecting
+// the peer and notifies the subscribers if the readiness has changed. They are
+// notified under the mutexCluster to keep the order of the notifications.
+func (n *network) updateCluster() {
+	n.mutexCluster.Lock()
+	defer n.mutexCluster.Unlock()
+	if n.cluster.quorum == 0 {
+		return
+	}
+
+	connected := []string{}
+	if n.cluster.nodes[n.nodename] {
+		connected = append(connected, n.nodename)
+	}
+	for _, name := range n.Nodes() {
+		if n.cluster.nodes[name] {
+			connected = append(connected, name)
+		}
+	}
+
+	ready := len(connected) >= n.cluster.quorum
+	if ready == n.cluster.ready {
+		return
+	}
+	n.cluster.ready = ready
+	lib.Log("[%s] NETWORK cluster ready: %v (%d of %d connected, quorum %d)",
+		n.nodename, ready, len(connected), len(n.cluster.nodes), n.cluster.quorum)
+
+	message := gen.MessageClusterReady{
+		Ready:     ready,
+		Connected: connected,
+	}
+	subscribers := n.cluster.subscribers[:0]
+	for _, subscriber := range n.cluster.subscribers {
+		if err := n.router.RouteSend(etf.Pid{}, subscriber, message); err == ErrProcessUnknown {
+			// subscriber is terminated
+			continue
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	n.cluster.subscribers = subscribers
+}
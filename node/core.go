@@ -28,10 +28,30 @@ type core struct {
 
 	tls TLS
 
+	// validateOnSend enables validating messages sent to the remote processes
+	validateOnSend bool
+
+	panicPolicy  gen.PanicPolicy
+	panicHandler gen.PanicHandler
+
+	// messagesRouted and messagesDropped count the messages put into the local
+	// mailboxes and dropped on overflow, messagesUndelivered - sent to the unknown
+	// local processes (see Metrics)
+	messagesRouted      uint64
+	messagesDropped     uint64
+	messagesUndelivered uint64
+	// dropLog logs the dropped and undelivered messages (see Options.DropLogSample)
+	dropLog *dropLog
+
 	nextPID  uint64
 	uniqID   uint64
 	nodename string
 	creation uint32
+	// startedAt keeps the monotonic clock reading for the accurate uptime
+	startedAt time.Time
+
+	stopReason      string
+	mutexStopReason sync.Mutex
 
 	names          map[string]etf.Pid
 	mutexNames     sync.Mutex
@@ -39,9 +59,61 @@ type core struct {
 	mutexAliases   sync.Mutex
 	processes      map[uint64]*process
 	mutexProcesses sync.Mutex
+	// rawProcesses is the number of processes receiving the raw messages
+	rawProcesses int64
 
 	behaviors      map[string]map[string]gen.RegisteredBehavior
 	mutexBehaviors sync.Mutex
+
+	registry GlobalRegistry
+	// globalNames the names published to the global registry (see registerName).
+	// It's guarded by mutexNames
+	globalNames map[string]bool
+
+	clock       TimerSource
+	nextTimerID uint64
+	timers      map[uint64]timerItem
+	mutexTimers sync.Mutex
+
+	schedules      map[string]*scheduleItem
+	mutexSchedules sync.Mutex
+
+	// receipts are pending until the barrier of the connection (see RouteSendWithReceipt)
+	receipts      map[ConnectionInterface][]pendingReceipt
+	mutexReceipts sync.Mutex
+
+	groups        map[string]*processGroup
+	groupsProcess gen.Process
+	groupsClock   int64
+	mutexGroups   sync.Mutex
+
+	// taps are indexed by the reference, the collectors are kept by the tapped process
+	taps      map[etf.Ref]*process
+	mutexTaps sync.Mutex
+
+	tombstones      []ProcessTombstone
+	tombstonesLimit int
+	tombstonesTTL   time.Duration
+	mutexTombstones sync.Mutex
+
+	observers       []chan gen.NodeDelta
+	observersClosed bool
+	mutexObservers  sync.Mutex
+}
+
+type timerItem struct {
+	from   etf.Pid
+	to     etf.Pid
+	cancel context.CancelFunc
+}
+
+type pendingReceipt struct {
+	from    etf.Pid
+	receipt gen.MessageDeliveryReceipt
+}
+
+type scheduleItem struct {
+	cancel context.CancelFunc
 }
 
 type coreInternal interface {
@@ -55,30 +127,100 @@ type coreInternal interface {
 	registerName(name string, pid etf.Pid) error
 	unregisterName(name string) error
 
+	routeSendFrom(from etf.Pid, to etf.Pid, message etf.Term) error
+	routeSendRaw(from etf.Pid, to etf.Pid, encoded []byte) error
+	routeSendWithTTL(from etf.Pid, to etf.Pid, message etf.Term, ttl time.Duration) error
+	routeSpawnRequest(nodename string, behaviorName string, request gen.RemoteSpawnRequest) error
+
+	coreTimerSource() TimerSource
+	sendAfter(from etf.Pid, to etf.Pid, message etf.Term, after time.Duration) context.CancelFunc
+	cancelTimers(pid etf.Pid) int
+
+	scheduleInterval(name string, interval time.Duration, fn func()) error
+	cancelSchedule(name string) bool
+
+	joinGroup(name string, pid etf.Pid) error
+	leaveGroup(name string, pid etf.Pid) error
+	groupLeader(name string) etf.Pid
+	groupMembers(name string) []etf.Pid
+	subscribeGroup(name string, pid etf.Pid) error
+	unsubscribeGroup(name string, pid etf.Pid)
+	groupsStarted(process gen.Process)
+	handleGroupsMessage(message etf.Term)
+
+	terminatedProcess(pid etf.Pid) (ProcessTombstone, bool)
+	purgeTerminated() int
+
+	metrics() NodeMetrics
+	startMetrics(sink func(NodeMetrics), sinkName string, interval time.Duration) error
+
+	tapProcess(pid etf.Pid, collector etf.Pid) (etf.Ref, error)
+	untap(ref etf.Ref) bool
+
+	exportRegistry() gen.RegistrySnapshot
+	importRegistry(snapshot gen.RegistrySnapshot) error
+
+	pauseProcess(pid etf.Pid) error
+	resumeProcess(pid etf.Pid) error
+	migrateProcess(pid etf.Pid, targetNode string) (etf.Pid, error)
+
+	processEnv(pid etf.Pid) (map[gen.EnvKey]interface{}, error)
+	setProcessEnv(pid etf.Pid, name gen.EnvKey, value interface{}) error
+
 	newAlias(p *process) (etf.Alias, error)
 	deleteAlias(owner *process, alias etf.Alias) error
 
 	coreNodeName() string
 	coreStop()
+	coreStopWithReason(reason string)
+	coreStopReason() string
 	coreUptime() int64
+	coreUptimeDuration() time.Duration
+	coreStartedAt() time.Time
 	coreIsAlive() bool
 
 	coreWait()
 	coreWaitWithTimeout(d time.Duration) error
+
+	observe() (<-chan gen.NodeDelta, func())
+
+	resolvePanic(pid etf.Pid, name string, reason interface{}) gen.PanicPolicy
 }
 
 func newCore(ctx context.Context, nodename string, options Options) (coreInternal, error) {
 	c := &core{
 		ctx:     ctx,
+		env:     options.Env,
 		nextPID: startPID,
 		uniqID:  uint64(time.Now().UnixNano()),
 		// keep node to get the process to access to the node's methods
-		nodename:  nodename,
-		creation:  options.Creation,
-		names:     make(map[string]etf.Pid),
-		aliases:   make(map[etf.Alias]*process),
-		processes: make(map[uint64]*process),
-		behaviors: make(map[string]map[string]gen.RegisteredBehavior),
+		nodename:    nodename,
+		creation:    options.Creation,
+		startedAt:   time.Now(),
+		names:       make(map[string]etf.Pid),
+		globalNames: make(map[string]bool),
+		aliases:     make(map[etf.Alias]*process),
+		processes:   make(map[uint64]*process),
+		behaviors:   make(map[string]map[string]gen.RegisteredBehavior),
+		clock:       options.TimerSource,
+		timers:      make(map[uint64]timerItem),
+		schedules:   make(map[string]*scheduleItem),
+		receipts:    make(map[ConnectionInterface][]pendingReceipt),
+		groups:      make(map[string]*processGroup),
+		taps:        make(map[etf.Ref]*process),
+		registry:    options.GlobalRegistry,
+
+		validateOnSend: options.ValidateOnSend,
+		panicPolicy:    options.PanicPolicy,
+		panicHandler:   options.PanicHandler,
+
+		tombstonesLimit: options.TerminatedRetention,
+		tombstonesTTL:   options.TerminatedRetentionTTL,
+
+		dropLog: newDropLog(options.DropLogSample, options.DropLogRate),
+	}
+	if c.clock == nil {
+		c.clock = realTimerSource{}
 	}
 
 	corectx, corestop := context.WithCancel(ctx)
@@ -92,6 +234,11 @@ func newCore(ctx context.Context, nodename string, options Options) (coreInterna
 		return nil, err
 	}
 	c.networkInternal = network
+
+	go func() {
+		<-corectx.Done()
+		c.closeObservers()
+	}()
 	return c, nil
 }
 
@@ -104,10 +251,35 @@ func (c *core) coreStop() {
 	c.stopNetwork()
 }
 
+func (c *core) coreStopWithReason(reason string) {
+	c.mutexStopReason.Lock()
+	c.stopReason = reason
+	c.mutexStopReason.Unlock()
+	c.coreStop()
+}
+
+func (c *core) coreStopReason() string {
+	c.mutexStopReason.Lock()
+	defer c.mutexStopReason.Unlock()
+	return c.stopReason
+}
+
 func (c *core) coreUptime() int64 {
 	return time.Now().Unix() - int64(c.creation)
 }
 
+func (c *core) coreUptimeDuration() time.Duration {
+	return time.Since(c.startedAt)
+}
+
+func (c *core) coreTimerSource() TimerSource {
+	return c.clock
+}
+
+func (c *core) coreStartedAt() time.Time {
+	return c.startedAt
+}
+
 func (c *core) coreWait() {
 	<-c.ctx.Done()
 }
@@ -225,7 +397,7 @@ func (c *core) deleteAlias(owner *process, alias etf.Alias) error {
 	p.Unlock()
 
 	// shouldn't reach this code. seems we got a bug
-	fmt.Println("Bug: Process lost its alias. Please, report this issue")
+	lib.LogWithLevel(lib.LogLevelError, "[%s] CORE process lost its alias. Please, report this issue", c.nodename)
 	c.mutexAliases.Lock()
 	delete(c.aliases, alias)
 	c.mutexAliases.Unlock()
@@ -238,9 +410,21 @@ func (c *core) newProcess(name string, behavior gen.ProcessBehavior, opts proces
 	var parentContext context.Context
 
 	mailboxSize := DefaultProcessMailboxSize
+	switch opts.Priority {
+	case gen.ProcessPriorityLow:
+		mailboxSize = DefaultProcessMailboxSize / 2
+	case gen.ProcessPriorityHigh:
+		mailboxSize = DefaultProcessMailboxSize * 2
+	case gen.ProcessPriorityMax:
+		mailboxSize = DefaultProcessMailboxSize * 4
+	}
 	if opts.MailboxSize > 0 {
 		mailboxSize = int(opts.MailboxSize)
 	}
+	directboxSize := DefaultProcessDirectboxSize
+	if opts.DirectboxSize > 0 {
+		directboxSize = int(opts.DirectboxSize)
+	}
 
 	parentContext = c.ctx
 
@@ -274,15 +458,20 @@ func (c *core) newProcess(name string, behavior gen.ProcessBehavior, opts proces
 
 		mailBox:      make(chan gen.ProcessMailboxMessage, mailboxSize),
 		gracefulExit: make(chan gen.ProcessGracefulExitRequest, mailboxSize),
-		direct:       make(chan gen.ProcessDirectMessage),
+		direct:       make(chan gen.ProcessDirectMessage, directboxSize),
 
 		context: processContext,
 		kill:    kill,
 
 		reply: make(map[etf.Ref]chan etf.Term),
+
+		onMailboxFull: opts.OnMailboxFull,
+		persister:     opts.MailboxPersister,
+		priority:      opts.Priority,
+		rawMessages:   opts.RawMessages,
 	}
 
-	process.exit = func(from etf.Pid, reason string) error {
+	process.exit = func(from etf.Pid, reason string, err error) error {
 		lib.Log("[%s] EXIT from %s to %s with reason: %s", c.nodename, from, pid, reason)
 		if processContext.Err() != nil {
 			// process is already died
@@ -292,6 +481,7 @@ func (c *core) newProcess(name string, behavior gen.ProcessBehavior, opts proces
 		ex := gen.ProcessGracefulExitRequest{
 			From:   from,
 			Reason: reason,
+			Err:    err,
 		}
 
 		// use select just in case if this process isn't been started yet
@@ -310,21 +500,61 @@ func (c *core) newProcess(name string, behavior gen.ProcessBehavior, opts proces
 		return nil
 	}
 
-	if name != "" {
-		lib.Log("[%s] CORE registering name (%s): %s", c.nodename, pid, name)
-		c.mutexNames.Lock()
-		if _, exist := c.names[name]; exist {
-			c.mutexNames.Unlock()
-			return nil, ErrTaken
+	skipped := 0
+	if process.persister != nil {
+		// the process isn't registered yet, so the replayed messages go first
+		replay := process.persister.Replay()
+		if len(replay) > mailboxSize {
+			lib.Log("[%s] CORE %s replay the last %d of %d persisted messages", c.nodename, pid, mailboxSize, len(replay))
+			skipped = len(replay) - mailboxSize
+			replay = replay[skipped:]
+		}
+		for _, message := range replay {
+			process.mailBox <- message
 		}
-		c.names[name] = process.self
-		c.mutexNames.Unlock()
 	}
 
 	lib.Log("[%s] CORE registering process: %s", c.nodename, pid)
 	c.mutexProcesses.Lock()
 	c.processes[process.self.ID] = process
 	c.mutexProcesses.Unlock()
+	if process.rawMessages {
+		atomic.AddInt64(&c.rawProcesses, 1)
+	}
+
+	// the name is registered once the process can take the messages. Otherwise,
+	// the message sent by this name might get the pid that is unknown yet.
+	if name != "" {
+		lib.Log("[%s] CORE registering name (%s): %s", c.nodename, pid, name)
+		c.mutexNames.Lock()
+		_, exist := c.names[name]
+		if exist == false {
+			c.names[name] = process.self
+		}
+		c.mutexNames.Unlock()
+
+		if exist {
+			c.mutexProcesses.Lock()
+			delete(c.processes, process.self.ID)
+			c.mutexProcesses.Unlock()
+			if process.rawMessages {
+				atomic.AddInt64(&c.rawProcesses, -1)
+			}
+			kill()
+			return nil, ErrTaken
+		}
+	}
+
+	// the persisted messages are kept untouched if the process hasn't been registered
+	// (e.g. the name is taken), so they are replayed on the next attempt
+	if skipped > 0 {
+		process.persister.Ack(skipped)
+	}
+
+	c.notifyObservers(gen.NodeDelta{Type: gen.NodeDeltaProcessSpawned, Pid: pid})
+	if name != "" {
+		c.notifyObservers(gen.NodeDelta{Type: gen.NodeDeltaNameRegistered, Pid: pid, Name: name})
+	}
 
 	return process, nil
 }
@@ -338,31 +568,432 @@ func (c *core) deleteProcess(pid etf.Pid) {
 	}
 	lib.Log("[%s] CORE unregistering process: %s", c.nodename, p.self)
 	delete(c.processes, pid.ID)
+	c.cleanTaps(p)
 	c.mutexProcesses.Unlock()
+	if p.rawMessages {
+		atomic.AddInt64(&c.rawProcesses, -1)
+	}
 
+	names := []string{}
+	global := []string{}
 	c.mutexNames.Lock()
-	if (p.name) != "" {
+	// the name might be pointed to the migrated process (see migrateProcess)
+	if pid, ok := c.names[p.name]; ok && pid == p.self {
 		lib.Log("[%s] CORE unregistering name (%s): %s", c.nodename, p.self, p.name)
 		delete(c.names, p.name)
+		names = append(names, p.name)
 	}
 
 	// delete names registered with this pid
 	for name, pid := range c.names {
 		if p.self == pid {
 			delete(c.names, name)
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if c.globalNames[name] {
+			delete(c.globalNames, name)
+			global = append(global, name)
 		}
 	}
 	c.mutexNames.Unlock()
 
+	for _, name := range global {
+		c.unregisterGlobal(name)
+	}
+	for _, name := range names {
+		c.notifyObservers(gen.NodeDelta{Type: gen.NodeDeltaNameUnregistered, Pid: pid, Name: name})
+	}
+	c.notifyObservers(gen.NodeDelta{Type: gen.NodeDeltaProcessTerminated, Pid: pid})
+
 	c.mutexAliases.Lock()
 	for alias := range c.aliases {
 		delete(c.aliases, alias)
 	}
 	c.mutexAliases.Unlock()
 
+	c.cancelTimers(pid)
+	c.handleGroupsTerminated(func(member etf.Pid) bool {
+		return member == pid
+	})
 	return
 }
 
+// sendAfter starts a timer. When the timer expires, the message is routed to the
+// process 'to' on behalf of the process 'from'. Timer is canceled if one of these
+// processes has terminated.
+func (c *core) sendAfter(from etf.Pid, to etf.Pid, message etf.Term, after time.Duration) context.CancelFunc {
+	ctx, cancelContext := context.WithCancel(c.ctx)
+	id := atomic.AddUint64(&c.nextTimerID, 1)
+
+	// the timer is created before returning and stopped on canceling to make the fake
+	// clock (see Options.TimerSource) be advanced right after these calls
+	timer := c.clock.NewTimer(after)
+	cancel := func() {
+		timer.Stop()
+		cancelContext()
+	}
+
+	c.mutexTimers.Lock()
+	c.timers[id] = timerItem{
+		from:   from,
+		to:     to,
+		cancel: cancel,
+	}
+	c.mutexTimers.Unlock()
+
+	go func() {
+		defer func() {
+			c.mutexTimers.Lock()
+			delete(c.timers, id)
+			c.mutexTimers.Unlock()
+			cancel()
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+			c.RouteSend(from, to, message)
+		}
+	}()
+	return cancel
+}
+
+// cancelTimers cancels all the timers owned by or targeting the given process.
+// Returns the number of canceled timers
+func (c *core) cancelTimers(pid etf.Pid) int {
+	canceled := 0
+	c.mutexTimers.Lock()
+	defer c.mutexTimers.Unlock()
+
+	for id, item := range c.timers {
+		if item.from != pid && item.to != pid {
+			continue
+		}
+		item.cancel()
+		delete(c.timers, id)
+		canceled++
+	}
+	if canceled > 0 {
+		lib.Log("[%s] CORE canceled %d timers of %s", c.nodename, canceled, pid)
+	}
+	return canceled
+}
+
+// processEnv returns the environment variables of the given process including
+// the inherited ones (see gen.Process.ListEnv)
+func (c *core) processEnv(pid etf.Pid) (map[gen.EnvKey]interface{}, error) {
+	p := c.localProcess(pid)
+	if p == nil {
+		return nil, ErrProcessUnknown
+	}
+	return p.ListEnv(), nil
+}
+
+// setProcessEnv sets the environment variable of the given process. The nil value
+// removes it.
+func (c *core) setProcessEnv(pid etf.Pid, name gen.EnvKey, value interface{}) error {
+	p := c.localProcess(pid)
+	if p == nil {
+		return ErrProcessUnknown
+	}
+	p.SetEnv(name, value)
+	lib.Log("[%s] CORE set env %q of %s", c.nodename, name, pid)
+	return nil
+}
+
+// pauseProcess makes the messages addressed to the given process be held
+// until resumeProcess is called
+func (c *core) pauseProcess(pid etf.Pid) error {
+	c.mutexProcesses.Lock()
+	p, exist := c.processes[pid.ID]
+	c.mutexProcesses.Unlock()
+	if !exist || pid.Node != etf.Atom(c.nodename) {
+		return ErrProcessUnknown
+	}
+
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+	lib.Log("[%s] CORE pause delivering messages to %s", c.nodename, pid)
+	p.paused = true
+	return nil
+}
+
+// resumeProcess delivers the held messages to the mailbox of the given
+// process preserving their order and disables holding. If the mailbox
+// has no room for all of them, the rest stays held, the process remains
+// paused and ErrProcessMailboxFull is returned (resume can be retried).
+func (c *core) resumeProcess(pid etf.Pid) error {
+	c.mutexProcesses.Lock()
+	p, exist := c.processes[pid.ID]
+	c.mutexProcesses.Unlock()
+	if !exist || pid.Node != etf.Atom(c.nodename) {
+		return ErrProcessUnknown
+	}
+	mailbox := p.mailboxAlive()
+	if mailbox == nil {
+		return ErrProcessTerminated
+	}
+
+	// the senders are waiting for this lock in order to not overtake the held
+	// messages, so it must never be kept while blocking on the mailbox
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+
+	lib.Log("[%s] CORE resume delivering messages to %s (held %d)", c.nodename, pid, len(p.held))
+	for i := range p.held {
+		select {
+		case mailbox <- p.held[i]:
+			continue
+		default:
+		}
+		p.held = p.held[i:]
+		lib.Log("[%s] CORE mailbox of %s is full. still holding %d messages", c.nodename, pid, len(p.held))
+		return ErrProcessMailboxFull
+	}
+	p.held = nil
+	p.paused = false
+	return nil
+}
+
+// migrateProcess moves the local process to the target node (see Node.MigrateProcess)
+func (c *core) migrateProcess(pid etf.Pid, targetNode string) (etf.Pid, error) {
+	c.mutexProcesses.Lock()
+	p, exist := c.processes[pid.ID]
+	c.mutexProcesses.Unlock()
+	if !exist || pid.Node != etf.Atom(c.nodename) {
+		return etf.Pid{}, ErrProcessUnknown
+	}
+
+	if err := c.pauseProcess(pid); err != nil {
+		return etf.Pid{}, err
+	}
+	spawned, err := c.handoffProcess(p, targetNode)
+	if err != nil {
+		lib.Log("[%s] CORE can't migrate %s to %s: %s", c.nodename, pid, targetNode, err)
+		c.resumeProcess(pid)
+		return etf.Pid{}, err
+	}
+	lib.Log("[%s] CORE migrated %s to %s", c.nodename, pid, spawned)
+
+	// point the names to the spawned process, so the source process
+	// doesn't take them away on termination
+	global := []string{}
+	c.mutexNames.Lock()
+	for name, registered := range c.names {
+		if registered == pid {
+			c.names[name] = spawned
+			if c.globalNames[name] {
+				global = append(global, name)
+			}
+		}
+	}
+	c.mutexNames.Unlock()
+	for _, name := range global {
+		c.unregisterGlobal(name)
+		if err := c.registerGlobal(name, spawned); err != nil {
+			lib.Log("[%s] CORE can't register global name %s: %s", c.nodename, name, err)
+			c.mutexNames.Lock()
+			delete(c.globalNames, name)
+			c.mutexNames.Unlock()
+		}
+	}
+
+	// forward the held messages. the source process is still paused,
+	// so the messages arriving in the meantime are held as well.
+	for {
+		p.pauseMutex.Lock()
+		held := p.held
+		p.held = nil
+		p.pauseMutex.Unlock()
+		if len(held) == 0 {
+			break
+		}
+		for _, message := range held {
+			if message.Deadline.IsZero() == false && time.Now().After(message.Deadline) {
+				continue
+			}
+			if err := c.RouteSend(p.self, spawned, message.Message); err != nil {
+				lib.Log("[%s] CORE can't forward message to %s: %s", c.nodename, spawned, err)
+			}
+		}
+	}
+
+	p.Exit("migrated")
+	return spawned, nil
+}
+
+// handoffProcess captures the state of the paused process and spawns
+// the equivalent one on the target node
+func (c *core) handoffProcess(p *process, targetNode string) (etf.Pid, error) {
+	mailbox := p.mailboxAlive()
+	if mailbox == nil {
+		return etf.Pid{}, ErrProcessTerminated
+	}
+
+	// drain the mailbox. the process takes the messages one by one,
+	// so the inspect request is handled right after the last of them
+	deadline := time.Now().Add(time.Duration(gen.DefaultCallTimeout) * time.Second)
+	for len(mailbox) > 0 {
+		if time.Now().After(deadline) {
+			return etf.Pid{}, ErrTimeout
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reply, err := p.Direct(gen.MessageDirectInspect{})
+	if err != nil {
+		return etf.Pid{}, err
+	}
+	inspect, ok := reply.(gen.MessageInspect)
+	if !ok {
+		return etf.Pid{}, ErrUnsupported
+	}
+	return p.RemoteSpawn(targetNode, inspect.Behavior, gen.RemoteSpawnOptions{}, inspect.State)
+}
+
+// enqueue puts the message into the holding buffer of the paused process or into the
+// mailbox without blocking. Returns true if the process is paused. The message is
+// persisted under the same lock right before that, so the persisted order matches the
+// delivery one.
+func (p *process) enqueue(mailbox chan gen.ProcessMailboxMessage, message gen.ProcessMailboxMessage) (bool, error) {
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+	if p.paused {
+		// the size of holding buffer is limited by the size of mailbox
+		if len(p.held) >= cap(p.mailBox) {
+			return true, ErrProcessMailboxFull
+		}
+		p.persist(message)
+		p.held = append(p.held, message)
+		return true, nil
+	}
+	// the senders are serialized by this lock, so nobody can take the free slot
+	if len(mailbox) >= cap(mailbox) {
+		return false, ErrProcessMailboxFull
+	}
+	p.persist(message)
+	mailbox <- message
+	return false, nil
+}
+
+// enqueueWait waits for the free slot in the full mailbox up to the given duration
+func (p *process) enqueueWait(mailbox chan gen.ProcessMailboxMessage, message gen.ProcessMailboxMessage, wait time.Duration) error {
+	// the message must be enqueued under the pause lock (the process could be paused
+	// in the meantime, the persisted order must match the delivery one), so keep
+	// trying to enqueue it until the slot is freed
+	deadline := time.Now().Add(wait)
+	for {
+		if _, err := p.enqueue(mailbox, message); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrProcessMailboxFull
+		}
+		time.Sleep(wait / 10)
+	}
+}
+
+// resolvePanic returns the policy to apply to the panic happened in the process.
+// The handler is invoked for gen.PanicPolicyCallback.
+func (c *core) resolvePanic(pid etf.Pid, name string, reason interface{}) gen.PanicPolicy {
+	switch c.panicPolicy {
+	case gen.PanicPolicyCrashNode:
+		return gen.PanicPolicyCrashNode
+	case gen.PanicPolicyCallback:
+		if c.panicHandler == nil {
+			break
+		}
+		if c.panicHandler(pid, name, reason) == gen.PanicPolicyCrashNode {
+			lib.Log("[%s] CORE panic handler decided to crash the node (process %s)", c.nodename, pid)
+			return gen.PanicPolicyCrashNode
+		}
+	}
+	return gen.PanicPolicyIsolate
+}
+
+// scheduleInterval starts invoking fn every interval until the schedule is canceled
+// or the node is stopped. Returns ErrTaken if the name is already scheduled.
+func (c *core) scheduleInterval(name string, interval time.Duration, fn func()) error {
+	if interval <= 0 {
+		return ErrScheduleInterval
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	item := &scheduleItem{
+		cancel: cancel,
+	}
+	c.mutexSchedules.Lock()
+	if _, exist := c.schedules[name]; exist {
+		c.mutexSchedules.Unlock()
+		cancel()
+		return ErrTaken
+	}
+	c.schedules[name] = item
+	c.mutexSchedules.Unlock()
+	lib.Log("[%s] CORE scheduled %q with interval %s", c.nodename, name, interval)
+
+	run := func() {
+		if lib.CatchPanic() {
+			defer func() {
+				if rcv := recover(); rcv != nil {
+					pc, file, line, _ := runtime.Caller(2)
+					lib.LogWithLevel(lib.LogLevelWarning, "[%s] CORE scheduled function %q failed %#v at %s[%s:%d]",
+						c.nodename, name, rcv, runtime.FuncForPC(pc).Name(), file, line)
+				}
+			}()
+		}
+		fn()
+	}
+
+	ticker := c.clock.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		defer func() {
+			c.mutexSchedules.Lock()
+			// the name could be scheduled again after canceling
+			if c.schedules[name] == item {
+				delete(c.schedules, name)
+			}
+			c.mutexSchedules.Unlock()
+			cancel()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				run()
+			}
+		}
+	}()
+	return nil
+}
+
+// cancelSchedule stops invoking the function scheduled with the given name.
+// Returns false if the name is not scheduled
+func (c *core) cancelSchedule(name string) bool {
+	c.mutexSchedules.Lock()
+	defer c.mutexSchedules.Unlock()
+
+	item, exist := c.schedules[name]
+	if !exist {
+		return false
+	}
+	item.cancel()
+	delete(c.schedules, name)
+	lib.Log("[%s] CORE canceled schedule %q", c.nodename, name)
+	return true
+}
+
+// spawn creates the process and starts its loop. The process (and its name) is known
+// to the node before ProcessInit is invoked, so the messages sent to it during the
+// initialization and before ProcessLoop has signaled 'started' are kept in the mailbox
+// and handled once the loop is started. They are dropped only if the mailbox is
+// full or the process fails to start.
 func (c *core) spawn(name string, opts processOptions, behavior gen.ProcessBehavior, args ...etf.Term) (gen.Process, error) {
 
 	process, err := c.newProcess(name, behavior, opts)
@@ -376,8 +1007,11 @@ func (c *core) spawn(name string, opts processOptions, behavior gen.ProcessBehav
 			defer func() {
 				if rcv := recover(); rcv != nil {
 					pc, fn, line, _ := runtime.Caller(2)
-					fmt.Printf("Warning: initialization process failed %s[%q] %#v at %s[%s:%d]\n",
-						process.self, name, rcv, runtime.FuncForPC(pc).Name(), fn, line)
+					lib.LogWithLevel(lib.LogLevelWarning, "[%s] CORE initialization process failed %s[%q] %#v at %s[%s:%d]",
+						c.nodename, process.self, name, rcv, runtime.FuncForPC(pc).Name(), fn, line)
+					if process.crashNode(rcv) {
+						panic(rcv)
+					}
 					c.deleteProcess(process.self)
 					err = fmt.Errorf("panic")
 				}
@@ -393,18 +1027,32 @@ func (c *core) spawn(name string, opts processOptions, behavior gen.ProcessBehav
 		return nil, err
 	}
 
-	started := make(chan bool)
-	defer close(started)
+	// the process loop isn't started yet, so it can't be terminated
+	// before the link/monitor has been established
+	if opts.link != (etf.Pid{}) {
+		c.RouteLink(opts.link, process.self)
+	}
+	if opts.monitor != (etf.Pid{}) {
+		c.RouteMonitor(opts.monitor, process.self, opts.monitorRef)
+	}
+
+	// the loop signals 'started' once. it is buffered, so the loop doesn't get stuck
+	// (and the channel is never closed under it) if the process is terminated
+	// before and nobody waits for this signal anymore
+	started := make(chan bool, 1)
 
 	cleanProcess := func(reason string) {
 		// set gracefulExit to nil before we start termination handling
 		process.gracefulExit = nil
 		c.deleteProcess(process.self)
+		// keep the record before the context is canceled (unless it was
+		// already canceled by the exit signal)
+		c.addTombstone(process.self, name, reason)
 		// invoke cancel context to prevent memory leaks
 		// and propagate context canelation
 		process.Kill()
 		// notify all the linked process and monitors
-		c.handleTerminated(process.self, name, reason)
+		c.handleTerminated(process.self, name, reason, process.exitErrorFor(reason))
 		// make the rest empty
 		process.Lock()
 		process.aliases = []etf.Alias{}
@@ -427,12 +1075,19 @@ func (c *core) spawn(name string, opts processOptions, behavior gen.ProcessBehav
 	}
 
 	go func(ps gen.ProcessState) {
+		if opts.DedicatedThread {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+		}
 		if lib.CatchPanic() {
 			defer func() {
 				if rcv := recover(); rcv != nil {
 					pc, fn, line, _ := runtime.Caller(2)
-					fmt.Printf("Warning: process terminated %s[%q] %#v at %s[%s:%d]\n",
-						process.self, name, rcv, runtime.FuncForPC(pc).Name(), fn, line)
+					lib.LogWithLevel(lib.LogLevelWarning, "[%s] CORE process terminated %s[%q] %#v at %s[%s:%d]",
+						c.nodename, process.self, name, rcv, runtime.FuncForPC(pc).Name(), fn, line)
+					if process.crashNode(rcv) {
+						panic(rcv)
+					}
 					cleanProcess("panic")
 				}
 			}()
@@ -445,34 +1100,144 @@ func (c *core) spawn(name string, opts processOptions, behavior gen.ProcessBehav
 
 	}(processState)
 
-	// wait for the starting process loop
-	<-started
+	// wait for the starting process loop. the process could be terminated
+	// before (e.g. its children failed on initialization)
+	select {
+	case <-started:
+	case <-process.context.Done():
+		// the failing child is reported with the exit error (see gen.Supervisor)
+		process.RLock()
+		err := process.exitError
+		process.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrProcessTerminated
+	}
+
+	if name != "" {
+		c.handleNameRegistered(name, process.self)
+	}
 	return process, nil
 }
 
 func (c *core) registerName(name string, pid etf.Pid) error {
 	lib.Log("[%s] CORE registering name %s", c.nodename, name)
 	c.mutexNames.Lock()
-	defer c.mutexNames.Unlock()
 	if _, ok := c.names[name]; ok {
+		c.mutexNames.Unlock()
 		// already registered
 		return ErrTaken
 	}
 	c.names[name] = pid
+	c.mutexNames.Unlock()
+
+	if err := c.registerGlobal(name, pid); err != nil {
+		c.mutexNames.Lock()
+		delete(c.names, name)
+		c.mutexNames.Unlock()
+		return err
+	}
+
+	c.handleNameRegistered(name, pid)
+	c.notifyObservers(gen.NodeDelta{Type: gen.NodeDeltaNameRegistered, Pid: pid, Name: name})
 	return nil
 }
 
 func (c *core) unregisterName(name string) error {
 	lib.Log("[%s] CORE unregistering name %s", c.nodename, name)
 	c.mutexNames.Lock()
-	defer c.mutexNames.Unlock()
-	if _, ok := c.names[name]; ok {
+	if pid, ok := c.names[name]; ok {
 		delete(c.names, name)
+		global := c.globalNames[name]
+		delete(c.globalNames, name)
+		c.mutexNames.Unlock()
+		if global {
+			c.unregisterGlobal(name)
+		}
+		c.notifyObservers(gen.NodeDelta{Type: gen.NodeDeltaNameUnregistered, Pid: pid, Name: name})
 		return nil
 	}
+	c.mutexNames.Unlock()
 	return ErrNameUnknown
 }
 
+func (c *core) registerGlobal(name string, pid etf.Pid) error {
+	if c.registry == nil {
+		return nil
+	}
+	lib.Log("[%s] CORE registering global name %s", c.nodename, name)
+	if err := c.registry.Register(name, pid); err != nil {
+		return err
+	}
+	c.mutexNames.Lock()
+	c.globalNames[name] = true
+	c.mutexNames.Unlock()
+	return nil
+}
+
+func (c *core) unregisterGlobal(name string) {
+	if c.registry == nil {
+		return
+	}
+	lib.Log("[%s] CORE unregistering global name %s", c.nodename, name)
+	if err := c.registry.Unregister(name); err != nil {
+		lib.Log("[%s] CORE can't unregister global name %s: %s", c.nodename, name, err)
+	}
+}
+
+func (c *core) observe() (<-chan gen.NodeDelta, func()) {
+	ch := make(chan gen.NodeDelta, DefaultObserveBufferSize)
+	c.mutexObservers.Lock()
+	defer c.mutexObservers.Unlock()
+	if c.observersClosed {
+		close(ch)
+		return ch, func() {}
+	}
+	c.observers = append(c.observers, ch)
+	cancel := func() {
+		c.mutexObservers.Lock()
+		defer c.mutexObservers.Unlock()
+		for i := range c.observers {
+			if c.observers[i] != ch {
+				continue
+			}
+			c.observers[i] = c.observers[len(c.observers)-1]
+			c.observers = c.observers[:len(c.observers)-1]
+			close(ch)
+			return
+		}
+	}
+	return ch, cancel
+}
+
+// notifyObservers never blocks. The event is dropped for the observer
+// whose buffer is full.
+func (c *core) notifyObservers(delta gen.NodeDelta) {
+	c.mutexObservers.Lock()
+	defer c.mutexObservers.Unlock()
+	for _, ch := range c.observers {
+		select {
+		case ch <- delta:
+		default:
+			lib.Log("[%s] CORE observer is too slow. dropped event %s (%s)", c.nodename, delta.Type, delta.Pid)
+		}
+	}
+}
+
+func (c *core) closeObservers() {
+	c.mutexObservers.Lock()
+	defer c.mutexObservers.Unlock()
+	if c.observersClosed {
+		return
+	}
+	c.observersClosed = true
+	for _, ch := range c.observers {
+		close(ch)
+	}
+	c.observers = nil
+}
+
 // RegisterBehavior
 func (c *core) RegisterBehavior(group, name string, behavior gen.ProcessBehavior, data interface{}) error {
 	lib.Log("[%s] CORE registering behavior %q in group %q ", c.nodename, name, group)
@@ -574,6 +1339,26 @@ func (c *core) ProcessInfo(pid etf.Pid) (gen.ProcessInfo, error) {
 	return p.Info(), nil
 }
 
+// ProcessInfoAll
+func (c *core) ProcessInfoAll() []gen.ProcessInfo {
+	c.mutexProcesses.Lock()
+	list := make([]*process, 0, len(c.processes))
+	for _, p := range c.processes {
+		list = append(list, p)
+	}
+	c.mutexProcesses.Unlock()
+
+	snapshot := c.snapshot()
+	info := make([]gen.ProcessInfo, 0, len(list))
+	for _, p := range list {
+		if p.IsAlive() == false {
+			continue
+		}
+		info = append(info, p.infoSnapshot(snapshot))
+	}
+	return info
+}
+
 // ProcessByPid
 func (c *core) ProcessByPid(pid etf.Pid) gen.Process {
 	c.mutexProcesses.Lock()
@@ -597,6 +1382,16 @@ func (c *core) ProcessByAlias(alias etf.Alias) gen.Process {
 	return nil
 }
 
+// ProcessByNameScoped
+func (c *core) ProcessByNameScoped(app string, name string) gen.Process {
+	return c.ProcessByName(scopedName(app, name))
+}
+
+// scopedName returns the name registered within the scope of application
+func scopedName(app string, name string) string {
+	return app + "/" + name
+}
+
 // ProcessByName
 func (c *core) ProcessByName(name string) gen.Process {
 	var pid etf.Pid
@@ -616,6 +1411,23 @@ func (c *core) ProcessByName(name string) gen.Process {
 	return c.ProcessByPid(pid)
 }
 
+// WhereIs
+func (c *core) WhereIs(name string) (etf.Pid, bool) {
+	c.mutexNames.Lock()
+	pid, ok := c.names[name]
+	c.mutexNames.Unlock()
+	if ok || c.registry == nil {
+		return pid, ok
+	}
+
+	// the name could be registered on another node
+	pid, err := c.registry.Resolve(name)
+	if err != nil {
+		return pid, false
+	}
+	return pid, true
+}
+
 // ProcessList
 func (c *core) ProcessList() []gen.Process {
 	list := []gen.Process{}
@@ -634,41 +1446,139 @@ func (c *core) ProcessList() []gen.Process {
 // RouteSendAlias
 //
 
-// RouteSend implements RouteSend method of Router interface
+// RouteSend implements RouteSend method of Router interface. Delivering to the local
+// process never blocks, including the case from == to (sending to itself from the
+// process' callback): if the mailbox is full, the message is dropped according to
+// the overflow policy (see routeSendDeadline) and ErrProcessMailboxFull is returned.
 func (c *core) RouteSend(from etf.Pid, to etf.Pid, message etf.Term) error {
+	if string(to.Node) == c.nodename {
+		// local route. the sender could be a remote process (message came
+		// from the connection) so do not check the sender here.
+		return c.routeSendFrom(from, to, message)
+	}
+	_, err := c.routeSendRemote(from, to, message)
+	return err
+}
+
+// routeSendRemote sends the message to the remote process and returns the connection
+// it was sent to
+func (c *core) routeSendRemote(from etf.Pid, to etf.Pid, message etf.Term) (ConnectionInterface, error) {
 	// do not allow to send from the alien node. Proxy request must be used.
 	if string(from.Node) != c.nodename {
-		return ErrSenderUnknown
+		return nil, ErrSenderUnknown
+	}
+
+	c.mutexProcesses.Lock()
+	p_from, exist := c.processes[from.ID]
+	c.mutexProcesses.Unlock()
+	if !exist {
+		lib.Log("[%s] CORE route message by pid (local) %s failed. Unknown sender", c.nodename, to)
+		return nil, ErrSenderUnknown
+	}
+	if c.validateOnSend {
+		if err := etf.Validate(message); err != nil {
+			return nil, err
+		}
 	}
 
+	connection, err := c.GetConnection(string(to.Node))
+	if err != nil {
+		return nil, err
+	}
+
+	lib.Log("[%s] CORE route message by pid (remote) %s", c.nodename, to)
+	if err := connection.Send(p_from, to, message); err != nil {
+		return nil, err
+	}
+	return connection, nil
+}
+
+// RouteSendWithReceipt implements RouteSendWithReceipt method of Router interface
+func (c *core) RouteSendWithReceipt(from etf.Pid, to etf.Pid, message etf.Term) (etf.Ref, error) {
+	// receipt is delivered to the local sender only
+	if string(from.Node) != c.nodename {
+		return etf.Ref{}, ErrSenderUnknown
+	}
+
+	receipt := gen.MessageDeliveryReceipt{
+		To:     to,
+		Queued: true,
+	}
 	if string(to.Node) == c.nodename {
-		if to.Creation != c.creation {
-			// message is addressed to the previous incarnation of this PID
-			return ErrProcessIncarnation
+		if err := c.routeSendFrom(from, to, message); err != nil {
+			return etf.Ref{}, err
 		}
-		// local route
-		c.mutexProcesses.Lock()
-		p, exist := c.processes[to.ID]
-		c.mutexProcesses.Unlock()
-		if !exist {
-			lib.Log("[%s] CORE route message by pid (local) %s failed. Unknown process", c.nodename, to)
-			return ErrProcessUnknown
+		// message is in the mailbox of the receiver
+		receipt.Ref = c.MakeRef()
+		c.RouteSend(etf.Pid{}, from, receipt)
+		return receipt.Ref, nil
+	}
+
+	// the barrier must wait for the connection the message was sent to. Another
+	// one might be established in the meantime (e.g. on reconnect).
+	connection, err := c.routeSendRemote(from, to, message)
+	if err != nil {
+		return etf.Ref{}, err
+	}
+	receipt.Ref = c.MakeRef()
+
+	// the receipts are sent in batches. the barrier made for the batch covers
+	// all the messages sent before it.
+	c.mutexReceipts.Lock()
+	batch, flushing := c.receipts[connection]
+	c.receipts[connection] = append(batch, pendingReceipt{from: from, receipt: receipt})
+	c.mutexReceipts.Unlock()
+	if !flushing {
+		go c.flushReceipts(connection)
+	}
+	return receipt.Ref, nil
+}
+
+// flushReceipts makes the barrier for the pending receipts of the given connection
+// and sends them. Keeps doing it until there are no pending receipts left.
+func (c *core) flushReceipts(connection ConnectionInterface) {
+	for {
+		c.mutexReceipts.Lock()
+		batch := c.receipts[connection]
+		if len(batch) == 0 {
+			delete(c.receipts, connection)
+			c.mutexReceipts.Unlock()
+			return
 		}
-		lib.Log("[%s] CORE route message by pid (local) %s", c.nodename, to)
-		select {
-		case p.mailBox <- gen.ProcessMailboxMessage{from, message}:
-		default:
-			return fmt.Errorf("WARNING! mailbox of %s is full. dropped message from %s", p.Self(), from)
+		c.receipts[connection] = []pendingReceipt{}
+		c.mutexReceipts.Unlock()
+
+		err := connection.Barrier()
+		if err != nil {
+			lib.Log("[%s] CORE delivery receipts for %d message(s): %s", c.nodename, len(batch), err)
+		}
+		for _, pending := range batch {
+			pending.receipt.Queued = err == nil
+			c.RouteSend(etf.Pid{}, pending.from, pending.receipt)
 		}
-		return nil
+	}
+}
+
+// routeSendRaw routes the pre-encoded message. The message must be encoded with
+// disabled atom cache. For the local process it is decoded and delivered as a regular one
+// unless the process receives the raw messages (see gen.ProcessOptions.RawMessages).
+func (c *core) routeSendRaw(from etf.Pid, to etf.Pid, encoded []byte) error {
+	if string(to.Node) == c.nodename {
+		if p := c.localProcess(to); p != nil && p.rawMessages {
+			return c.routeSendFrom(from, to, gen.MessageRaw{From: from, Data: encoded})
+		}
+		message, _, err := etf.Decode(encoded, []etf.Atom{}, etf.DecodeOptions{})
+		if err != nil {
+			return err
+		}
+		return c.routeSendFrom(from, to, message)
 	}
 
-	// sending to remote node
 	c.mutexProcesses.Lock()
 	p_from, exist := c.processes[from.ID]
 	c.mutexProcesses.Unlock()
-	if !exist {
-		lib.Log("[%s] CORE route message by pid (local) %s failed. Unknown sender", c.nodename, to)
+	if !exist || string(from.Node) != c.nodename {
+		lib.Log("[%s] CORE route raw message by pid (remote) %s failed. Unknown sender", c.nodename, to)
 		return ErrSenderUnknown
 	}
 	connection, err := c.GetConnection(string(to.Node))
@@ -676,30 +1586,152 @@ func (c *core) RouteSend(from etf.Pid, to etf.Pid, message etf.Term) error {
 		return err
 	}
 
-	lib.Log("[%s] CORE route message by pid (remote) %s", c.nodename, to)
-	return connection.Send(p_from, to, message)
+	lib.Log("[%s] CORE route raw message by pid (remote) %s", c.nodename, to)
+	return connection.SendRaw(p_from, to, encoded)
 }
 
-// RouteSendReg implements RouteSendReg method of Router interface
-func (c *core) RouteSendReg(from etf.Pid, to gen.ProcessID, message etf.Term) error {
-	// do not allow to send from the alien node. Proxy request must be used.
-	if string(from.Node) != c.nodename {
-		return ErrSenderUnknown
+// routeSendWithTTL routes the message with the deadline. If the local process is about
+// to receive this message after the deadline it is dropped. The deadline can't be
+// delivered to the remote process, so the remote one gets it as a regular message.
+func (c *core) routeSendWithTTL(from etf.Pid, to etf.Pid, message etf.Term, ttl time.Duration) error {
+	if string(to.Node) != c.nodename {
+		return c.RouteSend(from, to, message)
+	}
+	var deadline time.Time
+	if ttl > 0 {
+		deadline = time.Now().Add(ttl)
+	}
+	return c.routeSendDeadline(from, to, message, deadline)
+}
+
+// routeSendFrom delivers the message to the local process without checking
+// the sender. The value of 'from' might belong to the remote node (inbound
+// messages routed by the connection layer or on behalf of the proxy).
+func (c *core) routeSendFrom(from etf.Pid, to etf.Pid, message etf.Term) error {
+	return c.routeSendDeadline(from, to, message, time.Time{})
+}
+
+// routeSendDeadline puts the message into the mailbox (or the holding buffer of
+// the paused process) without blocking. On overflow, the message is dropped and
+// the OnMailboxFull callback of the receiver is invoked on the sender's goroutine.
+func (c *core) routeSendDeadline(from etf.Pid, to etf.Pid, message etf.Term, deadline time.Time) error {
+	if string(to.Node) != c.nodename {
+		return ErrNoRoute
+	}
+	if to.Creation != c.creation {
+		// message is addressed to the previous incarnation of this PID
+		return ErrProcessIncarnation
+	}
+	c.mutexProcesses.Lock()
+	p, exist := c.processes[to.ID]
+	c.mutexProcesses.Unlock()
+	if !exist {
+		atomic.AddUint64(&c.messagesUndelivered, 1)
+		c.dropLog.log("[%s] CORE route message by pid (local) %s failed. Unknown process", c.nodename, to)
+		return ErrProcessUnknown
+	}
+	lib.Log("[%s] CORE route message by pid (local) %s", c.nodename, to)
+
+	// MessageDown for the monitor created by the sync request (see callByName)
+	// must be delivered as a reply
+	if down, ok := message.(gen.MessageDown); ok && p.isSyncRequest(down.Ref) {
+		return p.PutSyncReply(down.Ref, down)
+	}
+
+	// the process could be terminated after we got it from the process table
+	mailbox := p.mailboxAlive()
+	if mailbox == nil {
+		atomic.AddUint64(&c.messagesUndelivered, 1)
+		c.dropLog.log("[%s] CORE route message by pid (local) %s failed. Process terminated", c.nodename, to)
+		return ErrProcessTerminated
+	}
+
+	mailboxMessage := gen.ProcessMailboxMessage{
+		From:     from,
+		Message:  message,
+		Deadline: deadline,
+	}
+	held, err := p.enqueue(mailbox, mailboxMessage)
+	if err == nil {
+		c.received(p, mailboxMessage)
+		return nil
+	}
+	if held {
+		atomic.AddUint64(&c.messagesDropped, 1)
+		c.dropLog.log("[%s] CORE holding buffer of paused %s is full. dropped message from %s", c.nodename, p.Self(), from)
+		if p.onMailboxFull != nil {
+			p.onMailboxFull(from, message)
+		}
+		return err
+	}
+
+	// the message sent by the process with higher priority waits for the free slot
+	if wait := c.priorityWait(from); wait > 0 {
+		if p.enqueueWait(mailbox, mailboxMessage, wait) == nil {
+			c.received(p, mailboxMessage)
+			return nil
+		}
+	}
+
+	atomic.AddUint64(&c.messagesDropped, 1)
+	c.dropLog.log("[%s] CORE mailbox of %s is full. dropped message from %s", c.nodename, p.Self(), from)
+	if p.onMailboxFull != nil {
+		p.onMailboxFull(from, message)
+	}
+	return ErrProcessMailboxFull
+}
+
+// received is invoked once the message is put into the mailbox (or the holding buffer)
+func (c *core) received(p *process, message gen.ProcessMailboxMessage) {
+	atomic.AddUint64(&c.messagesRouted, 1)
+	c.forwardTaps(p, message.From, message.Message)
+}
+
+// priorityWait returns how long the message sent by the given process may wait for the
+// free slot in the full mailbox
+func (c *core) priorityWait(from etf.Pid) time.Duration {
+	c.mutexProcesses.Lock()
+	sender, exist := c.processes[from.ID]
+	c.mutexProcesses.Unlock()
+	if !exist || sender.self != from {
+		return 0
 	}
+	switch sender.priority {
+	case gen.ProcessPriorityHigh:
+		return priorityHighWait
+	case gen.ProcessPriorityMax:
+		return priorityMaxWait
+	}
+	return 0
+}
+
+// HasRawReceivers
+func (c *core) HasRawReceivers() bool {
+	return atomic.LoadInt64(&c.rawProcesses) > 0
+}
 
+// RouteSendReg implements RouteSendReg method of Router interface
+func (c *core) RouteSendReg(from etf.Pid, to gen.ProcessID, message etf.Term) error {
 	if to.Node == c.nodename {
-		// local route
-		c.mutexNames.Lock()
-		pid, ok := c.names[to.Name]
-		c.mutexNames.Unlock()
+		// local route. the name unknown locally is resolved using
+		// the global registry (if it's enabled)
+		pid, ok := c.WhereIs(to.Name)
 		if !ok {
-			lib.Log("[%s] CORE route message by gen.ProcessID (local) %s failed. Unknown process", c.nodename, to)
+			atomic.AddUint64(&c.messagesUndelivered, 1)
+			c.dropLog.log("[%s] CORE route message by gen.ProcessID (local) %s failed. Unknown process", c.nodename, to)
 			return ErrProcessUnknown
 		}
 		lib.Log("[%s] CORE route message by gen.ProcessID (local) %s", c.nodename, to)
+		// the name of the migrated (or globally registered) process
+		// might point to the remote one
 		return c.RouteSend(from, pid, message)
 	}
 
+	// do not allow to send from the alien node. Proxy request must be used.
+	if string(from.Node) != c.nodename {
+		return ErrSenderUnknown
+	}
+
 	// send to remote node
 	c.mutexProcesses.Lock()
 	p_from, exist := c.processes[from.ID]
@@ -708,6 +1740,12 @@ func (c *core) RouteSendReg(from etf.Pid, to gen.ProcessID, message etf.Term) er
 		lib.Log("[%s] CORE route message by gen.ProcessID (local) %s failed. Unknown sender", c.nodename, to)
 		return ErrSenderUnknown
 	}
+	if c.validateOnSend {
+		if err := etf.Validate(message); err != nil {
+			return err
+		}
+	}
+
 	connection, err := c.GetConnection(string(to.Node))
 	if err != nil {
 		return err
@@ -719,11 +1757,6 @@ func (c *core) RouteSendReg(from etf.Pid, to gen.ProcessID, message etf.Term) er
 
 // RouteSendAlias implements RouteSendAlias method of Router interface
 func (c *core) RouteSendAlias(from etf.Pid, to etf.Alias, message etf.Term) error {
-	// do not allow to send from the alien node. Proxy request must be used.
-	if string(from.Node) != c.nodename {
-		return ErrSenderUnknown
-	}
-
 	lib.Log("[%s] CORE route message by alias %s", c.nodename, to)
 	if string(to.Node) == c.nodename {
 		// local route by alias
@@ -731,10 +1764,16 @@ func (c *core) RouteSendAlias(from etf.Pid, to etf.Alias, message etf.Term) erro
 		process, ok := c.aliases[to]
 		c.mutexAliases.Unlock()
 		if !ok {
-			lib.Log("[%s] CORE route message by alias (local) %s failed. Unknown process", c.nodename, to)
+			atomic.AddUint64(&c.messagesUndelivered, 1)
+			c.dropLog.log("[%s] CORE route message by alias (local) %s failed. Unknown process", c.nodename, to)
 			return ErrProcessUnknown
 		}
-		return c.RouteSend(from, process.self, message)
+		return c.routeSendFrom(from, process.self, message)
+	}
+
+	// do not allow to send from the alien node. Proxy request must be used.
+	if string(from.Node) != c.nodename {
+		return ErrSenderUnknown
 	}
 
 	// send to remote node
@@ -745,6 +1784,12 @@ func (c *core) RouteSendAlias(from etf.Pid, to etf.Alias, message etf.Term) erro
 		lib.Log("[%s] CORE route message by alias (local) %s failed. Unknown sender", c.nodename, to)
 		return ErrSenderUnknown
 	}
+	if c.validateOnSend {
+		if err := etf.Validate(message); err != nil {
+			return err
+		}
+	}
+
 	connection, err := c.GetConnection(string(to.Node))
 	if err != nil {
 		return err
@@ -762,23 +1807,64 @@ func (c *core) RouteProxy() error {
 
 // RouteSpawnRequest
 func (c *core) RouteSpawnRequest(behaviorName string, request gen.RemoteSpawnRequest) (etf.Pid, error) {
-	//rb, err_behavior := n.registrar.RegisteredBehavior(remoteBehaviorGroup, string(module))
-	// FIXME
-	//process_opts := processOptions{}
-	//process_opts.Env = map[string]interface{}{"ergo:RemoteSpawnRequest": remote_request}
+	if c.Maintenance() {
+		return etf.Pid{}, ErrNodeMaintenance
+	}
+	rb, err := c.RegisteredBehavior(remoteBehaviorGroup, behaviorName)
+	if err != nil {
+		return etf.Pid{}, ErrBehaviorUnknown
+	}
 
-	//process, err_spawn := n.registrar.spawn(request.Name, process_opts, rb.Behavior, args...)
-	return etf.Pid{}, nil
+	if err := c.acquireRemoteSpawn(); err != nil {
+		lib.Log("[%s] CORE rejected remote spawn request %q from %s: %s", c.nodename, behaviorName, request.From, err)
+		return etf.Pid{}, err
+	}
+	defer c.releaseRemoteSpawn()
+
+	opts := processOptions{}
+	opts.Env = map[gen.EnvKey]interface{}{
+		gen.EnvKeyRemoteSpawn: request,
+	}
+	process, err := c.spawn(request.Name, opts, rb.Behavior, request.Args...)
+	if err != nil {
+		return etf.Pid{}, err
+	}
+	return process.Self(), nil
 }
 
-// RouteSpawnReply
+// RouteSpawnReply delivers the result of the remote spawn request. The process spawned
+// by the request nobody waits for (canceled, timed out or the requesting process is
+// terminated) is terminated with the reason "abandoned", so it doesn't leak.
 func (c *core) RouteSpawnReply(to etf.Pid, ref etf.Ref, result etf.Term) error {
-	// FIXME
-	//			process := n.registrar.ProcessByPid(to)
-	//			if process == nil {
-	//				return
-	//			}
-	//			//flags := t.Element(4)
-	//			process.PutSyncReply(ref, t.Element(5))
-	return nil
+	if p, ok := c.ProcessByPid(to).(*process); ok && p.putSpawnReply(ref, result) {
+		return nil
+	}
+	spawned, ok := result.(etf.Pid)
+	if !ok {
+		return nil
+	}
+	lib.Log("[%s] CORE remote spawn request %s is abandoned. terminating %s", c.nodename, ref, spawned)
+	return c.RouteExit(spawned, to, "abandoned")
+}
+
+// routeSpawnRequest sends the remote spawn request. The result is delivered
+// with RouteSpawnReply.
+func (c *core) routeSpawnRequest(nodename string, behaviorName string, request gen.RemoteSpawnRequest) error {
+	if nodename == c.nodename {
+		go func() {
+			pid, err := c.RouteSpawnRequest(behaviorName, request)
+			if err != nil {
+				c.RouteSpawnReply(request.From, request.Ref, etf.Atom(err.Error()))
+				return
+			}
+			c.RouteSpawnReply(request.From, request.Ref, pid)
+		}()
+		return nil
+	}
+
+	connection, err := c.GetConnection(nodename)
+	if err != nil {
+		return err
+	}
+	return connection.SpawnRequest(behaviorName, request)
 }
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+// dropLog logs the dropped and undelivered messages. With the sampling enabled every
+// Nth of them is logged (at most rate per second) to keep the log readable under the
+// flood of messages. The sampled messages are logged with LogLevelWarning.
+type dropLog struct {
+	sample int
+	rate   int
+
+	mutex  sync.Mutex
+	count  int
+	second time.Time
+	logged int
+}
+
+func newDropLog(sample int, rate int) *dropLog {
+	return &dropLog{
+		sample: sample,
+		rate:   rate,
+	}
+}
+
+func (d *dropLog) log(f string, a ...interface{}) {
+	if d.sample < 1 {
+		lib.Log(f, a...)
+		return
+	}
+
+	d.mutex.Lock()
+	d.count++
+	if d.count%d.sample != 0 {
+		d.mutex.Unlock()
+		return
+	}
+	if d.rate > 0 {
+		now := time.Now()
+		if now.Sub(d.second) >= time.Second {
+			d.second = now
+			d.logged = 0
+		}
+		if d.logged >= d.rate {
+			d.mutex.Unlock()
+			return
+		}
+		d.logged++
+	}
+	count := d.count
+	d.mutex.Unlock()
+
+	lib.LogWithLevel(lib.LogLevelWarning, f+" (%d in total)", append(a, count)...)
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDropLog(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	lines := func() []string {
+		s := strings.TrimSpace(out.String())
+		out.Reset()
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "\n")
+	}
+
+	// every 3rd message is logged
+	d := newDropLog(3, 0)
+	for i := 0; i < 10; i++ {
+		d.log("[%s] CORE dropped %d", "node", i)
+	}
+	logged := lines()
+	if len(logged) != 3 {
+		t.Fatal("expected 3 messages, got", logged)
+	}
+	for i, l := range logged {
+		n := (i + 1) * 3
+		expected := fmt.Sprintf("CORE dropped %d (%d in total)", n-1, n)
+		if strings.HasSuffix(l, expected) == false {
+			t.Fatalf("expected %q, got %q", expected, l)
+		}
+	}
+
+	// at most 2 messages per second
+	d = newDropLog(1, 2)
+	for i := 0; i < 10; i++ {
+		d.log("[%s] CORE dropped %d", "node", i)
+	}
+	if logged := lines(); len(logged) != 2 {
+		t.Fatal("expected 2 messages, got", logged)
+	}
+	// the next second
+	d.second = d.second.Add(-time.Second)
+	d.log("[%s] CORE dropped %d", "node", 10)
+	if logged := lines(); len(logged) != 1 || strings.HasSuffix(logged[0], "(11 in total)") == false {
+		t.Fatal("expected the message of the next second, got", logged)
+	}
+}
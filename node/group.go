@@ -0,0 +1,498 @@
+package node
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+)
+
+const (
+	// groupsProcessName the name of the process replicating the group membership
+	// across the connected nodes
+	groupsProcessName = "ergo_groups"
+
+	groupsJoin     = etf.Atom("$ergo_groups_join")
+	groupsLeave    = etf.Atom("$ergo_groups_leave")
+	groupsSync     = etf.Atom("$ergo_groups_sync")
+	groupsDiscover = etf.Atom("$ergo_groups_discover")
+)
+
+// groupMember keeps the time of joining (by the clock of the member's node) so every
+// node orders the members the same way and elects the same leader
+type groupMember struct {
+	pid    etf.Pid
+	joined int64
+}
+
+func (m groupMember) less(other groupMember) bool {
+	if m.joined != other.joined {
+		return m.joined < other.joined
+	}
+	if m.pid.Node != other.pid.Node {
+		return m.pid.Node < other.pid.Node
+	}
+	return m.pid.ID < other.pid.ID
+}
+
+// processGroup keeps the members ordered by the time of joining. The first one is
+// the leader, so on leaving the leader the next joined member is promoted.
+type processGroup struct {
+	members     []groupMember
+	subscribers []etf.Pid
+}
+
+func (g *processGroup) leader() etf.Pid {
+	if len(g.members) == 0 {
+		return etf.Pid{}
+	}
+	return g.members[0].pid
+}
+
+func (g *processGroup) add(member groupMember) bool {
+	for i := range g.members {
+		if g.members[i].pid == member.pid {
+			return false
+		}
+	}
+	i := sort.Search(len(g.members), func(i int) bool {
+		return member.less(g.members[i])
+	})
+	g.members = append(g.members, groupMember{})
+	copy(g.members[i+1:], g.members[i:])
+	g.members[i] = member
+	return true
+}
+
+func (g *processGroup) remove(pid etf.Pid) bool {
+	for i := range g.members {
+		if g.members[i].pid == pid {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type groupLeaderChange struct {
+	subscribers []etf.Pid
+	message     gen.MessageGroupLeader
+}
+
+// groups is the process receiving the membership changes from the peers
+type groups struct {
+	gen.Server
+	core coreInternal
+}
+
+// Init
+func (g *groups) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	g.core.groupsStarted(process.ProcessState.Process)
+	return nil
+}
+
+// HandleInfo
+func (g *groups) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	g.core.handleGroupsMessage(message)
+	return gen.ServerStatusOK
+}
+
+// groupsStarted makes the core replicate the group membership using the given process.
+// The nodes connected before it are asked for their members.
+func (c *core) groupsStarted(process gen.Process) {
+	c.mutexGroups.Lock()
+	defer c.mutexGroups.Unlock()
+	c.groupsProcess = process
+	for _, peer := range c.Nodes() {
+		c.sendGroups(peer, etf.Tuple{groupsDiscover, etf.Atom(c.nodename)})
+		c.sendGroups(peer, c.groupsSyncMessage())
+	}
+}
+
+// joinGroup adds the local process to the group and announces it to the connected
+// nodes. The group is created on joining the first member.
+func (c *core) joinGroup(name string, pid etf.Pid) error {
+	if string(pid.Node) != c.nodename || c.ProcessByPid(pid) == nil {
+		return ErrProcessUnknown
+	}
+
+	c.mutexGroups.Lock()
+	group, exist := c.groups[name]
+	if !exist {
+		group = &processGroup{}
+		c.groups[name] = group
+	}
+	// keep the joining time monotonic for the members of this node
+	joined := time.Now().UnixNano()
+	if joined <= c.groupsClock {
+		joined = c.groupsClock + 1
+	}
+	member := groupMember{pid: pid, joined: joined}
+	previous := group.leader()
+	if group.add(member) == false {
+		c.mutexGroups.Unlock()
+		return ErrTaken
+	}
+	c.groupsClock = joined
+	change := c.groupLeaderChanged(name, group, previous)
+	c.broadcastGroups(etf.Tuple{groupsJoin, []byte(name), pid, joined})
+	c.mutexGroups.Unlock()
+
+	lib.Log("[%s] CORE process %s joined group %q", c.nodename, pid, name)
+	c.notifyGroupSubscribers(change)
+	return nil
+}
+
+// leaveGroup removes the local process from the group. The next joined member
+// is promoted if the leaving process was the leader.
+func (c *core) leaveGroup(name string, pid etf.Pid) error {
+	if string(pid.Node) != c.nodename {
+		return ErrProcessUnknown
+	}
+
+	c.mutexGroups.Lock()
+	group, exist := c.groups[name]
+	if !exist {
+		c.mutexGroups.Unlock()
+		return ErrProcessUnknown
+	}
+	previous := group.leader()
+	if group.remove(pid) == false {
+		c.mutexGroups.Unlock()
+		return ErrProcessUnknown
+	}
+	change := c.groupLeaderChanged(name, group, previous)
+	c.cleanGroup(name, group)
+	c.broadcastGroups(etf.Tuple{groupsLeave, []byte(name), pid})
+	c.mutexGroups.Unlock()
+
+	lib.Log("[%s] CORE process %s left group %q", c.nodename, pid, name)
+	c.notifyGroupSubscribers(change)
+	return nil
+}
+
+// groupLeader returns the leader of the group or empty etf.Pid if the group has no members
+func (c *core) groupLeader(name string) etf.Pid {
+	c.mutexGroups.Lock()
+	defer c.mutexGroups.Unlock()
+	group, exist := c.groups[name]
+	if !exist {
+		return etf.Pid{}
+	}
+	return group.leader()
+}
+
+// groupMembers returns the members of the group. The first one is the leader.
+func (c *core) groupMembers(name string) []etf.Pid {
+	c.mutexGroups.Lock()
+	defer c.mutexGroups.Unlock()
+	group, exist := c.groups[name]
+	if !exist {
+		return []etf.Pid{}
+	}
+	members := make([]etf.Pid, len(group.members))
+	for i := range group.members {
+		members[i] = group.members[i].pid
+	}
+	return members
+}
+
+// subscribeGroup makes the local process receive gen.MessageGroupLeader on changing
+// the leader of the group. Subscribing is allowed to the group with no members.
+func (c *core) subscribeGroup(name string, pid etf.Pid) error {
+	if c.ProcessByPid(pid) == nil {
+		return ErrProcessUnknown
+	}
+
+	c.mutexGroups.Lock()
+	defer c.mutexGroups.Unlock()
+	group, exist := c.groups[name]
+	if !exist {
+		group = &processGroup{}
+		c.groups[name] = group
+	}
+	for _, subscriber := range group.subscribers {
+		if subscriber == pid {
+			return ErrTaken
+		}
+	}
+	group.subscribers = append(group.subscribers, pid)
+	return nil
+}
+
+// unsubscribeGroup
+func (c *core) unsubscribeGroup(name string, pid etf.Pid) {
+	c.mutexGroups.Lock()
+	defer c.mutexGroups.Unlock()
+	group, exist := c.groups[name]
+	if !exist {
+		return
+	}
+	for i := range group.subscribers {
+		if group.subscribers[i] == pid {
+			group.subscribers = append(group.subscribers[:i], group.subscribers[i+1:]...)
+			break
+		}
+	}
+	c.cleanGroup(name, group)
+}
+
+// handleGroupsTerminated removes the terminated process (or all the processes of
+// the node that went down) from the groups and their subscribers. Leaving of the
+// local members is announced to the connected nodes.
+func (c *core) handleGroupsTerminated(match func(pid etf.Pid) bool) {
+	changes := []groupLeaderChange{}
+
+	c.mutexGroups.Lock()
+	for name, group := range c.groups {
+		previous := group.leader()
+		members := group.members[:0]
+		for _, member := range group.members {
+			if match(member.pid) {
+				if string(member.pid.Node) == c.nodename {
+					c.broadcastGroups(etf.Tuple{groupsLeave, []byte(name), member.pid})
+				}
+				continue
+			}
+			members = append(members, member)
+		}
+		group.members = members
+
+		subscribers := group.subscribers[:0]
+		for _, subscriber := range group.subscribers {
+			if match(subscriber) {
+				continue
+			}
+			subscribers = append(subscribers, subscriber)
+		}
+		group.subscribers = subscribers
+
+		changes = append(changes, c.groupLeaderChanged(name, group, previous))
+		c.cleanGroup(name, group)
+	}
+	c.mutexGroups.Unlock()
+
+	for _, change := range changes {
+		c.notifyGroupSubscribers(change)
+	}
+}
+
+// handleGroupsMessage applies the membership changes received from the peer.
+// The peers announce their own members only.
+func (c *core) handleGroupsMessage(message etf.Term) {
+	m, ok := message.(etf.Tuple)
+	if !ok || len(m) < 2 {
+		return
+	}
+
+	changes := []groupLeaderChange{}
+	c.mutexGroups.Lock()
+	switch m[0] {
+	case groupsJoin:
+		if len(m) != 4 {
+			break
+		}
+		name, ok1 := groupName(m[1])
+		pid, ok2 := m[2].(etf.Pid)
+		joined, ok3 := groupJoined(m[3])
+		if !ok1 || !ok2 || !ok3 || string(pid.Node) == c.nodename {
+			break
+		}
+		group, exist := c.groups[name]
+		if !exist {
+			group = &processGroup{}
+			c.groups[name] = group
+		}
+		previous := group.leader()
+		group.add(groupMember{pid: pid, joined: joined})
+		changes = append(changes, c.groupLeaderChanged(name, group, previous))
+
+	case groupsLeave:
+		if len(m) != 3 {
+			break
+		}
+		name, ok1 := groupName(m[1])
+		pid, ok2 := m[2].(etf.Pid)
+		if !ok1 || !ok2 || string(pid.Node) == c.nodename {
+			break
+		}
+		group, exist := c.groups[name]
+		if !exist {
+			break
+		}
+		previous := group.leader()
+		group.remove(pid)
+		changes = append(changes, c.groupLeaderChanged(name, group, previous))
+		c.cleanGroup(name, group)
+
+	case groupsSync:
+		// the peer's members replace the ones known before
+		if len(m) != 3 {
+			break
+		}
+		peer, ok1 := m[1].(etf.Atom)
+		list, ok2 := m[2].(etf.List)
+		if !ok1 || !ok2 || string(peer) == c.nodename {
+			break
+		}
+		synced := make(map[string][]groupMember)
+		for _, item := range list {
+			t, ok := item.(etf.Tuple)
+			if !ok || len(t) != 3 {
+				continue
+			}
+			name, ok1 := groupName(t[0])
+			pid, ok2 := t[1].(etf.Pid)
+			joined, ok3 := groupJoined(t[2])
+			if !ok1 || !ok2 || !ok3 || pid.Node != peer {
+				continue
+			}
+			synced[name] = append(synced[name], groupMember{pid: pid, joined: joined})
+		}
+		for name := range synced {
+			if _, exist := c.groups[name]; !exist {
+				c.groups[name] = &processGroup{}
+			}
+		}
+		for name, group := range c.groups {
+			previous := group.leader()
+			members := group.members[:0]
+			for _, member := range group.members {
+				if member.pid.Node == peer {
+					continue
+				}
+				members = append(members, member)
+			}
+			group.members = members
+			for _, member := range synced[name] {
+				group.add(member)
+			}
+			changes = append(changes, c.groupLeaderChanged(name, group, previous))
+			c.cleanGroup(name, group)
+		}
+
+	case groupsDiscover:
+		if peer, ok := m[1].(etf.Atom); ok {
+			c.sendGroups(string(peer), c.groupsSyncMessage())
+		}
+	}
+	c.mutexGroups.Unlock()
+
+	for _, change := range changes {
+		c.notifyGroupSubscribers(change)
+	}
+}
+
+// RouteNodeUp sends the members of this node to the connected peer
+func (c *core) RouteNodeUp(name string) {
+	c.mutexGroups.Lock()
+	defer c.mutexGroups.Unlock()
+	c.sendGroups(name, c.groupsSyncMessage())
+}
+
+// groupsSyncMessage must be called under the mutexGroups
+func (c *core) groupsSyncMessage() etf.Tuple {
+	list := etf.List{}
+	for name, group := range c.groups {
+		for _, member := range group.members {
+			if string(member.pid.Node) != c.nodename {
+				continue
+			}
+			list = append(list, etf.Tuple{[]byte(name), member.pid, member.joined})
+		}
+	}
+	return etf.Tuple{groupsSync, etf.Atom(c.nodename), list}
+}
+
+// broadcastGroups must be called under the mutexGroups to keep the order
+// of the membership changes
+func (c *core) broadcastGroups(message etf.Tuple) {
+	for _, peer := range c.Nodes() {
+		c.sendGroups(peer, message)
+	}
+}
+
+// sendGroups must be called under the mutexGroups
+func (c *core) sendGroups(peer string, message etf.Tuple) {
+	if c.groupsProcess == nil {
+		// not started yet. the members are synced on starting
+		return
+	}
+	connection, err := c.Connection(peer)
+	if err != nil {
+		return
+	}
+	to := gen.ProcessID{Name: groupsProcessName, Node: peer}
+	if err := connection.SendReg(c.groupsProcess, to, message); err != nil {
+		lib.Log("[%s] CORE can't send the groups update to %s: %s", c.nodename, peer, err)
+	}
+}
+
+func groupName(term etf.Term) (string, bool) {
+	switch name := term.(type) {
+	case []byte:
+		return string(name), true
+	case string:
+		return name, true
+	}
+	return "", false
+}
+
+func groupJoined(term etf.Term) (int64, bool) {
+	switch joined := term.(type) {
+	case int64:
+		return joined, true
+	case int:
+		return int64(joined), true
+	case *big.Int:
+		// large values are decoded as *big.Int
+		if joined.IsInt64() {
+			return joined.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+// groupLeaderChanged must be called under the mutexGroups
+func (c *core) groupLeaderChanged(name string, group *processGroup, previous etf.Pid) groupLeaderChange {
+	leader := group.leader()
+	if leader == previous {
+		return groupLeaderChange{}
+	}
+	lib.Log("[%s] CORE group %q leader changed %s -> %s", c.nodename, name, previous, leader)
+	subscribers := make([]etf.Pid, len(group.subscribers))
+	copy(subscribers, group.subscribers)
+	return groupLeaderChange{
+		subscribers: subscribers,
+		message: gen.MessageGroupLeader{
+			Group:    name,
+			Leader:   leader,
+			Previous: previous,
+		},
+	}
+}
+
+// cleanGroup must be called under the mutexGroups
+func (c *core) cleanGroup(name string, group *processGroup) {
+	if len(group.members) == 0 && len(group.subscribers) == 0 {
+		delete(c.groups, name)
+	}
+}
+
+func (c *core) notifyGroupSubscribers(change groupLeaderChange) {
+	for _, subscriber := range change.subscribers {
+		c.RouteSend(etf.Pid{}, subscriber, change.message)
+	}
+}
+
+// RouteNodeDown makes the monitors handle the node down and removes the processes
+// of this node from the groups
+func (c *core) RouteNodeDown(name string) {
+	c.monitorInternal.RouteNodeDown(name)
+	c.handleGroupsTerminated(func(pid etf.Pid) bool {
+		return string(pid.Node) == name
+	})
+}
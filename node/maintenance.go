@@ -0,0 +1,31 @@
+package node
+
+import (
+	"github.com/ergo-services/ergo/lib"
+)
+
+// SetMaintenance enables/disables the maintenance mode and advertises it using
+// the resolver if it implements ResolverMaintenance
+func (n *network) SetMaintenance(enable bool) error {
+	n.mutexMaintenance.Lock()
+	defer n.mutexMaintenance.Unlock()
+
+	if n.maintenance == enable {
+		return nil
+	}
+	if rm, ok := n.resolver.(ResolverMaintenance); ok {
+		if err := rm.SetMaintenance(enable); err != nil {
+			return err
+		}
+	}
+	n.maintenance = enable
+	lib.Log("[%s] NETWORK maintenance mode: %v", n.nodename, enable)
+	return nil
+}
+
+// Maintenance
+func (n *network) Maintenance() bool {
+	n.mutexMaintenance.Lock()
+	defer n.mutexMaintenance.Unlock()
+	return n.maintenance
+}
@@ -0,0 +1,79 @@
+package node
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+)
+
+const (
+	// DefaultMetricsInterval
+	DefaultMetricsInterval = 10 * time.Second
+
+	metricsScheduleName = "ergo:metrics"
+)
+
+// metrics returns the snapshot of the node metrics
+func (c *core) metrics() NodeMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	c.mutexProcesses.Lock()
+	processes := len(c.processes)
+	c.mutexProcesses.Unlock()
+	c.mutexNames.Lock()
+	names := len(c.names)
+	c.mutexNames.Unlock()
+
+	return NodeMetrics{
+		Time:                time.Now(),
+		Uptime:              c.coreUptimeDuration(),
+		Processes:           processes,
+		Names:               names,
+		MessagesRouted:      atomic.LoadUint64(&c.messagesRouted),
+		MessagesDropped:     atomic.LoadUint64(&c.messagesDropped),
+		MessagesUndelivered: atomic.LoadUint64(&c.messagesUndelivered),
+		Nodes:               c.Nodes(),
+		Network:             c.NetworkStats(),
+		Goroutines:          runtime.NumGoroutine(),
+		HeapAlloc:           mem.HeapAlloc,
+		NumGC:               mem.NumGC,
+		GCPauseTotal:        time.Duration(mem.PauseTotalNs),
+	}
+}
+
+// startMetrics schedules pushing the metrics to the sink function and/or the local
+// process registered with the given name
+func (c *core) startMetrics(sink func(NodeMetrics), sinkName string, interval time.Duration) error {
+	if sink == nil && sinkName == "" {
+		return nil
+	}
+	if interval == 0 {
+		interval = DefaultMetricsInterval
+	}
+
+	previous := c.metrics()
+	push := func() {
+		metrics := c.metrics()
+		if elapsed := metrics.Time.Sub(previous.Time).Seconds(); elapsed > 0 {
+			routed := metrics.MessagesRouted - previous.MessagesRouted
+			metrics.RoutedPerSecond = float64(routed) / elapsed
+		}
+		previous = metrics
+
+		if sink != nil {
+			sink(metrics)
+		}
+		if sinkName != "" {
+			to := gen.ProcessID{Name: sinkName, Node: c.nodename}
+			if err := c.RouteSendReg(etf.Pid{}, to, metrics); err != nil {
+				lib.Log("[%s] CORE can't push metrics to %q: %s", c.nodename, sinkName, err)
+			}
+		}
+	}
+	return c.scheduleInterval(metricsScheduleName, interval, push)
+}
@@ -23,6 +23,8 @@ type monitorInternal interface {
 	RouteUnlink(pidA etf.Pid, pidB etf.Pid) error
 	// RouteExit
 	RouteExit(to etf.Pid, terminated etf.Pid, reason string) error
+	// RouteKill
+	RouteKill(to etf.Pid) error
 	// RouteMonitorReg
 	RouteMonitorReg(by etf.Pid, process gen.ProcessID, ref etf.Ref) error
 	// RouteMonitor
@@ -39,15 +41,34 @@ type monitorInternal interface {
 	// IsMonitor
 	IsMonitor(ref etf.Ref) bool
 
+	monitorMulti(by etf.Pid, targets []etf.Pid, refs []etf.Ref)
+	demonitorMulti(refs []etf.Ref)
+
 	monitorNode(by etf.Pid, node string, ref etf.Ref)
 	demonitorNode(ref etf.Ref) bool
 
-	handleTerminated(terminated etf.Pid, name, reason string)
+	handleTerminated(terminated etf.Pid, name, reason string, err error)
+
+	stickyLink(by etf.Pid, name string) error
+	stickyUnlink(by etf.Pid, name string)
+	handleNameRegistered(name string, pid etf.Pid)
 
 	processLinks(process etf.Pid) []etf.Pid
 	processMonitors(process etf.Pid) []etf.Pid
 	processMonitorsByName(process etf.Pid) []gen.ProcessID
+	processMonitorsExt(process etf.Pid) []gen.MonitorInfo
 	processMonitoredBy(process etf.Pid) []etf.Pid
+	snapshot() monitorSnapshot
+	allMonitors() []gen.MonitorRecord
+	allLinks() []gen.LinkRecord
+}
+
+// monitorSnapshot keeps the links and monitors of all the processes (see ProcessInfoAll)
+type monitorSnapshot struct {
+	links          map[etf.Pid][]etf.Pid
+	monitors       map[etf.Pid][]etf.Pid
+	monitorsByName map[etf.Pid][]gen.ProcessID
+	monitoredBy    map[etf.Pid][]etf.Pid
 }
 
 type monitor struct {
@@ -64,6 +85,10 @@ type monitor struct {
 	links      map[etf.Pid][]etf.Pid
 	mutexLinks sync.Mutex
 
+	// sticky links by name
+	stickyLinks      map[string][]etf.Pid
+	mutexStickyLinks sync.Mutex
+
 	// monitors of nodes
 	nodes      map[string][]monitorItem
 	ref2node   map[etf.Ref]string
@@ -80,6 +105,8 @@ func newMonitor(nodename string, router CoreRouter) monitorInternal {
 		links:     make(map[etf.Pid][]etf.Pid),
 		nodes:     make(map[string][]monitorItem),
 
+		stickyLinks: make(map[string][]etf.Pid),
+
 		ref2pid:  make(map[etf.Ref]etf.Pid),
 		ref2name: make(map[etf.Ref]gen.ProcessID),
 		ref2node: make(map[etf.Ref]string),
@@ -226,7 +253,9 @@ func (m *monitor) RouteNodeDown(name string) {
 	m.mutexLinks.Unlock()
 }
 
-func (m *monitor) handleTerminated(terminated etf.Pid, name string, reason string) {
+// handleTerminated notifies the monitors and links of the terminated process. The error
+// (if any) is passed to the local ones only.
+func (m *monitor) handleTerminated(terminated etf.Pid, name string, reason string, err error) {
 	lib.Log("[%s] MONITOR process terminated: %v", m.nodename, terminated)
 
 	// if terminated process had a name we should make shure to clean up them all
@@ -236,7 +265,7 @@ func (m *monitor) handleTerminated(terminated etf.Pid, name string, reason strin
 		if items, ok := m.names[terminatedProcessID]; ok {
 			for i := range items {
 				lib.Log("[%s] MONITOR process terminated: %s. send notify to: %s", m.nodename, terminatedProcessID, items[i].pid)
-				m.RouteMonitorExitReg(items[i].pid, terminatedProcessID, reason, items[i].ref)
+				m.routeMonitorExitReg(items[i].pid, terminatedProcessID, reason, err, items[i].ref)
 				delete(m.ref2name, items[i].ref)
 			}
 			delete(m.names, terminatedProcessID)
@@ -249,18 +278,25 @@ func (m *monitor) handleTerminated(terminated etf.Pid, name string, reason strin
 
 		for i := range items {
 			lib.Log("[%s] MONITOR process terminated: %s. send notify to: %s", m.nodename, terminated, items[i].pid)
-			m.RouteMonitorExit(items[i].pid, terminated, reason, items[i].ref)
+			m.routeMonitorExit(items[i].pid, terminated, reason, err, items[i].ref)
 			delete(m.ref2pid, items[i].ref)
 		}
 		delete(m.processes, terminated)
 	}
 	m.mutexProcesses.Unlock()
 
+	// the linked processes get 'killed' for the killed process, so the exit signal
+	// they get is trappable unlike the one sent with RouteKill
+	linkReason := reason
+	if reason == "kill" {
+		linkReason = "killed"
+	}
+
 	m.mutexLinks.Lock()
 	if pidLinks, ok := m.links[terminated]; ok {
 		for i := range pidLinks {
 			lib.Log("[%s] LINK process exited: %s. send notify to: %s", m.nodename, terminated, pidLinks[i])
-			m.RouteExit(pidLinks[i], terminated, reason)
+			m.routeExit(pidLinks[i], terminated, linkReason, err)
 
 			// remove A link
 			pids, ok := m.links[pidLinks[i]]
@@ -285,8 +321,85 @@ func (m *monitor) handleTerminated(terminated etf.Pid, name string, reason strin
 		// remove link
 		delete(m.links, terminated)
 	}
-	defer m.mutexLinks.Unlock()
+	m.mutexLinks.Unlock()
 
+	// remove sticky links made by the terminated process
+	m.mutexStickyLinks.Lock()
+	for stickyName, pids := range m.stickyLinks {
+		for i := range pids {
+			if pids[i] != terminated {
+				continue
+			}
+			pids[i] = pids[0]
+			pids = pids[1:]
+			break
+		}
+		if len(pids) > 0 {
+			m.stickyLinks[stickyName] = pids
+		} else {
+			delete(m.stickyLinks, stickyName)
+		}
+	}
+	m.mutexStickyLinks.Unlock()
+}
+
+// stickyLink creates a link with the process registered with the given name
+// and keeps linking with the new process every time this name is registered.
+func (m *monitor) stickyLink(by etf.Pid, name string) error {
+	lib.Log("[%s] LINK sticky: %v => %s", m.nodename, by, name)
+
+	m.mutexStickyLinks.Lock()
+	pids := m.stickyLinks[name]
+	for i := range pids {
+		if pids[i] == by {
+			m.mutexStickyLinks.Unlock()
+			return fmt.Errorf("Already linked")
+		}
+	}
+	m.stickyLinks[name] = append(pids, by)
+	m.mutexStickyLinks.Unlock()
+
+	p := m.router.ProcessByName(name)
+	if p == nil {
+		// will be linked once this name is registered
+		return nil
+	}
+	return m.RouteLink(by, p.Self())
+}
+
+func (m *monitor) stickyUnlink(by etf.Pid, name string) {
+	m.mutexStickyLinks.Lock()
+	pids := m.stickyLinks[name]
+	for i := range pids {
+		if pids[i] != by {
+			continue
+		}
+		pids[i] = pids[0]
+		pids = pids[1:]
+		if len(pids) > 0 {
+			m.stickyLinks[name] = pids
+		} else {
+			delete(m.stickyLinks, name)
+		}
+		break
+	}
+	m.mutexStickyLinks.Unlock()
+
+	if p := m.router.ProcessByName(name); p != nil {
+		m.RouteUnlink(by, p.Self())
+	}
+}
+
+func (m *monitor) handleNameRegistered(name string, pid etf.Pid) {
+	m.mutexStickyLinks.Lock()
+	pids := make([]etf.Pid, len(m.stickyLinks[name]))
+	copy(pids, m.stickyLinks[name])
+	m.mutexStickyLinks.Unlock()
+
+	for i := range pids {
+		lib.Log("[%s] LINK sticky relink: %v => %s (%v)", m.nodename, pids[i], name, pid)
+		m.RouteLink(pids[i], pid)
+	}
 }
 
 func (m *monitor) processLinks(process etf.Pid) []etf.Pid {
@@ -329,6 +442,46 @@ func (m *monitor) processMonitorsByName(process etf.Pid) []gen.ProcessID {
 	return monitors
 }
 
+func (m *monitor) processMonitorsExt(process etf.Pid) []gen.MonitorInfo {
+	monitors := []gen.MonitorInfo{}
+
+	m.mutexProcesses.Lock()
+	for pid, by := range m.processes {
+		for b := range by {
+			if by[b].pid != process {
+				continue
+			}
+			info := gen.MonitorInfo{
+				Ref:      by[b].ref,
+				Pid:      pid,
+				Node:     string(pid.Node),
+				IsRemote: string(pid.Node) != m.nodename,
+			}
+			monitors = append(monitors, info)
+		}
+	}
+	m.mutexProcesses.Unlock()
+
+	m.mutexNames.Lock()
+	for processID, by := range m.names {
+		for b := range by {
+			if by[b].pid != process {
+				continue
+			}
+			info := gen.MonitorInfo{
+				Ref:       by[b].ref,
+				ProcessID: processID,
+				Node:      processID.Node,
+				IsRemote:  processID.Node != m.nodename,
+			}
+			monitors = append(monitors, info)
+		}
+	}
+	m.mutexNames.Unlock()
+
+	return monitors
+}
+
 func (m *monitor) processMonitoredBy(process etf.Pid) []etf.Pid {
 	monitors := []etf.Pid{}
 	m.mutexProcesses.Lock()
@@ -342,6 +495,110 @@ func (m *monitor) processMonitoredBy(process etf.Pid) []etf.Pid {
 	return monitors
 }
 
+// snapshot collects the links and monitors of all the processes taking every lock once
+func (m *monitor) snapshot() monitorSnapshot {
+	s := monitorSnapshot{
+		links:          make(map[etf.Pid][]etf.Pid),
+		monitors:       make(map[etf.Pid][]etf.Pid),
+		monitorsByName: make(map[etf.Pid][]gen.ProcessID),
+		monitoredBy:    make(map[etf.Pid][]etf.Pid),
+	}
+
+	m.mutexLinks.Lock()
+	for pid, links := range m.links {
+		s.links[pid] = links
+	}
+	m.mutexLinks.Unlock()
+
+	m.mutexProcesses.Lock()
+	for pid, by := range m.processes {
+		for b := range by {
+			s.monitors[by[b].pid] = append(s.monitors[by[b].pid], pid)
+			s.monitoredBy[pid] = append(s.monitoredBy[pid], by[b].pid)
+		}
+	}
+	m.mutexProcesses.Unlock()
+
+	m.mutexNames.Lock()
+	for processID, by := range m.names {
+		for b := range by {
+			s.monitorsByName[by[b].pid] = append(s.monitorsByName[by[b].pid], processID)
+		}
+	}
+	m.mutexNames.Unlock()
+	return s
+}
+
+// allMonitors returns the monitors of all the processes. The locks are taken together
+// so the result is consistent.
+func (m *monitor) allMonitors() []gen.MonitorRecord {
+	records := []gen.MonitorRecord{}
+
+	m.mutexProcesses.Lock()
+	defer m.mutexProcesses.Unlock()
+	m.mutexNames.Lock()
+	defer m.mutexNames.Unlock()
+	m.mutexNodes.Lock()
+	defer m.mutexNodes.Unlock()
+
+	for pid, by := range m.processes {
+		for b := range by {
+			records = append(records, gen.MonitorRecord{
+				Ref:      by[b].ref,
+				By:       by[b].pid,
+				Pid:      pid,
+				Node:     string(pid.Node),
+				IsRemote: string(pid.Node) != m.nodename || string(by[b].pid.Node) != m.nodename,
+			})
+		}
+	}
+	for processID, by := range m.names {
+		for b := range by {
+			records = append(records, gen.MonitorRecord{
+				Ref:       by[b].ref,
+				By:        by[b].pid,
+				ProcessID: processID,
+				Node:      processID.Node,
+				IsRemote:  processID.Node != m.nodename || string(by[b].pid.Node) != m.nodename,
+			})
+		}
+	}
+	for node, by := range m.nodes {
+		for b := range by {
+			records = append(records, gen.MonitorRecord{
+				Ref:      by[b].ref,
+				By:       by[b].pid,
+				Node:     node,
+				IsRemote: true,
+			})
+		}
+	}
+	return records
+}
+
+// allLinks returns the links of all the processes. Every link is listed once.
+func (m *monitor) allLinks() []gen.LinkRecord {
+	records := []gen.LinkRecord{}
+	seen := make(map[[2]etf.Pid]bool)
+
+	m.mutexLinks.Lock()
+	defer m.mutexLinks.Unlock()
+	for pidA, links := range m.links {
+		for _, pidB := range links {
+			if seen[[2]etf.Pid{pidB, pidA}] {
+				continue
+			}
+			seen[[2]etf.Pid{pidA, pidB}] = true
+			records = append(records, gen.LinkRecord{
+				A:        pidA,
+				B:        pidB,
+				IsRemote: string(pidA.Node) != m.nodename || string(pidB.Node) != m.nodename,
+			})
+		}
+	}
+	return records
+}
+
 func (m *monitor) IsMonitor(ref etf.Ref) bool {
 	m.mutexProcesses.Lock()
 	defer m.mutexProcesses.Unlock()
@@ -488,6 +745,10 @@ func (m *monitor) RouteUnlink(pidA etf.Pid, pidB etf.Pid) error {
 }
 
 func (m *monitor) RouteExit(to etf.Pid, terminated etf.Pid, reason string) error {
+	return m.routeExit(to, terminated, reason, nil)
+}
+
+func (m *monitor) routeExit(to etf.Pid, terminated etf.Pid, reason string, err error) error {
 	// for remote: {3, FromPid, ToPid, Reason}
 	if to.Node != etf.Atom(m.nodename) {
 		if reason == "noconnection" {
@@ -501,13 +762,28 @@ func (m *monitor) RouteExit(to etf.Pid, terminated etf.Pid, reason string) error
 	}
 
 	// check if 'to' process is still alive
-	if p := m.router.ProcessByPid(to); p != nil {
-		p.Exit(reason)
+	if p, ok := m.router.ProcessByPid(to).(*process); ok {
+		p.exit(terminated, reason, err)
 		return nil
 	}
 	return ErrProcessUnknown
 }
 
+// RouteKill sends exit signal with reason 'kill' to the local process. This signal
+// can not be trapped, so the process is terminated even if it traps exits.
+func (m *monitor) RouteKill(to etf.Pid) error {
+	if to.Node != etf.Atom(m.nodename) {
+		return ErrUnsupported
+	}
+	p := m.router.ProcessByPid(to)
+	if p == nil {
+		return ErrProcessUnknown
+	}
+	lib.Log("[%s] KILL process %s", m.nodename, to)
+	p.Kill()
+	return nil
+}
+
 func (m *monitor) RouteMonitor(by etf.Pid, pid etf.Pid, ref etf.Ref) error {
 	lib.Log("[%s] MONITOR process: %s => %s", m.nodename, by, pid)
 
@@ -663,7 +939,107 @@ func (m *monitor) RouteDemonitor(by etf.Pid, ref etf.Ref) error {
 	return nil
 }
 
+// monitorMulti creates monitors on the given targets using the given refs (one per target).
+// Remote targets are grouped by node in order to get the connection once per node.
+func (m *monitor) monitorMulti(by etf.Pid, targets []etf.Pid, refs []etf.Ref) {
+	remote := make(map[string][]int)
+	items := make(map[etf.Pid][]monitorItem)
+
+	for i := range targets {
+		if string(targets[i].Node) != m.nodename {
+			node := string(targets[i].Node)
+			remote[node] = append(remote[node], i)
+			continue
+		}
+		if p := m.router.ProcessByPid(targets[i]); p == nil {
+			m.RouteMonitorExit(by, targets[i], "noproc", refs[i])
+			continue
+		}
+		items[targets[i]] = append(items[targets[i]], monitorItem{pid: by, ref: refs[i]})
+	}
+
+	for node, group := range remote {
+		lib.Log("[%s] MONITOR %d processes on %s by %s", m.nodename, len(group), node, by)
+		connection, err := m.router.GetConnection(node)
+		if err != nil {
+			for _, i := range group {
+				m.RouteMonitorExit(by, targets[i], "noconnection", refs[i])
+			}
+			continue
+		}
+		for _, i := range group {
+			if err := connection.Monitor(by, targets[i], refs[i]); err != nil {
+				m.RouteMonitorExit(by, targets[i], "noconnection", refs[i])
+				continue
+			}
+			items[targets[i]] = append(items[targets[i]], monitorItem{pid: by, ref: refs[i]})
+		}
+	}
+
+	m.mutexProcesses.Lock()
+	for pid, l := range items {
+		m.processes[pid] = append(m.processes[pid], l...)
+		for i := range l {
+			m.ref2pid[l[i].ref] = pid
+		}
+	}
+	m.mutexProcesses.Unlock()
+}
+
+// demonitorMulti removes monitors (by pid) with the given refs. Unknown refs are ignored.
+func (m *monitor) demonitorMulti(refs []etf.Ref) {
+	type demonitorItem struct {
+		by  etf.Pid
+		pid etf.Pid
+		ref etf.Ref
+	}
+	remote := make(map[string][]demonitorItem)
+
+	m.mutexProcesses.Lock()
+	for _, ref := range refs {
+		pid, ok := m.ref2pid[ref]
+		if !ok {
+			continue
+		}
+		delete(m.ref2pid, ref)
+
+		items := m.processes[pid]
+		for i := range items {
+			if items[i].ref != ref {
+				continue
+			}
+			if string(pid.Node) != m.nodename {
+				item := demonitorItem{by: items[i].pid, pid: pid, ref: ref}
+				remote[string(pid.Node)] = append(remote[string(pid.Node)], item)
+			}
+			items[i] = items[0]
+			items = items[1:]
+			break
+		}
+		if len(items) == 0 {
+			delete(m.processes, pid)
+		} else {
+			m.processes[pid] = items
+		}
+	}
+	m.mutexProcesses.Unlock()
+
+	for node, group := range remote {
+		connection, err := m.router.GetConnection(node)
+		if err != nil {
+			continue
+		}
+		for _, item := range group {
+			connection.Demonitor(item.by, item.pid, item.ref)
+		}
+	}
+}
+
 func (m *monitor) RouteMonitorExit(to etf.Pid, terminated etf.Pid, reason string, ref etf.Ref) error {
+	return m.routeMonitorExit(to, terminated, reason, nil, ref)
+}
+
+func (m *monitor) routeMonitorExit(to etf.Pid, terminated etf.Pid, reason string, err error, ref etf.Ref) error {
 	if string(to.Node) != m.nodename {
 		// remote
 		if reason == "noconnection" {
@@ -684,11 +1060,16 @@ func (m *monitor) RouteMonitorExit(to etf.Pid, terminated etf.Pid, reason string
 		Ref:    ref,
 		Pid:    terminated,
 		Reason: reason,
+		Err:    err,
 	}
 	return m.router.RouteSend(terminated, to, down)
 }
 
 func (m *monitor) RouteMonitorExitReg(to etf.Pid, terminated gen.ProcessID, reason string, ref etf.Ref) error {
+	return m.routeMonitorExitReg(to, terminated, reason, nil, ref)
+}
+
+func (m *monitor) routeMonitorExitReg(to etf.Pid, terminated gen.ProcessID, reason string, err error, ref etf.Ref) error {
 	if string(to.Node) != m.nodename {
 		// remote
 		if reason == "noconnection" {
@@ -709,6 +1090,7 @@ func (m *monitor) RouteMonitorExitReg(to etf.Pid, terminated gen.ProcessID, reas
 		Ref:       ref,
 		ProcessID: terminated,
 		Reason:    reason,
+		Err:       err,
 	}
 	return m.router.RouteSendReg(to, terminated, down)
 }
@@ -1,11 +1,14 @@
 package node
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"crypto/ecdsa"
@@ -23,7 +26,6 @@ import (
 	"net"
 
 	"strconv"
-	"strings"
 )
 
 type networkInternal interface {
@@ -31,23 +33,75 @@ type networkInternal interface {
 	RemoveStaticRoute(name string) bool
 	StaticRoutes() []Route
 	Connect(peername string) error
+	ConnectConn(peername string, c net.Conn, options RouteOptions) error
+	AcceptConn(c net.Conn, options RouteOptions) (string, error)
 	Nodes() []string
+	NetworkStats() NetworkStats
 
 	GetConnection(peername string) (ConnectionInterface, error)
+	Connection(peername string) (ConnectionInterface, error)
+	PeerSupports(peername string, feature gen.Feature) (bool, error)
+	Barrier(peername string) error
 
+	SetCluster(nodes []string, quorum int) error
+	ClusterReady() bool
+	SubscribeCluster(pid etf.Pid) error
+	UnsubscribeCluster(pid etf.Pid)
+
+	SetMaintenance(enable bool) error
+	Maintenance() bool
+	Relisten(port uint16) error
+
+	acquireRemoteSpawn() error
+	releaseRemoteSpawn()
 	connect(to string) (ConnectionInterface, error)
 	stopNetwork()
 }
 
+type listener struct {
+	net.Listener
+	port      uint16
+	host      string
+	spec      ListenerSpec
+	tls       *TLS
+	handshake HandshakeInterface
+	// stop makes the accepting loop exit on closing the listener
+	stop context.CancelFunc
+}
+
+func (l *listener) Close() error {
+	if l.stop != nil {
+		l.stop()
+	}
+	return l.Listener.Close()
+}
+
+// socketListener applies the socket options to the accepted connections
+type socketListener struct {
+	net.Listener
+	network *network
+}
+
+func (sl *socketListener) Accept() (net.Conn, error) {
+	c, err := sl.Listener.Accept()
+	if err == nil {
+		sl.network.setSocketOptions(c, RouteOptions{})
+	}
+	return c, err
+}
+
 type connectionInternal struct {
 	conn       net.Conn
 	connection ConnectionInterface
 }
 
 type network struct {
-	nodename string
-	ctx      context.Context
-	listener net.Listener
+	nodename       string
+	ctx            context.Context
+	listeners      []*listener
+	mutexListeners sync.Mutex
+	// relistenGracePeriod how long the previous listener is kept open (see Relisten)
+	relistenGracePeriod time.Duration
 
 	resolver          Resolver
 	staticOnly        bool
@@ -56,14 +110,54 @@ type network struct {
 
 	connections      map[string]connectionInternal
 	mutexConnections sync.Mutex
+	maxConnections   int
+
+	reconnects      map[string]*ReconnectState
+	mutexReconnects sync.Mutex
+
+	cluster      cluster
+	mutexCluster sync.Mutex
+
+	maintenance      bool
+	mutexMaintenance sync.Mutex
+
+	handshakeStats      HandshakeStats
+	mutexHandshakeStats sync.Mutex
+
+	stringAsBinary bool
+	flowControl    bool
+	timeEncoding   etf.TimeEncoding
+
+	compressionDictionary []byte
+	middleware            []MessageMiddleware
+	atomCacheSize         int
+	atomCachePreload      []etf.Atom
+
+	// dial makes the outgoing connections to the peers
+	dial           DialFunc
+	dialTimeout    time.Duration
+	resolveTimeout time.Duration
+
+	tcpNoDelay     TCPNoDelay
+	tcpReadBuffer  int
+	tcpWriteBuffer int
 
 	remoteSpawn      map[string]gen.ProcessBehavior
 	remoteSpawnMutex sync.Mutex
-
-	tls      TLS
+	// remoteSpawnSlots limits the number of the remote spawn requests handled
+	// simultaneously. nil if it's unlimited
+	remoteSpawnSlots    chan struct{}
+	remoteSpawnWait     time.Duration
+	remoteSpawnInFlight int64
+
+	// TLS settings for the outgoing connections
+	tls      *TLS
 	version  Version
 	creation uint32
 
+	// tlsVerifyPeer checks the client certificate of the accepted connection
+	tlsVerifyPeer func(peername string, cert *x509.Certificate) error
+
 	router    CoreRouter
 	handshake HandshakeInterface
 	proto     ProtoInterface
@@ -76,42 +170,116 @@ func newNetwork(ctx context.Context, nodename string, options Options, router Co
 		staticOnly:   options.StaticRoutesOnly,
 		staticRoutes: make(map[string]Route),
 		connections:  make(map[string]connectionInternal),
+		reconnects:   make(map[string]*ReconnectState),
 		remoteSpawn:  make(map[string]gen.ProcessBehavior),
 		resolver:     options.Resolver,
-		handshake:    options.Handshake,
 		proto:        options.Proto,
 		router:       router,
 		creation:     options.Creation,
-	}
 
-	nn := strings.Split(nodename, "@")
-	if len(nn) != 2 {
-		return nil, fmt.Errorf("(EMPD) FQDN for node name is required (example: node@hostname)")
-	}
+		remoteSpawnWait:     options.RemoteSpawnWait,
+		relistenGracePeriod: options.RelistenGracePeriod,
 
-	n.version, _ = options.Env[EnvKeyVersion].(Version)
+		tlsVerifyPeer:  options.TLSVerifyPeer,
+		maxConnections: options.MaxConnections,
+		stringAsBinary: options.EncodeStringAsBinary,
+		flowControl:    options.FlowControl,
+		timeEncoding:   options.EncodeTime,
 
-	if err := n.loadTLS(options); err != nil {
-		return nil, err
+		compressionDictionary: options.CompressionDictionary,
+		middleware:            options.Middleware,
+		atomCacheSize:         options.AtomCacheSize,
+		atomCachePreload:      options.AtomCachePreload,
+
+		dial:           options.Dialer,
+		dialTimeout:    options.DialTimeout,
+		resolveTimeout: options.ResolveTimeout,
+
+		tcpNoDelay:     options.TCPNoDelay,
+		tcpReadBuffer:  options.TCPReadBuffer,
+		tcpWriteBuffer: options.TCPWriteBuffer,
+	}
+	if n.dial == nil {
+		dialer := &net.Dialer{}
+		n.dial = dialer.DialContext
+	}
+	if n.dialTimeout == 0 {
+		n.dialTimeout = defaultDialTimeout
+	}
+	if n.resolveTimeout == 0 {
+		n.resolveTimeout = defaultResolveTimeout
+	}
+	if n.relistenGracePeriod == 0 {
+		n.relistenGracePeriod = defaultRelistenGracePeriod
+	}
+	if options.RemoteSpawnConcurrency > 0 {
+		n.remoteSpawnSlots = make(chan struct{}, options.RemoteSpawnConcurrency)
 	}
 
-	err := n.handshake.Init(n.nodename, n.creation)
+	nn, err := etf.ParseNodeName(nodename)
 	if err != nil {
 		return nil, err
 	}
 
-	port, err := n.listen(ctx, nn[1], options)
-	if err != nil {
-		return nil, err
+	n.version, _ = options.Env[EnvKeyVersion].(Version)
+
+	n.tls = &TLS{}
+	resolverListeners := []ResolverListener{}
+	for i, spec := range options.Listeners {
+		l := &listener{
+			handshake: spec.Handshake,
+			spec:      spec,
+		}
+		if l.tls, err = n.loadTLS(spec, options); err != nil {
+			n.stopNetwork()
+			return nil, err
+		}
+		if err := l.handshake.Init(n.nodename, n.creation); err != nil {
+			n.stopNetwork()
+			return nil, err
+		}
+		host := spec.Host
+		if host == "" {
+			host = nn.Host
+		}
+		if err := n.listen(ctx, host, spec, l); err != nil {
+			n.stopNetwork()
+			return nil, err
+		}
+		n.listeners = append(n.listeners, l)
+
+		if i == 0 {
+			// the primary listener
+			n.handshake = l.handshake
+		}
+		if n.tls.Enabled == false && l.tls.Enabled {
+			// outgoing connections use the TLS settings of the first
+			// listener with enabled TLS
+			n.tls = l.tls
+		}
+		resolverListeners = append(resolverListeners, ResolverListener{
+			Port:             l.port,
+			HandshakeVersion: l.handshake.Version(),
+			EnabledTLS:       l.tls.Enabled,
+		})
+	}
+
+	if n.resolver == nil {
+		// static routes only
+		return n, nil
 	}
 
+	primary := n.listeners[0]
 	resolverOptions := ResolverOptions{
 		NodeVersion:      n.version,
-		HandshakeVersion: n.handshake.Version(),
-		EnabledTLS:       n.tls.Enabled,
+		HandshakeVersion: primary.handshake.Version(),
+		EnabledTLS:       primary.tls.Enabled,
 		EnabledProxy:     options.ProxyMode != ProxyModeDisabled,
+		Listeners:        resolverListeners,
+		Aliases:          options.Aliases,
 	}
-	if err := n.resolver.Register(nodename, port, resolverOptions); err != nil {
+	if err := n.resolver.Register(nodename, primary.port, resolverOptions); err != nil {
+		n.stopNetwork()
 		return nil, err
 	}
 
@@ -119,23 +287,36 @@ func newNetwork(ctx context.Context, nodename string, options Options, router Co
 }
 
 func (n *network) stopNetwork() {
-	if n.listener != nil {
-		n.listener.Close()
+	n.mutexListeners.Lock()
+	for _, l := range n.listeners {
+		l.Close()
 	}
+	n.mutexListeners.Unlock()
+	// close the connections to let the peers know this node is down
+	n.mutexConnections.Lock()
+	for _, ci := range n.connections {
+		ci.conn.Close()
+	}
+	n.mutexConnections.Unlock()
 }
 
 // AddStaticRoute adds a static route to the node with the given name
 func (n *network) AddStaticRoute(name string, port uint16, options RouteOptions) error {
-	ns := strings.Split(name, "@")
-	if len(ns) != 2 {
-		return fmt.Errorf("wrong FQDN")
+	nn, err := etf.ParseNodeName(name)
+	if err != nil {
+		return err
 	}
-	if _, err := net.LookupHost(ns[1]); err != nil {
+	ctx, cancel := context.WithTimeout(n.ctx, n.resolveTimeout)
+	_, err = net.DefaultResolver.LookupHost(ctx, nn.Host)
+	cancel()
+	if err != nil {
 		return err
 	}
 
 	route := Route{
-		Name:         name,
+		NodeName:     name,
+		Name:         nn.Name,
+		Host:         nn.Host,
 		Port:         port,
 		RouteOptions: options,
 	}
@@ -186,21 +367,103 @@ func (n *network) GetConnection(peername string) (ConnectionInterface, error) {
 		return connectionInternal.connection, nil
 	}
 
+	if route, exist := n.staticRoute(peername); exist && route.ManualConnect {
+		lib.Log("[%s] CORE node %q is not connected (static route with ManualConnect)", n.nodename, peername)
+		return nil, ErrNoRoute
+	}
+
 	connection, err := n.connect(peername)
 	if err != nil {
 		lib.Log("[%s] CORE no route to node %q: %s", n.nodename, peername, err)
+		if err == ErrTooManyConnections {
+			return nil, err
+		}
 		return nil, ErrNoRoute
 	}
 
 	return connection, nil
 }
 
+// Connection returns the established connection to the given node. Unlike
+// GetConnection, it doesn't try to connect to the node.
+func (n *network) Connection(peername string) (ConnectionInterface, error) {
+	n.mutexConnections.Lock()
+	defer n.mutexConnections.Unlock()
+
+	connectionInternal, ok := n.connections[peername]
+	if !ok {
+		return nil, ErrNoRoute
+	}
+	return connectionInternal.connection, nil
+}
+
+// PeerSupports
+func (n *network) PeerSupports(peername string, feature gen.Feature) (bool, error) {
+	connection, err := n.Connection(peername)
+	if err != nil {
+		return false, err
+	}
+
+	flags := connection.Flags()
+	switch feature {
+	case gen.FeatureFragmentation:
+		return flags.EnableFragmentation, nil
+	case gen.FeatureBigCreation:
+		return flags.EnableBigCreation, nil
+	case gen.FeatureBigPidRef:
+		return flags.EnableBigPidRef, nil
+	case gen.FeatureHeaderAtomCache:
+		return flags.DisableHeaderAtomCache == false, nil
+	case gen.FeatureStringAsBinary:
+		return flags.EnableStringAsBinary, nil
+	case gen.FeatureFlowControl:
+		return flags.EnableFlowControl, nil
+	case gen.FeatureCompression:
+		return flags.EnableCompression, nil
+	}
+
+	// proxy is not supported by the connections yet
+	return false, nil
+}
+
+// Barrier
+func (n *network) Barrier(peername string) error {
+	connection, err := n.Connection(peername)
+	if err != nil {
+		return err
+	}
+	return connection.Barrier()
+}
+
 // Connect
 func (n *network) Connect(peername string) error {
-	_, err := n.GetConnection(peername)
+	if _, err := n.Connection(peername); err == nil {
+		// already connected
+		return nil
+	}
+	_, err := n.connect(peername)
 	return err
 }
 
+func (n *network) staticRoute(peername string) (Route, bool) {
+	n.staticRoutesMutex.Lock()
+	defer n.staticRoutesMutex.Unlock()
+	route, exist := n.staticRoutes[peername]
+	return route, exist
+}
+
+// resolve returns the static route for the given node if it was added with
+// AddStaticRoute. Otherwise, uses the resolver.
+func (n *network) resolve(peername string) (Route, error) {
+	if route, exist := n.staticRoute(peername); exist {
+		return route, nil
+	}
+	if n.staticOnly || n.resolver == nil {
+		return Route{}, ErrNoRoute
+	}
+	return n.resolver.Resolve(peername)
+}
+
 // Nodes
 func (n *network) Nodes() []string {
 	list := []string{}
@@ -213,114 +476,270 @@ func (n *network) Nodes() []string {
 	return list
 }
 
-func (n *network) loadTLS(options Options) error {
-	switch options.TLSMode {
+// NetworkStats
+func (n *network) NetworkStats() NetworkStats {
+	n.mutexConnections.Lock()
+	stats := NetworkStats{
+		Connections:    len(n.connections),
+		MaxConnections: n.maxConnections,
+		Reconnecting:   make(map[string]ReconnectState),
+	}
+	n.mutexConnections.Unlock()
+
+	n.mutexHandshakeStats.Lock()
+	stats.Handshakes = n.handshakeStats
+	n.mutexHandshakeStats.Unlock()
+
+	stats.RemoteSpawnInFlight = int(atomic.LoadInt64(&n.remoteSpawnInFlight))
+	stats.RemoteSpawnConcurrency = cap(n.remoteSpawnSlots)
+
+	n.mutexReconnects.Lock()
+	defer n.mutexReconnects.Unlock()
+	for peername, state := range n.reconnects {
+		stats.Reconnecting[peername] = *state
+	}
+	return stats
+}
+
+// acquireRemoteSpawn takes the slot for handling the remote spawn request. Returns
+// ErrRemoteSpawnBusy if there is no free slot within the Options.RemoteSpawnWait
+func (n *network) acquireRemoteSpawn() error {
+	if n.remoteSpawnSlots != nil {
+		select {
+		case n.remoteSpawnSlots <- struct{}{}:
+		default:
+			if n.remoteSpawnWait == 0 {
+				return ErrRemoteSpawnBusy
+			}
+			timer := time.NewTimer(n.remoteSpawnWait)
+			defer timer.Stop()
+			select {
+			case n.remoteSpawnSlots <- struct{}{}:
+			case <-timer.C:
+				return ErrRemoteSpawnBusy
+			case <-n.ctx.Done():
+				return ErrRemoteSpawnBusy
+			}
+		}
+	}
+	atomic.AddInt64(&n.remoteSpawnInFlight, 1)
+	return nil
+}
+
+// releaseRemoteSpawn
+func (n *network) releaseRemoteSpawn() {
+	atomic.AddInt64(&n.remoteSpawnInFlight, -1)
+	if n.remoteSpawnSlots != nil {
+		<-n.remoteSpawnSlots
+	}
+}
+
+// countHandshake updates the handshake counters with the result of the handshake
+func (n *network) countHandshake(err error) {
+	n.mutexHandshakeStats.Lock()
+	defer n.mutexHandshakeStats.Unlock()
+
+	n.handshakeStats.Attempts++
+	switch {
+	case err == nil:
+		n.handshakeStats.Successes++
+	case errors.Is(err, ErrHandshakeCookie):
+		n.handshakeStats.FailuresCookie++
+	case errors.Is(err, ErrHandshakeTLS):
+		n.handshakeStats.FailuresTLS++
+	case errors.Is(err, ErrHandshakeVersion):
+		n.handshakeStats.FailuresVersion++
+	case errors.Is(err, ErrHandshakeTimeout):
+		n.handshakeStats.FailuresTimeout++
+	default:
+		n.handshakeStats.FailuresOther++
+	}
+}
+
+func (n *network) isConnectionsLimitReached() bool {
+	if n.maxConnections == 0 {
+		return false
+	}
+	n.mutexConnections.Lock()
+	defer n.mutexConnections.Unlock()
+	return len(n.connections) >= n.maxConnections
+}
+
+// startTLS checks whether the peer starts TLS handshake and upgrades the accepted
+// connection to TLS. Otherwise, returns the connection as is (plaintext). The peer
+// must send the first byte within the TLS handshake timeout, so the silent one
+// doesn't block the accepting of the other connections.
+func (n *network) startTLS(c net.Conn, config *tls.Config) (net.Conn, bool, error) {
+	pc := &peekConn{
+		Conn:   c,
+		reader: bufio.NewReader(c),
+	}
+	c.SetReadDeadline(time.Now().Add(defaultTLSHandshakeTimeout))
+	b, err := pc.reader.Peek(1)
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		return pc, false, err
+	}
+	// TLS record type 'handshake' (ClientHello). Handshake messages of the plaintext
+	// connection start with the 2 bytes length header.
+	if b[0] != 0x16 {
+		lib.Log("[%s] Accepted plaintext connection from %s", n.nodename, c.RemoteAddr())
+		return pc, false, nil
+	}
+	lib.Log("[%s] Upgrading connection from %s to TLS", n.nodename, c.RemoteAddr())
+	return tls.Server(pc, config), true, nil
+}
+
+func (n *network) loadTLS(spec ListenerSpec, options Options) (*TLS, error) {
+	t := &TLS{}
+	switch spec.TLSMode {
 	case TLSModeAuto:
 		cert, err := generateSelfSignedCert(n.version)
 		if err != nil {
-			return fmt.Errorf("Can't generate certificate: %s\n", err)
+			return nil, fmt.Errorf("Can't generate certificate: %s\n", err)
 		}
 
-		n.tls.Server = cert
-		n.tls.Client = cert
-		n.tls.Mode = TLSModeAuto
-		n.tls.Enabled = true
-		n.tls.Config = tls.Config{
+		t.Server = cert
+		t.Client = cert
+		t.Mode = TLSModeAuto
+		t.Enabled = true
+		t.Config = tls.Config{
 			Certificates:       []tls.Certificate{cert},
 			InsecureSkipVerify: true,
 		}
 
 	case TLSModeStrict:
-		certServer, err := tls.LoadX509KeyPair(options.TLSCrtServer, options.TLSKeyServer)
+		certServer, err := tls.LoadX509KeyPair(spec.TLSCrtServer, spec.TLSKeyServer)
 		if err != nil {
-			return fmt.Errorf("Can't load server certificate: %s\n", err)
+			return nil, fmt.Errorf("Can't load server certificate: %s\n", err)
 		}
-		certClient, err := tls.LoadX509KeyPair(options.TLSCrtClient, options.TLSKeyClient)
+		certClient, err := tls.LoadX509KeyPair(spec.TLSCrtClient, spec.TLSKeyClient)
 		if err != nil {
-			return fmt.Errorf("Can't load client certificate: %s\n", err)
+			return nil, fmt.Errorf("Can't load client certificate: %s\n", err)
 		}
 
-		n.tls.Server = certServer
-		n.tls.Client = certClient
-		n.tls.Mode = TLSModeStrict
-		n.tls.Enabled = true
-		n.tls.Config = tls.Config{
+		t.Server = certServer
+		t.Client = certClient
+		t.Mode = TLSModeStrict
+		t.Enabled = true
+		t.Config = tls.Config{
 			Certificates: []tls.Certificate{certServer},
 			ServerName:   "localhost",
 		}
 	}
-	return nil
+	t.StartTLS = t.Enabled && spec.TLSStartTLS
+
+	if t.Enabled && options.TLSVerifyPeer != nil {
+		t.Config.ClientAuth = tls.RequireAndVerifyClientCert
+		t.Config.ClientCAs = options.TLSClientCAs
+	}
+
+	if t.Enabled && options.TLSSessionResumption {
+		// the same config is used for the accepting and dialing connections,
+		// so the session cache is shared by all the outgoing connections
+		size := options.TLSSessionCacheSize
+		if size == 0 {
+			size = defaultTLSSessionCacheSize
+		}
+		t.Config.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+		t.Config.SessionTicketsDisabled = false
+	}
+	return t, nil
 }
 
-func (n *network) listen(ctx context.Context, hostname string, options Options) (uint16, error) {
+func (n *network) listen(ctx context.Context, hostname string, spec ListenerSpec, l *listener) error {
 
 	lc := net.ListenConfig{}
-	for port := options.ListenBegin; port <= options.ListenEnd; port++ {
+	for port := spec.ListenBegin; port <= spec.ListenEnd; port++ {
 		hostPort := net.JoinHostPort(hostname, strconv.Itoa(int(port)))
 		listener, err := lc.Listen(ctx, "tcp", hostPort)
 		if err != nil {
 			continue
 		}
-		if n.tls.Enabled {
-			listener = tls.NewListener(listener, &n.tls.Config)
+		listener = &socketListener{Listener: listener, network: n}
+		if l.tls.Enabled && l.tls.StartTLS == false {
+			listener = tls.NewListener(listener, &l.tls.Config)
 		}
-		n.listener = listener
+		l.Listener = listener
+		l.port = port
+		l.host = hostname
+		lctx, stop := context.WithCancel(ctx)
+		l.stop = stop
 
 		go func() {
 			for {
 				c, err := listener.Accept()
-				lib.Log("[%s] Accepted new connection from %s", n.nodename, c.RemoteAddr().String())
-
 				if err != nil {
-					if ctx.Err() == nil {
+					if lctx.Err() == nil {
 						continue
 					}
 					lib.Log(err.Error())
 					return
 				}
+				lib.Log("[%s] Accepted new connection from %s", n.nodename, c.RemoteAddr().String())
 
-				peername, protoOptions, err := n.handshake.Accept(c, n.tls.Enabled)
-				if err != nil {
-					lib.Log("[%s] Can't handshake with %s: %s", n.nodename, c.RemoteAddr().String(), err)
-					c.Close()
-					continue
-				}
-				connection, err := n.proto.Init(c, peername, protoOptions, n.router)
-				if err != nil {
+				if n.isConnectionsLimitReached() {
+					lib.Log("[%s] Refused connection from %s: reached the limit of connections (%d)",
+						n.nodename, c.RemoteAddr().String(), n.maxConnections)
 					c.Close()
 					continue
 				}
 
-				cInternal := connectionInternal{
-					conn:       c,
-					connection: connection,
-				}
-
-				if _, err := n.registerConnection(peername, cInternal); err != nil {
-					// Race condition:
-					// There must be another goroutine which already created and registered
-					// connection to this node.
-					// Close this connection and use the already registered connection
+				if n.Maintenance() {
+					lib.Log("[%s] Refused connection from %s: maintenance mode",
+						n.nodename, c.RemoteAddr().String())
 					c.Close()
 					continue
 				}
 
-				// run serving connection
-				go func(ctx context.Context, ci connectionInternal) {
-					n.proto.Serve(ctx, ci.connection)
-					n.unregisterConnection(peername)
-					ci.conn.Close()
-				}(ctx, cInternal)
-
+				go n.handleAccepted(c, l)
 			}
 		}()
 
-		// return port number this node listenig on for the incoming connections
-		return port, nil
+		return nil
 	}
 
 	// all ports within a given range are taken
-	return 0, fmt.Errorf("Can't start listener. Port range is taken")
+	return fmt.Errorf("Can't start listener. Port range %d...%d is taken", spec.ListenBegin, spec.ListenEnd)
+}
+
+// handleAccepted detects TLS (see ListenerSpec.TLSStartTLS), completes the TLS
+// handshake and makes the handshake with the peer. It runs on its own goroutine, so
+// the slow or silent peer doesn't block accepting the other connections.
+func (n *network) handleAccepted(c net.Conn, l *listener) {
+	enabledTLS := l.tls.Enabled
+	if l.tls.Enabled && l.tls.StartTLS {
+		var err error
+		c, enabledTLS, err = n.startTLS(c, &l.tls.Config)
+		if err != nil {
+			lib.Log("[%s] Can't detect TLS for the connection from %s: %s",
+				n.nodename, c.RemoteAddr().String(), err)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				err = fmt.Errorf("%w: %s", ErrHandshakeTimeout, err)
+			}
+			n.countHandshake(err)
+			c.Close()
+			return
+		}
+	}
+
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		// complete TLS handshake explicitly to distinguish its failures
+		tlsConn.SetDeadline(time.Now().Add(defaultTLSHandshakeTimeout))
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		if err != nil {
+			lib.Log("[%s] TLS handshake with %s failed: %s", n.nodename, c.RemoteAddr().String(), err)
+			n.countHandshake(fmt.Errorf("%w: %s", ErrHandshakeTLS, err))
+			c.Close()
+			return
+		}
+	}
+
+	options := RouteOptions{
+		Handshake: l.handshake,
+	}
+	n.acceptConn(c, enabledTLS, options)
 }
 
 func (n *network) connect(peername string) (ConnectionInterface, error) {
@@ -329,80 +748,192 @@ func (n *network) connect(peername string) (ConnectionInterface, error) {
 	var err error
 	var enabledTLS bool
 
+	if peername == n.nodename {
+		return nil, ErrSelfConnect
+	}
+
+	if n.isConnectionsLimitReached() {
+		return nil, ErrTooManyConnections
+	}
+
 	// resolve the route
-	route, err = n.resolver.Resolve(peername)
+	route, err = n.resolve(peername)
 	if err != nil {
 		return nil, err
 	}
+	if route.Maintenance {
+		// the peer doesn't accept new connections
+		return nil, ErrNodeMaintenance
+	}
+
+	if route.IsErgo && route.EnabledTLS == false && n.tls.Enabled {
+		// prefer the TLS listener of the peer if it has any (e.g. the cluster
+		// is migrating to TLS, see Options.Listeners)
+		for _, l := range route.Listeners {
+			if l.EnabledTLS {
+				route.Port = l.Port
+				route.EnabledTLS = true
+				break
+			}
+		}
+	}
 
 	HostPort := net.JoinHostPort(route.Host, strconv.Itoa(int(route.Port)))
 
+	var tlsConfig *tls.Config
 	if route.IsErgo == true {
 		// rely on the route TLS settings if they were defined
 		if route.EnabledTLS {
-			if route.TLSConfig == nil {
+			tlsConfig = route.TLSConfig
+			if tlsConfig == nil {
 				// use the local TLS settings
-				tlsdialer := tls.Dialer{
-					Config: &n.tls.Config,
-				}
-				c, err = tlsdialer.DialContext(n.ctx, "tcp", HostPort)
-			} else {
-				// use the route TLS settings
-				tlsdialer := tls.Dialer{
-					Config: route.TLSConfig,
-				}
-				c, err = tlsdialer.DialContext(n.ctx, "tcp", HostPort)
+				tlsConfig = &n.tls.Config
 			}
-			enabledTLS = true
-
-		} else {
-			// TLS disabled on a remote node
-			dialer := net.Dialer{}
-			c, err = dialer.DialContext(n.ctx, "tcp", HostPort)
 		}
-
 	} else {
 		// rely on the local TLS settings
 		if n.tls.Enabled {
-			tlsdialer := tls.Dialer{
-				Config: &n.tls.Config,
-			}
-			c, err = tlsdialer.DialContext(n.ctx, "tcp", HostPort)
-			enabledTLS = true
-
-		} else {
-			dialer := net.Dialer{}
-			c, err = dialer.DialContext(n.ctx, "tcp", HostPort)
-
+			tlsConfig = &n.tls.Config
 		}
 	}
 
+	ctx, cancel := context.WithTimeout(n.ctx, n.dialTimeout)
+	c, err = n.dial(ctx, "tcp", HostPort)
+	cancel()
 	// check if we couldn't establish a connection with the node
 	if err != nil {
 		return nil, err
 	}
+	n.setSocketOptions(c, route.RouteOptions)
+
+	if tlsConfig != nil {
+		if tlsConfig.ServerName == "" {
+			// the same way tls.Dialer does
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = route.Host
+		}
+		tlsConn := tls.Client(c, tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(defaultTLSHandshakeTimeout))
+		err = tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		if err != nil {
+			c.Close()
+			err = fmt.Errorf("%w: %s", ErrHandshakeTLS, err)
+			n.countHandshake(err)
+			return nil, err
+		}
+		c = tlsConn
+		enabledTLS = true
+	}
+
+	return n.connectConn(peername, c, enabledTLS, route.RouteOptions)
+}
+
+// protoMiddleware returns the middleware chain for the connection: the node's
+// middleware followed by the route's one
+func (n *network) protoMiddleware(options RouteOptions) []MessageMiddleware {
+	middleware := make([]MessageMiddleware, 0, len(n.middleware)+len(options.Middleware))
+	middleware = append(middleware, n.middleware...)
+	return append(middleware, options.Middleware...)
+}
+
+// ConnectConn
+func (n *network) ConnectConn(peername string, c net.Conn, options RouteOptions) error {
+	if _, err := n.Connection(peername); err == nil {
+		c.Close()
+		return ErrTaken
+	}
+	if peername == n.nodename {
+		c.Close()
+		return ErrSelfConnect
+	}
+	if n.isConnectionsLimitReached() {
+		c.Close()
+		return ErrTooManyConnections
+	}
+	n.setSocketOptions(c, options)
+	_, enabledTLS := c.(*tls.Conn)
+	_, err := n.connectConn(peername, c, enabledTLS, options)
+	return err
+}
+
+// setSocketOptions applies the TCP options to the connection. The route options
+// override the node ones. Non-TCP connections (e.g. TLS or tunnels) are left as is.
+func (n *network) setSocketOptions(c net.Conn, options RouteOptions) {
+	tcp, ok := c.(*net.TCPConn)
+	if !ok {
+		return
+	}
 
+	noDelay := n.tcpNoDelay
+	if options.TCPNoDelay != TCPNoDelayDefault {
+		noDelay = options.TCPNoDelay
+	}
+	switch noDelay {
+	case TCPNoDelayEnable:
+		tcp.SetNoDelay(true)
+	case TCPNoDelayDisable:
+		tcp.SetNoDelay(false)
+	}
+
+	readBuffer := n.tcpReadBuffer
+	if options.TCPReadBuffer > 0 {
+		readBuffer = options.TCPReadBuffer
+	}
+	if readBuffer > 0 {
+		if err := tcp.SetReadBuffer(readBuffer); err != nil {
+			lib.Log("[%s] NETWORK can't set read buffer: %s", n.nodename, err)
+		}
+	}
+	writeBuffer := n.tcpWriteBuffer
+	if options.TCPWriteBuffer > 0 {
+		writeBuffer = options.TCPWriteBuffer
+	}
+	if writeBuffer > 0 {
+		if err := tcp.SetWriteBuffer(writeBuffer); err != nil {
+			lib.Log("[%s] NETWORK can't set write buffer: %s", n.nodename, err)
+		}
+	}
+}
+
+// connectConn makes the handshake over the established connection with the peer,
+// registers it and starts serving. The connection is closed on failure.
+func (n *network) connectConn(peername string, c net.Conn, enabledTLS bool, options RouteOptions) (ConnectionInterface, error) {
 	// handshake
-	handshake := route.Handshake
+	handshake := options.Handshake
 	if handshake == nil {
-		//	// use default handshake
+		// use default handshake
 		handshake = n.handshake
 	}
 
-	protoOptions, err := n.handshake.Start(c, enabledTLS)
+	protoOptions, err := handshake.Start(c, enabledTLS)
+	n.countHandshake(err)
 	if err != nil {
 		c.Close()
 		return nil, err
 	}
 
 	// proto
-	proto := route.Proto
+	proto := options.Proto
 	if proto == nil {
 		// use default proto
 		proto = n.proto
 	}
 
-	connection, err := n.proto.Init(c, peername, protoOptions, n.router)
+	if n.stringAsBinary {
+		protoOptions.Flags.EnableStringAsBinary = true
+	}
+	// the handshake enables the flow control if the peer supports it
+	protoOptions.Flags.EnableFlowControl = n.flowControl && protoOptions.Flags.EnableFlowControl
+	protoOptions.TimeEncoding = n.timeEncoding
+	protoOptions.CompressionDictionary = n.compressionDictionary
+	protoOptions.AtomCacheSize = n.atomCacheSize
+	protoOptions.AtomCachePreload = n.atomCachePreload
+	if options.CompressionDictionary != nil {
+		protoOptions.CompressionDictionary = options.CompressionDictionary
+	}
+	protoOptions.Middleware = n.protoMiddleware(options)
+	connection, err := proto.Init(c, peername, protoOptions, n.router)
 	if err != nil {
 		c.Close()
 		return nil, err
@@ -413,6 +944,10 @@ func (n *network) connect(peername string) (ConnectionInterface, error) {
 	}
 
 	if registered, err := n.registerConnection(peername, cInternal); err != nil {
+		if err != ErrTaken {
+			c.Close()
+			return nil, err
+		}
 		// Race condition:
 		// There must be another goroutine which already created and registered
 		// connection to this node.
@@ -423,7 +958,7 @@ func (n *network) connect(peername string) (ConnectionInterface, error) {
 
 	// run serving connection
 	go func(ctx context.Context, ci connectionInternal) {
-		n.proto.Serve(ctx, ci.connection)
+		proto.Serve(ctx, ci.connection)
 		n.unregisterConnection(peername)
 		ci.conn.Close()
 	}(n.ctx, cInternal)
@@ -431,16 +966,132 @@ func (n *network) connect(peername string) (ConnectionInterface, error) {
 	return connection, nil
 }
 
+// AcceptConn
+func (n *network) AcceptConn(c net.Conn, options RouteOptions) (string, error) {
+	if n.isConnectionsLimitReached() {
+		c.Close()
+		return "", ErrTooManyConnections
+	}
+	if n.Maintenance() {
+		c.Close()
+		return "", ErrNodeMaintenance
+	}
+	n.setSocketOptions(c, options)
+	_, enabledTLS := c.(*tls.Conn)
+	return n.acceptConn(c, enabledTLS, options)
+}
+
+// acceptConn accepts the handshake started by the peer over the given connection,
+// registers it and starts serving. The connection is closed on failure.
+func (n *network) acceptConn(c net.Conn, enabledTLS bool, options RouteOptions) (string, error) {
+	handshake := options.Handshake
+	if handshake == nil {
+		handshake = n.handshake
+	}
+	peername, protoOptions, err := handshake.Accept(c, enabledTLS)
+	if err == nil && peername == n.nodename {
+		// custom handshake implementation may not check it
+		err = ErrSelfConnect
+	}
+	if err == nil && n.tlsVerifyPeer != nil {
+		err = n.verifyPeer(c, peername)
+	}
+	n.countHandshake(err)
+	if err != nil {
+		lib.Log("[%s] Can't handshake with %s: %s", n.nodename, c.RemoteAddr().String(), err)
+		c.Close()
+		return "", err
+	}
+
+	proto := options.Proto
+	if proto == nil {
+		proto = n.proto
+	}
+
+	if n.stringAsBinary {
+		protoOptions.Flags.EnableStringAsBinary = true
+	}
+	// the handshake enables the flow control if the peer supports it
+	protoOptions.Flags.EnableFlowControl = n.flowControl && protoOptions.Flags.EnableFlowControl
+	protoOptions.TimeEncoding = n.timeEncoding
+	protoOptions.CompressionDictionary = n.compressionDictionary
+	protoOptions.AtomCacheSize = n.atomCacheSize
+	protoOptions.AtomCachePreload = n.atomCachePreload
+	if options.CompressionDictionary != nil {
+		protoOptions.CompressionDictionary = options.CompressionDictionary
+	}
+	protoOptions.Middleware = n.protoMiddleware(options)
+	connection, err := proto.Init(c, peername, protoOptions, n.router)
+	if err != nil {
+		c.Close()
+		return "", err
+	}
+
+	cInternal := connectionInternal{
+		conn:       c,
+		connection: connection,
+	}
+
+	if _, err := n.registerConnection(peername, cInternal); err != nil {
+		if err == ErrTooManyConnections {
+			lib.Log("[%s] Refused connection from %s: reached the limit of connections (%d)",
+				n.nodename, peername, n.maxConnections)
+		}
+		// Race condition:
+		// There must be another goroutine which already created and registered
+		// connection to this node.
+		// Close this connection and use the already registered connection
+		c.Close()
+		return "", err
+	}
+
+	// run serving connection
+	go func(ctx context.Context, ci connectionInternal) {
+		proto.Serve(ctx, ci.connection)
+		n.unregisterConnection(peername)
+		ci.conn.Close()
+	}(n.ctx, cInternal)
+
+	return peername, nil
+}
+
+// verifyPeer checks the client certificate of the accepted connection against the node
+// name the peer has introduced itself with (see Options.TLSVerifyPeer)
+func (n *network) verifyPeer(c net.Conn, peername string) error {
+	var cert *x509.Certificate
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			cert = certs[0]
+		}
+	}
+	if err := n.tlsVerifyPeer(peername, cert); err != nil {
+		return fmt.Errorf("%w: peer certificate is rejected: %s", ErrHandshakeTLS, err)
+	}
+	return nil
+}
+
 func (n *network) registerConnection(peername string, ci connectionInternal) (connectionInternal, error) {
 	lib.Log("[%s] NETWORK registering peer %#v", n.nodename, peername)
 	n.mutexConnections.Lock()
-	defer n.mutexConnections.Unlock()
-
+	if n.ctx.Err() != nil {
+		// node is stopped
+		n.mutexConnections.Unlock()
+		return ci, ErrNoRoute
+	}
 	if registered, exist := n.connections[peername]; exist {
 		// already registered
+		n.mutexConnections.Unlock()
 		return registered, ErrTaken
 	}
+	if n.maxConnections > 0 && len(n.connections) >= n.maxConnections {
+		n.mutexConnections.Unlock()
+		return ci, ErrTooManyConnections
+	}
 	n.connections[peername] = ci
+	n.mutexConnections.Unlock()
+
+	n.router.RouteNodeUp(peername)
+	n.updateCluster()
 	return ci, nil
 }
 
@@ -453,7 +1104,107 @@ func (n *network) unregisterConnection(peername string) {
 
 	if exist {
 		n.router.RouteNodeDown(peername)
+		n.updateCluster()
+		n.reconnect(peername)
+	}
+}
+
+// reconnect starts reconnecting to the node according to the reconnect policy
+// of its static route
+func (n *network) reconnect(peername string) {
+	route, exist := n.staticRoute(peername)
+	if !exist || route.Reconnect.Enable == false || n.ctx.Err() != nil {
+		return
+	}
+
+	n.mutexReconnects.Lock()
+	if _, exist := n.reconnects[peername]; exist {
+		// already reconnecting
+		n.mutexReconnects.Unlock()
+		return
+	}
+	state := &ReconnectState{}
+	n.reconnects[peername] = state
+	n.mutexReconnects.Unlock()
+
+	policy := route.Reconnect
+	if policy.BackoffBase == 0 {
+		policy.BackoffBase = defaultReconnectBackoffBase
 	}
+	if policy.BackoffMax == 0 {
+		policy.BackoffMax = defaultReconnectBackoffMax
+	}
+
+	go func() {
+		defer func() {
+			n.mutexReconnects.Lock()
+			delete(n.reconnects, peername)
+			n.mutexReconnects.Unlock()
+		}()
+
+		delay := policy.BackoffBase
+		for attempt := 1; ; attempt++ {
+			n.mutexReconnects.Lock()
+			state.NextAttempt = time.Now().Add(delay)
+			n.mutexReconnects.Unlock()
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-n.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if _, exist := n.staticRoute(peername); !exist {
+				// route has been removed
+				return
+			}
+			if _, err := n.Connection(peername); err == nil {
+				// already connected
+				return
+			}
+
+			_, err := n.connect(peername)
+			if err == nil {
+				lib.Log("[%s] NETWORK reconnected to %s", n.nodename, peername)
+				return
+			}
+			lib.Log("[%s] NETWORK can't reconnect to %s (attempt %d): %s", n.nodename, peername, attempt, err)
+
+			n.mutexReconnects.Lock()
+			state.Attempts = attempt
+			state.LastError = err
+			n.mutexReconnects.Unlock()
+
+			if policy.StopOnCookieMismatch && errors.Is(err, ErrHandshakeCookie) {
+				lib.Log("[%s] NETWORK stopped reconnecting to %s: %s", n.nodename, peername, err)
+				return
+			}
+			if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+				lib.Log("[%s] NETWORK gave up reconnecting to %s", n.nodename, peername)
+				if policy.GiveUp == ReconnectGiveUpRemoveRoute {
+					n.RemoveStaticRoute(peername)
+				}
+				return
+			}
+
+			delay *= 2
+			if delay > policy.BackoffMax {
+				delay = policy.BackoffMax
+			}
+		}
+	}()
+}
+
+// peekConn allows to look at the data of the connection before handling it
+type peekConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (pc *peekConn) Read(b []byte) (int, error) {
+	return pc.reader.Read(b)
 }
 
 func generateSelfSignedCert(version Version) (tls.Certificate, error) {
@@ -543,6 +1294,18 @@ func (c *Connection) SendReg(from gen.Process, to gen.ProcessID, message etf.Ter
 func (c *Connection) SendAlias(from gen.Process, to etf.Alias, message etf.Term) error {
 	return ErrUnsupported
 }
+func (c *Connection) SendRaw(from gen.Process, to etf.Pid, encoded []byte) error {
+	return ErrUnsupported
+}
+func (c *Connection) MaxMessageSize() int {
+	return 0
+}
+func (c *Connection) Flags() ProtoFlags {
+	return ProtoFlags{}
+}
+func (c *Connection) Barrier() error {
+	return ErrUnsupported
+}
 func (c *Connection) Link(local gen.Process, remote etf.Pid) error {
 	return ErrUnsupported
 }
@@ -570,7 +1333,13 @@ func (c *Connection) MonitorExitReg(process gen.Process, reason string, ref etf.
 func (c *Connection) MonitorExit(to etf.Pid, terminated etf.Pid, reason string, ref etf.Ref) error {
 	return ErrUnsupported
 }
-func (c *Connection) SpawnRequest() error {
+func (c *Connection) SpawnRequest(behaviorName string, request gen.RemoteSpawnRequest) error {
+	return ErrUnsupported
+}
+func (c *Connection) SpawnReply(to etf.Pid, ref etf.Ref, spawned etf.Pid) error {
+	return ErrUnsupported
+}
+func (c *Connection) SpawnReplyError(to etf.Pid, ref etf.Ref, err error) error {
 	return ErrUnsupported
 }
 func (c *Connection) Proxy() error {
@@ -3,8 +3,10 @@ package node
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
@@ -26,6 +28,7 @@ type node struct {
 	context  context.Context
 	stop     context.CancelFunc
 	version  Version
+	flags    gen.NodeFlags
 	env      map[gen.EnvKey]interface{}
 }
 
@@ -35,30 +38,76 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 	lib.Log("Start node with name %q and cookie %q", name, cookie)
 	nodectx, nodestop := context.WithCancel(ctx)
 
-	if len(strings.Split(name, "@")) != 2 {
-		return nil, fmt.Errorf("incorrect FQDN node name (example: node@localhost)")
+	nn, err := etf.ParseNodeName(name)
+	if err != nil {
+		return nil, err
 	}
 	if opts.Creation == 0 {
 		opts.Creation = uint32(time.Now().Unix())
 	}
 
-	// set defaults listening port range
-	if opts.Listen > 0 {
-		opts.ListenBegin = opts.Listen
-		opts.ListenEnd = opts.Listen
-		lib.Log("Node listening port: %d", opts.Listen)
+	if len(opts.Listeners) == 0 {
+		opts.Listeners = []ListenerSpec{
+			ListenerSpec{
+				Listen:       opts.Listen,
+				ListenBegin:  opts.ListenBegin,
+				ListenEnd:    opts.ListenEnd,
+				TLSMode:      opts.TLSMode,
+				TLSCrtServer: opts.TLSCrtServer,
+				TLSKeyServer: opts.TLSKeyServer,
+				TLSCrtClient: opts.TLSCrtClient,
+				TLSKeyClient: opts.TLSKeyClient,
+				TLSStartTLS:  opts.TLSStartTLS,
+			},
+		}
 	} else {
-		if opts.ListenBegin == 0 {
-			opts.ListenBegin = defaultListenBegin
+		// do not modify the caller's slice setting defaults
+		opts.Listeners = append([]ListenerSpec{}, opts.Listeners...)
+	}
+
+	// set defaults listening port range
+	for i := range opts.Listeners {
+		spec := &opts.Listeners[i]
+		if spec.Host == "" {
+			spec.Host = nn.Host
+		}
+		if spec.Listen > 0 {
+			spec.ListenBegin = spec.Listen
+			spec.ListenEnd = spec.Listen
+			lib.Log("Node listening port: %d", spec.Listen)
+		} else {
+			if spec.ListenBegin == 0 {
+				spec.ListenBegin = defaultListenBegin
+			}
+			if spec.ListenEnd == 0 {
+				spec.ListenEnd = defaultListenEnd
+			}
+			lib.Log("Node listening range: %d...%d", spec.ListenBegin, spec.ListenEnd)
 		}
-		if opts.ListenEnd == 0 {
-			opts.ListenEnd = defaultListenEnd
+		if spec.Handshake == nil {
+			spec.Handshake = opts.Handshake
 		}
-		lib.Log("Node listening range: %d...%d", opts.ListenBegin, opts.ListenEnd)
 	}
 
-	if opts.Handshake == nil {
-		return nil, fmt.Errorf("Handshake must be defined")
+	for _, spec := range opts.Listeners {
+		if spec.Handshake == nil {
+			return nil, fmt.Errorf("Handshake must be defined")
+		}
+	}
+
+	if opts.AdvertiseHost != "" {
+		// listeners keep binding to the host of the given name
+		nn.Host = opts.AdvertiseHost
+		name = nn.String()
+		if _, err := etf.ParseNodeName(name); err != nil {
+			return nil, err
+		}
+		lib.Log("Node advertised as %q", name)
+	}
+	for _, alias := range opts.Aliases {
+		if _, err := etf.ParseNodeName(alias); err != nil {
+			return nil, err
+		}
 	}
 	if opts.Proto == nil {
 		return nil, fmt.Errorf("Proto must be defined")
@@ -66,6 +115,19 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 	if opts.StaticRoutesOnly == false && opts.Resolver == nil {
 		return nil, fmt.Errorf("Resolver must be defined if StaticRoutesOnly == false")
 	}
+	if opts.PanicPolicy == gen.PanicPolicyCallback && opts.PanicHandler == nil {
+		return nil, fmt.Errorf("PanicHandler must be defined if PanicPolicy is gen.PanicPolicyCallback")
+	}
+	if opts.TLSVerifyPeer != nil && opts.TLSClientCAs == nil {
+		return nil, fmt.Errorf("TLSClientCAs must be defined if TLSVerifyPeer is set")
+	}
+
+	// node environment is inherited by all the processes
+	env := make(map[gen.EnvKey]interface{})
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	opts.Env = env
 
 	core, err := newCore(nodectx, name, opts)
 	if err != nil {
@@ -77,31 +139,41 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 		context:      nodectx,
 		stop:         nodestop,
 		creation:     opts.Creation,
+		flags:        nodeFlags(opts),
 		coreInternal: core,
+		env:          env,
+	}
+
+	// set global variable 'ergo:Node'. it must be done before starting
+	// the applications since their processes are using it
+	env[EnvKeyNode] = Node(node)
+
+	// replicates the group membership across the connected nodes
+	if _, err := node.Spawn(groupsProcessName, gen.ProcessOptions{}, &groups{core: core}); err != nil {
+		nodestop()
+		return nil, err
 	}
 
+	// load applications
+	apps := []string{}
 	for _, app := range opts.Applications {
-		// load applications
 		name, err := node.ApplicationLoad(app)
 		if err != nil {
 			nodestop()
 			return nil, err
 		}
-		// start applications
-		_, err = node.ApplicationStart(name)
-		if err != nil {
-			nodestop()
-			return nil, err
-		}
+		apps = append(apps, name)
 	}
-
-	node.env = make(map[gen.EnvKey]interface{})
-	for k, v := range opts.Env {
-		node.env[k] = v
+	// start applications
+	if err := node.startApplications(apps, opts); err != nil {
+		nodestop()
+		return nil, err
 	}
 
-	// set global variable 'ergo:Node'
-	node.env[EnvKeyNode] = Node(node)
+	if err := node.startMetrics(opts.MetricsSink, opts.MetricsSinkName, opts.MetricsInterval); err != nil {
+		nodestop()
+		return nil, err
+	}
 
 	return node, nil
 }
@@ -111,6 +183,11 @@ func (n *node) Version() Version {
 	return n.version
 }
 
+// Flags
+func (n *node) Flags() gen.NodeFlags {
+	return n.flags
+}
+
 // Spawn
 func (n *node) Spawn(name string, opts gen.ProcessOptions, object gen.ProcessBehavior, args ...etf.Term) (gen.Process, error) {
 	// process started by node has no parent
@@ -120,6 +197,35 @@ func (n *node) Spawn(name string, opts gen.ProcessOptions, object gen.ProcessBeh
 	return n.spawn(name, options, object, args...)
 }
 
+// SpawnLink
+func (n *node) SpawnLink(parent etf.Pid, name string, opts gen.ProcessOptions, object gen.ProcessBehavior, args ...etf.Term) (gen.Process, error) {
+	if n.ProcessByPid(parent) == nil {
+		return nil, ErrProcessUnknown
+	}
+	options := processOptions{
+		ProcessOptions: opts,
+		link:           parent,
+	}
+	return n.spawn(name, options, object, args...)
+}
+
+// SpawnMonitor
+func (n *node) SpawnMonitor(parent etf.Pid, name string, opts gen.ProcessOptions, object gen.ProcessBehavior, args ...etf.Term) (gen.Process, etf.Ref, error) {
+	if n.ProcessByPid(parent) == nil {
+		return nil, etf.Ref{}, ErrProcessUnknown
+	}
+	options := processOptions{
+		ProcessOptions: opts,
+		monitor:        parent,
+		monitorRef:     n.MakeRef(),
+	}
+	process, err := n.spawn(name, options, object, args...)
+	if err != nil {
+		return nil, etf.Ref{}, err
+	}
+	return process, options.monitorRef, nil
+}
+
 // RegisterName
 func (n *node) RegisterName(name string, pid etf.Pid) error {
 	return n.registerName(name, pid)
@@ -130,11 +236,174 @@ func (n *node) UnregisterName(name string) error {
 	return n.unregisterName(name)
 }
 
+// RegisterNameScoped
+func (n *node) RegisterNameScoped(app string, name string, pid etf.Pid) error {
+	return n.registerName(scopedName(app, name), pid)
+}
+
+// UnregisterNameScoped
+func (n *node) UnregisterNameScoped(app string, name string) error {
+	return n.unregisterName(scopedName(app, name))
+}
+
+// SendAfter
+func (n *node) SendAfter(from etf.Pid, to etf.Pid, message etf.Term, after time.Duration) context.CancelFunc {
+	return n.sendAfter(from, to, message, after)
+}
+
+// CancelTimers
+func (n *node) CancelTimers(pid etf.Pid) int {
+	return n.cancelTimers(pid)
+}
+
+// TerminatedProcess
+func (n *node) TerminatedProcess(pid etf.Pid) (ProcessTombstone, bool) {
+	return n.terminatedProcess(pid)
+}
+
+// PurgeTerminated
+func (n *node) PurgeTerminated() int {
+	return n.purgeTerminated()
+}
+
+// Metrics
+func (n *node) Metrics() NodeMetrics {
+	return n.metrics()
+}
+
+// TapProcess
+func (n *node) TapProcess(pid etf.Pid, collector etf.Pid) (etf.Ref, error) {
+	return n.tapProcess(pid, collector)
+}
+
+// Untap
+func (n *node) Untap(ref etf.Ref) bool {
+	return n.untap(ref)
+}
+
+// ExportRegistry
+func (n *node) ExportRegistry() gen.RegistrySnapshot {
+	return n.exportRegistry()
+}
+
+// ImportRegistry
+func (n *node) ImportRegistry(snapshot gen.RegistrySnapshot) error {
+	return n.importRegistry(snapshot)
+}
+
+// JoinGroup
+func (n *node) JoinGroup(name string, pid etf.Pid) error {
+	return n.joinGroup(name, pid)
+}
+
+// LeaveGroup
+func (n *node) LeaveGroup(name string, pid etf.Pid) error {
+	return n.leaveGroup(name, pid)
+}
+
+// GroupLeader
+func (n *node) GroupLeader(name string) etf.Pid {
+	return n.groupLeader(name)
+}
+
+// GroupMembers
+func (n *node) GroupMembers(name string) []etf.Pid {
+	return n.groupMembers(name)
+}
+
+// SubscribeGroup
+func (n *node) SubscribeGroup(name string, pid etf.Pid) error {
+	return n.subscribeGroup(name, pid)
+}
+
+// UnsubscribeGroup
+func (n *node) UnsubscribeGroup(name string, pid etf.Pid) {
+	n.unsubscribeGroup(name, pid)
+}
+
+// ScheduleInterval
+func (n *node) ScheduleInterval(name string, interval time.Duration, fn func()) error {
+	return n.scheduleInterval(name, interval, fn)
+}
+
+// CancelSchedule
+func (n *node) CancelSchedule(name string) bool {
+	return n.cancelSchedule(name)
+}
+
+// ProcessEnv
+func (n *node) ProcessEnv(pid etf.Pid) (map[gen.EnvKey]interface{}, error) {
+	return n.processEnv(pid)
+}
+
+// SetProcessEnv
+func (n *node) SetProcessEnv(pid etf.Pid, name gen.EnvKey, value interface{}) error {
+	return n.setProcessEnv(pid, name, value)
+}
+
+// PauseProcess
+func (n *node) PauseProcess(pid etf.Pid) error {
+	return n.pauseProcess(pid)
+}
+
+// ResumeProcess
+func (n *node) ResumeProcess(pid etf.Pid) error {
+	return n.resumeProcess(pid)
+}
+
+// MigrateProcess
+func (n *node) MigrateProcess(pid etf.Pid, targetNode string) (etf.Pid, error) {
+	return n.migrateProcess(pid, targetNode)
+}
+
+// SendRaw
+func (n *node) SendRaw(from etf.Pid, to etf.Pid, encoded []byte) error {
+	return n.routeSendRaw(from, to, encoded)
+}
+
+// Observe
+func (n *node) Observe() (<-chan gen.NodeDelta, func()) {
+	return n.observe()
+}
+
+// RouteSendWithTTL
+func (n *node) RouteSendWithTTL(from etf.Pid, to etf.Pid, message etf.Term, ttl time.Duration) error {
+	return n.routeSendWithTTL(from, to, message, ttl)
+}
+
+// MonitorMulti
+func (n *node) MonitorMulti(by etf.Pid, targets []etf.Pid) ([]etf.Ref, error) {
+	if n.ProcessByPid(by) == nil {
+		return nil, ErrProcessUnknown
+	}
+	refs := make([]etf.Ref, len(targets))
+	for i := range targets {
+		refs[i] = n.MakeRef()
+	}
+	n.monitorMulti(by, targets, refs)
+	return refs, nil
+}
+
+// DemonitorMulti
+func (n *node) DemonitorMulti(refs []etf.Ref) {
+	n.demonitorMulti(refs)
+}
+
 // Stop
 func (n *node) Stop() {
 	n.coreStop()
 }
 
+// StopWithReason
+func (n *node) StopWithReason(reason string) {
+	n.coreStopWithReason(reason)
+}
+
+// StopReason
+func (n *node) StopReason() string {
+	return n.coreStopReason()
+}
+
 // Name
 func (n *node) Name() string {
 	return n.name
@@ -150,6 +419,16 @@ func (n *node) Uptime() int64 {
 	return n.coreUptime()
 }
 
+// UptimeDuration
+func (n *node) UptimeDuration() time.Duration {
+	return n.coreUptimeDuration()
+}
+
+// StartedAt
+func (n *node) StartedAt() time.Time {
+	return n.coreStartedAt()
+}
+
 // Wait
 func (n *node) Wait() {
 	n.coreWait()
@@ -222,6 +501,17 @@ func (n *node) ApplicationInfo(name string) (gen.ApplicationInfo, error) {
 	return appInfo, nil
 }
 
+// ApplicationByPid returns the name of the application the given process belongs to.
+// Returns false if the process is unknown or isn't running under any application.
+func (n *node) ApplicationByPid(pid etf.Pid) (string, bool) {
+	p := n.ProcessByPid(pid)
+	if p == nil {
+		return "", false
+	}
+	name, ok := p.Env(gen.EnvKeyApplication).(string)
+	return name, ok
+}
+
 // ApplicationLoad loads the application specification for an application. Returns name of
 // loaded application.
 func (n *node) ApplicationLoad(app gen.ApplicationBehavior, args ...etf.Term) (string, error) {
@@ -277,6 +567,193 @@ func (n *node) ApplicationStart(appName string, args ...etf.Term) (gen.Process,
 	return n.applicationStart(gen.ApplicationStartTemporary, appName, args...)
 }
 
+// startApplications starts the given (loaded) applications using the
+// delay/jitter and concurrency settings of the node options
+func (n *node) startApplications(apps []string, opts Options) error {
+	if err := n.checkAppDependencies(apps); err != nil {
+		return err
+	}
+
+	// the starts are spaced by the delay even if they are concurrent,
+	// so every start takes the next slot
+	var mutexSlot sync.Mutex
+	var slot time.Time
+	pause := func() {
+		delay := opts.ApplicationStartDelay
+		if opts.ApplicationStartJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(opts.ApplicationStartJitter)))
+		}
+		mutexSlot.Lock()
+		now := time.Now()
+		if slot.Before(now) {
+			slot = now
+		}
+		slot = slot.Add(delay)
+		wait := slot.Sub(now)
+		mutexSlot.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	start := func(name string) error {
+		_, err := n.ApplicationStart(name)
+		if err != nil && err != ErrAppAlreadyStarted {
+			return fmt.Errorf("can't start application %q: %w", name, err)
+		}
+		return nil
+	}
+
+	if opts.ApplicationStartConcurrent == false {
+		for i, name := range apps {
+			if i > 0 {
+				pause()
+			}
+			if err := start(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type appState struct {
+		done chan struct{}
+		err  error
+	}
+	states := make(map[string]*appState)
+	for _, name := range apps {
+		states[name] = &appState{done: make(chan struct{})}
+	}
+
+	var wg sync.WaitGroup
+	for i, name := range apps {
+		var deps []string
+		if rb, err := n.RegisteredBehavior(appBehaviorGroup, name); err == nil {
+			if spec, ok := rb.Data.(*gen.ApplicationSpec); ok {
+				deps = spec.Applications
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, name string, deps []string) {
+			defer wg.Done()
+			state := states[name]
+			defer close(state.done)
+
+			// wait for the dependencies listed for the starting as well.
+			// the rest of them will be started by ApplicationStart
+			for _, dep := range deps {
+				depState, ok := states[dep]
+				if ok == false || dep == name {
+					continue
+				}
+				<-depState.done
+				if depState.err != nil {
+					state.err = fmt.Errorf("can't start application %q: dependency %q failed", name, dep)
+					return
+				}
+			}
+			if i > 0 {
+				pause()
+			}
+			state.err = start(name)
+		}(i, name, deps)
+	}
+	wg.Wait()
+
+	for _, name := range apps {
+		if err := states[name].err; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAppDependencies returns ErrAppDependencyCycle with the names of the applications
+// making the cycle. Such applications can't be started (they would wait for each other).
+func (n *node) checkAppDependencies(apps []string) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	path := []string{}
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			for i := range path {
+				if path[i] == name {
+					cycle := append(path[i:], name)
+					return fmt.Errorf("%w: %s", ErrAppDependencyCycle, strings.Join(cycle, " -> "))
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		if rb, err := n.RegisteredBehavior(appBehaviorGroup, name); err == nil {
+			if spec, ok := rb.Data.(*gen.ApplicationSpec); ok {
+				for _, dep := range spec.Applications {
+					if err := visit(dep); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range apps {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplicationStartSync start Application with start type ApplicationStartTemporary
+// and wait until all the processes of its supervision tree are initialized.
+// Application started after exceeding the timeout is stopped.
+func (n *node) ApplicationStartSync(appName string, timeout time.Duration, args ...etf.Term) (gen.Process, error) {
+	type result struct {
+		process gen.Process
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		process, err := n.applicationStart(gen.ApplicationStartTemporary, appName, args...)
+		done <- result{process, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, fmt.Errorf("can't start application %q: %w", appName, r.err)
+		}
+		return r.process, nil
+	case <-timer.C:
+		go func() {
+			r := <-done
+			if r.err != nil {
+				return
+			}
+			lib.Log("[%s] application %q started after the timeout. stopping", n.Name(), appName)
+			if err := n.ApplicationStop(appName); err != nil {
+				r.process.Kill()
+			}
+		}()
+		return nil, ErrTimeout
+	}
+}
+
 func (n *node) applicationStart(startType, appName string, args ...etf.Term) (gen.Process, error) {
 	rb, err := n.RegisteredBehavior(appBehaviorGroup, appName)
 	if err != nil {
@@ -307,7 +784,8 @@ func (n *node) applicationStart(startType, appName string, args ...etf.Term) (ge
 	}
 
 	env := map[gen.EnvKey]interface{}{
-		gen.EnvKeySpec: spec,
+		gen.EnvKeySpec:        spec,
+		gen.EnvKeyApplication: spec.Name,
 	}
 	options := gen.ProcessOptions{
 		Env: env,
@@ -348,6 +826,22 @@ func (n *node) ApplicationStop(name string) error {
 	return nil
 }
 
+// CallByName makes a sync request (in fashion of gen_server:call) to the process
+// registered with the given name on the given node. The 'from' process must be
+// based on gen.Server in order to receive the reply. Returns ErrTimeout if the
+// timeout is exceeded and ErrProcessUnknown if the name is not registered.
+func (n *node) CallByName(from etf.Pid, nodename, name string, request etf.Term, timeout time.Duration) (etf.Term, error) {
+	p, ok := n.ProcessByPid(from).(*process)
+	if !ok {
+		return nil, ErrSenderUnknown
+	}
+	to := gen.ProcessID{
+		Name: name,
+		Node: nodename,
+	}
+	return p.callByName(to, request, timeout)
+}
+
 // Links
 func (n *node) Links(process etf.Pid) []etf.Pid {
 	return n.processLinks(process)
@@ -358,6 +852,21 @@ func (n *node) Monitors(process etf.Pid) []etf.Pid {
 	return n.processMonitors(process)
 }
 
+// MonitorsExt
+func (n *node) MonitorsExt(process etf.Pid) []gen.MonitorInfo {
+	return n.processMonitorsExt(process)
+}
+
+// AllMonitors
+func (n *node) AllMonitors() []gen.MonitorRecord {
+	return n.allMonitors()
+}
+
+// AllLinks
+func (n *node) AllLinks() []gen.LinkRecord {
+	return n.allLinks()
+}
+
 // MonitorsByName
 func (n *node) MonitorsByName(process etf.Pid) []gen.ProcessID {
 	return n.processMonitorsByName(process)
@@ -421,18 +930,51 @@ func (n *node) RevokeRemoteSpawn(name string) error {
 	return n.UnregisterBehavior(remoteBehaviorGroup, name)
 }
 
+func nodeFlags(opts Options) gen.NodeFlags {
+	protoFlags := DefaultProtoOptions(0, false).Flags
+	flags := gen.NodeFlags{
+		Compression:           opts.Compression,
+		CompressionDictionary: opts.CompressionDictionary != nil,
+		Proxy:                 opts.ProxyMode != ProxyModeDisabled,
+		Fragmentation:         protoFlags.EnableFragmentation,
+		BigCreation:           protoFlags.EnableBigCreation,
+		BigPidRef:             protoFlags.EnableBigPidRef,
+		HeaderAtomCache:       protoFlags.DisableHeaderAtomCache == false,
+		StringAsBinary:        opts.EncodeStringAsBinary,
+		FlowControl:           opts.FlowControl,
+		StaticRoutesOnly:      opts.StaticRoutesOnly,
+		Cloud:                 opts.CloudEnable,
+	}
+	for _, spec := range opts.Listeners {
+		if spec.TLSMode == TLSModeDisabled {
+			continue
+		}
+		flags.TLS = true
+		if spec.TLSMode == TLSModeStrict {
+			flags.TLSStrict = true
+		}
+		if spec.TLSStartTLS {
+			flags.StartTLS = true
+		}
+	}
+	return flags
+}
+
 // DefaultProtoOptions
 func DefaultProtoOptions(handlers int, disableHeaderAtomCache bool) ProtoOptions {
 	flags := ProtoFlags{
 		DisableHeaderAtomCache: disableHeaderAtomCache,
 		EnableBigCreation:      true,
 	}
+	if handlers < 1 {
+		handlers = runtime.GOMAXPROCS(0)
+	}
 	return ProtoOptions{
 		MaxMessageSize:    0, // no limit
 		SendQueueLength:   DefaultProtoSendQueueLength,
 		RecvQueueLength:   DefaultProtoRecvQueueLength,
 		FragmentationUnit: DefaultProroFragmentationUnit,
-		NumHandlers:       runtime.GOMAXPROCS(handlers),
+		NumHandlers:       handlers,
 		Flags:             flags,
 	}
 }
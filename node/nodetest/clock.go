@@ -0,0 +1,136 @@
+package nodetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ergo-services/ergo/node"
+)
+
+// FakeTimerSource is the fake clock for the deterministic testing of the node timers.
+// The time stands still until it's advanced explicitly.
+//
+//	clock := nodetest.NewFakeTimerSource()
+//	myNode, _ := ergo.StartNode(name, cookie, node.Options{TimerSource: clock})
+//	...
+//	process.SendAfter(to, "hello", time.Minute)
+//	clock.Advance(time.Minute) // the message is sent
+type FakeTimerSource struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	source *FakeTimerSource
+	when   time.Time
+	// period is zero for the one-shot timer
+	period time.Duration
+	c      chan time.Time
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+// NewFakeTimerSource creates the fake clock starting at the current time
+func NewFakeTimerSource() *FakeTimerSource {
+	return &FakeTimerSource{
+		now: time.Now(),
+	}
+}
+
+// NewTimer
+func (f *FakeTimerSource) NewTimer(d time.Duration) node.Timer {
+	return f.add(d, 0)
+}
+
+// NewTicker
+func (f *FakeTimerSource) NewTicker(d time.Duration) node.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(d, d)}
+}
+
+// Now returns the current time of the fake clock
+func (f *FakeTimerSource) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Pending returns the number of the active timers and tickers
+func (f *FakeTimerSource) Pending() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.timers)
+}
+
+// Advance moves the clock forward and fires the expired timers. Like the real ticker,
+// the fake one drops the ticks if the previous one hasn't been received yet.
+func (f *FakeTimerSource) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now = f.now.Add(d)
+	timers := f.timers[:0]
+	for _, t := range f.timers {
+		for t.when.After(f.now) == false {
+			select {
+			case t.c <- t.when:
+			default:
+			}
+			if t.period == 0 {
+				break
+			}
+			t.when = t.when.Add(t.period)
+		}
+		if t.period == 0 && t.when.After(f.now) == false {
+			// one-shot timer has fired
+			continue
+		}
+		timers = append(timers, t)
+	}
+	f.timers = timers
+}
+
+func (f *FakeTimerSource) add(d time.Duration, period time.Duration) *fakeTimer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	t := &fakeTimer{
+		source: f,
+		when:   f.now.Add(d),
+		period: period,
+		c:      make(chan time.Time, 1),
+	}
+	f.timers = append(f.timers, t)
+	return t
+}
+
+func (f *FakeTimerSource) remove(t *fakeTimer) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i := range f.timers {
+		if f.timers[i] == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop returns false if the timer has already fired or been stopped
+func (t *fakeTimer) Stop() bool {
+	return t.source.remove(t)
+}
+
+func (t fakeTicker) Stop() {
+	t.source.remove(t.fakeTimer)
+}
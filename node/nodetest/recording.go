@@ -0,0 +1,125 @@
+package nodetest
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+// Matcher returns true if the given message is the expected one
+type Matcher func(message etf.Term) bool
+
+// Equal creates Matcher comparing messages with the expected one using reflect.DeepEqual
+func Equal(expected etf.Term) Matcher {
+	return func(message etf.Term) bool {
+		return reflect.DeepEqual(expected, message)
+	}
+}
+
+// Any creates Matcher accepting any message
+func Any() Matcher {
+	return func(message etf.Term) bool {
+		return true
+	}
+}
+
+// RecordingProcess is a gen.Server based behavior that captures all the received
+// messages (sent with Send, Cast or Call). Calls are replied with "ok".
+//
+//	rp := &nodetest.RecordingProcess{}
+//	process, _ := myNode.Spawn("", gen.ProcessOptions{}, rp)
+//	...
+//	if err := rp.Expect(nodetest.Equal(etf.Atom("hello")), time.Second); err != nil {
+//		t.Fatal(err)
+//	}
+type RecordingProcess struct {
+	gen.Server
+
+	mutex    sync.Mutex
+	messages []etf.Term
+	updated  chan struct{}
+}
+
+// Init
+func (rp *RecordingProcess) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	return nil
+}
+
+// HandleCast
+func (rp *RecordingProcess) HandleCast(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	rp.record(message)
+	return gen.ServerStatusOK
+}
+
+// HandleCall
+func (rp *RecordingProcess) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
+	rp.record(message)
+	return etf.Atom("ok"), gen.ServerStatusOK
+}
+
+// HandleInfo
+func (rp *RecordingProcess) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	rp.record(message)
+	return gen.ServerStatusOK
+}
+
+// ReceivedMessages returns a copy of the messages received so far
+func (rp *RecordingProcess) ReceivedMessages() []etf.Term {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+
+	messages := make([]etf.Term, len(rp.messages))
+	copy(messages, rp.messages)
+	return messages
+}
+
+// Expect waits for a message matching the given matcher. Messages received before
+// this call are also checked. Returns node.ErrTimeout if the timeout is exceeded.
+func (rp *RecordingProcess) Expect(matcher Matcher, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	checked := 0
+	for {
+		rp.mutex.Lock()
+		for ; checked < len(rp.messages); checked++ {
+			if matcher(rp.messages[checked]) {
+				rp.mutex.Unlock()
+				return nil
+			}
+		}
+		updated := rp.getUpdated()
+		rp.mutex.Unlock()
+
+		select {
+		case <-updated:
+			continue
+		case <-timer.C:
+			return node.ErrTimeout
+		}
+	}
+}
+
+func (rp *RecordingProcess) record(message etf.Term) {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+
+	rp.messages = append(rp.messages, message)
+	// wake up all the waiters
+	if rp.updated != nil {
+		close(rp.updated)
+		rp.updated = nil
+	}
+}
+
+// getUpdated must be called under the mutex
+func (rp *RecordingProcess) getUpdated() chan struct{} {
+	if rp.updated == nil {
+		rp.updated = make(chan struct{})
+	}
+	return rp.updated
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
@@ -14,9 +15,23 @@ import (
 const (
 	// DefaultProcessMailboxSize
 	DefaultProcessMailboxSize = 100
+	// DefaultProcessDirectboxSize
+	DefaultProcessDirectboxSize = 10
+
+	// priorityHighWait and priorityMaxWait how long the message sent by the process
+	// with high (max) priority waits for the free slot in the full mailbox
+	priorityHighWait = 5 * time.Millisecond
+	priorityMaxWait  = 20 * time.Millisecond
+
+	// defaultFlushInterval how often Flush checks the mailbox
+	defaultFlushInterval = 10 * time.Millisecond
 )
 
 type process struct {
+	// reductions the number of handled messages (see CountReduction). It's updated
+	// atomically, so keep it first to have it 64-bit aligned on the 32-bit platforms.
+	reductions uint64
+
 	coreInternal
 	sync.RWMutex
 
@@ -42,14 +57,36 @@ type process struct {
 
 	trapExit    bool
 	compression bool
+	exitError   error
+	priority    gen.ProcessPriority
+	rawMessages bool
+
+	// taps the collectors receiving a copy of every message put into the mailbox
+	taps map[etf.Ref]etf.Pid
+
+	onMailboxFull func(from etf.Pid, message etf.Term)
+	persister     gen.MailboxPersister
+
+	pauseMutex sync.Mutex
+	paused     bool
+	held       []gen.ProcessMailboxMessage
+
+	// crashResolved is set once the panic has been resolved to gen.PanicPolicyCrashNode
+	// by the behavior (see PanicPolicy), so it re-panics and the core must not ask again.
+	crashResolved int32
 }
 
 type processOptions struct {
 	gen.ProcessOptions
 	parent *process
+	// link and monitor are established before starting the process loop
+	// (see SpawnLink and SpawnMonitor)
+	link       etf.Pid
+	monitor    etf.Pid
+	monitorRef etf.Ref
 }
 
-type processExitFunc func(from etf.Pid, reason string) error
+type processExitFunc func(from etf.Pid, reason string, err error) error
 
 // Self
 func (p *process) Self() etf.Pid {
@@ -97,7 +134,7 @@ func (p *process) Exit(reason string) error {
 	if p.behavior == nil {
 		return ErrProcessTerminated
 	}
-	return p.exit(p.self, reason)
+	return p.exit(p.self, reason, nil)
 }
 
 // Context
@@ -152,14 +189,34 @@ func (p *process) Info() gen.ProcessInfo {
 		return gen.ProcessInfo{}
 	}
 
-	gl := p.self
-	if p.groupLeader != nil {
-		gl = p.groupLeader.Self()
-	}
 	links := p.Links()
 	monitors := p.Monitors()
 	monitorsByName := p.MonitorsByName()
 	monitoredBy := p.MonitoredBy()
+	return p.info(links, monitors, monitorsByName, monitoredBy)
+}
+
+// infoSnapshot returns process details using the links and monitors from the snapshot
+func (p *process) infoSnapshot(s monitorSnapshot) gen.ProcessInfo {
+	if p.behavior == nil {
+		return gen.ProcessInfo{}
+	}
+
+	// keep the same values Info returns for the process with no monitors
+	monitors := []etf.Pid{}
+	monitors = append(monitors, s.monitors[p.self]...)
+	monitorsByName := []gen.ProcessID{}
+	monitorsByName = append(monitorsByName, s.monitorsByName[p.self]...)
+	monitoredBy := []etf.Pid{}
+	monitoredBy = append(monitoredBy, s.monitoredBy[p.self]...)
+	return p.info(s.links[p.self], monitors, monitorsByName, monitoredBy)
+}
+
+func (p *process) info(links []etf.Pid, monitors []etf.Pid, monitorsByName []gen.ProcessID, monitoredBy []etf.Pid) gen.ProcessInfo {
+	gl := p.self
+	if p.groupLeader != nil {
+		gl = p.groupLeader.Self()
+	}
 	return gen.ProcessInfo{
 		PID:             p.self,
 		Name:            p.name,
@@ -171,7 +228,10 @@ func (p *process) Info() gen.ProcessInfo {
 		Aliases:         p.aliases,
 		Status:          "running",
 		MessageQueueLen: len(p.mailBox),
+		PendingReplies:  p.PendingReplies(),
 		TrapExit:        p.trapExit,
+		Reductions:      atomic.LoadUint64(&p.reductions),
+		Priority:        p.priority,
 	}
 }
 
@@ -195,20 +255,39 @@ func (p *process) Send(to interface{}, message etf.Term) error {
 	return fmt.Errorf("Unknown receiver type")
 }
 
+// SendWithReceipt
+func (p *process) SendWithReceipt(to etf.Pid, message etf.Term) (etf.Ref, error) {
+	if p.behavior == nil {
+		return etf.Ref{}, ErrProcessTerminated
+	}
+	return p.RouteSendWithReceipt(p.self, to, message)
+}
+
+// SendRaw
+func (p *process) SendRaw(to etf.Pid, encoded []byte) error {
+	if p.behavior == nil {
+		return ErrProcessTerminated
+	}
+	return p.routeSendRaw(p.self, to, encoded)
+}
+
 // SendAfter
 func (p *process) SendAfter(to interface{}, message etf.Term, after time.Duration) context.CancelFunc {
 	//TODO: should we control the number of timers/goroutines have been created this way?
-	ctx, cancel := context.WithCancel(p.context)
-	go func() {
+	ctx, cancelContext := context.WithCancel(p.context)
+	timer := p.coreTimerSource().NewTimer(after)
+	cancel := func() {
 		// to prevent of timer leaks due to its not GCed until the timer fires
-		timer := time.NewTimer(after)
-		defer timer.Stop()
+		timer.Stop()
+		cancelContext()
+	}
+	go func() {
 		defer cancel()
 
 		select {
 		case <-ctx.Done():
 			return
-		case <-timer.C:
+		case <-timer.C():
 			if p.IsAlive() {
 				p.Send(to, message)
 			}
@@ -284,6 +363,86 @@ func (p *process) Env(name gen.EnvKey) interface{} {
 	return nil
 }
 
+// PanicPolicy
+func (p *process) PanicPolicy(reason interface{}) gen.PanicPolicy {
+	policy := p.resolvePanic(p.self, p.name, reason)
+	if policy == gen.PanicPolicyCrashNode {
+		atomic.StoreInt32(&p.crashResolved, 1)
+	}
+	return policy
+}
+
+// crashNode returns true if the node must be crashed by the panic recovered by the core.
+// The PanicHandler is invoked only if the behavior hasn't resolved this panic already.
+func (p *process) crashNode(reason interface{}) bool {
+	if atomic.LoadInt32(&p.crashResolved) == 1 {
+		return true
+	}
+	return p.resolvePanic(p.self, p.name, reason) == gen.PanicPolicyCrashNode
+}
+
+// persist passes the message being put into the mailbox to the persister (if it's defined)
+func (p *process) persist(message gen.ProcessMailboxMessage) {
+	if p.persister == nil {
+		return
+	}
+	if err := p.persister.Append(message); err != nil {
+		lib.LogWithLevel(lib.LogLevelWarning, "[%s] CORE can't persist message to %s: %s", p.NodeName(), p.self, err)
+	}
+}
+
+// AckPersisted
+func (p *process) AckPersisted() {
+	// the terminated process might take the message on its way out. Keep it
+	// persisted, since it's going to be replayed to the next incarnation.
+	if p.persister == nil || p.context.Err() != nil {
+		return
+	}
+	p.persister.Ack(1)
+}
+
+// mailboxAlive returns the mailbox of the process or nil if the process is terminated.
+// The mailbox is set to nil on termination (see cleanProcess in core.spawn), so
+// sending to it without this check could block forever.
+func (p *process) mailboxAlive() chan gen.ProcessMailboxMessage {
+	p.RLock()
+	defer p.RUnlock()
+	if p.context.Err() != nil {
+		return nil
+	}
+	return p.mailBox
+}
+
+// Flush
+func (p *process) Flush(timeout time.Duration) int {
+	mailbox := p.mailboxAlive()
+	if mailbox == nil {
+		// process is terminated
+		return 0
+	}
+	if len(mailbox) == 0 {
+		return 0
+	}
+
+	timer := lib.TakeTimer()
+	defer lib.ReleaseTimer(timer)
+	timer.Reset(timeout)
+
+	ticker := time.NewTicker(defaultFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if len(mailbox) == 0 {
+				return 0
+			}
+		case <-timer.C:
+			return len(mailbox)
+		}
+	}
+}
+
 // Wait
 func (p *process) Wait() {
 	if p.IsAlive() {
@@ -324,6 +483,22 @@ func (p *process) Unlink(with etf.Pid) {
 	p.RouteUnlink(p.self, with)
 }
 
+// StickyLink
+func (p *process) StickyLink(name string) error {
+	if p.behavior == nil {
+		return ErrProcessTerminated
+	}
+	return p.stickyLink(p.self, name)
+}
+
+// StickyUnlink
+func (p *process) StickyUnlink(name string) {
+	if p.behavior == nil {
+		return
+	}
+	p.stickyUnlink(p.self, name)
+}
+
 // IsAlive
 func (p *process) IsAlive() bool {
 	if p.behavior == nil {
@@ -342,6 +517,11 @@ func (p *process) NodeStop() {
 	p.coreStop()
 }
 
+// NodeStopReason
+func (p *process) NodeStopReason() string {
+	return p.coreStopReason()
+}
+
 // NodeUptime
 func (p *process) NodeUptime() int64 {
 	return p.coreUptime()
@@ -370,6 +550,23 @@ func (p *process) TrapExit() bool {
 	return p.trapExit
 }
 
+// SetExitError
+func (p *process) SetExitError(err error) {
+	p.Lock()
+	p.exitError = err
+	p.Unlock()
+}
+
+// exitErrorFor returns the error kept by SetExitError if it matches the given reason
+func (p *process) exitErrorFor(reason string) error {
+	p.RLock()
+	defer p.RUnlock()
+	if p.exitError == nil || p.exitError.Error() != reason {
+		return nil
+	}
+	return p.exitError
+}
+
 // SetCompression
 func (p *process) SetCompression(enable bool) {
 	p.compression = enable
@@ -380,6 +577,11 @@ func (p *process) Compression() bool {
 	return p.compression
 }
 
+// RawMessages
+func (p *process) RawMessages() bool {
+	return p.rawMessages
+}
+
 // Behavior
 func (p *process) Behavior() gen.ProcessBehavior {
 	p.Lock()
@@ -448,51 +650,106 @@ func (p *process) DemonitorProcess(ref etf.Ref) bool {
 
 // RemoteSpawn
 func (p *process) RemoteSpawn(node string, object string, opts gen.RemoteSpawnOptions, args ...etf.Term) (etf.Pid, error) {
-	// ref := p.MakeRef()
-	//	optlist := etf.List{}
-	//	if opts.RegisterName != "" {
-	//		optlist = append(optlist, etf.Tuple{etf.Atom("name"), etf.Atom(opts.RegisterName)})
-	//
-	//	}
-	//	if opts.Timeout == 0 {
-	//		opts.Timeout = gen.DefaultCallTimeout
-	//	}
-	//	control := etf.Tuple{distProtoSPAWN_REQUEST, ref, p.self, p.self,
-	//		// {M,F,A}
-	//		etf.Tuple{etf.Atom(object), etf.Atom(opts.Function), len(args)},
-	//		optlist,
-	//	}
-	//	p.SendSyncRequestRaw(ref, etf.Atom(node), append([]etf.Term{control}, args)...)
-	//	reply, err := p.WaitSyncReply(ref, opts.Timeout)
-	//	if err != nil {
-	//		return etf.Pid{}, err
-	//	}
-	//
-	//	// Result of the operation. If Result is a process identifier,
-	//	// the operation succeeded and the process identifier is the
-	//	// identifier of the newly created process. If Result is an atom,
-	//	// the operation failed and the atom identifies failure reason.
-	//	switch r := reply.(type) {
-	//	case etf.Pid:
-	//		m := etf.Ref{} // empty reference
-	//		if opts.Monitor != m {
-	//			p.RouteMonitor(p.self, r, opts.Monitor)
-	//		}
-	//		if opts.Link {
-	//			p.Link(r)
-	//		}
-	//		return r, nil
-	//	case etf.Atom:
-	//		switch string(r) {
-	//		case ErrTaken.Error():
-	//			return etf.Pid{}, ErrTaken
-	//
-	//		}
-	//		return etf.Pid{}, fmt.Errorf(string(r))
-	//	}
-
-	//return etf.Pid{}, fmt.Errorf("unknown result: %#v", reply)
-	return etf.Pid{}, nil
+	if opts.Timeout == 0 {
+		opts.Timeout = gen.DefaultCallTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	pid, err := p.RemoteSpawnWithContext(ctx, node, object, opts, args...)
+	if err == context.DeadlineExceeded {
+		return etf.Pid{}, ErrTimeout
+	}
+	return pid, err
+}
+
+// RemoteSpawnWithContext
+func (p *process) RemoteSpawnWithContext(ctx context.Context, node string, object string, opts gen.RemoteSpawnOptions, args ...etf.Term) (etf.Pid, error) {
+	if p.reply == nil {
+		return etf.Pid{}, ErrProcessTerminated
+	}
+	ref := p.MakeRef()
+	reply := make(chan etf.Term, 2)
+	p.replyMutex.Lock()
+	p.reply[ref] = reply
+	p.replyMutex.Unlock()
+
+	request := gen.RemoteSpawnRequest{
+		Name:     opts.RegisterName,
+		From:     p.self,
+		Ref:      ref,
+		Function: opts.Function,
+		Args:     args,
+	}
+	if err := p.routeSpawnRequest(node, object, request); err != nil {
+		p.abandonSpawn(ref, reply)
+		return etf.Pid{}, err
+	}
+
+	var result etf.Term
+	select {
+	case result = <-reply:
+		p.abandonSpawn(ref, reply)
+	case <-ctx.Done():
+		p.abandonSpawn(ref, reply)
+		return etf.Pid{}, ctx.Err()
+	case <-p.context.Done():
+		p.abandonSpawn(ref, reply)
+		return etf.Pid{}, ErrProcessTerminated
+	}
+
+	// Result of the operation. If Result is a process identifier,
+	// the operation succeeded and the process identifier is the
+	// identifier of the newly created process. If Result is an atom,
+	// the operation failed and the atom identifies failure reason.
+	switch r := result.(type) {
+	case etf.Pid:
+		if opts.Monitor != (etf.Ref{}) {
+			p.RouteMonitor(p.self, r, opts.Monitor)
+		}
+		if opts.Link {
+			p.RouteLink(p.self, r)
+		}
+		return r, nil
+	case etf.Atom:
+		for _, err := range []error{ErrTaken, ErrBehaviorUnknown, ErrRemoteSpawnBusy, ErrNodeMaintenance} {
+			if string(r) == err.Error() {
+				return etf.Pid{}, err
+			}
+		}
+		return etf.Pid{}, fmt.Errorf(string(r))
+	}
+	return etf.Pid{}, fmt.Errorf("unknown result: %#v", result)
+}
+
+// abandonSpawn removes the pending remote spawn request. The process spawned by
+// the reply that has arrived in the meantime is terminated (see RouteSpawnReply).
+func (p *process) abandonSpawn(ref etf.Ref, reply chan etf.Term) {
+	p.replyMutex.Lock()
+	delete(p.reply, ref)
+	p.replyMutex.Unlock()
+	select {
+	case result := <-reply:
+		if spawned, ok := result.(etf.Pid); ok {
+			p.RouteExit(spawned, p.self, "abandoned")
+		}
+	default:
+	}
+}
+
+// putSpawnReply returns false if nobody waits for the reply
+func (p *process) putSpawnReply(ref etf.Ref, result etf.Term) bool {
+	p.replyMutex.Lock()
+	defer p.replyMutex.Unlock()
+	reply, ok := p.reply[ref]
+	if !ok {
+		return false
+	}
+	select {
+	case reply <- result:
+		return true
+	default:
+		return false
+	}
 }
 
 // Spawn
@@ -517,9 +774,14 @@ func (p *process) directRequest(request interface{}, timeout int) (interface{},
 		Reply:   make(chan gen.ProcessDirectMessage, 1),
 	}
 
-	// sending request
+	// sending request. the timer taken from the pool might be stopped,
+	// so it must be armed explicitly not to wait forever on the full directbox
+	timer.Reset(time.Second * time.Duration(timeout))
 	select {
 	case p.direct <- direct:
+		if !timer.Stop() {
+			<-timer.C
+		}
 		timer.Reset(time.Second * time.Duration(timeout))
 	case <-timer.C:
 		return nil, ErrProcessBusy
@@ -585,6 +847,10 @@ func (p *process) PutSyncReply(ref etf.Ref, reply etf.Term) error {
 
 // WaitSyncReply
 func (p *process) WaitSyncReply(ref etf.Ref, timeout int) (etf.Term, error) {
+	return p.waitSyncReply(ref, time.Second*time.Duration(timeout))
+}
+
+func (p *process) waitSyncReply(ref etf.Ref, timeout time.Duration) (etf.Term, error) {
 	p.replyMutex.Lock()
 	reply, wait_for_reply := p.reply[ref]
 	p.replyMutex.Unlock()
@@ -601,7 +867,7 @@ func (p *process) WaitSyncReply(ref etf.Ref, timeout int) (etf.Term, error) {
 
 	timer := lib.TakeTimer()
 	defer lib.ReleaseTimer(timer)
-	timer.Reset(time.Second * time.Duration(timeout))
+	timer.Reset(timeout)
 
 	for {
 		select {
@@ -616,6 +882,61 @@ func (p *process) WaitSyncReply(ref etf.Ref, timeout int) (etf.Term, error) {
 
 }
 
+// PendingReplies
+func (p *process) PendingReplies() int {
+	p.replyMutex.Lock()
+	defer p.replyMutex.Unlock()
+	return len(p.reply)
+}
+
+// isSyncRequest returns true if the process is waiting for the reply
+// with the given reference
+func (p *process) isSyncRequest(ref etf.Ref) bool {
+	p.replyMutex.Lock()
+	defer p.replyMutex.Unlock()
+	_, ok := p.reply[ref]
+	return ok
+}
+
+// callByName makes a sync request in fashion of gen_server:call to the process
+// registered with the given name. Monitor is created with the same reference
+// so MessageDown is delivered as a reply if the process doesn't exist.
+func (p *process) callByName(to gen.ProcessID, request etf.Term, timeout time.Duration) (etf.Term, error) {
+	ref := p.MakeRef()
+	message := etf.Tuple{etf.Atom("$gen_call"), etf.Tuple{p.self, ref}, request}
+	if err := p.SendSyncRequest(ref, to, message); err != nil {
+		p.replyMutex.Lock()
+		delete(p.reply, ref)
+		p.replyMutex.Unlock()
+		return nil, err
+	}
+	if to.Node != p.coreNodeName() {
+		p.RouteMonitorReg(p.self, to, ref)
+		defer p.RouteDemonitor(p.self, ref)
+	}
+
+	reply, err := p.waitSyncReply(ref, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if down, ok := reply.(gen.MessageDown); ok && down.Ref == ref {
+		switch down.Reason {
+		case "noproc":
+			return nil, ErrProcessUnknown
+		case "noconnection":
+			return nil, ErrNoRoute
+		}
+		return nil, ErrProcessTerminated
+	}
+	return reply, nil
+}
+
+// CountReduction
+func (p *process) CountReduction() {
+	atomic.AddUint64(&p.reductions, 1)
+}
+
 // ProcessChannels
 func (p *process) ProcessChannels() gen.ProcessChannels {
 	return gen.ProcessChannels{
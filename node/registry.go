@@ -0,0 +1,113 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+)
+
+// exportRegistry makes the snapshot of the names, aliases and behaviors. Every map
+// is copied under its own lock.
+func (c *core) exportRegistry() gen.RegistrySnapshot {
+	snapshot := gen.RegistrySnapshot{
+		Names:     make(map[string]etf.Pid),
+		Aliases:   make(map[etf.Alias]etf.Pid),
+		Behaviors: make(map[string]map[string]gen.RegisteredBehavior),
+	}
+
+	c.mutexNames.Lock()
+	for name, pid := range c.names {
+		snapshot.Names[name] = pid
+	}
+	c.mutexNames.Unlock()
+
+	c.mutexAliases.Lock()
+	for alias, p := range c.aliases {
+		snapshot.Aliases[alias] = p.self
+	}
+	c.mutexAliases.Unlock()
+
+	c.mutexBehaviors.Lock()
+	for group, behaviors := range c.behaviors {
+		groupBehaviors := make(map[string]gen.RegisteredBehavior)
+		for name, rb := range behaviors {
+			groupBehaviors[name] = rb
+		}
+		snapshot.Behaviors[group] = groupBehaviors
+	}
+	c.mutexBehaviors.Unlock()
+
+	return snapshot
+}
+
+// importRegistry restores the registry from the snapshot skipping the entries
+// that can't be restored on this node
+func (c *core) importRegistry(snapshot gen.RegistrySnapshot) error {
+	skippedBehaviors := 0
+	for group, behaviors := range snapshot.Behaviors {
+		for name, rb := range behaviors {
+			if err := c.RegisterBehavior(group, name, rb.Behavior, rb.Data); err != nil {
+				skippedBehaviors++
+			}
+		}
+	}
+
+	skippedNames := 0
+	for name, pid := range snapshot.Names {
+		if c.localProcess(pid) == nil {
+			skippedNames++
+			continue
+		}
+		if err := c.registerName(name, pid); err != nil {
+			skippedNames++
+		}
+	}
+
+	skippedAliases := 0
+	for alias, pid := range snapshot.Aliases {
+		if string(alias.Node) != c.nodename || alias.Creation != c.creation {
+			// made by another node
+			skippedAliases++
+			continue
+		}
+		p := c.localProcess(pid)
+		if p == nil {
+			skippedAliases++
+			continue
+		}
+
+		c.mutexAliases.Lock()
+		if _, exist := c.aliases[alias]; exist {
+			c.mutexAliases.Unlock()
+			skippedAliases++
+			continue
+		}
+		c.aliases[alias] = p
+		c.mutexAliases.Unlock()
+
+		p.Lock()
+		p.aliases = append(p.aliases, alias)
+		p.Unlock()
+	}
+
+	lib.Log("[%s] CORE imported registry (skipped %d names, %d aliases, %d behaviors)",
+		c.nodename, skippedNames, skippedAliases, skippedBehaviors)
+	if skippedNames+skippedAliases+skippedBehaviors > 0 {
+		return fmt.Errorf("%w: skipped %d names, %d aliases, %d behaviors",
+			ErrRegistryImport, skippedNames, skippedAliases, skippedBehaviors)
+	}
+	return nil
+}
+
+// localProcess returns the alive local process with the given pid
+func (c *core) localProcess(pid etf.Pid) *process {
+	c.mutexProcesses.Lock()
+	defer c.mutexProcesses.Unlock()
+	p, exist := c.processes[pid.ID]
+	if exist == false || p.self != pid || p.IsAlive() == false {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,66 @@
+package node
+
+import (
+	"time"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+// Relisten starts the new primary listener on the given port and registers it on the
+// resolver. The previous listener keeps accepting the connections during the grace
+// period for the peers that resolved the previous port.
+func (n *network) Relisten(port uint16) error {
+	n.mutexListeners.Lock()
+	defer n.mutexListeners.Unlock()
+
+	if len(n.listeners) == 0 {
+		return ErrUnsupported
+	}
+	previous := n.listeners[0]
+	if previous.port == port {
+		return nil
+	}
+
+	var rl ResolverListenPort
+	if n.resolver != nil {
+		r, ok := n.resolver.(ResolverListenPort)
+		if ok == false {
+			return ErrUnsupported
+		}
+		rl = r
+	}
+
+	spec := previous.spec
+	spec.Listen = port
+	spec.ListenBegin = port
+	spec.ListenEnd = port
+	l := &listener{
+		spec:      spec,
+		tls:       previous.tls,
+		handshake: previous.handshake,
+	}
+	if err := n.listen(n.ctx, previous.host, spec, l); err != nil {
+		return err
+	}
+
+	if rl != nil {
+		if err := rl.SetListenPort(port); err != nil {
+			l.Close()
+			return err
+		}
+	}
+	n.listeners[0] = l
+	lib.Log("[%s] NETWORK relisten on port %d (previous %d)", n.nodename, port, previous.port)
+
+	go func() {
+		timer := time.NewTimer(n.relistenGracePeriod)
+		defer timer.Stop()
+		select {
+		case <-n.ctx.Done():
+		case <-timer.C:
+		}
+		previous.Close()
+		lib.Log("[%s] NETWORK closed listener on port %d", n.nodename, previous.port)
+	}()
+	return nil
+}
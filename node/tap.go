@@ -0,0 +1,102 @@
+package node
+
+import (
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+)
+
+// tapProcess makes the collector receive a copy of every message put into the mailbox
+// of the given local process from now on
+func (c *core) tapProcess(pid etf.Pid, collector etf.Pid) (etf.Ref, error) {
+	// keep the lock to not race with unregistering the process (see cleanTaps)
+	c.mutexProcesses.Lock()
+	defer c.mutexProcesses.Unlock()
+	p, exist := c.processes[pid.ID]
+	if !exist || p.self != pid || p.IsAlive() == false {
+		return etf.Ref{}, ErrProcessUnknown
+	}
+
+	ref := c.MakeRef()
+	c.mutexTaps.Lock()
+	c.taps[ref] = p
+	c.mutexTaps.Unlock()
+
+	p.Lock()
+	if p.taps == nil {
+		p.taps = make(map[etf.Ref]etf.Pid)
+	}
+	p.taps[ref] = collector
+	p.Unlock()
+
+	lib.Log("[%s] CORE tap %s => %s (%s)", c.nodename, pid, collector, ref)
+	return ref, nil
+}
+
+// untap removes the tap. Returns false if it's unknown.
+func (c *core) untap(ref etf.Ref) bool {
+	c.mutexTaps.Lock()
+	p, exist := c.taps[ref]
+	delete(c.taps, ref)
+	c.mutexTaps.Unlock()
+	if !exist {
+		return false
+	}
+
+	p.Lock()
+	delete(p.taps, ref)
+	p.Unlock()
+	lib.Log("[%s] CORE untap %s (%s)", c.nodename, p.self, ref)
+	return true
+}
+
+// forwardTaps sends the copy of the received message to the collectors on behalf of
+// the tapped process. The copies themselves are never forwarded to avoid the loop
+// if the collector is tapped as well.
+func (c *core) forwardTaps(p *process, from etf.Pid, message etf.Term) {
+	if _, ok := message.(gen.MessageTap); ok {
+		return
+	}
+
+	p.RLock()
+	if len(p.taps) == 0 {
+		p.RUnlock()
+		return
+	}
+	taps := make(map[etf.Ref]etf.Pid, len(p.taps))
+	for ref, collector := range p.taps {
+		taps[ref] = collector
+	}
+	p.RUnlock()
+
+	for ref, collector := range taps {
+		tap := gen.MessageTap{
+			Ref:     ref,
+			Pid:     p.self,
+			From:    from,
+			Message: message,
+		}
+		if err := c.RouteSend(p.self, collector, tap); err != nil {
+			lib.Log("[%s] CORE can't forward tapped message of %s to %s: %s", c.nodename, p.self, collector, err)
+		}
+	}
+}
+
+// cleanTaps removes the taps of the terminated process. Must be called under the mutexProcesses
+func (c *core) cleanTaps(p *process) {
+	p.RLock()
+	refs := make([]etf.Ref, 0, len(p.taps))
+	for ref := range p.taps {
+		refs = append(refs, ref)
+	}
+	p.RUnlock()
+	if len(refs) == 0 {
+		return
+	}
+
+	c.mutexTaps.Lock()
+	for _, ref := range refs {
+		delete(c.taps, ref)
+	}
+	c.mutexTaps.Unlock()
+}
@@ -0,0 +1,32 @@
+package node
+
+import (
+	"time"
+)
+
+// realTimerSource is the default TimerSource based on the time package
+type realTimerSource struct{}
+
+type realTimer struct {
+	*time.Timer
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (realTimerSource) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realTimerSource) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/lib"
+)
+
+// addTombstone keeps the record about the terminated process if the retention is enabled
+// (see Options.TerminatedRetention). The oldest record is dropped on exceeding the limit.
+func (c *core) addTombstone(pid etf.Pid, name string, reason string) {
+	if c.tombstonesLimit < 1 {
+		return
+	}
+	tombstone := ProcessTombstone{
+		PID:        pid,
+		Name:       name,
+		Reason:     reason,
+		Terminated: time.Now(),
+	}
+
+	c.mutexTombstones.Lock()
+	defer c.mutexTombstones.Unlock()
+	c.expireTombstones()
+	if len(c.tombstones) >= c.tombstonesLimit {
+		// do not keep the reference to the dropped record in the underlying array
+		c.tombstones[0] = ProcessTombstone{}
+		c.tombstones = c.tombstones[1:]
+	}
+	c.tombstones = append(c.tombstones, tombstone)
+}
+
+// terminatedProcess returns the record about the terminated process
+func (c *core) terminatedProcess(pid etf.Pid) (ProcessTombstone, bool) {
+	c.mutexTombstones.Lock()
+	defer c.mutexTombstones.Unlock()
+	c.expireTombstones()
+	for i := len(c.tombstones) - 1; i >= 0; i-- {
+		if c.tombstones[i].PID == pid {
+			return c.tombstones[i], true
+		}
+	}
+	return ProcessTombstone{}, false
+}
+
+// purgeTerminated drops all the records about the terminated processes
+func (c *core) purgeTerminated() int {
+	c.mutexTombstones.Lock()
+	defer c.mutexTombstones.Unlock()
+	n := len(c.tombstones)
+	c.tombstones = nil
+	lib.Log("[%s] CORE purged %d records about the terminated processes", c.nodename, n)
+	return n
+}
+
+// expireTombstones must be called under the mutexTombstones
+func (c *core) expireTombstones() {
+	if c.tombstonesTTL == 0 {
+		return
+	}
+	deadline := time.Now().Add(-c.tombstonesTTL)
+	n := 0
+	// records are ordered by the time of termination
+	for n < len(c.tombstones) && c.tombstones[n].Terminated.Before(deadline) {
+		c.tombstones[n] = ProcessTombstone{}
+		n++
+	}
+	c.tombstones = c.tombstones[n:]
+}
@@ -3,8 +3,10 @@ package node
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
@@ -16,12 +18,15 @@ var (
 	ErrAppAlreadyStarted    = fmt.Errorf("Application is already started")
 	ErrAppUnknown           = fmt.Errorf("Unknown application name")
 	ErrAppIsNotRunning      = fmt.Errorf("Application is not running")
+	ErrAppDependencyCycle   = fmt.Errorf("Application dependency cycle")
 	ErrNameUnknown          = fmt.Errorf("Unknown name")
 	ErrNameOwner            = fmt.Errorf("Not an owner")
 	ErrProcessBusy          = fmt.Errorf("Process is busy")
+	ErrMessageTooLarge      = fmt.Errorf("Message is too large")
 	ErrProcessUnknown       = fmt.Errorf("Unknown process")
 	ErrProcessIncarnation   = fmt.Errorf("Process ID belongs to the previous incarnation")
 	ErrProcessTerminated    = fmt.Errorf("Process terminated")
+	ErrProcessMailboxFull   = fmt.Errorf("Mailbox is full")
 	ErrMonitorUnknown       = fmt.Errorf("Unknown monitor reference")
 	ErrSenderUnknown        = fmt.Errorf("Unknown sender")
 	ErrBehaviorUnknown      = fmt.Errorf("Unknown behavior")
@@ -32,6 +37,20 @@ var (
 	ErrTaken                = fmt.Errorf("Resource is taken")
 	ErrTimeout              = fmt.Errorf("Timed out")
 	ErrFragmented           = fmt.Errorf("Fragmented data")
+	ErrTooManyConnections   = fmt.Errorf("Too many connections")
+	ErrScheduleInterval     = fmt.Errorf("Schedule interval must be positive")
+	ErrClusterQuorum        = fmt.Errorf("Quorum must be between 1 and the number of the cluster nodes")
+	ErrNodeMaintenance      = fmt.Errorf("Node is in maintenance mode")
+	ErrRegistryImport       = fmt.Errorf("Registry snapshot is partially imported")
+	ErrRemoteSpawnBusy      = fmt.Errorf("Too many remote spawn requests")
+	ErrSelfConnect          = fmt.Errorf("Can't connect to itself")
+
+	// handshake failure reasons (see HandshakeStats). Handshake implementations
+	// wrap them (fmt.Errorf with %w) to get the failures counted by reason.
+	ErrHandshakeTimeout = fmt.Errorf("Handshake timeout")
+	ErrHandshakeCookie  = fmt.Errorf("Handshake cookie mismatch")
+	ErrHandshakeVersion = fmt.Errorf("Handshake version mismatch")
+	ErrHandshakeTLS     = fmt.Errorf("Handshake TLS failure")
 
 	ErrUnsupported = fmt.Errorf("Not supported")
 )
@@ -42,6 +61,20 @@ const (
 	defaultListenBegin uint16 = 15000
 	defaultListenEnd   uint16 = 65000
 
+	defaultTLSSessionCacheSize = 64
+	defaultTLSHandshakeTimeout = 5 * time.Second
+
+	defaultResolveTimeout = 5 * time.Second
+	defaultDialTimeout    = 5 * time.Second
+
+	defaultRelistenGracePeriod = 5 * time.Second
+
+	defaultReconnectBackoffBase = time.Second
+	defaultReconnectBackoffMax  = 30 * time.Second
+
+	// DefaultObserveBufferSize the size of the channel returned by Observe
+	DefaultObserveBufferSize int = 1024
+
 	EnvKeyVersion gen.EnvKey = "ergo:Version"
 	EnvKeyNode    gen.EnvKey = "ergo:Node"
 
@@ -58,24 +91,167 @@ type Node interface {
 	IsAlive() bool
 	// Uptime returns node uptime in seconds
 	Uptime() int64
+	// UptimeDuration returns node uptime measured with the monotonic clock
+	UptimeDuration() time.Duration
+	// StartedAt returns the time the node was started at
+	StartedAt() time.Time
 	// Version return node version
 	Version() Version
+	// Flags returns the set of features enabled on this node
+	Flags() gen.NodeFlags
 	// Spawn spawns a new process
 	Spawn(name string, opts gen.ProcessOptions, object gen.ProcessBehavior, args ...etf.Term) (gen.Process, error)
+	// SpawnLink spawns a new process linked to the local process 'parent'. The link is
+	// established before the process loop is started, so the exit is never missed.
+	SpawnLink(parent etf.Pid, name string, opts gen.ProcessOptions, object gen.ProcessBehavior, args ...etf.Term) (gen.Process, error)
+	// SpawnMonitor spawns a new process monitored by the local process 'parent'. The monitor
+	// is created before the process loop is started. Returns the monitor reference.
+	SpawnMonitor(parent etf.Pid, name string, opts gen.ProcessOptions, object gen.ProcessBehavior, args ...etf.Term) (gen.Process, etf.Ref, error)
+
+	// CallByName makes a sync request (in fashion of gen_server:call) to the process
+	// registered with the given name on the given node. The 'from' process must be
+	// based on gen.Server. Returns ErrTimeout if the timeout is exceeded and
+	// ErrProcessUnknown if the name is not registered.
+	CallByName(from etf.Pid, nodename, name string, request etf.Term, timeout time.Duration) (etf.Term, error)
+
+	// SendAfter starts a timer. When the timer expires, the message is sent to the process 'to'
+	// on behalf of the process 'from'. The timer is canceled automatically if one of these
+	// processes has terminated.
+	SendAfter(from etf.Pid, to etf.Pid, message etf.Term, after time.Duration) context.CancelFunc
+	// CancelTimers cancels all the timers (made with SendAfter) owned by or targeting the
+	// given process. Returns the number of canceled timers.
+	CancelTimers(pid etf.Pid) int
+	// ScheduleInterval runs fn every interval in its own goroutine until the schedule is
+	// canceled with CancelSchedule or the node is stopped. Intended for the node-level
+	// housekeeping (metrics flushing, cache eviction). Returns ErrTaken if the given name
+	// is already scheduled.
+	ScheduleInterval(name string, interval time.Duration, fn func()) error
+	// CancelSchedule cancels the schedule with the given name. Returns false if it doesn't exist.
+	CancelSchedule(name string) bool
+
+	// ProcessEnv returns the environment variables of the running local process
+	// including the ones inherited from its parent and group leader. Returns
+	// ErrProcessUnknown if the process doesn't exist or has terminated.
+	ProcessEnv(pid etf.Pid) (map[gen.EnvKey]interface{}, error)
+	// SetProcessEnv sets the environment variable of the running local process (e.g.
+	// to flip the feature flag at runtime). The nil value removes the variable.
+	SetProcessEnv(pid etf.Pid, name gen.EnvKey, value interface{}) error
+
+	// PauseProcess makes the messages addressed to the local process be held instead of
+	// delivering them to its mailbox. The number of held messages is limited by the mailbox
+	// size, the sender gets ErrProcessMailboxFull on exceeding this limit.
+	PauseProcess(pid etf.Pid) error
+	// ResumeProcess delivers the held messages to the process preserving their order.
+	// It never blocks. If the mailbox has no room for all of them, the process remains
+	// paused with the rest of the messages held and ErrProcessMailboxFull is returned.
+	ResumeProcess(pid etf.Pid) error
+	// MigrateProcess moves the local process to the target node. The process is paused,
+	// its state is captured with gen.MessageDirectInspect once the mailbox is drained,
+	// and the equivalent process is spawned on the target node. The held messages are
+	// forwarded to the spawned process, the names of the source process are pointed to it
+	// and the source process is terminated with the reason "migrated". Returns the pid of
+	// the spawned process. On failure, the source process is resumed.
+	MigrateProcess(pid etf.Pid, targetNode string) (etf.Pid, error)
+
+	// SendRaw sends the pre-encoded message (etf.Encode with disabled atom cache) to the
+	// process with the given pid. Allows to encode the message once and send it to many
+	// remote processes without re-encoding.
+	SendRaw(from etf.Pid, to etf.Pid, encoded []byte) error
+	// RouteSendWithTTL sends the message that must be processed within the given ttl.
+	// If the local process gets this message from the mailbox after the deadline, the
+	// message is dropped. For the remote process the message is sent as a regular one.
+	// The deadline is honoured by the gen.Server based processes only. The process
+	// with a custom ProcessLoop gets it in gen.ProcessMailboxMessage and must check
+	// it on its own.
+	RouteSendWithTTL(from etf.Pid, to etf.Pid, message etf.Term, ttl time.Duration) error
+
+	// MonitorMulti creates monitors between the process 'by' and the given targets.
+	// Returns a reference per target in the same order. Remote targets are grouped
+	// by node to reduce the overhead.
+	MonitorMulti(by etf.Pid, targets []etf.Pid) ([]etf.Ref, error)
+	// DemonitorMulti removes monitors created with MonitorMulti (or MonitorProcess by pid)
+	DemonitorMulti(refs []etf.Ref)
 
-	// RegisterName
+	// RegisterName associates the name with pid. The name is published to the
+	// Options.GlobalRegistry (if it's set)
 	RegisterName(name string, pid etf.Pid) error
 	// UnregisterName
 	UnregisterName(name string) error
+	// RegisterNameScoped associates the name with pid within the scope of the given application,
+	// so different applications can use the same name. Scoped name is registered as "app/name".
+	RegisterNameScoped(app string, name string, pid etf.Pid) error
+	// UnregisterNameScoped
+	UnregisterNameScoped(app string, name string) error
+
+	// TerminatedProcess returns the record about the terminated process if the retention
+	// is enabled (see Options.TerminatedRetention)
+	TerminatedProcess(pid etf.Pid) (ProcessTombstone, bool)
+	// PurgeTerminated drops all the records about the terminated processes. Returns the
+	// number of the dropped records.
+	PurgeTerminated() int
+
+	// TapProcess makes the collector receive a copy of every message put into the mailbox
+	// of the given local process from now on as gen.MessageTap. The tapped process isn't
+	// modified. Multiple taps of the same process are allowed. The tap is removed with
+	// Untap or on termination of the tapped process.
+	TapProcess(pid etf.Pid, collector etf.Pid) (etf.Ref, error)
+	// Untap removes the tap. Returns false if it's unknown.
+	Untap(ref etf.Ref) bool
+
+	// ExportRegistry returns the snapshot of the registered names, aliases and behaviors
+	ExportRegistry() gen.RegistrySnapshot
+	// ImportRegistry restores the registry from the snapshot (e.g. to warm-start
+	// the replacement node). The behaviors are restored unless their names are taken
+	// (their data is shared with the source node, not copied). The names and aliases
+	// are pid-scoped, so they are restored only for the alive processes of this node
+	// (aliases must be made by this node as well) if they aren't taken. Returns
+	// ErrRegistryImport with the number of the skipped entries if any.
+	ImportRegistry(snapshot gen.RegistrySnapshot) error
+
+	// JoinGroup adds the local process to the named group. The membership is replicated
+	// across the connected nodes (like OTP pg), so every node elects the same leader: the
+	// member joined first (by the clock of its node). If the leader terminates (or leaves
+	// the group) the next joined member is promoted and the subscribers get
+	// gen.MessageGroupLeader. Remote members are removed if the connection to their node
+	// is down. The nodes that are not connected to each other (network partition) elect
+	// their own leaders. On reconnecting, the membership is synced and the leader joined
+	// first wins.
+	JoinGroup(name string, pid etf.Pid) error
+	// LeaveGroup removes the local process from the group
+	LeaveGroup(name string, pid etf.Pid) error
+	// GroupLeader returns the leader of the group. Returns empty etf.Pid if the group
+	// has no members.
+	GroupLeader(name string) etf.Pid
+	// GroupMembers returns the members of the group in order they joined. The first one is the leader.
+	GroupMembers(name string) []etf.Pid
+	// SubscribeGroup makes the local process receive gen.MessageGroupLeader on changing
+	// the leader of the group.
+	SubscribeGroup(name string, pid etf.Pid) error
+	// UnsubscribeGroup
+	UnsubscribeGroup(name string, pid etf.Pid)
+
+	// Observe returns a channel delivering the changes of the node state: spawning and
+	// termination of the processes, registering and unregistering the names. The channel
+	// is buffered (DefaultObserveBufferSize). Events are never blocking the node, so they
+	// are dropped if the consumer is too slow and the buffer is full. The channel is
+	// closed on stopping the node or on calling the returned cancel function.
+	Observe() (<-chan gen.NodeDelta, func())
 
 	LoadedApplications() []gen.ApplicationInfo
 	WhichApplications() []gen.ApplicationInfo
 	ApplicationInfo(name string) (gen.ApplicationInfo, error)
+	// ApplicationByPid returns the name of the application the process belongs to
+	ApplicationByPid(pid etf.Pid) (string, bool)
 	ApplicationLoad(app gen.ApplicationBehavior, args ...etf.Term) (string, error)
 	ApplicationUnload(appName string) error
 	ApplicationStart(appName string, args ...etf.Term) (gen.Process, error)
 	ApplicationStartPermanent(appName string, args ...etf.Term) (gen.Process, error)
 	ApplicationStartTransient(appName string, args ...etf.Term) (gen.Process, error)
+	// ApplicationStartSync starts Application (with start type ApplicationStartTemporary)
+	// and returns once all the processes of its supervision tree are initialized. Returns
+	// the error with the name of the failing child or ErrTimeout if the timeout is exceeded
+	// (the application is stopped once it's started).
+	ApplicationStartSync(appName string, timeout time.Duration, args ...etf.Term) (gen.Process, error)
 	ApplicationStop(appName string) error
 
 	ProvideRPC(module string, function string, fun gen.RPC) error
@@ -90,17 +266,87 @@ type Node interface {
 	// StaticRoutes returns list of routes added using AddStaticRoute
 	StaticRoutes() []Route
 
-	// Connect sets up a connection to node
+	// Connect sets up a connection to node. The error wraps ErrHandshakeCookie
+	// if the peer has rejected the cookie, so it can be told apart from the
+	// network failures using errors.Is
 	Connect(node string) error
+	// ConnectConn sets up a connection to the node over the given established connection
+	// (e.g. a tunnel over SSH, QUIC or WebSocket made by the caller) instead of dialing.
+	// The handshake is started over this connection using options.Handshake (or the
+	// default one). The name of the peer isn't verified, so it must be trusted.
+	// The connection is closed on failure.
+	ConnectConn(node string, conn net.Conn, options RouteOptions) error
+	// AcceptConn accepts the connection from the node over the given established connection
+	// (e.g. accepted by the custom listener or WebSocket upgrade handler). The handshake is
+	// accepted using options.Handshake (or the default one). Returns the name of the
+	// connected node. The connection is closed on failure.
+	AcceptConn(conn net.Conn, options RouteOptions) (string, error)
 	// Nodes returns the list of connected nodes
 	Nodes() []string
+	// Connection returns the connection to the given node. Returns ErrNoRoute
+	// if there is no established connection to this node.
+	Connection(nodename string) (ConnectionInterface, error)
+	// PeerSupports returns true if the given feature is enabled for the connection
+	// with the node. Returns ErrNoRoute if there is no established connection to this node.
+	PeerSupports(nodename string, feature gen.Feature) (bool, error)
+	// SetCluster defines the expected set of nodes. The cluster is ready once the quorum
+	// of them is connected (this node is counted if it belongs to the set). Returns
+	// ErrClusterQuorum if the quorum exceeds the number of nodes.
+	SetCluster(nodes []string, quorum int) error
+	// ClusterReady returns true if the quorum of the cluster nodes is connected
+	ClusterReady() bool
+	// SubscribeCluster makes the local process receive gen.MessageClusterReady on changing
+	// the readiness of the cluster.
+	SubscribeCluster(pid etf.Pid) error
+	// UnsubscribeCluster
+	UnsubscribeCluster(pid etf.Pid)
+	// Barrier blocks until all the messages sent to the given node before this call
+	// have been written to the connection. Returns ErrNoRoute if there is no established
+	// connection or it was closed in the meantime, so the messages might have been lost
+	// (e.g. during the reconnect). It only waits for the socket write: the distribution
+	// protocol has no acknowledgements, so the successful barrier doesn't mean the peer
+	// has received the messages. At-least-once delivery requires the acknowledgements
+	// at the application level.
+	Barrier(nodename string) error
+	// NetworkStats returns the number of established connections, the limit and the state
+	// of reconnecting to the statically routed nodes
+	NetworkStats() NetworkStats
+	// SetMaintenance enables/disables the maintenance mode. In this mode the node refuses
+	// new inbound connections and remote spawn requests (ErrNodeMaintenance), while the
+	// established connections keep working. The mode is advertised to the cluster
+	// if the resolver implements ResolverMaintenance.
+	SetMaintenance(enable bool) error
+	// Maintenance returns true if the node is in maintenance mode
+	Maintenance() bool
+	// Relisten moves the primary listener to the given port with no downtime. The new
+	// listener is registered on the resolver (it must implement ResolverListenPort),
+	// the previous one is closed after Options.RelistenGracePeriod. The established
+	// connections are kept. Returns error keeping the previous listener if the new
+	// port can't be bound.
+	Relisten(port uint16) error
+	// Metrics returns the snapshot of the node metrics: process counts, routing counters,
+	// connections and runtime stats. See Options.MetricsSink to push them periodically.
+	Metrics() NodeMetrics
 
 	Links(process etf.Pid) []etf.Pid
 	Monitors(process etf.Pid) []etf.Pid
 	MonitorsByName(process etf.Pid) []gen.ProcessID
 	MonitoredBy(process etf.Pid) []etf.Pid
+	// MonitorsExt returns monitors created by the given process (by pid and by name)
+	// including the monitor reference and the node the target belongs to
+	MonitorsExt(process etf.Pid) []gen.MonitorInfo
+	// AllMonitors returns the monitors of all the processes on this node (including
+	// the monitors of the nodes). Useful to find the processes leaking the monitors.
+	AllMonitors() []gen.MonitorRecord
+	// AllLinks returns the links of all the processes on this node
+	AllLinks() []gen.LinkRecord
 
 	Stop()
+	// StopWithReason stops the node. The given reason is available for the terminating
+	// processes via Process.NodeStopReason
+	StopWithReason(reason string)
+	// StopReason returns the reason given to StopWithReason
+	StopReason() string
 	Wait()
 	WaitWithTimeout(d time.Duration) error
 }
@@ -125,10 +371,16 @@ type CoreRouter interface {
 	RouteSendReg(from etf.Pid, to gen.ProcessID, message etf.Term) error
 	// RouteSendAlias routes message by process alias
 	RouteSendAlias(from etf.Pid, to etf.Alias, message etf.Term) error
+	// RouteSendWithReceipt routes message by Pid and sends gen.MessageDeliveryReceipt
+	// to the local sender once the message is queued
+	RouteSendWithReceipt(from etf.Pid, to etf.Pid, message etf.Term) (etf.Ref, error)
 
 	ProcessByPid(pid etf.Pid) gen.Process
 	ProcessByName(name string) gen.Process
 	ProcessByAlias(alias etf.Alias) gen.Process
+	// HasRawReceivers returns true if there is a local process receiving the raw
+	// messages (see gen.ProcessOptions.RawMessages)
+	HasRawReceivers() bool
 
 	GetConnection(nodename string) (ConnectionInterface, error)
 
@@ -142,6 +394,8 @@ type CoreRouter interface {
 	RouteUnlink(pidA etf.Pid, pidB etf.Pid) error
 	// RouteExit routes MessageExit to the linked process
 	RouteExit(to etf.Pid, terminated etf.Pid, reason string) error
+	// RouteKill terminates the local process regardless of trapping exits
+	RouteKill(to etf.Pid) error
 	// RouteMonitorReg makes monitor to the given registered process name (gen.ProcessID)
 	RouteMonitorReg(by etf.Pid, process gen.ProcessID, ref etf.Ref) error
 	// RouteMonitor makes monitor to the given Pid
@@ -149,6 +403,8 @@ type CoreRouter interface {
 	RouteDemonitor(by etf.Pid, ref etf.Ref) error
 	RouteMonitorExitReg(to etf.Pid, terminated gen.ProcessID, reason string, ref etf.Ref) error
 	RouteMonitorExit(to etf.Pid, terminated etf.Pid, reason string, ref etf.Ref) error
+	// RouteNodeUp
+	RouteNodeUp(name string)
 	// RouteNodeDown
 	RouteNodeDown(name string)
 
@@ -170,6 +426,9 @@ type TLSMode int
 // ProxyMode
 type ProxyMode int
 
+// TCPNoDelay
+type TCPNoDelay int
+
 const (
 	// TLSModeDisabled no TLS encryption
 	TLSModeDisabled TLSMode = 0
@@ -181,12 +440,29 @@ const (
 	// ProxyModeDisabled
 	ProxyModeDisabled ProxyMode = 0
 	ProxyModeEnabled  ProxyMode = 1
+
+	// TCPNoDelayDefault keeps the Go default (TCP_NODELAY is enabled)
+	TCPNoDelayDefault TCPNoDelay = 0
+	TCPNoDelayEnable  TCPNoDelay = 1
+	TCPNoDelayDisable TCPNoDelay = 2
 )
 
 // Options defines bootstrapping options for the node
 type Options struct {
-	// Applications application list that must be started
+	// Applications application list that must be started. The node fails to start
+	// with ErrAppDependencyCycle if their dependencies make a cycle.
 	Applications []gen.ApplicationBehavior
+	// ApplicationStartDelay defines a pause between the starting of applications
+	// listed in Applications (the concurrent starts are spaced by it as well).
+	// Allows to smooth the resource usage on the booting node.
+	ApplicationStartDelay time.Duration
+	// ApplicationStartJitter adds a random value in range [0, ApplicationStartJitter)
+	// to the ApplicationStartDelay.
+	ApplicationStartJitter time.Duration
+	// ApplicationStartConcurrent enables starting the applications concurrently.
+	// Application is started right after all its dependencies (listed in the
+	// Applications field of its spec) have been started.
+	ApplicationStartConcurrent bool
 	// Env node environment
 	Env map[gen.EnvKey]interface{}
 
@@ -202,6 +478,53 @@ type Options struct {
 	// Default values 15000 and 65000 accordingly
 	ListenBegin uint16
 	ListenEnd   uint16
+	// RelistenGracePeriod defines how long the previous listener keeps accepting
+	// the connections after changing the port with Relisten. Default 5 seconds
+	RelistenGracePeriod time.Duration
+
+	// AdvertiseHost defines the externally reachable host (NAT, containers). The node is
+	// registered on the resolver and known to the peers as name@AdvertiseHost, while the
+	// listeners bind to the host given in the node name on start (see ListenerSpec.Host).
+	AdvertiseHost string
+
+	// Aliases defines additional names the node is registered with on the resolver
+	// (e.g. the old name during the renaming of the cluster), so the peers knowing the node
+	// by any of these names can connect to it. The handshake doesn't check the name
+	// the connection was addressed to, so the node accepts them as well.
+	Aliases []string
+
+	// Listeners defines a set of listeners the node accepts incoming connections on
+	// simultaneously (e.g. plaintext and TLS ones during the migration). Each listener
+	// has its own port range, TLS settings and handshake. If it's empty, the node listens
+	// according to the Listen*, TLS* and Handshake options. The first listener is
+	// the primary one, its handshake is used for the outgoing connections. All of them
+	// are advertised by the resolver, the Ergo peers with enabled TLS prefer the TLS one.
+	Listeners []ListenerSpec
+
+	// Dialer makes the outgoing connections to the peers (proxying, TCP options tuning).
+	// TLS is established over the connection made by this dialer. Pass it to the resolver
+	// to use it for the resolver's connections as well (see dist.ResolverOptions.Dialer).
+	// Default is net.Dialer
+	Dialer DialFunc
+	// DialTimeout limits the time of making the outgoing connection to the peer
+	// including resolving its host name. Default 5 seconds
+	DialTimeout time.Duration
+	// ResolveTimeout limits the time of resolving the host name of the static
+	// route (see AddStaticRoute). Default 5 seconds
+	ResolveTimeout time.Duration
+
+	// TCPNoDelay enables/disables Nagle's algorithm for the dialed and accepted
+	// connections. Disabling TCP_NODELAY benefits the bulk transfer. Can be overridden
+	// per route (see RouteOptions.TCPNoDelay).
+	TCPNoDelay TCPNoDelay
+	// TCPReadBuffer and TCPWriteBuffer define the socket buffer sizes for the dialed
+	// and accepted connections. Default 0 (the system default). Can be overridden per route.
+	TCPReadBuffer  int
+	TCPWriteBuffer int
+
+	// MaxConnections limits the number of simultaneous connections to the peers.
+	// Default value 0 (unlimited)
+	MaxConnections int
 
 	// StaticRoutesOnly disables resolving service (default is EPMD client) and
 	// makes resolving localy only for nodes added using gen.AddStaticRoute
@@ -217,8 +540,104 @@ type Options struct {
 	// Resolver defines a resolving service (default is EPMD service, client and server)
 	Resolver Resolver
 
+	// GlobalRegistry defines an external registry of the process names shared across
+	// the cluster. The names registered with RegisterName are published to this registry
+	// (the names given on spawning are local only) and the names that are not found
+	// locally are resolved using it (see WhereIs). Sending by name uses it as well.
+	GlobalRegistry GlobalRegistry
+
 	// Compression enables compression for outgoing messages
 	Compression bool
+	// CompressionDictionary defines the preset dictionary (zlib) for compressing the messages.
+	// Improves compression ratio for the small and structurally similar messages. The same
+	// dictionary must be used on both sides (it must be agreed out of band). Can be overridden
+	// per route (see RouteOptions.CompressionDictionary).
+	CompressionDictionary []byte
+
+	// AtomCacheSize limits the number of atoms in the header atom cache for each
+	// connection. Default 0 (2048, maximum allowed by the protocol)
+	AtomCacheSize int
+	// AtomCachePreload defines the atoms put into the header atom cache on establishing
+	// the connection. Atoms known in advance are sent using the cache references
+	// starting from the first message, which reduces the traffic of the short-lived
+	// connections.
+	AtomCachePreload []etf.Atom
+
+	// Middleware is the chain of the handlers invoked for every message sent to and
+	// received from the remote processes (e.g. for signing or auditing the messages).
+	// Can be extended per route (see RouteOptions.Middleware).
+	Middleware []MessageMiddleware
+
+	// EncodeStringAsBinary makes Go strings be encoded as binaries instead of the
+	// list of chars for all connections. Can be enabled per connection by the handshake
+	// using ProtoFlags.EnableStringAsBinary
+	EncodeStringAsBinary bool
+
+	// EncodeTime defines the way time.Time values are encoded for all connections.
+	// Default is etf.TimeEncodingTimestamp ({MegaSecs, Secs, MicroSecs}).
+	EncodeTime etf.TimeEncoding
+
+	// PanicPolicy defines the way of handling the panics happened in the processes.
+	// Default is gen.PanicPolicyIsolate (the process is terminated with reason "panic").
+	// gen.PanicPolicyCrashNode propagates the panic crashing the node. With
+	// gen.PanicPolicyCallback the decision is made by PanicHandler.
+	PanicPolicy gen.PanicPolicy
+	// PanicHandler is invoked if PanicPolicy is gen.PanicPolicyCallback (must be defined
+	// in this case). It's invoked once per panic.
+	PanicHandler gen.PanicHandler
+
+	// MetricsSink is invoked every MetricsInterval with the snapshot of the node metrics
+	// (see Node.Metrics) to push them to the monitoring system. It runs on its own goroutine.
+	MetricsSink func(metrics NodeMetrics)
+	// MetricsSinkName defines the local process (registered name) receiving the snapshot
+	// of the node metrics as a message every MetricsInterval. Can be used along with MetricsSink.
+	MetricsSinkName string
+	// MetricsInterval defines how often the metrics are pushed. They are scheduled with
+	// the name "ergo:metrics" (see ScheduleInterval). Default 10 seconds
+	MetricsInterval time.Duration
+
+	// DropLogSample makes the node log every Nth message dropped due to the full mailbox
+	// or undelivered to the unknown local process, regardless of the "ergo.trace" flag
+	// (with lib.LogLevelWarning, see lib.SetLogLevel).
+	// Default 0 (such messages are logged with the "ergo.trace" flag only, each of them)
+	DropLogSample int
+	// DropLogRate limits the number of the dropped messages logged per second if
+	// DropLogSample is set. Default 0 (unlimited)
+	DropLogRate int
+
+	// TerminatedRetention defines the number of records about the terminated processes
+	// (pid, name, exit reason) kept for the diagnostics (see Node.TerminatedProcess).
+	// The oldest record is dropped on exceeding this limit. Default 0 (disabled)
+	TerminatedRetention int
+	// TerminatedRetentionTTL defines how long the records about the terminated processes
+	// are kept. Default 0 (until they are dropped by the TerminatedRetention limit)
+	TerminatedRetentionTTL time.Duration
+
+	// RemoteSpawnConcurrency limits the number of the remote spawn requests (see
+	// ProvideRemoteSpawn) handled simultaneously to protect the node from the spawn storm
+	// initiated by the peers. Default 0 (unlimited)
+	RemoteSpawnConcurrency int
+	// RemoteSpawnWait defines how long the remote spawn request waits for the free slot
+	// if RemoteSpawnConcurrency is reached. The request is rejected with ErrRemoteSpawnBusy
+	// on exceeding it. Waiting blocks reading from the connection the request came from.
+	// Default 0 (rejected immediately)
+	RemoteSpawnWait time.Duration
+
+	// TimerSource creates the timers for Node.SendAfter, Node.ScheduleInterval and
+	// Process.SendAfter. Tests can use the fake clock (see nodetest.FakeTimerSource)
+	// to fire them deterministically. Default is the real time.
+	TimerSource TimerSource
+
+	// ValidateOnSend enables validation of the messages sent to the remote processes
+	// (see etf.Validate). Sending the message with a value that can't be encoded
+	// returns an error before the message is passed to the connection.
+	ValidateOnSend bool
+
+	// FlowControl enables backpressure for the remote senders. If the mailbox of the local
+	// process is full, the sender is asked to pause sending to this process. Sending to
+	// the paused process returns ErrProcessBusy. It's enabled for the connection if the
+	// peer has enabled it as well (Ergo peers only), the handshake negotiates it.
+	FlowControl bool
 
 	// ProxyMode enables/disables proxy mode for the node
 	ProxyMode ProxyMode
@@ -229,6 +648,27 @@ type Options struct {
 	TLSKeyServer string
 	TLSCrtClient string
 	TLSKeyClient string
+	// TLSStartTLS allows gradual TLS rollout. The listener accepts both TLS and plaintext
+	// connections and upgrades the connection to TLS if the peer starts TLS handshake.
+	// Outgoing connections use TLS if the peer advertises TLS support.
+	TLSStartTLS bool
+	// TLSSessionResumption enables TLS session resumption (session tickets) for the
+	// connections between the nodes, so the reconnecting node skips the full TLS handshake.
+	TLSSessionResumption bool
+	// TLSSessionCacheSize defines the number of sessions kept by the client session cache.
+	// Default 64
+	TLSSessionCacheSize int
+	// TLSVerifyPeer is invoked on accepting the connection once the peer has introduced
+	// itself in the handshake. It gets the claimed node name and the client certificate
+	// (nil if there is none, e.g. the plaintext connection with TLSStartTLS), so the
+	// certificate issued for one node can't be used to impersonate another one. The
+	// connection is closed if it returns an error. Makes the listeners with enabled TLS
+	// require the client certificate signed by one of TLSClientCAs.
+	TLSVerifyPeer func(peername string, cert *x509.Certificate) error
+	// TLSClientCAs defines the certificate authorities the client certificates are
+	// verified against. Must be defined if TLSVerifyPeer is set, otherwise any self-signed
+	// certificate could be used to claim the node name.
+	TLSClientCAs *x509.CertPool
 
 	// Handshake defines a handshake handler. By default is using
 	// DIST handshake created with dist.CreateHandshake(...)
@@ -242,17 +682,122 @@ type Options struct {
 	CloudOptions CloudOptions
 }
 
+// ProcessTombstone keeps the details about the terminated process
+type ProcessTombstone struct {
+	PID        etf.Pid
+	Name       string
+	Reason     string
+	Terminated time.Time
+}
+
+// DialFunc makes the outgoing connection (see net.Dialer.DialContext)
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// ListenerSpec defines the listening options of the node
+type ListenerSpec struct {
+	// Host defines the host to bind the listener to. Default is the host of the node name
+	Host string
+	// Listen defines a port number for accepting incoming connections
+	Listen uint16
+	// ListenBegin and ListenEnd define a range of the port numbers where
+	// the listener looking for available free port number.
+	// Default values 15000 and 65000 accordingly
+	ListenBegin uint16
+	ListenEnd   uint16
+
+	// TLS settings (see Options)
+	TLSMode      TLSMode
+	TLSCrtServer string
+	TLSKeyServer string
+	TLSCrtClient string
+	TLSKeyClient string
+	TLSStartTLS  bool
+
+	// Handshake defines a handshake handler for the accepted connections.
+	// Default is Options.Handshake
+	Handshake HandshakeInterface
+}
+
+// NetworkStats
+type NetworkStats struct {
+	// Connections number of established connections
+	Connections int
+	// MaxConnections the limit of simultaneous connections (0 - unlimited)
+	MaxConnections int
+	// Reconnecting the state of reconnecting to the nodes (see RouteOptions.Reconnect)
+	Reconnecting map[string]ReconnectState
+	// Handshakes the handshake counters
+	Handshakes HandshakeStats
+	// RemoteSpawnInFlight number of the remote spawn requests being handled
+	RemoteSpawnInFlight int
+	// RemoteSpawnConcurrency the limit of the remote spawn requests handled
+	// simultaneously (0 - unlimited)
+	RemoteSpawnConcurrency int
+}
+
+// NodeMetrics
+type NodeMetrics struct {
+	Time   time.Time
+	Uptime time.Duration
+	// Processes number of the running processes
+	Processes int
+	// Names number of the registered names
+	Names int
+	// MessagesRouted the number of messages put into the mailboxes of the local
+	// processes since the node started
+	MessagesRouted uint64
+	// MessagesDropped the number of messages dropped due to the full mailbox
+	MessagesDropped uint64
+	// MessagesUndelivered the number of messages sent to the unknown or terminated
+	// local processes
+	MessagesUndelivered uint64
+	// RoutedPerSecond the rate of MessagesRouted since the previous push
+	// (see Options.MetricsSink). It's 0 for the snapshot returned by Node.Metrics
+	RoutedPerSecond float64
+	// Nodes the list of connected nodes
+	Nodes   []string
+	Network NetworkStats
+
+	Goroutines   int
+	HeapAlloc    uint64
+	NumGC        uint32
+	GCPauseTotal time.Duration
+}
+
+// HandshakeStats counters of the handshakes made for the incoming and outgoing connections
+type HandshakeStats struct {
+	Attempts  uint64
+	Successes uint64
+	// failures by reason
+	FailuresCookie  uint64
+	FailuresTLS     uint64
+	FailuresVersion uint64
+	FailuresTimeout uint64
+	FailuresOther   uint64
+}
+
+// ReconnectState
+type ReconnectState struct {
+	// Attempts number of the failed attempts
+	Attempts int
+	// NextAttempt the time of the next attempt
+	NextAttempt time.Time
+	// LastError the reason of the last failed attempt
+	LastError error
+}
+
 type CloudOptions struct {
 	ID     string
 	Cookie string
 }
 
 type TLS struct {
-	Enabled bool
-	Mode    TLSMode
-	Server  tls.Certificate
-	Client  tls.Certificate
-	Config  tls.Config
+	Enabled  bool
+	StartTLS bool
+	Mode     TLSMode
+	Server   tls.Certificate
+	Client   tls.Certificate
+	Config   tls.Config
 }
 
 // Connection
@@ -265,6 +810,16 @@ type ConnectionInterface interface {
 	Send(from gen.Process, to etf.Pid, message etf.Term) error
 	SendReg(from gen.Process, to gen.ProcessID, message etf.Term) error
 	SendAlias(from gen.Process, to etf.Alias, message etf.Term) error
+	// SendRaw sends the message encoded with disabled atom cache
+	SendRaw(from gen.Process, to etf.Pid, encoded []byte) error
+	// MaxMessageSize returns the message size limit negotiated with the peer (0 - no limit)
+	MaxMessageSize() int
+	// Flags returns the set of features enabled for this connection
+	Flags() ProtoFlags
+	// Barrier blocks until all the messages enqueued before it have been written
+	// to the socket (not received by the peer). Returns ErrNoRoute if the connection
+	// has been closed.
+	Barrier() error
 
 	Link(local etf.Pid, remote etf.Pid) error
 	Unlink(local etf.Pid, remote etf.Pid) error
@@ -278,7 +833,7 @@ type ConnectionInterface interface {
 	DemonitorReg(local etf.Pid, remote gen.ProcessID, ref etf.Ref) error
 	MonitorExitReg(to etf.Pid, terminated gen.ProcessID, reason string, ref etf.Ref) error
 
-	SpawnRequest() error
+	SpawnRequest(behaviorName string, request gen.RemoteSpawnRequest) error
 	SpawnReply(to etf.Pid, ref etf.Ref, spawned etf.Pid) error
 	SpawnReplyError(to etf.Pid, ref etf.Ref, err error) error
 
@@ -326,9 +881,13 @@ type CustomProtoOptions interface{}
 
 // ProtoOptions
 type ProtoOptions struct {
-	// MaxMessageSize limit the message size. Default 0 (no limit)
+	// MaxMessageSize limit the message size (encoded control message and payload,
+	// the dist header isn't counted). Default 0 (no limit).
+	// Sending a larger message returns ErrMessageTooLarge.
 	MaxMessageSize int
 	// NumHandlers defines the number of readers/writers per connection. Default is the number of CPU.
+	// Messages between the same pair of processes are always sent by the same writer,
+	// so their order is preserved.
 	NumHandlers int
 	// SendQueueLength defines queue size of handler for the outgoing messages. Default 100.
 	SendQueueLength int
@@ -336,12 +895,48 @@ type ProtoOptions struct {
 	RecvQueueLength int
 	// FragmentationUnit defines unit size for the fragmentation feature. Default 65000
 	FragmentationUnit int
+	// MaxReassemblyBytes limits the amount of data kept for reassembling the fragmented
+	// messages. Connection is closed if the limit is exceeded. Default 0 (no limit)
+	MaxReassemblyBytes int
+	// ReassemblyTimeout defines how long to wait for the next fragment of the message.
+	// Incomplete messages are discarded on exceeding it. Default 30 seconds
+	ReassemblyTimeout time.Duration
+	// ReassemblyTimeoutReset closes connection if the incomplete messages were discarded
+	ReassemblyTimeoutReset bool
+	// TimeEncoding defines the way time.Time values are encoded
+	TimeEncoding etf.TimeEncoding
+	// CompressionDictionary defines the preset dictionary for compressing/decompressing
+	// the messages. Must be the same on both sides.
+	CompressionDictionary []byte
+	// AtomCacheSize limits the number of atoms in the header atom cache of the
+	// outgoing messages. Default 0 (2048, maximum allowed by the protocol)
+	AtomCacheSize int
+	// AtomCachePreload defines the atoms put into the header atom cache on
+	// establishing the connection
+	AtomCachePreload []etf.Atom
+	// Middleware is the chain of the handlers invoked for every message sent
+	// and received over the connection
+	Middleware []MessageMiddleware
 	// Flags defines enabled/disabled features for the peering node
 	Flags ProtoFlags
 	// Custom brings a custom set of options to the ProtoInterface.Serve handler
 	Custom CustomProtoOptions
 }
 
+// MessageMiddleware intercepts the messages sent to and received from the remote
+// processes (see Options.Middleware). The returned message replaces the original one,
+// so it can be signed, redacted, etc. Returning an error drops the message. The
+// destination 'to' is etf.Pid, gen.ProcessID or etf.Alias. Raw messages (see
+// Node.SendRaw) and the service ones (links, monitors, etc) are not intercepted.
+type MessageMiddleware interface {
+	// OnSend is invoked before encoding the outgoing message. The error is returned
+	// to the sender.
+	OnSend(from etf.Pid, to etf.Term, message etf.Term) (etf.Term, error)
+	// OnRecv is invoked before routing the incoming message to the local process.
+	// The sender 'from' is empty if the peer hasn't provided it.
+	OnRecv(from etf.Pid, to etf.Term, message etf.Term) (etf.Term, error)
+}
+
 // ProtoFlags
 type ProtoFlags struct {
 	// DisableHeaderAtomCache makes proto handler disable header atom cache feature
@@ -352,6 +947,16 @@ type ProtoFlags struct {
 	EnableBigPidRef bool
 	// EnableFragmentation enables fragmentation feature for the sending data
 	EnableFragmentation bool
+	// EnableStringAsBinary makes proto handler encode Go strings as binaries
+	// instead of the list of chars
+	EnableStringAsBinary bool
+	// EnableFlowControl makes proto handler notify the remote sender if the mailbox
+	// of the local process is full and pause sending to the remote process on such
+	// notification. Must be negotiated with the peer during the handshake.
+	EnableFlowControl bool
+	// EnableCompression the peer is able to decompress the messages (Ergo peers only).
+	// Otherwise, the messages are sent uncompressed regardless of the compression settings.
+	EnableCompression bool
 }
 
 // ResolverOptions defines resolving options
@@ -360,6 +965,20 @@ type ResolverOptions struct {
 	HandshakeVersion HandshakeVersion
 	EnabledTLS       bool
 	EnabledProxy     bool
+	// Listeners describes all the listeners of the node. The port, handshake version
+	// and TLS flag above belong to the primary one (the first in this list).
+	Listeners []ResolverListener
+	// Aliases additional names the node must be resolvable by (see Options.Aliases)
+	Aliases []string
+	// Maintenance the node is in maintenance mode (see Node.SetMaintenance)
+	Maintenance bool
+}
+
+// ResolverListener
+type ResolverListener struct {
+	Port             uint16
+	HandshakeVersion HandshakeVersion
+	EnabledTLS       bool
 }
 
 // Resolver defines resolving interface
@@ -368,6 +987,50 @@ type Resolver interface {
 	Resolve(peername string) (Route, error)
 }
 
+// TimerSource creates the timers of the node (see Options.TimerSource)
+type TimerSource interface {
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the one-shot timer. The channel C delivers the time once the timer has fired.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker delivers the ticks every period until it's stopped
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// ResolverMaintenance is implemented by the resolvers able to advertise the maintenance
+// mode of the node (see Node.SetMaintenance). The resolved route of the node in this
+// mode must have the Maintenance flag set.
+type ResolverMaintenance interface {
+	SetMaintenance(enable bool) error
+}
+
+// ResolverListenPort is implemented by the resolvers able to update the registered
+// port of the node (see Node.Relisten)
+type ResolverListenPort interface {
+	SetListenPort(port uint16) error
+}
+
+// GlobalRegistry defines interface for the cluster-wide registry of the process names
+// backed by an external store (etcd, Redis, etc)
+type GlobalRegistry interface {
+	// Register publishes the name of the process. Must return ErrTaken if this name
+	// has been registered by another process.
+	Register(name string, pid etf.Pid) error
+	// Unregister removes the name from the registry
+	Unregister(name string) error
+	// Resolve returns pid of the process registered with the given name.
+	// Must return ErrNameUnknown if the name is not registered.
+	Resolve(name string) (etf.Pid, error)
+}
+
 // CustomRouteOptions a custom set of route options
 type CustomRouteOptions interface{}
 
@@ -377,6 +1040,22 @@ type RouteOptions struct {
 	EnabledTLS   bool
 	EnabledProxy bool
 	IsErgo       bool
+	// ManualConnect disables connecting to the statically routed node on sending
+	// a message to it. The connection must be established with Connect.
+	ManualConnect bool
+	// CompressionDictionary overrides Options.CompressionDictionary for the connection
+	// to this node
+	CompressionDictionary []byte
+	// Middleware is invoked for the messages of the connection to this node after
+	// the node's ones (see Options.Middleware)
+	Middleware []MessageMiddleware
+	// Reconnect defines the reconnect policy if the connection to this node has been lost
+	Reconnect ReconnectPolicy
+	// TCPNoDelay, TCPReadBuffer and TCPWriteBuffer override the node options
+	// for the connection to this node
+	TCPNoDelay     TCPNoDelay
+	TCPReadBuffer  int
+	TCPWriteBuffer int
 
 	TLSConfig *tls.Config
 	Handshake HandshakeInterface
@@ -384,11 +1063,45 @@ type RouteOptions struct {
 	Custom    CustomRouteOptions
 }
 
+// ReconnectGiveUp defines the action on exceeding ReconnectPolicy.MaxAttempts
+type ReconnectGiveUp int
+
+const (
+	// ReconnectGiveUpKeepRoute stops reconnecting. The static route is kept, so the
+	// connection could be established on demand (unless ManualConnect) or using Connect.
+	ReconnectGiveUpKeepRoute ReconnectGiveUp = 0
+	// ReconnectGiveUpRemoveRoute stops reconnecting and removes the static route
+	ReconnectGiveUpRemoveRoute ReconnectGiveUp = 1
+)
+
+// ReconnectPolicy
+type ReconnectPolicy struct {
+	// Enable makes the node reconnect to the statically routed node on losing connection
+	Enable bool
+	// MaxAttempts the number of attempts before giving up. Default 0 (unlimited)
+	MaxAttempts int
+	// BackoffBase the delay before the first attempt. It is doubled for every next one
+	// up to BackoffMax. Default values 1 second and 30 seconds accordingly
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// GiveUp defines the action on exceeding MaxAttempts
+	GiveUp ReconnectGiveUp
+	// StopOnCookieMismatch makes the node stop reconnecting right away if the peer
+	// has rejected the cookie, since the next attempts fail the same way until
+	// the cookie is updated
+	StopOnCookieMismatch bool
+}
+
 // Route
 type Route struct {
 	NodeName string
 	Name     string
 	Host     string
 	Port     uint16
+	// Maintenance is set by the resolver if the node is in maintenance mode
+	Maintenance bool
+	// Listeners the additional listeners of the node advertised by the resolver.
+	// The primary one is defined by Port and EnabledTLS.
+	Listeners []ResolverListener
 	RouteOptions
 }
@@ -60,27 +60,52 @@ func (e *epmd) serve(l net.Listener) {
 func (e *epmd) handle(c net.Conn) {
 	var name string
 	var node registeredNode
+	var err error
 	buf := make([]byte, 1024)
+	// the registered node might send the requests one by one (renewing
+	// the registration), so they can be read at once
+	var pending []byte
 
 	defer c.Close()
 	for {
-		n, err := c.Read(buf)
-		lib.Log("Request from EPMD client: %v", buf[:n])
-		if err != nil {
-			lib.Log("EPMD unregistering node: '%s'", name)
-			e.nodesMutex.Lock()
-			delete(e.nodes, name)
-			e.nodesMutex.Unlock()
-			return
-		}
-		// buf[0:1] - length
-		if uint16(n-2) != binary.BigEndian.Uint16(buf[0:2]) {
+		// 2 bytes - length
+		if len(pending) < 2 || len(pending) < 2+int(binary.BigEndian.Uint16(pending[0:2])) {
+			n, err := c.Read(buf)
+			lib.Log("Request from EPMD client: %v", buf[:n])
+			if err != nil {
+				lib.Log("EPMD unregistering node: '%s'", name)
+				e.nodesMutex.Lock()
+				delete(e.nodes, name)
+				e.nodesMutex.Unlock()
+				return
+			}
+			pending = append(pending, buf[:n]...)
 			continue
 		}
+		n := 2 + int(binary.BigEndian.Uint16(pending[0:2]))
+		packet := pending[:n]
+		pending = pending[n:]
 
-		switch buf[2] {
+		switch packet[2] {
 		case epmdAliveReq:
-			name, node, err = e.readAliveReq(buf[3:])
+			if name != "" {
+				// the node renews its registration (e.g. with the updated port
+				// or extra data) keeping the connection
+				renewed, node, err := e.readAliveReq(packet[3:n])
+				if err != nil || renewed != name {
+					e.sendAliveResp(c, 1)
+					continue
+				}
+				e.nodesMutex.Lock()
+				e.nodes[name] = node
+				e.nodesMutex.Unlock()
+				if err := e.sendAliveResp(c, 0); err != nil {
+					return
+				}
+				continue
+			}
+
+			name, node, err = e.readAliveReq(packet[3:n])
 			if err != nil {
 				// send error and close connection
 				e.sendAliveResp(c, 1)
@@ -115,7 +140,7 @@ func (e *epmd) handle(c net.Conn) {
 			}
 			continue
 		case epmdPortPleaseReq:
-			requestedName := string(buf[3:n])
+			requestedName := string(packet[3:n])
 
 			e.nodesMutex.Lock()
 			node, exist := e.nodes[requestedName]
@@ -129,7 +154,7 @@ func (e *epmd) handle(c net.Conn) {
 			e.sendPortPleaseResp(c, requestedName, node)
 			return
 		case epmdNamesReq:
-			e.sendNamesResp(c, buf[3:n])
+			e.sendNamesResp(c, packet[3:n])
 			return
 		default:
 			lib.Log("unknown EPMD request")
@@ -144,9 +169,19 @@ func (e *epmd) readAliveReq(req []byte) (string, registeredNode, error) {
 		return "", registeredNode{}, fmt.Errorf("Malformed EPMD request")
 	}
 	// Name length
-	l := binary.BigEndian.Uint16(req[8:10])
+	l := int(binary.BigEndian.Uint16(req[8:10]))
+	if len(req) < 12+l {
+		return "", registeredNode{}, fmt.Errorf("Malformed EPMD request")
+	}
 	// Name
 	name := string(req[10 : 10+l])
+	// Extra. The request buffer is reused, so keep a copy of it
+	elen := int(binary.BigEndian.Uint16(req[10+l : 12+l]))
+	if len(req) < 12+l+elen {
+		return "", registeredNode{}, fmt.Errorf("Malformed EPMD request")
+	}
+	extra := make([]byte, elen)
+	copy(extra, req[12+l:])
 	// Hidden
 	hidden := false
 	if req[2] == 72 {
@@ -158,7 +193,7 @@ func (e *epmd) readAliveReq(req []byte) (string, registeredNode, error) {
 		hidden: hidden,
 		hi:     binary.BigEndian.Uint16(req[4:6]),
 		lo:     binary.BigEndian.Uint16(req[6:8]),
-		extra:  req[10+l:],
+		extra:  extra,
 	}
 
 	return name, node, nil
@@ -30,6 +30,14 @@ type linkFlusher struct {
 	pending bool
 }
 
+// Flush writes the buffered data to the socket
+func (lf *linkFlusher) Flush() error {
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+	lf.pending = false
+	return lf.writer.Flush()
+}
+
 func (lf *linkFlusher) Write(b []byte) (int, error) {
 	lf.mutex.Lock()
 	defer lf.mutex.Unlock()
@@ -18,6 +18,8 @@ const (
 	DistHandshakeVersion6 node.HandshakeVersion = 6
 
 	DefaultDistHandshakeVersion = DistHandshakeVersion5
+	// DefaultDistHandshakeMaxFrameSize limits the size of the handshake messages
+	DefaultDistHandshakeMaxFrameSize = 512
 
 	// distribution flags are defined here https://erlang.org/doc/apps/erts/erl_dist_protocol.html#distribution-flags
 	flagPublished          nodeFlagId = 0x1
@@ -49,6 +51,15 @@ const (
 	flagNameMe = 1 << 33
 	flagV4NC   = 1 << 34
 	flagAlias  = 1 << 35
+
+	// Ergo specific flags (not used by Erlang)
+
+	// flagErgoMaxMessageSize the peer exchanges MaxMessageSize right after the handshake
+	flagErgoMaxMessageSize = 1 << 60
+	// flagErgoCompression the peer is able to decompress the messages
+	flagErgoCompression = 1 << 61
+	// flagErgoFlowControl the peer handles the flow control signals
+	flagErgoFlowControl = 1 << 62
 )
 
 type nodeFlagId uint64
@@ -87,6 +98,50 @@ type DistHandshake struct {
 type DistHandshakeOptions struct {
 	Version node.HandshakeVersion // 5 or 6
 	Cookie  string
+	// Authenticator overrides the cookie based authentication. Use CookieAuthenticator
+	// to keep the cookie check along with the custom one.
+	Authenticator Authenticator
+	// MaxMessageSize limits the size of the incoming messages. Ergo peers exchange
+	// this value during the handshake, so the effective limit for the connection is
+	// the minimal one of both sides. Default 0 (no limit)
+	MaxMessageSize int
+	// FlowControl advertises the flow control support (see node.Options.FlowControl).
+	// It is enabled for the connection if both sides advertise it, so the peers that
+	// don't know the flow control signals (e.g. Erlang nodes) never get them.
+	FlowControl bool
+	// MaxFrameSize limits the size of the handshake messages received from the peer.
+	// The larger ones are rejected before reading their body, since the peer isn't
+	// authenticated yet. Default DefaultDistHandshakeMaxFrameSize
+	MaxFrameSize int
+}
+
+// Authenticator defines the way the nodes prove their identity during the handshake.
+// Digest must be 16 bytes long to keep compatibility with the Erlang nodes.
+type Authenticator interface {
+	// Digest returns the digest for the challenge received from the peer
+	Digest(peername string, challenge uint32) []byte
+	// Authenticate validates the digest received from the peer as a reply
+	// for the given challenge. Returning false rejects the connection.
+	Authenticate(peername string, challenge uint32, digest []byte) bool
+}
+
+type cookieAuthenticator struct {
+	cookie string
+}
+
+// CookieAuthenticator creates the default Authenticator based on the magic cookie
+func CookieAuthenticator(cookie string) Authenticator {
+	return &cookieAuthenticator{
+		cookie: cookie,
+	}
+}
+
+func (ca *cookieAuthenticator) Digest(peername string, challenge uint32) []byte {
+	return genDigest(challenge, ca.cookie)
+}
+
+func (ca *cookieAuthenticator) Authenticate(peername string, challenge uint32, digest []byte) bool {
+	return bytes.Equal(genDigest(challenge, ca.cookie), digest)
 }
 
 func CreateDistHandshake(timeout time.Duration, options DistHandshakeOptions) node.HandshakeInterface {
@@ -94,9 +149,16 @@ func CreateDistHandshake(timeout time.Duration, options DistHandshakeOptions) no
 	if options.Version != DistHandshakeVersion5 && options.Version != DistHandshakeVersion6 {
 		options.Version = DefaultDistHandshakeVersion
 	}
+	if options.Authenticator == nil {
+		options.Authenticator = CookieAuthenticator(options.Cookie)
+	}
+	if options.MaxFrameSize == 0 {
+		options.MaxFrameSize = DefaultDistHandshakeMaxFrameSize
+	}
 	return &DistHandshake{
 		options:   options,
 		challenge: rand.Uint32(),
+		timeout:   timeout,
 	}
 }
 
@@ -138,12 +200,18 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 		flagSpawn,
 		flagV4NC,
 		flagAlias,
+		flagErgoMaxMessageSize,
+		flagErgoCompression,
 	)
+	if dh.options.FlowControl {
+		flags |= flagErgoFlowControl
+	}
 
 	b := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(b)
 
 	var await []byte
+	var replied bool
 
 	if dh.options.Version == DistHandshakeVersion5 {
 		dh.composeName(b, tls, flags)
@@ -164,7 +232,7 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 
 	asyncReadChannel := make(chan error, 2)
 	asyncRead := func() {
-		_, e := b.ReadDataFrom(conn, 512)
+		_, e := b.ReadDataFrom(conn, dh.options.MaxFrameSize)
 		asyncReadChannel <- e
 	}
 
@@ -184,15 +252,23 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 
 		select {
 		case <-timer.C:
-			return protoOptions, fmt.Errorf("handshake timeout")
+			return protoOptions, node.ErrHandshakeTimeout
 
 		case e := <-asyncReadChannel:
+			if e == io.EOF && replied && len(b.B) == 0 {
+				// the peer closes the connection with no reply if the digest
+				// of our challenge reply doesn't match (cookie mismatch)
+				return protoOptions, fmt.Errorf("connection closed by peer: %w", node.ErrHandshakeCookie)
+			}
 			if e != nil {
 				return protoOptions, e
 			}
 
 		next:
-			l := binary.BigEndian.Uint16(b.B[expectingBytes-2 : expectingBytes])
+			l, e := dh.readFrameLength(b.B, expectingBytes)
+			if e != nil {
+				return protoOptions, e
+			}
 			buffer := b.B[expectingBytes:]
 
 			if len(buffer) < int(l) {
@@ -213,15 +289,20 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 
 				peer_challenge, peer_name, peer_flags = dh.readChallenge(b.B[1:])
 				if peer_challenge == 0 {
-					return protoOptions, fmt.Errorf("malformed handshake (mismatch handshake version")
+					return protoOptions, fmt.Errorf("malformed handshake: %w", node.ErrHandshakeVersion)
+				}
+				if peer_name == dh.nodename {
+					// route points to this node
+					return protoOptions, node.ErrSelfConnect
 				}
 				b.Reset()
 
-				dh.composeChallengeReply(b, peer_challenge, tls)
+				dh.composeChallengeReply(b, peer_name, peer_challenge, tls)
 
 				if e := b.WriteDataTo(conn); e != nil {
 					return protoOptions, e
 				}
+				replied = true
 				// add 's' status for the case if we got it after 'n' or 'N' message
 				// yes, sometime it happens
 				await = []byte{'s', 'a'}
@@ -230,11 +311,17 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 				// Peer support version 6.
 
 				// The new challenge message format (version 6)
-				// 8 (flags) + 4 (Creation) + 2 (NameLen) + Name
-				if len(buffer) < 16 {
+				// 8 (flags) + 4 (Challenge) + 4 (Creation) + 2 (NameLen) + Name
+				if len(buffer) < 19 {
 					return protoOptions, fmt.Errorf("malformed handshake ('N' length)")
 				}
-				peer_challenge, peer_name, peer_flags = dh.readChallengeVersion6(buffer[1:])
+				peer_challenge, peer_name, peer_flags = dh.readChallengeVersion6(buffer[1:l])
+				if peer_name == "" {
+					return protoOptions, fmt.Errorf("malformed handshake ('N' name)")
+				}
+				if peer_name == dh.nodename {
+					return protoOptions, node.ErrSelfConnect
+				}
 				b.Reset()
 
 				if dh.options.Version == DistHandshakeVersion5 {
@@ -245,30 +332,41 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 					}
 				}
 
-				dh.composeChallengeReply(b, peer_challenge, tls)
+				dh.composeChallengeReply(b, peer_name, peer_challenge, tls)
 
 				if e := b.WriteDataTo(conn); e != nil {
 					return protoOptions, e
 				}
+				replied = true
 
 				// add 's' (send_status message) for the case if we got it after 'n' or 'N' message
 				await = []byte{'s', 'a'}
 
 			case 'a':
-				// 'a' + 16 (digest)
-				if len(buffer) != 17 {
+				// 'a' + 16 (digest). might be followed by the 'm' message (Ergo peer)
+				if l != 17 || len(buffer) < 17 {
 					return protoOptions, fmt.Errorf("malformed handshake ('a' length of digest)")
 				}
 
 				// 'a' + 16 (digest)
-				digest := genDigest(dh.challenge, dh.options.Cookie)
-				if bytes.Compare(buffer[1:17], digest) != 0 {
-					return protoOptions, fmt.Errorf("malformed handshake ('a' digest)")
+				if dh.options.Authenticator.Authenticate(peer_name, dh.challenge, buffer[1:17]) == false {
+					return protoOptions, fmt.Errorf("malformed handshake ('a' digest): %w", node.ErrHandshakeCookie)
 				}
 
 				// handshaked
 				//FIXME
 				protoOptions = node.DefaultProtoOptions(0, false)
+				protoOptions.MaxMessageSize = dh.options.MaxMessageSize
+				protoOptions.Flags.EnableCompression = peer_flags.isSet(flagErgoCompression)
+				protoOptions.Flags.EnableFlowControl = dh.options.FlowControl && peer_flags.isSet(flagErgoFlowControl)
+				if peer_flags.isSet(flagErgoMaxMessageSize) {
+					pending := b.B[expectingBytes+17:]
+					size, e := dh.exchangeMaxMessageSize(conn, pending, tls)
+					if e != nil {
+						return protoOptions, e
+					}
+					protoOptions.MaxMessageSize = size
+				}
 				return protoOptions, nil
 
 			case 's':
@@ -295,7 +393,6 @@ func (dh *DistHandshake) Start(conn io.ReadWriter, tls bool) (node.ProtoOptions,
 }
 
 func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.ProtoOptions, error) {
-	var peer_challenge uint32
 	var peer_name string
 	var peer_flags nodeFlags
 	var protoOptions node.ProtoOptions
@@ -321,7 +418,12 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 		flagSpawn,
 		flagV4NC,
 		flagAlias,
+		flagErgoMaxMessageSize,
+		flagErgoCompression,
 	)
+	if dh.options.FlowControl {
+		flags |= flagErgoFlowControl
+	}
 
 	b := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(b)
@@ -334,7 +436,7 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 
 	asyncReadChannel := make(chan error, 2)
 	asyncRead := func() {
-		_, e := b.ReadDataFrom(conn, 512)
+		_, e := b.ReadDataFrom(conn, dh.options.MaxFrameSize)
 		asyncReadChannel <- e
 	}
 
@@ -358,7 +460,7 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 
 		select {
 		case <-timer.C:
-			return peer_name, protoOptions, fmt.Errorf("handshake accept timeout")
+			return peer_name, protoOptions, node.ErrHandshakeTimeout
 		case e := <-asyncReadChannel:
 			if e != nil {
 				return peer_name, protoOptions, e
@@ -369,7 +471,10 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 			}
 
 		next:
-			l := binary.BigEndian.Uint16(b.B[expectingBytes-2 : expectingBytes])
+			l, e := dh.readFrameLength(b.B, expectingBytes)
+			if e != nil {
+				return peer_name, protoOptions, e
+			}
 			buffer := b.B[expectingBytes:]
 
 			if len(buffer) < int(l) {
@@ -407,6 +512,11 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 				if e := b.WriteDataTo(conn); e != nil {
 					return peer_name, protoOptions, e
 				}
+				if peer_name == dh.nodename {
+					// the challenge is sent anyway so the connecting side
+					// finds out its own name and fails with ErrSelfConnect
+					return peer_name, protoOptions, node.ErrSelfConnect
+				}
 
 			case 'N':
 				// The new challenge message format (version 6)
@@ -429,6 +539,9 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 				if e := b.WriteDataTo(conn); e != nil {
 					return peer_name, protoOptions, e
 				}
+				if peer_name == dh.nodename {
+					return peer_name, protoOptions, node.ErrSelfConnect
+				}
 
 				await = []byte{'s', 'r'}
 
@@ -447,17 +560,18 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 				b.Reset()
 
 			case 'r':
-				if len(buffer) < 19 {
+				// 'r' + 4 (challenge) + 16 (digest)
+				if len(buffer) < 21 {
 					return peer_name, protoOptions, fmt.Errorf("malformed handshake ('r' length)")
 				}
 
-				peer_challenge, valid := dh.validateChallengeReply(buffer[1:])
+				peer_challenge, valid := dh.validateChallengeReply(peer_name, buffer[1:])
 				if valid == false {
-					return peer_name, protoOptions, fmt.Errorf("malformed handshake ('r' invalid reply)")
+					return peer_name, protoOptions, fmt.Errorf("malformed handshake ('r' invalid reply): %w", node.ErrHandshakeCookie)
 				}
 				b.Reset()
 
-				dh.composeChallengeAck(b, peer_challenge, tls)
+				dh.composeChallengeAck(b, peer_name, peer_challenge, tls)
 				if e := b.WriteDataTo(conn); e != nil {
 					return peer_name, protoOptions, e
 				}
@@ -465,6 +579,16 @@ func (dh *DistHandshake) Accept(conn io.ReadWriter, tls bool) (string, node.Prot
 				// handshaked
 				// FIXME
 				protoOptions = node.DefaultProtoOptions(0, false)
+				protoOptions.MaxMessageSize = dh.options.MaxMessageSize
+				protoOptions.Flags.EnableCompression = peer_flags.isSet(flagErgoCompression)
+				protoOptions.Flags.EnableFlowControl = dh.options.FlowControl && peer_flags.isSet(flagErgoFlowControl)
+				if peer_flags.isSet(flagErgoMaxMessageSize) {
+					size, e := dh.exchangeMaxMessageSize(conn, nil, tls)
+					if e != nil {
+						return peer_name, protoOptions, e
+					}
+					protoOptions.MaxMessageSize = size
+				}
 
 				return peer_name, protoOptions, nil
 
@@ -552,7 +676,7 @@ func (dh *DistHandshake) readName(b []byte) (string, nodeFlags, error) {
 
 func (dh *DistHandshake) readNameVersion6(b []byte) (string, nodeFlags, error) {
 	nameLen := int(binary.BigEndian.Uint16(b[12:14]))
-	if nameLen > 250 {
+	if nameLen > 250 || len(b) < 14+nameLen {
 		return "", 0, fmt.Errorf("Malformed node name")
 	}
 	nodename := string(b[14 : 14+nameLen])
@@ -564,6 +688,23 @@ func (dh *DistHandshake) readNameVersion6(b []byte) (string, nodeFlags, error) {
 	return nodename, flags, nil
 }
 
+// readFrameLength returns the length of the handshake message the buffer starts with
+func (dh *DistHandshake) readFrameLength(b []byte, expectingBytes int) (int, error) {
+	if len(b) < expectingBytes+1 {
+		return 0, fmt.Errorf("malformed handshake (too short packet)")
+	}
+	var l uint32
+	if expectingBytes == 4 {
+		l = binary.BigEndian.Uint32(b[0:4])
+	} else {
+		l = uint32(binary.BigEndian.Uint16(b[0:2]))
+	}
+	if l > uint32(dh.options.MaxFrameSize) {
+		return 0, fmt.Errorf("malformed handshake (packet length %d exceeds the limit %d)", l, dh.options.MaxFrameSize)
+	}
+	return int(l), nil
+}
+
 func (dh *DistHandshake) composeStatus(b *lib.Buffer, tls bool) {
 	// there are few options for the status: ok, ok_simultaneous, nok, not_allowed, alive
 	// More details here: https://erlang.org/doc/apps/erts/erl_dist_protocol.html#the-handshake-in-detail
@@ -654,8 +795,17 @@ func (dh *DistHandshake) readChallenge(msg []byte) (challenge uint32, nodename s
 	return
 }
 
+// readChallengeVersion6 reads the 'N' challenge message: 8 (flags) + 4 (challenge) +
+// 4 (creation) + 2 (name length) + name. The challenge is still 32-bit in version 6.
+// Returns zero challenge if the message is malformed.
 func (dh *DistHandshake) readChallengeVersion6(msg []byte) (challenge uint32, nodename string, flags nodeFlags) {
+	if len(msg) < 18 {
+		return
+	}
 	lenName := int(binary.BigEndian.Uint16(msg[16:18]))
+	if len(msg) < 18+lenName {
+		return
+	}
 	challenge = binary.BigEndian.Uint32(msg[8:12])
 	nodename = string(msg[18 : 18+lenName])
 	flags = nodeFlags(binary.BigEndian.Uint64(msg[0:8]))
@@ -672,21 +822,21 @@ func (dh *DistHandshake) readComplement(msg []byte, peer_flags nodeFlags) nodeFl
 	return peer_flags
 }
 
-func (dh *DistHandshake) validateChallengeReply(b []byte) (uint32, bool) {
+func (dh *DistHandshake) validateChallengeReply(peername string, b []byte) (uint32, bool) {
 	challenge := binary.BigEndian.Uint32(b[:4])
-	digestB := b[4:]
+	// the digest is always 16 bytes (MD5). the buffer might have more data
+	digest := b[4:20]
 
-	digestA := genDigest(dh.challenge, dh.options.Cookie)
-	return challenge, bytes.Equal(digestA[:], digestB)
+	return challenge, dh.options.Authenticator.Authenticate(peername, dh.challenge, digest)
 }
 
-func (dh *DistHandshake) composeChallengeAck(b *lib.Buffer, peer_challenge uint32, tls bool) {
+func (dh *DistHandshake) composeChallengeAck(b *lib.Buffer, peername string, peer_challenge uint32, tls bool) {
 	if tls {
 		b.Allocate(5)
 		dataLength := uint32(17) // 'a' + 16 (digest)
 		binary.BigEndian.PutUint32(b.B[0:4], dataLength)
 		b.B[4] = 'a'
-		digest := genDigest(peer_challenge, dh.options.Cookie)
+		digest := dh.options.Authenticator.Digest(peername, peer_challenge)
 		b.Append(digest)
 		return
 	}
@@ -695,13 +845,13 @@ func (dh *DistHandshake) composeChallengeAck(b *lib.Buffer, peer_challenge uint3
 	dataLength := uint16(17) // 'a' + 16 (digest)
 	binary.BigEndian.PutUint16(b.B[0:2], dataLength)
 	b.B[2] = 'a'
-	digest := genDigest(peer_challenge, dh.options.Cookie)
+	digest := dh.options.Authenticator.Digest(peername, peer_challenge)
 	b.Append(digest)
 }
 
-func (dh *DistHandshake) composeChallengeReply(b *lib.Buffer, challenge uint32, tls bool) {
+func (dh *DistHandshake) composeChallengeReply(b *lib.Buffer, peername string, challenge uint32, tls bool) {
 	if tls {
-		digest := genDigest(challenge, dh.options.Cookie)
+		digest := dh.options.Authenticator.Digest(peername, challenge)
 		b.Allocate(9)
 		dataLength := 5 + len(digest) // 1 (byte) + 4 (challenge) + 16 (digest)
 		binary.BigEndian.PutUint32(b.B[0:4], uint32(dataLength))
@@ -712,7 +862,7 @@ func (dh *DistHandshake) composeChallengeReply(b *lib.Buffer, challenge uint32,
 	}
 
 	b.Allocate(7)
-	digest := genDigest(challenge, dh.options.Cookie)
+	digest := dh.options.Authenticator.Digest(peername, challenge)
 	dataLength := 5 + len(digest) // 1 (byte) + 4 (challenge) + 16 (digest)
 	binary.BigEndian.PutUint16(b.B[0:2], uint16(dataLength))
 	b.B[2] = 'r'
@@ -742,6 +892,51 @@ func (dh *DistHandshake) composeComplement(b *lib.Buffer, flags nodeFlags, tls b
 	binary.BigEndian.PutUint32(b.B[7:11], dh.creation)
 }
 
+// exchangeMaxMessageSize sends the local MaxMessageSize to the peer and reads
+// the peer's one. Returns the effective limit (the minimal non-zero value).
+// Argument pending keeps the data that has been read with the last handshake message.
+func (dh *DistHandshake) exchangeMaxMessageSize(conn io.ReadWriter, pending []byte, tls bool) (int, error) {
+	lenHeader := 2
+	if tls {
+		lenHeader = 4
+	}
+
+	// 'm' + 4 (max message size)
+	packet := make([]byte, lenHeader+5)
+	if tls {
+		binary.BigEndian.PutUint32(packet[0:4], 5)
+	} else {
+		binary.BigEndian.PutUint16(packet[0:2], 5)
+	}
+	packet[lenHeader] = 'm'
+	binary.BigEndian.PutUint32(packet[lenHeader+1:], uint32(dh.options.MaxMessageSize))
+	if _, e := conn.Write(packet); e != nil {
+		return 0, e
+	}
+
+	// read exactly the size of this message in order to keep
+	// the data of the following distribution messages
+	n := copy(packet, pending)
+	if n < len(packet) {
+		if _, e := io.ReadFull(conn, packet[n:]); e != nil {
+			return 0, e
+		}
+	}
+	if packet[lenHeader] != 'm' {
+		return 0, fmt.Errorf("malformed handshake ('m' expected)")
+	}
+
+	local := dh.options.MaxMessageSize
+	peer := int(binary.BigEndian.Uint32(packet[lenHeader+1:]))
+	if local == 0 || (peer > 0 && peer < local) {
+		return peer, nil
+	}
+	return local, nil
+}
+
+// genDigest returns MD5(Cookie ++ Challenge) where the challenge is the decimal string
+// representation of the unsigned 32-bit value (integer_to_list in Erlang). The same for
+// both handshake versions.
 func genDigest(challenge uint32, cookie string) []byte {
 	s := fmt.Sprintf("%s%d", cookie, challenge)
 	digest := md5.Sum([]byte(s))
@@ -0,0 +1,248 @@
+package dist
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo/lib"
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestHandshakeDigest(t *testing.T) {
+	// erlang:md5([atom_to_list(Cookie), integer_to_list(Challenge)])
+	vectors := []struct {
+		cookie    string
+		challenge uint32
+		digest    string
+	}{
+		{"cookie", 1, "022b150ae5b6cbed66ae1201494bd24e"},
+		{"ErgoCookie", 2147483648, "4454ee8d4aedf92f5b3fd9adf199f006"},
+		{"secret", 3735928559, "c3939b31d7a913d82e2ace09247c7b41"},
+	}
+
+	for _, v := range vectors {
+		digest := hex.EncodeToString(genDigest(v.challenge, v.cookie))
+		if digest != v.digest {
+			t.Fatalf("cookie %q challenge %d: expected digest %s, got %s", v.cookie, v.challenge, v.digest, digest)
+		}
+		expected, _ := hex.DecodeString(v.digest)
+		if CookieAuthenticator(v.cookie).Authenticate("peer", v.challenge, expected) == false {
+			t.Fatal("authentication failed")
+		}
+	}
+}
+
+func TestHandshakeChallengeVersion6(t *testing.T) {
+	dh := CreateDistHandshake(time.Second, DistHandshakeOptions{
+		Version: DistHandshakeVersion6,
+		Cookie:  "secret",
+	}).(*DistHandshake)
+	dh.Init("node@localhost", 0x01020304)
+	dh.challenge = 3735928559
+
+	flags := toNodeFlags(flagHandshake23, flagBigCreation, flagSpawn)
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	dh.composeChallengeVersion6(b, false, flags)
+
+	// 2 (length) + 'N' + 8 (flags) + 4 (challenge) + 4 (creation) + 2 (name length) + name
+	packet := b.B
+	if int(binary.BigEndian.Uint16(packet[0:2])) != len(packet)-2 || packet[2] != 'N' {
+		t.Fatal("malformed packet", packet)
+	}
+	if binary.BigEndian.Uint64(packet[3:11]) != flags.toUint64() ||
+		binary.BigEndian.Uint32(packet[11:15]) != 3735928559 ||
+		binary.BigEndian.Uint32(packet[15:19]) != 0x01020304 ||
+		int(binary.BigEndian.Uint16(packet[19:21])) != len("node@localhost") ||
+		string(packet[21:]) != "node@localhost" {
+		t.Fatal("malformed packet", packet)
+	}
+
+	challenge, name, peerFlags := dh.readChallengeVersion6(packet[3:])
+	if challenge != 3735928559 || name != "node@localhost" || peerFlags != flags {
+		t.Fatal("wrong result", challenge, name, peerFlags)
+	}
+
+	// truncated name
+	if _, name, _ := dh.readChallengeVersion6(packet[3 : len(packet)-1]); name != "" {
+		t.Fatal("must be malformed")
+	}
+}
+
+func TestHandshakeVersions(t *testing.T) {
+	cases := []struct {
+		name   string
+		start  node.HandshakeVersion
+		accept node.HandshakeVersion
+	}{
+		{"version 5 -> version 5", DistHandshakeVersion5, DistHandshakeVersion5},
+		{"version 5 -> version 6", DistHandshakeVersion5, DistHandshakeVersion6},
+		{"version 6 -> version 6", DistHandshakeVersion6, DistHandshakeVersion6},
+	}
+
+	handshake := func(start, accept node.HandshakeVersion, cookieStart, cookieAccept string) (error, error) {
+		a := CreateDistHandshake(time.Second, DistHandshakeOptions{Version: start, Cookie: cookieStart})
+		a.Init("a@localhost", 1)
+		b := CreateDistHandshake(time.Second, DistHandshakeOptions{Version: accept, Cookie: cookieAccept})
+		b.Init("b@localhost", 2)
+
+		// use TCP instead of net.Pipe since the peers might write simultaneously
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err, err
+		}
+		defer l.Close()
+
+		errAccept := make(chan error, 1)
+		go func() {
+			c2, err := l.Accept()
+			if err != nil {
+				errAccept <- err
+				return
+			}
+			defer c2.Close()
+			_, _, err = b.Accept(c2, false)
+			if err != nil {
+				c2.Close()
+			}
+			errAccept <- err
+		}()
+		c1, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return err, err
+		}
+		defer c1.Close()
+		_, err = a.Start(c1, false)
+		if err != nil {
+			c1.Close()
+		}
+		return err, <-errAccept
+	}
+
+	for _, c := range cases {
+		errStart, errAccept := handshake(c.start, c.accept, "secret", "secret")
+		if errStart != nil || errAccept != nil {
+			t.Fatalf("%s: %v, %v", c.name, errStart, errAccept)
+		}
+
+		errStart, errAccept = handshake(c.start, c.accept, "secret", "wrong")
+		if errAccept == nil {
+			t.Fatalf("%s: cookie mismatch must fail", c.name)
+		}
+		if errors.Is(errStart, node.ErrHandshakeCookie) == false {
+			t.Fatalf("%s: expected ErrHandshakeCookie, got %v", c.name, errStart)
+		}
+	}
+}
+
+func TestHandshakeClosedByPeer(t *testing.T) {
+	dh := CreateDistHandshake(time.Second, DistHandshakeOptions{Cookie: "secret"})
+	dh.Init("a@localhost", 1)
+
+	// the peer closes the connection before the challenge reply
+	// has been sent. it isn't a cookie mismatch
+	c1, c2 := net.Pipe()
+	go func() {
+		buf := make([]byte, 1024)
+		c2.Read(buf)
+		c2.Close()
+	}()
+	_, err := dh.Start(c1, false)
+	c1.Close()
+	if err == nil || errors.Is(err, node.ErrHandshakeCookie) {
+		t.Fatal("expected the connection error, got", err)
+	}
+}
+
+func TestHandshakeMaxFrameSize(t *testing.T) {
+	dh := CreateDistHandshake(time.Second, DistHandshakeOptions{
+		Cookie:       "secret",
+		MaxFrameSize: 100,
+	}).(*DistHandshake)
+	dh.Init("node@localhost", 1)
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go func() {
+		// the length prefix of the huge message followed by the beginning of its body
+		c1.Write([]byte{0xff, 0xff, 'N', 0, 0, 0})
+	}()
+	if _, _, err := dh.Accept(c2, false); err == nil || strings.Contains(err.Error(), "exceeds the limit") == false {
+		t.Fatal("expected the frame size error, got", err)
+	}
+
+	// 4 bytes length prefix is used for the TLS connections
+	if _, err := dh.readFrameLength([]byte{0x01, 0, 0, 0x10, 'N'}, 4); err == nil {
+		t.Fatal("must be rejected")
+	}
+	if l, err := dh.readFrameLength([]byte{0, 0, 0, 0x10, 'N'}, 4); err != nil || l != 0x10 {
+		t.Fatal("wrong result", l, err)
+	}
+}
+
+func TestHandshakeFlowControl(t *testing.T) {
+	handshake := func(start, accept bool) (node.ProtoOptions, node.ProtoOptions) {
+		a := CreateDistHandshake(time.Second, DistHandshakeOptions{Cookie: "secret", FlowControl: start})
+		a.Init("a@localhost", 1)
+		b := CreateDistHandshake(time.Second, DistHandshakeOptions{Cookie: "secret", FlowControl: accept})
+		b.Init("b@localhost", 2)
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		accepted := make(chan node.ProtoOptions, 1)
+		go func() {
+			c2, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			defer c2.Close()
+			_, options, err := b.Accept(c2, false)
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- options
+		}()
+		c1, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c1.Close()
+		optionsStart, err := a.Start(c1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		optionsAccept, ok := <-accepted
+		if !ok {
+			t.Fatal("accept failed")
+		}
+		return optionsStart, optionsAccept
+	}
+
+	cases := []struct {
+		start, accept, expected bool
+	}{
+		{true, true, true},
+		{true, false, false},
+		{false, true, false},
+		{false, false, false},
+	}
+	for _, c := range cases {
+		a, b := handshake(c.start, c.accept)
+		if a.Flags.EnableFlowControl != c.expected || b.Flags.EnableFlowControl != c.expected {
+			t.Fatalf("%v -> %v: expected %v, got %v and %v", c.start, c.accept, c.expected,
+				a.Flags.EnableFlowControl, b.Flags.EnableFlowControl)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package dist
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/lib"
+	"github.com/ergo-services/ergo/node"
+)
+
+const (
+	// DefaultMulticastGroup
+	DefaultMulticastGroup = "239.255.43.99"
+	// DefaultMulticastPort
+	DefaultMulticastPort uint16 = 4370
+	// DefaultMulticastTTL how long the discovered node is kept in the peer table
+	// since its last announcement
+	DefaultMulticastTTL = 10 * time.Second
+
+	multicastMagic   = 4412
+	multicastVersion = 1
+	multicastMaxSize = 1024
+)
+
+// multicastResolver implements resolver discovering the nodes via UDP multicast
+type multicastResolver struct {
+	node.Resolver
+
+	ctx     context.Context
+	group   *net.UDPAddr
+	ifi     *net.Interface
+	ttl     time.Duration
+	started bool
+
+	names              []string
+	port               uint16
+	options            node.ResolverOptions
+	announcements      [][]byte
+	mutexAnnouncements sync.Mutex
+	// announceNow makes the node announce itself without waiting for the interval
+	announceNow chan struct{}
+
+	mutexPeers sync.Mutex
+	peers      map[string]multicastPeer
+}
+
+type multicastPeer struct {
+	route   node.Route
+	expires time.Time
+}
+
+// MulticastResolverOptions defines options for the multicast resolver
+type MulticastResolverOptions struct {
+	// Group defines the multicast group address. Default is DefaultMulticastGroup
+	Group string
+	// Port defines the UDP port of the multicast group. Default is DefaultMulticastPort
+	Port uint16
+	// TTL defines how long the node is kept in the peer table since its last
+	// announcement. The node announces itself every TTL/3. Default is DefaultMulticastTTL
+	TTL time.Duration
+	// Interface defines the network interface to join the group on. Default is nil
+	// (the system-assigned one)
+	Interface *net.Interface
+}
+
+// CreateMulticastResolver creates resolver for the zero-config local clusters. The
+// nodes announce themselves over UDP multicast and discover each other with no EPMD
+// server or static routes. The announced host is the host part of the node name, so
+// it must be reachable by the peers.
+func CreateMulticastResolver(ctx context.Context, group string, port uint16) (node.Resolver, error) {
+	options := MulticastResolverOptions{
+		Group: group,
+		Port:  port,
+	}
+	return CreateMulticastResolverWithOptions(ctx, options)
+}
+
+// CreateMulticastResolverWithOptions
+func CreateMulticastResolverWithOptions(ctx context.Context, options MulticastResolverOptions) (node.Resolver, error) {
+	if options.Group == "" {
+		options.Group = DefaultMulticastGroup
+	}
+	if options.Port == 0 {
+		options.Port = DefaultMulticastPort
+	}
+	if options.TTL == 0 {
+		options.TTL = DefaultMulticastTTL
+	}
+	hostPort := net.JoinHostPort(options.Group, strconv.Itoa(int(options.Port)))
+	group, err := net.ResolveUDPAddr("udp", hostPort)
+	if err != nil {
+		return nil, err
+	}
+	if group.IP.IsMulticast() == false {
+		return nil, fmt.Errorf("%s is not a multicast address", options.Group)
+	}
+
+	resolver := &multicastResolver{
+		ctx:   ctx,
+		group: group,
+		ifi:   options.Interface,
+		ttl:   options.TTL,
+		peers: make(map[string]multicastPeer),
+
+		announceNow: make(chan struct{}, 1),
+	}
+	return resolver, nil
+}
+
+// Register joins the multicast group and starts announcing the node (with its aliases)
+// until the node is stopped.
+func (m *multicastResolver) Register(name string, port uint16, options node.ResolverOptions) error {
+	if m.started {
+		return fmt.Errorf("multicast resolver is already registered")
+	}
+
+	names := []string{name}
+	nn, err := etf.ParseNodeName(name)
+	if err != nil {
+		return err
+	}
+	for _, alias := range options.Aliases {
+		an, err := etf.ParseNodeName(alias)
+		if err != nil {
+			return err
+		}
+		if an.Host != nn.Host {
+			return fmt.Errorf("alias %q must have the same host as the node %q", alias, name)
+		}
+		names = append(names, alias)
+	}
+
+	m.mutexAnnouncements.Lock()
+	m.names = names
+	m.port = port
+	m.options = options
+	err = m.composeAnnouncements()
+	m.mutexAnnouncements.Unlock()
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.ListenMulticastUDP("udp", m.ifi, m.group)
+	if err != nil {
+		return err
+	}
+	sender, err := net.DialUDP("udp", nil, m.group)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	m.started = true
+
+	go func() {
+		<-m.ctx.Done()
+		// interrupt reading
+		listener.Close()
+	}()
+
+	go m.receive(name, listener)
+	go m.announce(name, sender)
+	return nil
+}
+
+// SetMaintenance updates the announcements of the node and announces them immediately.
+// The route resolved by the peers has the Maintenance flag set.
+func (m *multicastResolver) SetMaintenance(enable bool) error {
+	m.mutexAnnouncements.Lock()
+	m.options.Maintenance = enable
+	err := m.composeAnnouncements()
+	m.mutexAnnouncements.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.requestAnnouncement()
+	return nil
+}
+
+// SetListenPort updates the announcements of the node with the given port and
+// announces them immediately
+func (m *multicastResolver) SetListenPort(port uint16) error {
+	m.mutexAnnouncements.Lock()
+	m.port = port
+	err := m.composeAnnouncements()
+	m.mutexAnnouncements.Unlock()
+	if err != nil {
+		return err
+	}
+	m.requestAnnouncement()
+	return nil
+}
+
+// Resolve returns the route to the node discovered within the last TTL
+func (m *multicastResolver) Resolve(name string) (node.Route, error) {
+	m.mutexPeers.Lock()
+	defer m.mutexPeers.Unlock()
+
+	peer, exist := m.peers[name]
+	if exist == false {
+		return node.Route{}, fmt.Errorf("desired node not found")
+	}
+	if time.Now().After(peer.expires) {
+		delete(m.peers, name)
+		return node.Route{}, fmt.Errorf("desired node not found")
+	}
+	return peer.route, nil
+}
+
+// requestAnnouncement makes the node announce itself without waiting for the interval
+func (m *multicastResolver) requestAnnouncement() {
+	select {
+	case m.announceNow <- struct{}{}:
+	default:
+		// already requested
+	}
+}
+
+func (m *multicastResolver) announce(nodename string, conn *net.UDPConn) {
+	defer conn.Close()
+
+	interval := m.ttl / 3
+	for {
+		m.mutexAnnouncements.Lock()
+		announcements := m.announcements
+		m.mutexAnnouncements.Unlock()
+
+		for _, announcement := range announcements {
+			if _, err := conn.Write(announcement); err != nil {
+				lib.Log("[%s] MULTICAST resolver: can't announce the node: %s", nodename, err)
+			}
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.announceNow:
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (m *multicastResolver) receive(nodename string, conn *net.UDPConn) {
+	buf := make([]byte, multicastMaxSize)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if m.ctx.Err() != nil {
+				// node is stopped
+				return
+			}
+			lib.Log("[%s] MULTICAST resolver: can't read announcement: %s", nodename, err)
+			continue
+		}
+
+		route, err := m.readAnnouncement(buf[:n])
+		if err != nil {
+			// not ours
+			continue
+		}
+
+		now := time.Now()
+		m.mutexPeers.Lock()
+		m.peers[route.NodeName] = multicastPeer{
+			route:   route,
+			expires: now.Add(m.ttl),
+		}
+		// age out the dead nodes
+		for name, peer := range m.peers {
+			if now.After(peer.expires) {
+				delete(m.peers, name)
+			}
+		}
+		m.mutexPeers.Unlock()
+	}
+}
+
+// composeAnnouncements must be called under the mutexAnnouncements
+func (m *multicastResolver) composeAnnouncements() error {
+	announcements := [][]byte{}
+	for _, name := range m.names {
+		announcement, err := m.composeAnnouncement(name, m.port, m.options)
+		if err != nil {
+			return err
+		}
+		announcements = append(announcements, announcement)
+	}
+	m.announcements = announcements
+	return nil
+}
+
+func (m *multicastResolver) composeAnnouncement(name string, port uint16, options node.ResolverOptions) ([]byte, error) {
+	// 2 bytes: multicastMagic
+	// 1 byte: multicastVersion
+	// 1 byte: flag enabled TLS
+	// 1 byte: flag enabled proxy
+	// 1 byte: flag maintenance
+	// 2 bytes: port
+	// 2 bytes: length of the node name
+	// N bytes: node name
+	// the additional listeners (see composeListeners) if there are any
+	buf := make([]byte, 10+len(name))
+	if len(options.Listeners) > 1 {
+		buf = append(buf, composeListeners(options.Listeners[1:])...)
+	}
+	if len(buf) > multicastMaxSize {
+		return nil, fmt.Errorf("node name %q is too long", name)
+	}
+	binary.BigEndian.PutUint16(buf[0:2], uint16(multicastMagic))
+	buf[2] = multicastVersion
+	if options.EnabledTLS {
+		buf[3] = 1
+	}
+	if options.EnabledProxy {
+		buf[4] = 1
+	}
+	if options.Maintenance {
+		buf[5] = 1
+	}
+	binary.BigEndian.PutUint16(buf[6:8], port)
+	binary.BigEndian.PutUint16(buf[8:10], uint16(len(name)))
+	copy(buf[10:10+len(name)], name)
+	return buf, nil
+}
+
+func (m *multicastResolver) readAnnouncement(buf []byte) (node.Route, error) {
+	var route node.Route
+
+	if len(buf) < 10 {
+		return route, fmt.Errorf("malformed announcement")
+	}
+	if binary.BigEndian.Uint16(buf[0:2]) != uint16(multicastMagic) {
+		return route, fmt.Errorf("malformed announcement")
+	}
+	if buf[2] != multicastVersion {
+		return route, fmt.Errorf("unsupported announcement version %d", buf[2])
+	}
+	l := int(binary.BigEndian.Uint16(buf[8:10]))
+	if len(buf) < 10+l {
+		return route, fmt.Errorf("malformed announcement")
+	}
+	name := string(buf[10 : 10+l])
+	if len(buf) > 10+l {
+		route.Listeners = readListeners(buf[10+l:])
+	}
+	nn, err := etf.ParseNodeName(name)
+	if err != nil {
+		return route, err
+	}
+
+	route.NodeName = name
+	route.Name = nn.Name
+	route.Host = nn.Host
+	route.Port = binary.BigEndian.Uint16(buf[6:8])
+	route.EnabledTLS = buf[3] == 1
+	route.EnabledProxy = buf[4] == 1
+	route.Maintenance = buf[5] == 1
+	route.IsErgo = true
+	return route, nil
+}
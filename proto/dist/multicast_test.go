@@ -0,0 +1,109 @@
+package dist
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestMulticastResolver(t *testing.T) {
+	options := MulticastResolverOptions{
+		Group: "239.255.43.100",
+		Port:  45371,
+		TTL:   300 * time.Millisecond,
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	r1, err := CreateMulticastResolverWithOptions(ctx1, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	r2, err := CreateMulticastResolverWithOptions(ctx2, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro1 := node.ResolverOptions{
+		EnabledTLS: true,
+		Aliases:    []string{"alias1@localhost"},
+	}
+	if err := r1.Register("node1@localhost", 15001, ro1); err != nil {
+		t.Fatal(err)
+	}
+	ro2 := node.ResolverOptions{
+		Listeners: []node.ResolverListener{
+			{Port: 15002, HandshakeVersion: DistHandshakeVersion5},
+			{Port: 15012, HandshakeVersion: DistHandshakeVersion6, EnabledTLS: true},
+		},
+	}
+	if err := r2.Register("node2@localhost", 15002, ro2); err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := func(r node.Resolver, name string) (node.Route, error) {
+		var route node.Route
+		var err error
+		for i := 0; i < 50; i++ {
+			if route, err = r.Resolve(name); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return route, err
+	}
+
+	route, err := resolve(r2, "node1@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.Port != 15001 || route.Host != "localhost" || route.Name != "node1" ||
+		route.EnabledTLS == false || route.IsErgo == false {
+		t.Fatal("wrong route", route)
+	}
+	if route, err = resolve(r2, "alias1@localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if route.Port != 15001 {
+		t.Fatal("wrong route of the alias", route)
+	}
+	if route, err = resolve(r1, "node2@localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if route.Port != 15002 || route.EnabledTLS {
+		t.Fatal("wrong route", route)
+	}
+	if !reflect.DeepEqual(route.Listeners, ro2.Listeners[1:]) {
+		t.Fatal("wrong additional listeners", route.Listeners)
+	}
+
+	// node1 advertises the maintenance mode
+	if err := r1.(node.ResolverMaintenance).SetMaintenance(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if route, err = r2.Resolve("node1@localhost"); err == nil && route.Maintenance {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if route.Maintenance == false {
+		t.Fatal("maintenance mode isn't advertised", route)
+	}
+
+	// node1 is stopped and must age out of the peer table
+	cancel1()
+	time.Sleep(2 * options.TTL)
+	if _, err := r2.Resolve("node1@localhost"); err == nil {
+		t.Fatal("stopped node must be aged out")
+	}
+
+	if _, err := CreateMulticastResolver(ctx2, "127.0.0.1", 45371); err == nil {
+		t.Fatal("must fail on the unicast address")
+	}
+}
@@ -1,6 +1,8 @@
 package dist
 
 import (
+	"bytes"
+	"compress/zlib"
 	"context"
 	"encoding/binary"
 	"fmt"
@@ -21,6 +23,7 @@ var (
 	ErrMissingInCache     = fmt.Errorf("missing in cache")
 	ErrMalformed          = fmt.Errorf("malformed")
 	ErrOverloadConnection = fmt.Errorf("connection buffer is overloaded")
+	ErrReassemblyLimit    = fmt.Errorf("exceeded the limit of reassembling data")
 )
 
 func init() {
@@ -33,6 +36,19 @@ const (
 	defaultCleanTimeout  = 5 * time.Second  // for checkClean
 	defaultCleanDeadline = 30 * time.Second // for checkClean
 
+	// flow control
+	flowControlSignal = etf.Atom("$ergo_flow_control")
+	flowControlPause  = 100 * time.Millisecond
+
+	// the space reserved for the dist header (including the atom cache) of
+	// the outgoing packet. MaxMessageSize limits the message (control and payload),
+	// the packet may exceed it by this size.
+	maxDistHeaderSize = 8192
+
+	// the limit for the uncompressed size of the compressed packet
+	// if MaxMessageSize is not defined
+	maxDecompressedSize = 64 * 1024 * 1024
+
 	// http://erlang.org/doc/apps/erts/erl_ext_dist.html#distribution_header
 	protoDist           = 131
 	protoDistCompressed = 80
@@ -47,6 +63,7 @@ type fragmentedPacket struct {
 	disorderedSlices map[uint64][]byte
 	fragmentID       uint64
 	lastUpdate       time.Time
+	size             int
 }
 
 type distConnection struct {
@@ -59,6 +76,7 @@ type distConnection struct {
 	conn          io.ReadWriter
 	compression   bool
 	options       node.ProtoOptions
+	ctx           context.Context
 	cancelContext context.CancelFunc
 
 	// route incoming messages
@@ -83,12 +101,18 @@ type distConnection struct {
 	sequenceID     int64
 	fragments      map[uint64]*fragmentedPacket
 	fragmentsMutex sync.Mutex
+	// amount of data kept in fragments
+	fragmentsSize int
 
 	// check and clean lost fragments
 	checkCleanPending  bool
 	checkCleanTimer    *time.Timer
 	checkCleanTimeout  time.Duration // default is 5 seconds
 	checkCleanDeadline time.Duration // how long we wait for the next fragment of the certain sequenceID. Default is 30 seconds
+
+	// flow control. keeps the deadlines of the paused targets (pid, name or alias)
+	flowControl      map[etf.Term]time.Time
+	flowControlMutex sync.Mutex
 }
 
 type distProto struct {
@@ -121,6 +145,28 @@ func (dp *distProto) Init(conn io.ReadWriter, peername string, options node.Prot
 		router:      router,
 		options:     options,
 		compression: dp.compression,
+		flowControl: make(map[etf.Term]time.Time),
+
+		checkCleanDeadline: options.ReassemblyTimeout,
+	}
+
+	connection.ctx, connection.cancelContext = context.WithCancel(context.Background())
+
+	// create the queues for the outgoing messages here, since the connection is
+	// registered (and can be used for sending) before Serve is started. The messages
+	// are kept in the queues until the senders are run by Serve.
+	numHandlers := options.NumHandlers
+	if numHandlers < 1 {
+		numHandlers = runtime.GOMAXPROCS(0)
+	}
+	connection.senders = senders{
+		sender: make([]*senderChannel, numHandlers),
+		n:      int32(numHandlers),
+	}
+	for i := 0; i < numHandlers; i++ {
+		connection.senders.sender[i] = &senderChannel{
+			sendChannel: make(chan *sendMessage, options.SendQueueLength),
+		}
 	}
 	return connection, nil
 }
@@ -128,7 +174,6 @@ func (dp *distProto) Init(conn io.ReadWriter, peername string, options node.Prot
 type senders struct {
 	sender []*senderChannel
 	n      int32
-	i      int32
 }
 
 type senderChannel struct {
@@ -139,7 +184,11 @@ type senderChannel struct {
 type sendMessage struct {
 	control     etf.Term
 	payload     etf.Term
+	payloadRaw  []byte
 	compression bool
+	// barrier is set for the message made by Barrier. Sender flushes the
+	// link and replies to this channel
+	barrier chan error
 }
 
 type receivers struct {
@@ -154,20 +203,33 @@ func (dp *distProto) Serve(ctx context.Context, conn node.ConnectionInterface) {
 		fmt.Println("conn is not a *distConnection type")
 		return
 	}
-	connectionctx, cancel := context.WithCancel(ctx)
+	// connection context is created by Init, stop it along with the given one
+	connectionctx := connection.ctx
+	cancel := connection.cancelContext
 	defer cancel()
-	connection.cancelContext = cancel
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-connectionctx.Done():
+		}
+	}()
 
 	// initializing atom cache if its enabled
 	if connection.options.Flags.DisableHeaderAtomCache == false {
-		connection.cacheOut = etf.NewAtomCache(connectionctx)
+		cacheOptions := etf.AtomCacheOptions{
+			Size:    connection.options.AtomCacheSize,
+			Preload: connection.options.AtomCachePreload,
+		}
+		connection.cacheOut = etf.NewAtomCacheWithOptions(connectionctx, cacheOptions)
 	}
 
 	// create connection buffering
 	connection.flusher = newLinkFlusher(connection.conn, defaultLatency)
 
-	// define the total number of reader/writer goroutines
-	numHandlers := runtime.GOMAXPROCS(connection.options.NumHandlers)
+	// the number of reader/writer goroutines is defined by the number
+	// of the send queues created on Init
+	numHandlers := len(connection.senders.sender)
 
 	// do not use shared channels within intencive code parts, impacts on a performance
 	connection.receivers = receivers{
@@ -182,17 +244,10 @@ func (dp *distProto) Serve(ctx context.Context, conn node.ConnectionInterface) {
 		go connection.receiver(recv)
 	}
 
-	connection.senders = senders{
-		sender: make([]*senderChannel, numHandlers),
-		n:      int32(numHandlers),
-	}
-	// run readers/writers for incoming/outgoing messages
+	// run writers for outgoing messages
 	for i := 0; i < numHandlers; i++ {
 		// run writer routines (encoder)
-		send := make(chan *sendMessage, connection.options.SendQueueLength)
-		connection.senders.sender[i] = &senderChannel{
-			sendChannel: send,
-		}
+		send := connection.senders.sender[i].sendChannel
 		go connection.sender(send, connection.options.FragmentationUnit, connection.options.Flags)
 	}
 
@@ -258,6 +313,15 @@ func (dp *distProto) Serve(ctx context.Context, conn node.ConnectionInterface) {
 func (dc *distConnection) Send(from gen.Process, to etf.Pid, message etf.Term) error {
 	var compression bool
 
+	if dc.isPaused(to) {
+		return node.ErrProcessBusy
+	}
+
+	message, err := dc.onSend(from.Self(), to, message)
+	if err != nil {
+		return err
+	}
+
 	if dc.compression == true {
 		compression = true
 	} else {
@@ -268,11 +332,40 @@ func (dc *distConnection) Send(from gen.Process, to etf.Pid, message etf.Term) e
 		payload:     message,
 		compression: compression,
 	}
-	return dc.send(msg)
+	if dc.options.Flags.EnableFlowControl {
+		// the receiver must know the sender to notify it
+		msg.control = etf.Tuple{distProtoSEND_SENDER, from.Self(), to}
+	}
+	return dc.send(from.Self(), to, msg)
+}
+func (dc *distConnection) SendRaw(from gen.Process, to etf.Pid, encoded []byte) error {
+	msg := &sendMessage{
+		control:    etf.Tuple{distProtoSEND, etf.Atom(""), to},
+		payloadRaw: encoded,
+	}
+	if dc.options.Flags.EnableFlowControl {
+		msg.control = etf.Tuple{distProtoSEND_SENDER, from.Self(), to}
+	}
+	return dc.send(from.Self(), to, msg)
+}
+func (dc *distConnection) MaxMessageSize() int {
+	return dc.options.MaxMessageSize
+}
+func (dc *distConnection) Flags() node.ProtoFlags {
+	return dc.options.Flags
 }
 func (dc *distConnection) SendReg(from gen.Process, to gen.ProcessID, message etf.Term) error {
 	var compression bool
 
+	if dc.isPaused(etf.Atom(to.Name)) {
+		return node.ErrProcessBusy
+	}
+
+	message, err := dc.onSend(from.Self(), to, message)
+	if err != nil {
+		return err
+	}
+
 	if dc.compression == true {
 		compression = true
 	} else {
@@ -283,11 +376,20 @@ func (dc *distConnection) SendReg(from gen.Process, to gen.ProcessID, message et
 		payload:     message,
 		compression: compression,
 	}
-	return dc.send(msg)
+	return dc.send(from.Self(), etf.Atom(to.Name), msg)
 }
 func (dc *distConnection) SendAlias(from gen.Process, to etf.Alias, message etf.Term) error {
 	var compression bool
 
+	if dc.isPaused(etf.Ref(to)) {
+		return node.ErrProcessBusy
+	}
+
+	message, err := dc.onSend(from.Self(), to, message)
+	if err != nil {
+		return err
+	}
+
 	if dc.compression == true {
 		compression = true
 	} else {
@@ -298,67 +400,92 @@ func (dc *distConnection) SendAlias(from gen.Process, to etf.Alias, message etf.
 		payload:     message,
 		compression: compression,
 	}
-	return dc.send(msg)
+	return dc.send(from.Self(), to, msg)
 }
 
 func (dc *distConnection) Link(local etf.Pid, remote etf.Pid) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoLINK, local, remote},
 	}
-	return dc.send(msg)
+	return dc.send(local, remote, msg)
 }
 func (dc *distConnection) Unlink(local etf.Pid, remote etf.Pid) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoUNLINK, local, remote},
 	}
-	return dc.send(msg)
+	return dc.send(local, remote, msg)
 }
 func (dc *distConnection) LinkExit(to etf.Pid, terminated etf.Pid, reason string) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoEXIT, terminated, to, etf.Atom(reason)},
 	}
-	return dc.send(msg)
+	return dc.send(terminated, to, msg)
 }
 
 func (dc *distConnection) Monitor(local etf.Pid, remote etf.Pid, ref etf.Ref) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoMONITOR, local, remote, ref},
 	}
-	return dc.send(msg)
+	return dc.send(local, remote, msg)
 }
 func (dc *distConnection) MonitorReg(local etf.Pid, remote gen.ProcessID, ref etf.Ref) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoMONITOR, local, etf.Atom(remote.Name), ref},
 	}
-	return dc.send(msg)
+	return dc.send(local, etf.Atom(remote.Name), msg)
 }
 func (dc *distConnection) Demonitor(local etf.Pid, remote etf.Pid, ref etf.Ref) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoDEMONITOR, local, remote, ref},
 	}
-	return dc.send(msg)
+	return dc.send(local, remote, msg)
 }
 func (dc *distConnection) DemonitorReg(local etf.Pid, remote gen.ProcessID, ref etf.Ref) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoDEMONITOR, local, etf.Atom(remote.Name), ref},
 	}
-	return dc.send(msg)
+	return dc.send(local, etf.Atom(remote.Name), msg)
 }
 func (dc *distConnection) MonitorExitReg(to etf.Pid, terminated gen.ProcessID, reason string, ref etf.Ref) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoMONITOR_EXIT, etf.Atom(terminated.Name), to, ref, etf.Atom(reason)},
 	}
-	return dc.send(msg)
+	return dc.send(etf.Atom(terminated.Name), to, msg)
 }
 func (dc *distConnection) MonitorExit(to etf.Pid, terminated etf.Pid, reason string, ref etf.Ref) error {
 	msg := &sendMessage{
 		control: etf.Tuple{distProtoMONITOR_EXIT, terminated, to, ref, etf.Atom(reason)},
 	}
-	return dc.send(msg)
+	return dc.send(terminated, to, msg)
 }
 
-func (dc *distConnection) SpawnRequest() error {
-	return nil
+func (dc *distConnection) SpawnRequest(behaviorName string, request gen.RemoteSpawnRequest) error {
+	optlist := etf.List{}
+	if request.Name != "" {
+		optlist = append(optlist, etf.Tuple{etf.Atom("name"), etf.Atom(request.Name)})
+	}
+	msg := &sendMessage{
+		// {29, ReqId, From, GroupLeader, {Module, Function, Arity}, OptList}
+		control: etf.Tuple{distProtoSPAWN_REQUEST, request.Ref, request.From, request.From,
+			etf.Tuple{etf.Atom(behaviorName), etf.Atom(request.Function), len(request.Args)},
+			optlist,
+		},
+		payload: etf.List(request.Args),
+	}
+	return dc.send(request.From, etf.Atom(behaviorName), msg)
+}
+func (dc *distConnection) SpawnReply(to etf.Pid, ref etf.Ref, spawned etf.Pid) error {
+	msg := &sendMessage{
+		// {31, ReqId, To, Flags, Result}
+		control: etf.Tuple{distProtoSPAWN_REPLY, ref, to, 0, spawned},
+	}
+	return dc.send(spawned, to, msg)
+}
+func (dc *distConnection) SpawnReplyError(to etf.Pid, ref etf.Ref, err error) error {
+	msg := &sendMessage{
+		control: etf.Tuple{distProtoSPAWN_REPLY, ref, to, 0, etf.Atom(err.Error())},
+	}
+	return dc.send(ref, to, msg)
 }
 func (dc *distConnection) Proxy() error {
 	return nil
@@ -377,7 +504,7 @@ func (dc *distConnection) read(ctx context.Context, b *lib.Buffer) (int, error)
 
 	for {
 		if b.Len() < expectingBytes {
-			n, e := b.ReadDataFrom(dc.conn, dc.options.MaxMessageSize)
+			n, e := b.ReadDataFrom(dc.conn, dc.maxPacketSize())
 			if n == 0 {
 				// link was closed
 				return 0, nil
@@ -398,6 +525,10 @@ func (dc *distConnection) read(ctx context.Context, b *lib.Buffer) (int, error)
 		}
 
 		packetLength := binary.BigEndian.Uint32(b.B[:4])
+		if max := dc.maxPacketSize(); max > 0 && int(packetLength) > max {
+			lib.Log("[%s] received too large packet (%d bytes) from %s", dc.nodename, packetLength, dc.peername)
+			return 0, node.ErrMessageTooLarge
+		}
 		if packetLength == 0 {
 			// keepalive
 			b.Set(b.B[4:])
@@ -541,12 +672,45 @@ func (dc *distConnection) decodePacket(packet []byte) (etf.Term, etf.Term, error
 func (dc *distConnection) decodeDist(packet []byte) (etf.Term, etf.Term, error) {
 	switch packet[0] {
 	case protoDistCompressed:
-		// do we need it?
-		// zip.NewReader(...)
-		// ...unzipping to the new buffer b (lib.TakeBuffer)
-		// just in case: if b[0] == protoDistCompressed return error
-		// otherwise it will cause recursive call and im not sure if its ok
-		// return l.decodeDist(b)
+		// 1 (protoDistCompressed) + 4 (uncompressed size) + zlib data
+		if len(packet) < 5 {
+			return nil, nil, ErrMalformed
+		}
+		size := int(binary.BigEndian.Uint32(packet[1:5]))
+		if size == 0 {
+			return nil, nil, ErrMalformed
+		}
+		if size > dc.maxUncompressedSize() {
+			return nil, nil, node.ErrMessageTooLarge
+		}
+		zr, err := zlib.NewReaderDict(bytes.NewReader(packet[5:]), dc.options.CompressionDictionary)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer zr.Close()
+
+		// do not trust the declared size. the buffer grows with the actual data
+		// and the extra byte reveals the data exceeding the declared size
+		b := lib.TakeBuffer()
+		defer lib.ReleaseBuffer(b)
+		lr := io.LimitReader(zr, int64(size)+1)
+		for {
+			_, err := b.ReadDataFrom(lr, size+1)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if b.Len() != size {
+			return nil, nil, ErrMalformed
+		}
+		// do not allow nested compression
+		if b.B[0] == protoDistCompressed {
+			return nil, nil, ErrMalformed
+		}
+		return dc.decodeDist(b.B)
 
 	case protoDistMessage:
 		var control, message etf.Term
@@ -559,6 +723,11 @@ func (dc *distConnection) decodeDist(packet []byte) (etf.Term, etf.Term, error)
 			return nil, nil, err
 		}
 
+		// the same measure as checkMessageSize uses on the sending side
+		if dc.options.MaxMessageSize > 0 && len(packet) > dc.options.MaxMessageSize {
+			return nil, nil, node.ErrMessageTooLarge
+		}
+
 		decodeOptions := etf.DecodeOptions{
 			// FIXME must be used from peer's flag
 			FlagBigPidRef: false,
@@ -574,6 +743,14 @@ func (dc *distConnection) decodeDist(packet []byte) (etf.Term, etf.Term, error)
 			return control, nil, nil
 		}
 
+		if from, ok := dc.rawReceiver(control); ok {
+			message, err = dc.rawMessage(from, packet, cache, decodeOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+			return control, message, nil
+		}
+
 		// decode payload message
 		message, packet, err = etf.Decode(packet, cache, decodeOptions)
 		if err != nil {
@@ -618,6 +795,94 @@ func (dc *distConnection) decodeDist(packet []byte) (etf.Term, etf.Term, error)
 	return nil, nil, fmt.Errorf("unknown packet type %d", packet[0])
 }
 
+// rawReceiver returns the sender of the message if it's addressed to the local process
+// receiving the raw messages (see gen.ProcessOptions.RawMessages). The payload of such
+// a message is never decoded.
+func (dc *distConnection) rawReceiver(control etf.Term) (etf.Pid, bool) {
+	var from, to etf.Pid
+	var name etf.Atom
+
+	t, ok := control.(etf.Tuple)
+	if !ok || len(t) < 3 {
+		return from, false
+	}
+	switch t.Element(1) {
+	case distProtoSEND:
+		if dc.options.Flags.EnableFlowControl {
+			// the flow control signals are sent using SEND
+			return from, false
+		}
+		to, ok = t.Element(3).(etf.Pid)
+		if !ok || string(to.Node) != dc.nodename {
+			return from, false
+		}
+	case distProtoSEND_SENDER:
+		from, _ = t.Element(2).(etf.Pid)
+		to, ok = t.Element(3).(etf.Pid)
+		if !ok || string(to.Node) != dc.nodename {
+			return from, false
+		}
+	case distProtoREG_SEND:
+		if len(t) != 4 {
+			return from, false
+		}
+		from, _ = t.Element(2).(etf.Pid)
+		name, _ = t.Element(4).(etf.Atom)
+	default:
+		return from, false
+	}
+
+	// do not look up the process if there are no raw receivers at all
+	if dc.router.HasRawReceivers() == false {
+		return from, false
+	}
+	var process gen.Process
+	if name != "" {
+		process = dc.router.ProcessByName(string(name))
+	} else {
+		process = dc.router.ProcessByPid(to)
+	}
+	if process == nil || process.RawMessages() == false {
+		return from, false
+	}
+	return from, true
+}
+
+// rawMessage makes gen.MessageRaw with the encoded payload. If the peer uses the atom
+// cache, the payload might refer to it, so it's decoded and encoded again with
+// disabled atom cache to make it usable outside this link.
+func (dc *distConnection) rawMessage(from etf.Pid, payload []byte, cache []etf.Atom, options etf.DecodeOptions) (gen.MessageRaw, error) {
+	message := gen.MessageRaw{From: from}
+	if len(cache) == 0 {
+		// the packet buffer is reused once the message is handled
+		message.Data = make([]byte, len(payload))
+		copy(message.Data, payload)
+		return message, nil
+	}
+
+	term, tail, err := etf.Decode(payload, cache, options)
+	if err != nil {
+		return message, err
+	}
+	if len(tail) != 0 {
+		return message, fmt.Errorf("packet has extra %d byte(s)", len(tail))
+	}
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	encodeOptions := etf.EncodeOptions{
+		FlagBigCreation: dc.options.Flags.EnableBigCreation,
+		FlagBigPidRef:   dc.options.Flags.EnableBigPidRef,
+		StringAsBinary:  dc.options.Flags.EnableStringAsBinary,
+		TimeEncoding:    dc.options.TimeEncoding,
+	}
+	if err := etf.Encode(term, b, encodeOptions); err != nil {
+		return message, err
+	}
+	message.Data = make([]byte, b.Len())
+	copy(message.Data, b.B)
+	return message, nil
+}
+
 func (dc *distConnection) handleMessage(control, message etf.Term) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -637,14 +902,43 @@ func (dc *distConnection) handleMessage(control, message etf.Term) (err error) {
 					Node: dc.nodename,
 					Name: string(t.Element(4).(etf.Atom)),
 				}
-				dc.router.RouteSendReg(t.Element(2).(etf.Pid), to, message)
+				from := t.Element(2).(etf.Pid)
+				message, ok := dc.onRecv(from, to, message)
+				if ok == false {
+					return nil
+				}
+				if err := dc.router.RouteSendReg(from, to, message); err == node.ErrProcessMailboxFull {
+					dc.sendFlowControl(from, t.Element(4))
+				}
 				return nil
 
 			case distProtoSEND:
 				// {2, Unused, ToPid}
 				// SEND has no sender pid
 				lib.Log("[%s] CONTROL SEND [from %s]: %#v", dc.nodename, dc.peername, control)
-				dc.router.RouteSend(etf.Pid{}, t.Element(3).(etf.Pid), message)
+				if dc.handleFlowControl(message) {
+					return nil
+				}
+				to := t.Element(3).(etf.Pid)
+				message, ok := dc.onRecv(etf.Pid{}, to, message)
+				if ok == false {
+					return nil
+				}
+				dc.router.RouteSend(etf.Pid{}, to, message)
+				return nil
+
+			case distProtoSEND_SENDER:
+				// {22, FromPid, ToPid}
+				lib.Log("[%s] CONTROL SEND_SENDER [from %s]: %#v", dc.nodename, dc.peername, control)
+				from := t.Element(2).(etf.Pid)
+				to := t.Element(3).(etf.Pid)
+				message, ok := dc.onRecv(from, to, message)
+				if ok == false {
+					return nil
+				}
+				if err := dc.router.RouteSend(from, to, message); err == node.ErrProcessMailboxFull {
+					dc.sendFlowControl(from, to)
+				}
 				return nil
 
 			case distProtoLINK:
@@ -729,9 +1023,6 @@ func (dc *distConnection) handleMessage(control, message etf.Term) (err error) {
 				return fmt.Errorf("malformed monitor exit message")
 
 			// Not implemented yet, just stubs. TODO.
-			case distProtoSEND_SENDER:
-				lib.Log("[%s] CONTROL SEND_SENDER unsupported [from %s]: %#v", dc.nodename, dc.peername, control)
-				return nil
 			case distProtoPAYLOAD_EXIT:
 				lib.Log("[%s] CONTROL PAYLOAD_EXIT unsupported [from %s]: %#v", dc.nodename, dc.peername, control)
 				return nil
@@ -746,8 +1037,15 @@ func (dc *distConnection) handleMessage(control, message etf.Term) (err error) {
 			case distProtoALIAS_SEND:
 				// {33, FromPid, Alias}
 				lib.Log("[%s] CONTROL ALIAS_SEND [from %s]: %#v", dc.nodename, dc.peername, control)
+				from := t.Element(2).(etf.Pid)
 				alias := etf.Alias(t.Element(3).(etf.Ref))
-				dc.router.RouteSendAlias(t.Element(2).(etf.Pid), alias, message)
+				message, ok := dc.onRecv(from, alias, message)
+				if ok == false {
+					return nil
+				}
+				if err := dc.router.RouteSendAlias(from, alias, message); err == node.ErrProcessMailboxFull {
+					dc.sendFlowControl(from, t.Element(3))
+				}
 				return nil
 
 			case distProtoSPAWN_REQUEST:
@@ -786,11 +1084,14 @@ func (dc *distConnection) handleMessage(control, message etf.Term) (err error) {
 					From:     from,
 					Ref:      ref,
 					Function: string(function),
+					Args:     args,
 				}
 				pid, err := dc.router.RouteSpawnRequest(string(module), spawnRequest)
 				if err != nil {
+					// the request is rejected (e.g. the node is in maintenance
+					// mode), but the connection keeps working
 					dc.SpawnReplyError(from, ref, err)
-					return err
+					return nil
 				}
 				dc.SpawnReply(from, ref, pid)
 				return nil
@@ -839,6 +1140,18 @@ func (dc *distConnection) decodeFragment(packet []byte, first bool) (*lib.Buffer
 		dc.fragments[sequenceID] = fragmented
 	}
 
+	size := len(packet) - 16
+	fragmented.size += size
+	dc.fragmentsSize += size
+	if max := dc.maxPacketSize(); max > 0 && fragmented.size > max {
+		lib.Log("[%s] FRAGMENT exceeded the message size limit with %s", dc.nodename, dc.peername)
+		return nil, node.ErrMessageTooLarge
+	}
+	if dc.options.MaxReassemblyBytes > 0 && dc.fragmentsSize > dc.options.MaxReassemblyBytes {
+		lib.Log("[%s] FRAGMENT exceeded the limit of reassembling data with %s", dc.nodename, dc.peername)
+		return nil, ErrReassemblyLimit
+	}
+
 	// until we get the first item everything will be treated as disordered
 	if first {
 		fragmented.fragmentID = fragmentID + 1
@@ -874,6 +1187,7 @@ func (dc *distConnection) decodeFragment(packet []byte, first bool) (*lib.Buffer
 	if fragmented.fragmentID == 1 && len(fragmented.disorderedSlices) == 0 {
 		// it was the last fragment
 		delete(dc.fragments, sequenceID)
+		dc.fragmentsSize -= fragmented.size
 		lib.ReleaseBuffer(fragmented.disordered)
 		return fragmented.buffer, nil
 	}
@@ -899,12 +1213,21 @@ func (dc *distConnection) decodeFragment(packet []byte, first bool) (*lib.Buffer
 		}
 
 		valid := time.Now().Add(-dc.checkCleanDeadline)
+		dropped := false
 		for sequenceID, fragmented := range dc.fragments {
 			if fragmented.lastUpdate.Before(valid) {
 				// dropping  due to exceeded deadline
 				delete(dc.fragments, sequenceID)
+				dc.fragmentsSize -= fragmented.size
+				lib.ReleaseBuffer(fragmented.buffer)
+				lib.ReleaseBuffer(fragmented.disordered)
+				dropped = true
 			}
 		}
+		if dropped && dc.options.ReassemblyTimeoutReset {
+			lib.Log("[%s] FRAGMENT incomplete messages from %s were dropped. Close connection", dc.nodename, dc.peername)
+			dc.cancelContext()
+		}
 		if len(dc.fragments) == 0 {
 			dc.checkCleanPending = false
 			return
@@ -1077,20 +1400,32 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 	// goroutines around this connection
 	defer dc.cancelContext()
 
-	cacheEnabled := flags.DisableHeaderAtomCache && dc.cacheOut != nil
+	cacheEnabled := !flags.DisableHeaderAtomCache && dc.cacheOut != nil
 	fragmentationEnabled := flags.EnableFragmentation && fragmentationUnit > 0
 
+	// the compressor is created on the first compressed message and
+	// reused for the next ones (keeping the preset dictionary)
+	var compressor *zlib.Writer
+
 	// Header atom cache is encoded right after the control/message encoding process
 	// but should be stored as a first item in the packet.
 	// Thats why we do reserve some space for it in order to get rid
 	// of reallocation packetBuffer data
-	reserveHeaderAtomCache := 8192
+	reserveHeaderAtomCache := maxDistHeaderSize
 
 	if cacheEnabled {
 		encodingAtomCache = etf.TakeListAtomCache()
 		defer etf.ReleaseListAtomCache(encodingAtomCache)
 		writerAtomCache = make(map[etf.Atom]etf.CacheItem)
 		linkAtomCache = dc.cacheOut
+
+		// take the preloaded atoms (see ProtoOptions.AtomCachePreload)
+		linkAtomCache.Lock()
+		for _, a := range linkAtomCache.ListSince(0) {
+			lastCacheID++
+			writerAtomCache[a] = etf.CacheItem{ID: lastCacheID, Name: a, Encoded: false}
+		}
+		linkAtomCache.Unlock()
 	}
 
 	encodeOptions := etf.EncodeOptions{
@@ -1099,6 +1434,8 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 		EncodingAtomCache: encodingAtomCache,
 		FlagBigCreation:   flags.EnableBigCreation,
 		FlagBigPidRef:     flags.EnableBigPidRef,
+		StringAsBinary:    flags.EnableStringAsBinary,
+		TimeEncoding:      dc.options.TimeEncoding,
 	}
 
 	for {
@@ -1109,6 +1446,12 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 			return
 		}
 
+		if message.barrier != nil {
+			// all the messages enqueued before have been written to the link
+			message.barrier <- dc.flusher.Flush()
+			continue
+		}
+
 		packetBuffer = lib.TakeBuffer()
 		lenControl, lenMessage, lenAtomCache, lenPacket, startDataPosition = 0, 0, 0, 0, reserveHeaderAtomCache
 
@@ -1139,6 +1482,10 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 			}
 
 		}
+		// pre-encoded message has no references to the atom cache
+		if message.payloadRaw != nil {
+			packetBuffer.Append(message.payloadRaw)
+		}
 		lenMessage = packetBuffer.Len() - reserveHeaderAtomCache - lenControl
 
 		// encode Header Atom Cache if its enabled
@@ -1150,7 +1497,7 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 			if lenAtomCache > reserveHeaderAtomCache-22 {
 				// are you serious? ))) what da hell you just sent?
 				// FIXME i'm gonna fix it if someone report about this issue :)
-				fmt.Println("WARNING: exceed atom header cache size limit. please report about this issue")
+				lib.LogWithLevel(lib.LogLevelWarning, "[%s] PROTO exceed atom header cache size limit. please report about this issue", dc.nodename)
 				return
 			}
 
@@ -1164,6 +1511,35 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 			packetBuffer.B[startDataPosition] = byte(0)
 		}
 
+		// the peer rejects the compressed packet exceeding this limit
+		if message.compression && flags.EnableCompression && packetBuffer.Len()-startDataPosition < dc.maxUncompressedSize() {
+			// 1 (dist header: protoDistMessage) + lenAtomCache + lenControl + lenMessage
+			packetBuffer.B[startDataPosition-1] = protoDistMessage
+			data := packetBuffer.B[startDataPosition-1:]
+			compressed, err := dc.compress(&compressor, data)
+			if err != nil {
+				lib.Log("[%s] can't compress message to %s: %s", dc.nodename, dc.peername, err)
+				return
+			}
+
+			// send it compressed if it makes sense and doesn't need to be fragmented
+			lenPacket = compressed.Len() - 4
+			if lenPacket-6 < len(data) && (!fragmentationEnabled || lenPacket < fragmentationUnit) {
+				binary.BigEndian.PutUint32(compressed.B[0:4], uint32(lenPacket))
+				compressed.B[4] = protoDist           // 131
+				compressed.B[5] = protoDistCompressed // 80
+				binary.BigEndian.PutUint32(compressed.B[6:10], uint32(len(data)))
+				_, err := dc.flusher.Write(compressed.B)
+				lib.ReleaseBuffer(compressed)
+				if err != nil {
+					return
+				}
+				lib.ReleaseBuffer(packetBuffer)
+				goto updateCache
+			}
+			lib.ReleaseBuffer(compressed)
+		}
+
 		for {
 
 			// 4 (packet len) + 1 (dist header: 131) + 1 (dist header: protoDistMessage) + lenAtomCache
@@ -1245,6 +1621,7 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 
 		lib.ReleaseBuffer(packetBuffer)
 
+	updateCache:
 		if cacheEnabled == false {
 			continue
 		}
@@ -1264,9 +1641,146 @@ func (dc *distConnection) sender(send <-chan *sendMessage, fragmentationUnit int
 
 }
 
-func (dc *distConnection) send(msg *sendMessage) error {
-	i := atomic.AddInt32(&dc.senders.i, 1)
-	n := i % dc.senders.n
+// compress returns the buffer with the compressed data. The first 10 bytes are
+// reserved for the packet header: 4 (packet len) + 1 (protoDist) + 1 (protoDistCompressed)
+// + 4 (uncompressed size)
+func (dc *distConnection) compress(compressor **zlib.Writer, data []byte) (*lib.Buffer, error) {
+	var err error
+
+	b := lib.TakeBuffer()
+	b.Allocate(10)
+	if *compressor == nil {
+		*compressor, err = zlib.NewWriterLevelDict(b, zlib.DefaultCompression, dc.options.CompressionDictionary)
+		if err != nil {
+			lib.ReleaseBuffer(b)
+			return nil, err
+		}
+	} else {
+		(*compressor).Reset(b)
+	}
+
+	if _, err := (*compressor).Write(data); err != nil {
+		lib.ReleaseBuffer(b)
+		return nil, err
+	}
+	if err := (*compressor).Close(); err != nil {
+		lib.ReleaseBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// onSend runs the middleware chain (see node.MessageMiddleware) for the outgoing message
+func (dc *distConnection) onSend(from etf.Pid, to etf.Term, message etf.Term) (etf.Term, error) {
+	for _, middleware := range dc.options.Middleware {
+		var err error
+		if message, err = middleware.OnSend(from, to, message); err != nil {
+			lib.Log("[%s] MIDDLEWARE dropped message from %s to %v [to %s]: %s", dc.nodename, from, to, dc.peername, err)
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// onRecv runs the middleware chain for the incoming message (except gen.MessageRaw).
+// Returns false if the message is dropped.
+func (dc *distConnection) onRecv(from etf.Pid, to etf.Term, message etf.Term) (etf.Term, bool) {
+	if _, ok := message.(gen.MessageRaw); ok {
+		// the payload of the raw message is never decoded, so the middleware
+		// (handling the terms) is bypassed
+		return message, true
+	}
+	for _, middleware := range dc.options.Middleware {
+		var err error
+		if message, err = middleware.OnRecv(from, to, message); err != nil {
+			lib.Log("[%s] MIDDLEWARE dropped message from %s to %v [from %s]: %s", dc.nodename, from, to, dc.peername, err)
+			return nil, false
+		}
+	}
+	return message, true
+}
+
+// sendFlowControl asks the remote sender to pause sending to the given target
+// (pid, name or alias) since its mailbox is full.
+func (dc *distConnection) sendFlowControl(to etf.Pid, target etf.Term) {
+	if dc.options.Flags.EnableFlowControl == false {
+		return
+	}
+	lib.Log("[%s] FLOW CONTROL pause %v for %s", dc.nodename, target, to)
+	msg := &sendMessage{
+		control: etf.Tuple{distProtoSEND, etf.Atom(""), to},
+		payload: etf.Tuple{flowControlSignal, target, int(flowControlPause / time.Millisecond)},
+	}
+	dc.send(target, to, msg)
+}
+
+// handleFlowControl returns true if the message is the flow control signal
+func (dc *distConnection) handleFlowControl(message etf.Term) bool {
+	if dc.options.Flags.EnableFlowControl == false {
+		return false
+	}
+	signal, ok := message.(etf.Tuple)
+	if !ok || len(signal) != 3 || signal.Element(1) != flowControlSignal {
+		return false
+	}
+
+	// the target is used as a map key, so the malformed one (e.g. a list)
+	// must not get there
+	var target etf.Term
+	switch t := signal.Element(2).(type) {
+	case etf.Pid, etf.Atom, etf.Ref:
+		target = t
+	default:
+		lib.Log("[%s] FLOW CONTROL malformed target %#v from %s", dc.nodename, t, dc.peername)
+		return true
+	}
+
+	var pause int64
+	switch p := signal.Element(3).(type) {
+	case int:
+		pause = int64(p)
+	case int64:
+		pause = p
+	}
+	if pause <= 0 {
+		lib.Log("[%s] FLOW CONTROL malformed pause %#v from %s", dc.nodename, signal.Element(3), dc.peername)
+		return true
+	}
+
+	lib.Log("[%s] FLOW CONTROL %v is paused for %dms", dc.nodename, target, pause)
+	dc.flowControlMutex.Lock()
+	dc.flowControl[target] = time.Now().Add(time.Duration(pause) * time.Millisecond)
+	dc.flowControlMutex.Unlock()
+	return true
+}
+
+// isPaused returns true if the peer has asked to pause sending to the given target
+func (dc *distConnection) isPaused(target etf.Term) bool {
+	if dc.options.Flags.EnableFlowControl == false {
+		return false
+	}
+	dc.flowControlMutex.Lock()
+	defer dc.flowControlMutex.Unlock()
+
+	deadline, ok := dc.flowControl[target]
+	if !ok {
+		return false
+	}
+	if time.Now().After(deadline) {
+		delete(dc.flowControl, target)
+		return false
+	}
+	return true
+}
+
+// send puts the message into the queue of one of the senders. Messages between the same
+// pair of processes always go through the same sender in order to keep them ordered.
+func (dc *distConnection) send(from etf.Term, to etf.Term, msg *sendMessage) error {
+	if err := dc.checkMessageSize(msg); err != nil {
+		return err
+	}
+
+	n := streamKey(from, to) % uint64(dc.senders.n)
 	s := dc.senders.sender[n]
 	if s == nil {
 		// connection was closed
@@ -1282,3 +1796,139 @@ func (dc *distConnection) send(msg *sendMessage) error {
 		return ErrOverloadConnection
 	}
 }
+
+// Barrier puts the barrier message into the queue of each sender and waits until
+// all of them are handled. Messages are distributed among the senders, so the
+// barrier must pass through all the queues.
+func (dc *distConnection) Barrier() error {
+	barrier := make(chan error, dc.senders.n)
+	for i := range dc.senders.sender {
+		s := dc.senders.sender[i]
+		if s == nil {
+			// connection was closed
+			return node.ErrNoRoute
+		}
+		s.Lock()
+		if s.sendChannel == nil {
+			s.Unlock()
+			return node.ErrNoRoute
+		}
+		select {
+		case s.sendChannel <- &sendMessage{barrier: barrier}:
+			s.Unlock()
+		case <-dc.ctx.Done():
+			s.Unlock()
+			return node.ErrNoRoute
+		}
+	}
+
+	for i := 0; i < int(dc.senders.n); i++ {
+		select {
+		case err := <-barrier:
+			if err != nil {
+				return err
+			}
+		case <-dc.ctx.Done():
+			return node.ErrNoRoute
+		}
+	}
+	return nil
+}
+
+// checkMessageSize encodes the message (control and payload) in order to check its
+// size against the MaxMessageSize limit. The receiving side measures the same part of
+// the packet (see decodeDist), the atom cache references can only make it shorter.
+// Encoded payload is sent as a pre-encoded one.
+func (dc *distConnection) checkMessageSize(msg *sendMessage) error {
+	if dc.options.MaxMessageSize == 0 {
+		return nil
+	}
+
+	encodeOptions := etf.EncodeOptions{
+		FlagBigCreation: dc.options.Flags.EnableBigCreation,
+		FlagBigPidRef:   dc.options.Flags.EnableBigPidRef,
+		StringAsBinary:  dc.options.Flags.EnableStringAsBinary,
+		TimeEncoding:    dc.options.TimeEncoding,
+	}
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	if err := etf.Encode(msg.control, b, encodeOptions); err != nil {
+		return err
+	}
+	lenControl := b.Len()
+
+	if msg.payload != nil {
+		if err := etf.Encode(msg.payload, b, encodeOptions); err != nil {
+			return err
+		}
+		if b.Len() > dc.options.MaxMessageSize {
+			return node.ErrMessageTooLarge
+		}
+		msg.payloadRaw = make([]byte, b.Len()-lenControl)
+		copy(msg.payloadRaw, b.B[lenControl:])
+		msg.payload = nil
+		return nil
+	}
+
+	if lenControl+len(msg.payloadRaw) > dc.options.MaxMessageSize {
+		return node.ErrMessageTooLarge
+	}
+	return nil
+}
+
+// maxPacketSize returns the limit for the incoming packets (0 - no limit)
+func (dc *distConnection) maxPacketSize() int {
+	if dc.options.MaxMessageSize == 0 {
+		return 0
+	}
+	return dc.options.MaxMessageSize + maxDistHeaderSize
+}
+
+// maxUncompressedSize returns the limit for the uncompressed size of the compressed packets
+func (dc *distConnection) maxUncompressedSize() int {
+	if max := dc.maxPacketSize(); max > 0 {
+		return max
+	}
+	return maxDecompressedSize
+}
+
+// streamKey returns FNV-1a hash of the sender/receiver pair
+func streamKey(from etf.Term, to etf.Term) uint64 {
+	const prime = 1099511628211
+	var h uint64 = 14695981039346656037
+
+	hashString := func(str etf.Atom) {
+		for i := 0; i < len(str); i++ {
+			h ^= uint64(str[i])
+			h *= prime
+		}
+	}
+	hashUint64 := func(v uint64) {
+		for i := 0; i < 8; i++ {
+			h ^= v & 0xff
+			h *= prime
+			v >>= 8
+		}
+	}
+	hashRef := func(ref etf.Ref) {
+		hashString(ref.Node)
+		for _, id := range ref.ID {
+			hashUint64(uint64(id))
+		}
+	}
+
+	for _, term := range []etf.Term{from, to} {
+		switch t := term.(type) {
+		case etf.Pid:
+			hashString(t.Node)
+			hashUint64(t.ID)
+		case etf.Atom:
+			hashString(t)
+		case etf.Ref:
+			hashRef(t)
+		case etf.Alias:
+			hashRef(etf.Ref(t))
+		}
+	}
+	return h
+}
@@ -2,15 +2,21 @@ package dist
 
 import (
 	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"net"
 	"reflect"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
 	"github.com/ergo-services/ergo/lib"
+	"github.com/ergo-services/ergo/node"
 )
 
 func TestLinkRead(t *testing.T) {
@@ -21,7 +27,7 @@ func TestLinkRead(t *testing.T) {
 		client.Close()
 	}()
 
-	link := Link{
+	link := distConnection{
 		conn: server,
 	}
 
@@ -41,7 +47,7 @@ func TestLinkRead(t *testing.T) {
 	c := make(chan bool)
 	b := lib.TakeBuffer()
 	go func() {
-		link.Read(b)
+		link.read(context.Background(), b)
 		close(c)
 	}()
 	select {
@@ -112,7 +118,7 @@ func TestValidateChallengeAck(t *testing.T) {
 }
 
 func TestDecodeDistHeaderAtomCache(t *testing.T) {
-	link := Link{}
+	link := distConnection{}
 	a1 := etf.Atom("atom1")
 	a2 := etf.Atom("atom2")
 	link.cacheIn[1034] = &a1
@@ -190,7 +196,7 @@ func TestEncodeDistHeaderAtomCache(t *testing.T) {
 
 	}
 
-	l := &Link{}
+	l := &distConnection{}
 	l.encodeDistHeaderAtomCache(b, writerAtomCache, encodingAtomCache)
 
 	if !reflect.DeepEqual(b.B, expected) {
@@ -218,7 +224,7 @@ func TestEncodeDistHeaderAtomCache(t *testing.T) {
 }
 
 func BenchmarkDecodeDistHeaderAtomCache(b *testing.B) {
-	link := &Link{}
+	link := &distConnection{}
 	packet := []byte{
 		131, 68, // start dist header
 		5, 4, 137, 9, // 5 atoms and theirs flags
@@ -241,7 +247,7 @@ func BenchmarkDecodeDistHeaderAtomCache(b *testing.B) {
 }
 
 func BenchmarkEncodeDistHeaderAtomCache(b *testing.B) {
-	link := &Link{}
+	link := &distConnection{}
 	buf := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(buf)
 
@@ -267,8 +273,144 @@ func BenchmarkEncodeDistHeaderAtomCache(b *testing.B) {
 	}
 }
 
+// syncBuffer is written by the sender and the flusher timer (keepalive packets)
+type syncBuffer struct {
+	sync.Mutex
+	b bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.Lock()
+	defer sb.Unlock()
+	return sb.b.Write(p)
+}
+
+func (sb *syncBuffer) Bytes() []byte {
+	sb.Lock()
+	defer sb.Unlock()
+	return append([]byte{}, sb.b.Bytes()...)
+}
+
+// senderOutput runs the sender with the given messages and returns the packets
+// (keepalive ones are skipped) it has written to the link
+func senderOutput(t *testing.T, dc *distConnection, flags node.ProtoFlags, messages ...*sendMessage) [][]byte {
+	out := &syncBuffer{}
+	dc.ctx, dc.cancelContext = context.WithCancel(context.Background())
+	defer dc.cancelContext()
+	dc.flusher = newLinkFlusher(out, defaultLatency)
+
+	ch := make(chan *sendMessage, len(messages)+1)
+	go dc.sender(ch, 0, flags)
+	for _, m := range messages {
+		ch <- m
+	}
+	barrier := make(chan error, 1)
+	ch <- &sendMessage{barrier: barrier}
+	if err := <-barrier; err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	packets := [][]byte{}
+	b := out.Bytes()
+	for len(b) >= 4 {
+		l := binary.BigEndian.Uint32(b)
+		if l > 0 {
+			packets = append(packets, b[:4+l])
+		}
+		b = b[4+l:]
+	}
+	if len(packets) != len(messages) {
+		t.Fatalf("expected %d packets, got %d", len(messages), len(packets))
+	}
+	return packets
+}
+
+func TestSenderAtomCachePreload(t *testing.T) {
+	send := func(flags node.ProtoFlags) [][]byte {
+		dc := &distConnection{}
+		cacheOptions := etf.AtomCacheOptions{
+			Preload: []etf.Atom{"preloaded"},
+		}
+		dc.cacheOut = etf.NewAtomCacheWithOptions(context.Background(), cacheOptions)
+		packets := senderOutput(t, dc, flags,
+			&sendMessage{control: etf.Tuple{etf.Atom("preloaded")}},
+			&sendMessage{control: etf.Tuple{etf.Atom("preloaded")}},
+		)
+		for i := range packets {
+			packets[i] = packets[i][4:]
+		}
+		return packets
+	}
+
+	// tuple of one element with ATOM_CACHE_REF to the entry 0
+	ref := []byte{104, 1, 82, 0}
+
+	packets := send(node.ProtoFlags{})
+	// the first packet introduces the atom as a new entry of the header atom cache
+	if !bytes.Equal(packets[0][:3], []byte{131, 68, 1}) ||
+		!bytes.Contains(packets[0], []byte("preloaded")) ||
+		!bytes.HasSuffix(packets[0], ref) {
+		t.Fatal("preloaded atom isn't encoded as a new cache entry", packets[0])
+	}
+	// the next one refers to the cached atom only
+	if !bytes.Equal(packets[1][:3], []byte{131, 68, 1}) ||
+		bytes.Contains(packets[1], []byte("preloaded")) ||
+		!bytes.HasSuffix(packets[1], ref) {
+		t.Fatal("preloaded atom isn't encoded as a cache reference", packets[1])
+	}
+
+	// the atoms are encoded as is if the cache is disabled
+	packets = send(node.ProtoFlags{DisableHeaderAtomCache: true})
+	for _, packet := range packets {
+		if !bytes.Equal(packet[:3], []byte{131, 68, 0}) ||
+			!bytes.HasSuffix(packet, []byte("preloaded")) {
+			t.Fatal("atom cache must not be used", packet)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	limit := 1000
+	control := etf.Tuple{etf.Atom("control")}
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	etf.Encode(control, b, etf.EncodeOptions{})
+	// binary of n bytes is encoded with 5 bytes header
+	fits := limit - b.Len() - 5
+
+	message := func(n int) *sendMessage {
+		return &sendMessage{control: control, payload: make([]byte, n)}
+	}
+
+	dc := &distConnection{}
+	dc.options.MaxMessageSize = limit
+	dc.senders = senders{
+		sender: []*senderChannel{{sendChannel: make(chan *sendMessage, 2)}},
+		n:      1,
+	}
+
+	// sending side
+	if err := dc.send(etf.Pid{}, etf.Pid{}, message(fits)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.send(etf.Pid{}, etf.Pid{}, message(fits+1)); err != node.ErrMessageTooLarge {
+		t.Fatal("expected ErrMessageTooLarge, got", err)
+	}
+
+	// receiving side measures the same part of the packet (the dist header isn't counted)
+	packets := senderOutput(t, &distConnection{}, node.ProtoFlags{DisableHeaderAtomCache: true},
+		message(fits), message(fits+1))
+	if _, _, err := dc.decodePacket(packets[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dc.decodePacket(packets[1]); err != node.ErrMessageTooLarge {
+		t.Fatal("expected ErrMessageTooLarge, got", err)
+	}
+}
+
 func TestDecodeFragment(t *testing.T) {
-	link := &Link{}
+	link := &distConnection{}
 
 	link.checkCleanTimeout = 50 * time.Millisecond
 	link.checkCleanDeadline = 150 * time.Millisecond
@@ -399,3 +541,220 @@ func TestDecodeFragment(t *testing.T) {
 		}
 	}
 }
+
+func TestSendOrdering(t *testing.T) {
+	numHandlers := 8
+	dc := &distConnection{}
+	dc.senders = senders{
+		sender: make([]*senderChannel, numHandlers),
+		n:      int32(numHandlers),
+	}
+	for i := 0; i < numHandlers; i++ {
+		dc.senders.sender[i] = &senderChannel{
+			sendChannel: make(chan *sendMessage, 1000),
+		}
+	}
+
+	type pair struct {
+		from etf.Pid
+		to   etf.Term
+	}
+	pairs := []pair{}
+	for i := 0; i < 5; i++ {
+		from := etf.Pid{Node: "node@localhost", ID: uint64(1000 + i)}
+		pairs = append(pairs,
+			pair{from, etf.Pid{Node: "remote@localhost", ID: uint64(2000 + i)}},
+			pair{from, etf.Atom(fmt.Sprintf("name%d", i))},
+			pair{from, etf.Alias{Node: "remote@localhost", ID: [5]uint32{uint32(i), 1, 2}}},
+		)
+	}
+
+	// interleave sends of all the pairs
+	for seq := 0; seq < 50; seq++ {
+		for _, p := range pairs {
+			msg := &sendMessage{
+				control: etf.Tuple{distProtoSEND, p.from, p.to},
+				payload: seq,
+			}
+			if err := dc.send(p.from, p.to, msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stream := make(map[pair]int)
+	next := make(map[pair]int)
+	for i := 0; i < numHandlers; i++ {
+		ch := dc.senders.sender[i].sendChannel
+		for len(ch) > 0 {
+			msg := <-ch
+			control := msg.control.(etf.Tuple)
+			p := pair{control.Element(2).(etf.Pid), control.Element(3)}
+			if s, ok := stream[p]; ok && s != i {
+				t.Fatalf("messages of %v went through the different streams %d and %d", p, s, i)
+			}
+			stream[p] = i
+			if msg.payload.(int) != next[p] {
+				t.Fatalf("wrong order for %v: expected %d, got %d", p, next[p], msg.payload)
+			}
+			next[p]++
+		}
+	}
+
+	for _, p := range pairs {
+		if next[p] != 50 {
+			t.Fatalf("lost messages for %v: %d", p, next[p])
+		}
+	}
+}
+
+func TestInitSenders(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	proto := CreateProto("node@localhost", false, node.ProxyModeDisabled)
+
+	options := node.DefaultProtoOptions(procs+1, false)
+	conn, err := proto.Init(&bytes.Buffer{}, "peer@localhost", options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := conn.(*distConnection)
+	if len(dc.senders.sender) != procs+1 || dc.senders.n != int32(procs+1) {
+		t.Fatal("wrong number of senders", len(dc.senders.sender), dc.senders.n)
+	}
+	if runtime.GOMAXPROCS(0) != procs {
+		t.Fatal("GOMAXPROCS has been changed")
+	}
+
+	options.NumHandlers = 0
+	conn, err = proto.Init(&bytes.Buffer{}, "peer@localhost", options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc = conn.(*distConnection)
+	if len(dc.senders.sender) != procs {
+		t.Fatal("wrong number of senders", len(dc.senders.sender))
+	}
+}
+
+func TestFlowControlSignal(t *testing.T) {
+	dc := &distConnection{
+		flowControl: make(map[etf.Term]time.Time),
+	}
+	target := etf.Pid{Node: "node@localhost", ID: 1000}
+	signal := etf.Tuple{flowControlSignal, target, 100}
+
+	if dc.handleFlowControl(signal) {
+		t.Fatal("flow control is disabled, must be handled as a regular message")
+	}
+
+	dc.options.Flags.EnableFlowControl = true
+	if !dc.handleFlowControl(signal) || !dc.isPaused(target) {
+		t.Fatal("target must be paused")
+	}
+	if dc.handleFlowControl(etf.Tuple{"regular", target, 100}) {
+		t.Fatal("regular message is handled as a signal")
+	}
+
+	// malformed signals are dropped
+	malformed := []etf.Term{
+		etf.Tuple{flowControlSignal, etf.List{1, 2}, 100},
+		etf.Tuple{flowControlSignal, etf.Map{"a": 1}, 100},
+		etf.Tuple{flowControlSignal, etf.Atom("name"), "100"},
+		etf.Tuple{flowControlSignal, etf.Atom("name"), -1},
+	}
+	for _, m := range malformed {
+		if !dc.handleFlowControl(m) {
+			t.Fatalf("malformed signal %#v must be dropped", m)
+		}
+	}
+	if dc.isPaused(etf.Atom("name")) || len(dc.flowControl) != 1 {
+		t.Fatal("malformed signal has paused the target")
+	}
+}
+
+func TestCompressionDictionary(t *testing.T) {
+	dictionary := []byte("temperaturehumiditypressuresensorlocation")
+	dc := &distConnection{}
+	dc.options.CompressionDictionary = dictionary
+
+	control := etf.Tuple{distProtoSEND, etf.Atom(""), etf.Pid{Node: "node@localhost", ID: 1000}}
+	message := etf.Tuple{etf.Atom("sensor"), etf.Atom("location"), etf.Atom("temperature"), 21, etf.Atom("humidity"), 40}
+
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	// protoDistMessage + empty atom cache header
+	b.AppendByte(protoDistMessage)
+	b.AppendByte(0)
+	if err := etf.Encode(control, b, etf.EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := etf.Encode(message, b, etf.EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var compressor *zlib.Writer
+	compressed, err := dc.compress(&compressor, b.B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lib.ReleaseBuffer(compressed)
+
+	// packet header is reserved
+	packet := compressed.B[5:]
+	packet[0] = protoDistCompressed
+	binary.BigEndian.PutUint32(packet[1:5], uint32(b.Len()))
+
+	control1, message1, err := dc.decodeDist(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(control, control1) {
+		t.Fatalf("control mismatch: %#v", control1)
+	}
+	if !reflect.DeepEqual(message, message1) {
+		t.Fatalf("message mismatch: %#v", message1)
+	}
+
+	// the peer with another dictionary can't decompress it
+	dc1 := &distConnection{}
+	dc1.options.CompressionDictionary = []byte("anotherdictionary")
+	if _, _, err := dc1.decodeDist(packet); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	dc := &distConnection{}
+
+	data := make([]byte, 1024)
+	data[0] = protoDistMessage
+	var compressor *zlib.Writer
+	compressed, err := dc.compress(&compressor, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lib.ReleaseBuffer(compressed)
+	packet := compressed.B[5:]
+	packet[0] = protoDistCompressed
+
+	cases := []struct {
+		size           int
+		maxMessageSize int
+		err            error
+	}{
+		// the default ceiling is applied if MaxMessageSize is not defined
+		{size: maxDecompressedSize + 1, err: node.ErrMessageTooLarge},
+		{size: maxDistHeaderSize + 2, maxMessageSize: 1, err: node.ErrMessageTooLarge},
+		// the declared size must match the uncompressed data
+		{size: len(data) - 1, err: ErrMalformed},
+		{size: len(data) + 1, err: ErrMalformed},
+		{size: 0, err: ErrMalformed},
+	}
+	for _, c := range cases {
+		dc.options.MaxMessageSize = c.maxMessageSize
+		binary.BigEndian.PutUint32(packet[1:5], uint32(c.size))
+		if _, _, err := dc.decodeDist(packet); err != c.err {
+			t.Fatalf("size %d (max %d): expected %v, got %v", c.size, c.maxMessageSize, c.err, err)
+		}
+	}
+}
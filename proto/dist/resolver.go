@@ -7,9 +7,10 @@ import (
 	"io"
 	"net"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/ergo-services/ergo/etf"
 	"github.com/ergo-services/ergo/lib"
 	"github.com/ergo-services/ergo/node"
 )
@@ -17,8 +18,18 @@ import (
 const (
 	DefaultEPMDPort uint16 = 4369
 
+	// DefaultResolverDialTimeout timeout for the connection to the EPMD server
+	DefaultResolverDialTimeout = 5 * time.Second
+	// DefaultResolverMaxFrameSize limits the size of the node name and the extra
+	// data in the EPMD response
+	DefaultResolverMaxFrameSize = 1024
+	// defaultResolverFallbackDelay how long to wait for the primary address family
+	// before trying the fallback one (RFC 6555 Happy Eyeballs)
+	defaultResolverFallbackDelay = 300 * time.Millisecond
+
 	epmdAliveReq      = 120
 	epmdAliveResp     = 121
+	epmdAliveXResp    = 118
 	epmdPortPleaseReq = 122
 	epmdPortResp      = 119
 	epmdNamesReq      = 110
@@ -43,55 +54,161 @@ type epmdResolver struct {
 	enableServer bool
 	host         string
 	port         uint16
+	dialTimeout  time.Duration
+	dialer       node.DialFunc
+	maxFrameSize int
 
-	nodePort         uint16
 	nodeName         string
 	nodeHost         string
 	handshakeVersion node.HandshakeVersion
 
-	extra []byte
+	nodePort   uint16
+	options    node.ResolverOptions
+	extra      []byte
+	mutexExtra sync.Mutex
+
+	// registrations keeps the functions making the registrations be renewed
+	// with the updated extra data
+	registrations      []func()
+	mutexRegistrations sync.Mutex
+}
+
+// ResolverOptions defines options for the EPMD resolver
+type ResolverOptions struct {
+	// EnableServer starts embedded EPMD server
+	EnableServer bool
+	// Host defines host of the EPMD server
+	Host string
+	// Port defines port of the EPMD server. Default is 4369
+	Port uint16
+	// DialTimeout defines timeout for the connection to the EPMD server including
+	// resolving its host name. Default is 5 seconds
+	DialTimeout time.Duration
+	// Dialer makes the connections to the EPMD server and the peers' EPMD servers.
+	// Default is net.Dialer (see node.Options.Dialer)
+	Dialer node.DialFunc
+	// MaxFrameSize limits the size of the node name and the extra data in the EPMD
+	// response. The larger ones are rejected before reading. Default is 1024
+	MaxFrameSize int
 }
 
 func CreateResolver(ctx context.Context, enableServer bool, host string, port uint16) node.Resolver {
+	options := ResolverOptions{
+		EnableServer: enableServer,
+		Host:         host,
+		Port:         port,
+	}
+	return CreateResolverWithOptions(ctx, options)
+}
+
+func CreateResolverWithOptions(ctx context.Context, options ResolverOptions) node.Resolver {
+	if options.Port == 0 {
+		options.Port = DefaultEPMDPort
+	}
+	if options.DialTimeout == 0 {
+		options.DialTimeout = DefaultResolverDialTimeout
+	}
+	if options.MaxFrameSize == 0 {
+		options.MaxFrameSize = DefaultResolverMaxFrameSize
+	}
 	resolver := &epmdResolver{
 		ctx:          ctx,
-		enableServer: enableServer,
-		host:         host,
-		port:         port,
+		enableServer: options.EnableServer,
+		host:         options.Host,
+		port:         options.Port,
+		dialTimeout:  options.DialTimeout,
+		dialer:       options.Dialer,
+		maxFrameSize: options.MaxFrameSize,
 	}
-	if enableServer {
-		startServerEPMD(ctx, host, port)
+	if options.EnableServer {
+		startServerEPMD(ctx, options.Host, options.Port)
 	}
 	return resolver
 }
 
+// Register registers the node on the EPMD server. EPMD keeps a single port per node
+// name, so the primary listener is registered and the additional ones are published
+// in the extra data (see node.Route.Listeners).
 func (e *epmdResolver) Register(name string, port uint16, options node.ResolverOptions) error {
-	n := strings.Split(name, "@")
-	if len(n) != 2 {
-		return fmt.Errorf("(EMPD) FQDN for node name is required (example: node@hostname)")
+	nn, err := etf.ParseNodeName(name)
+	if err != nil {
+		return err
 	}
 
-	e.nodeName = n[0]
-	e.nodeHost = n[1]
-	e.nodePort = port
+	e.nodeName = nn.Name
+	e.nodeHost = nn.Host
 	e.handshakeVersion = options.HandshakeVersion
 
+	e.mutexExtra.Lock()
+	e.nodePort = port
+	e.options = options
 	e.composeExtra(options)
+	e.mutexExtra.Unlock()
+
+	// validate the aliases before registering anything
+	aliases := []string{}
+	for _, alias := range options.Aliases {
+		an, err := etf.ParseNodeName(alias)
+		if err != nil {
+			return err
+		}
+		if an.Host != nn.Host {
+			return fmt.Errorf("alias %q must have the same host as the node %q", alias, name)
+		}
+		aliases = append(aliases, an.Name)
+	}
+
+	if err := e.register(name, nn.Name); err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		if err := e.register(name, alias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	conn, err := e.registerNode(options)
+// register registers the node at the EPMD server with the given name and keeps
+// this registration alive until the node is stopped
+func (e *epmdResolver) register(nodename string, name string) error {
+	conn, err := e.registerNode(nodename, name)
 	if err != nil {
 		return err
 	}
+
+	// The registration is alive as long as the connection to the EPMD server
+	// is established. This connection is owned by the reader goroutine (it is
+	// the only one that closes it). The watcher goroutine just interrupts
+	// reading on stopping the node.
+	var mutexConn sync.Mutex
+	done := make(chan struct{})
+
 	go func() {
+		defer close(done)
 		buf := make([]byte, 1024)
 		for {
-			_, err := conn.Read(buf)
+			n, err := conn.Read(buf)
 			if err == nil {
-				continue
+				// the reply to the renewed registration (see renewRegistrations)
+				if n < 2 || buf[1] == 0 {
+					continue
+				}
+				// EPMD server doesn't allow renewing the registration on the
+				// same connection. register the node again
+				err = fmt.Errorf("renewing rejected with code %d", buf[1])
+			}
+			conn.Close()
+			if e.ctx.Err() != nil {
+				// node is stopped
+				return
 			}
-			lib.Log("[%s] EPMD client: closing connection", name)
+			lib.Log("[%s] EPMD client: closing connection (%s): %s", nodename, name, err)
 
-			// reconnect to the EPMD server
+			// reconnect to the EPMD server. The first attempts are made shortly
+			// since the EPMD server might not have handled the closed
+			// connection yet (renewing the registration)
+			delay := 100 * time.Millisecond
 			for {
 				if e.ctx.Err() != nil {
 					// node is stopped
@@ -103,39 +220,103 @@ func (e *epmdResolver) Register(name string, port uint16, options node.ResolverO
 					startServerEPMD(e.ctx, e.host, e.port)
 				}
 
-				if c, err := e.registerNode(name, options); err != nil {
-					lib.Log("[%s] EPMD client: can't register node %q (%s). Retry in 3 seconds...", name, err)
-					time.Sleep(3 * time.Second)
-				} else {
-					conn = c
-					break
+				c, err := e.registerNode(nodename, name)
+				if err != nil {
+					lib.Log("[%s] EPMD client: can't register node %q (%s). Retry in %s...", nodename, name, err, delay)
+					select {
+					case <-e.ctx.Done():
+					case <-time.After(delay):
+					}
+					delay *= 2
+					if delay > 3*time.Second {
+						delay = 3 * time.Second
+					}
+					continue
 				}
+
+				mutexConn.Lock()
+				conn = c
+				mutexConn.Unlock()
+				// the node could be stopped while we were registering it
+				if e.ctx.Err() != nil {
+					conn.Close()
+					return
+				}
+				break
 			}
 		}
 	}()
 
 	go func() {
-		<-e.ctx.Done()
-		conn.Close()
+		select {
+		case <-e.ctx.Done():
+			mutexConn.Lock()
+			// interrupt reading. the reader closes the connection
+			conn.SetReadDeadline(time.Now())
+			mutexConn.Unlock()
+		case <-done:
+		}
 	}()
 
+	e.mutexRegistrations.Lock()
+	e.registrations = append(e.registrations, func() {
+		mutexConn.Lock()
+		defer mutexConn.Unlock()
+		// renew the registration keeping the connection, so the node stays registered.
+		// the reader gets the reply
+		if err := e.sendAliveReq(conn, name); err != nil {
+			// interrupt reading. the reader registers the node again
+			conn.SetReadDeadline(time.Now())
+		}
+	})
+	e.mutexRegistrations.Unlock()
+	return nil
+}
+
+// SetMaintenance updates the extra data and renews the registrations of the node
+// to advertise it. The route resolved by the peers has the Maintenance flag set.
+func (e *epmdResolver) SetMaintenance(enable bool) error {
+	e.mutexExtra.Lock()
+	e.options.Maintenance = enable
+	e.composeExtra(e.options)
+	e.mutexExtra.Unlock()
+
+	e.renewRegistrations()
+	return nil
+}
+
+// SetListenPort renews the registrations of the node with the given port
+func (e *epmdResolver) SetListenPort(port uint16) error {
+	e.mutexExtra.Lock()
+	e.nodePort = port
+	e.mutexExtra.Unlock()
+
+	e.renewRegistrations()
 	return nil
 }
 
+func (e *epmdResolver) renewRegistrations() {
+	e.mutexRegistrations.Lock()
+	defer e.mutexRegistrations.Unlock()
+	for _, renew := range e.registrations {
+		renew()
+	}
+}
+
 func (e *epmdResolver) Resolve(name string) (node.Route, error) {
 
-	n := strings.Split(name, "@")
-	if len(n) != 2 {
-		return node.Route{}, fmt.Errorf("incorrect FQDN node name (example: node@localhost)")
+	nn, err := etf.ParseNodeName(name)
+	if err != nil {
+		return node.Route{}, err
 	}
-	conn, err := net.Dial("tcp", net.JoinHostPort(n[1], fmt.Sprintf("%d", e.port)))
+	conn, err := e.dial(nn.Host, e.port)
 	if err != nil {
 		return node.Route{}, err
 	}
 
 	defer conn.Close()
 
-	if err := e.sendPortPleaseReq(conn, n[0]); err != nil {
+	if err := e.sendPortPleaseReq(conn, nn.Name); err != nil {
 		return node.Route{}, err
 	}
 
@@ -145,14 +326,14 @@ func (e *epmdResolver) Resolve(name string) (node.Route, error) {
 	}
 
 	route.NodeName = name
-	route.Name = n[0]
-	route.Host = n[1]
+	route.Name = nn.Name
+	route.Host = nn.Host
 	return route, nil
 
 }
 
 func (e *epmdResolver) composeExtra(options node.ResolverOptions) {
-	buf := make([]byte, 5)
+	buf := make([]byte, 7)
 
 	// 2 bytes: ergoExtraMagic
 	binary.BigEndian.PutUint16(buf[0:2], uint16(ergoExtraMagic))
@@ -166,12 +347,20 @@ func (e *epmdResolver) composeExtra(options node.ResolverOptions) {
 	if options.EnabledProxy {
 		buf[5] = 1
 	}
+	// 1 byte flag maintenance
+	if options.Maintenance {
+		buf[6] = 1
+	}
+	// additional listeners
+	if len(options.Listeners) > 1 {
+		buf = append(buf, composeListeners(options.Listeners[1:])...)
+	}
 	e.extra = buf
 	return
 }
 
 func (e *epmdResolver) readExtra(buf []byte, route *node.Route) {
-	if len(buf) < 5 {
+	if len(buf) < 6 {
 		return
 	}
 	magic := binary.BigEndian.Uint16(buf[0:2])
@@ -191,57 +380,86 @@ func (e *epmdResolver) readExtra(buf []byte, route *node.Route) {
 		route.EnabledProxy = true
 	}
 
+	// the nodes of the previous versions have no maintenance flag
+	if len(buf) > 6 && buf[6] == 1 {
+		route.Maintenance = true
+	}
+	if len(buf) > 7 {
+		route.Listeners = readListeners(buf[7:])
+	}
+
 	route.IsErgo = true
 
 	return
 }
 
-func (e *epmdResolver) registerNode(name string, options node.ResolverOptions) (net.Conn, error) {
-	dsn := net.JoinHostPort(options.ServerHost, strconv.Itoa(int(options.ServerPort)))
-	conn, err := net.Dial("tcp", dsn)
+func (e *epmdResolver) registerNode(nodename string, name string) (net.Conn, error) {
+	conn, err := e.dial(e.host, e.port)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := e.sendAliveReq(conn); err != nil {
+	if err := e.sendAliveReq(conn, name); err != nil {
 		conn.Close()
 		return nil, err
 	}
 
-	if err := e.readAliveResp(conn); err != nil {
+	if err := e.readAliveResp(conn, name); err != nil {
 		conn.Close()
 		return nil, err
 	}
 
-	lib.Log("[%s] EPMD client: node registered", name)
+	lib.Log("[%s] EPMD client: node registered as %q", nodename, name)
 	return conn, nil
 }
 
-func (e *epmdResolver) sendAliveReq(conn net.Conn) error {
-	buf := make([]byte, 2+14+len(e.nodeName)+len(e.extra))
+// dial makes a connection to the EPMD server. If the host has both IPv4 and IPv6
+// addresses they are raced (Happy Eyeballs) and the first established connection is used.
+func (e *epmdResolver) dial(host string, port uint16) (net.Conn, error) {
+	hostPort := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	if e.dialer != nil {
+		ctx, cancel := context.WithTimeout(e.ctx, e.dialTimeout)
+		defer cancel()
+		return e.dialer(ctx, "tcp", hostPort)
+	}
+
+	dialer := net.Dialer{
+		Timeout:       e.dialTimeout,
+		FallbackDelay: defaultResolverFallbackDelay,
+	}
+	return dialer.DialContext(e.ctx, "tcp", hostPort)
+}
+
+func (e *epmdResolver) sendAliveReq(conn net.Conn, name string) error {
+	e.mutexExtra.Lock()
+	extra := e.extra
+	port := e.nodePort
+	e.mutexExtra.Unlock()
+
+	buf := make([]byte, 2+14+len(name)+len(extra))
 	binary.BigEndian.PutUint16(buf[0:2], uint16(len(buf)-2))
 	buf[2] = byte(epmdAliveReq)
-	binary.BigEndian.PutUint16(buf[3:5], e.nodePort)
+	binary.BigEndian.PutUint16(buf[3:5], port)
 	// http://erlang.org/doc/reference_manual/distributed.html (section 13.5)
 	// 77 — regular public node, 72 — hidden
 	// We use a regular one
 	buf[5] = 77
 	// Protocol TCP
 	buf[6] = 0
-	// HighestVersion
-	binary.BigEndian.PutUint16(buf[7:9], uint16(DistHandshakeVersion6))
-	// LowestVersion
-	binary.BigEndian.PutUint16(buf[9:11], uint16(DistHandshakeVersion5))
+	// HighestVersion, LowestVersion
+	hi, lo := e.handshakeVersions()
+	binary.BigEndian.PutUint16(buf[7:9], uint16(hi))
+	binary.BigEndian.PutUint16(buf[9:11], uint16(lo))
 	// length Node name
-	l := len(e.nodeName)
-	binary.BigEndian.PutUint16(reply[11:13], uint16(l))
+	l := len(name)
+	binary.BigEndian.PutUint16(buf[11:13], uint16(l))
 	// Node name
 	offset := (13 + l)
-	copy(buf[13:offset], e.nodeName)
+	copy(buf[13:offset], name)
 	// Extra data
-	l = len(e.extra)
+	l = len(extra)
 	binary.BigEndian.PutUint16(buf[offset:offset+2], uint16(l))
-	copy(buf[offset+2:offset+2+l], e.extra)
+	copy(buf[offset+2:offset+2+l], extra)
 	// Send
 	if _, err := conn.Write(buf); err != nil {
 		return err
@@ -249,46 +467,139 @@ func (e *epmdResolver) sendAliveReq(conn net.Conn) error {
 	return nil
 }
 
-func (e *epmdResolver) readAliveResp(conn net.Conn) error {
-	buf := make([]byte, 16)
-	if _, err := conn.Read(buf); err != nil {
+// handshakeVersions returns the highest and lowest handshake versions
+// this node is able to accept
+func (e *epmdResolver) handshakeVersions() (node.HandshakeVersion, node.HandshakeVersion) {
+	switch e.handshakeVersion {
+	case DistHandshakeVersion5, DistHandshakeVersion6:
+		// DIST handshake supports both versions
+		return DistHandshakeVersion6, DistHandshakeVersion5
+	case 0:
+		// handshake hasn't defined its version. use the default one
+		return DefaultDistHandshakeVersion, DefaultDistHandshakeVersion
+	}
+	// custom handshake
+	return e.handshakeVersion, e.handshakeVersion
+}
+
+func (e *epmdResolver) readAliveResp(conn net.Conn, name string) error {
+	// ALIVE2_RESP: 'y' (121), Result (1 byte), Creation (2 bytes)
+	// ALIVE2_X_RESP: 'v' (118), Result (1 byte), Creation (4 bytes)
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
 		return err
 	}
-	if buf[0] != epmdAliveResp {
+	if buf[1] != 0 {
+		return fmt.Errorf("Can't register %q. Code: %d", name, buf[1])
+	}
+
+	switch buf[0] {
+	case epmdAliveResp:
+		buf = make([]byte, 2)
+	case epmdAliveXResp:
+		buf = make([]byte, 4)
+	default:
 		return fmt.Errorf("Malformed EMPD response")
 	}
-	if buf[1] != 0 {
-		return fmt.Errorf("Can't register. Code: %d", e.nodeName, buf[1])
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
 	}
 	return nil
 }
 
 func (e *epmdResolver) sendPortPleaseReq(conn net.Conn, name string) error {
-	replylen := uint16(2 + len(name) + 1)
-	reply = make([]byte, replylen)
-	binary.BigEndian.PutUint16(reply[0:2], uint16(len(reply)-2))
-	reply[2] = byte(epmdPortPleaseReq)
-	copy(reply[3:replylen], name)
-	_, err := conn.Write(reply)
+	buflen := uint16(2 + len(name) + 1)
+	buf := make([]byte, buflen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(len(buf)-2))
+	buf[2] = byte(epmdPortPleaseReq)
+	copy(buf[3:buflen], name)
+	_, err := conn.Write(buf)
 	return err
 }
 
 func (e *epmdResolver) readPortResp(c net.Conn) (node.Route, error) {
 	var route node.Route
 
-	buf = make([]byte, 1024)
-	_, err = c.Read(buf)
-	if err != nil && err != io.EOF {
-		return -1, fmt.Errorf("reading from link - %s", err)
+	// PORT2_RESP: 'w' (119), Result (1 byte). The rest is present if Result == 0
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return route, fmt.Errorf("reading from link - %s", err)
+	}
+	if buf[0] != epmdPortResp {
+		return route, fmt.Errorf("malformed reply - %#v", buf)
+	}
+	if buf[1] > 0 {
+		return route, fmt.Errorf("desired node not found")
+	}
+
+	// PortNo (2), NodeType (1), Protocol (1), HighestVersion (2),
+	// LowestVersion (2), Nlen (2)
+	buf = make([]byte, 10)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return route, fmt.Errorf("reading from link - %s", err)
+	}
+	route.Port = binary.BigEndian.Uint16(buf[0:2])
+
+	// NodeName (Nlen), Elen (2)
+	nlen := int(binary.BigEndian.Uint16(buf[8:10]))
+	if nlen > e.maxFrameSize {
+		return route, fmt.Errorf("malformed reply - name length %d exceeds the limit %d", nlen, e.maxFrameSize)
+	}
+	buf = make([]byte, nlen+2)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return route, fmt.Errorf("reading from link - %s", err)
+	}
+
+	// Extra (Elen)
+	elen := int(binary.BigEndian.Uint16(buf[nlen : nlen+2]))
+	if elen == 0 {
+		return route, nil
+	}
+	if elen > e.maxFrameSize {
+		return route, fmt.Errorf("malformed reply - extra length %d exceeds the limit %d", elen, e.maxFrameSize)
+	}
+	buf = make([]byte, elen)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return route, fmt.Errorf("reading from link - %s", err)
 	}
+	e.readExtra(buf, &route)
+	return route, nil
+}
 
-	if buf[0] == epmdPortResp && buf[1] == 0 {
-		p := binary.BigEndian.Uint16(buf[2:4])
-		// we don't use all the extra info for a while. FIXME (do we need it?)
-		return int(p), nil
-	} else if buf[1] > 0 {
-		return -1, fmt.Errorf("desired node not found")
-	} else {
-		return -1, fmt.Errorf("malformed reply - %#v", buf)
+// composeListeners encodes the additional listeners of the node:
+// 1 byte number of listeners, then 2 bytes port, 1 byte handshake version
+// and 1 byte flag enabled TLS for each of them
+func composeListeners(listeners []node.ResolverListener) []byte {
+	if len(listeners) > 255 {
+		listeners = listeners[:255]
+	}
+	buf := make([]byte, 1+4*len(listeners))
+	buf[0] = byte(len(listeners))
+	for i, l := range listeners {
+		b := buf[1+4*i:]
+		binary.BigEndian.PutUint16(b[0:2], l.Port)
+		b[2] = byte(l.HandshakeVersion)
+		if l.EnabledTLS {
+			b[3] = 1
+		}
+	}
+	return buf
+}
+
+// readListeners decodes the listeners encoded by composeListeners. The malformed
+// data is ignored.
+func readListeners(buf []byte) []node.ResolverListener {
+	if len(buf) < 1 || len(buf) < 1+4*int(buf[0]) {
+		return nil
+	}
+	listeners := []node.ResolverListener{}
+	for i := 0; i < int(buf[0]); i++ {
+		b := buf[1+4*i:]
+		listeners = append(listeners, node.ResolverListener{
+			Port:             binary.BigEndian.Uint16(b[0:2]),
+			HandshakeVersion: node.HandshakeVersion(b[2]),
+			EnabledTLS:       b[3] == 1,
+		})
 	}
+	return listeners
 }
@@ -0,0 +1,109 @@
+package dist
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestResolverExtra(t *testing.T) {
+	e := &epmdResolver{}
+	options := node.ResolverOptions{
+		EnabledTLS:  true,
+		Maintenance: true,
+		Listeners: []node.ResolverListener{
+			{Port: 15000, HandshakeVersion: DistHandshakeVersion5, EnabledTLS: true},
+			{Port: 15010, HandshakeVersion: DistHandshakeVersion5},
+			{Port: 15020, HandshakeVersion: DistHandshakeVersion6, EnabledTLS: true},
+		},
+	}
+	e.composeExtra(options)
+
+	route := node.Route{}
+	e.readExtra(e.extra, &route)
+	if !route.IsErgo || !route.EnabledTLS || !route.Maintenance {
+		t.Fatal("wrong route", route)
+	}
+	// the primary listener is registered on the EPMD server
+	if !reflect.DeepEqual(route.Listeners, options.Listeners[1:]) {
+		t.Fatal("wrong additional listeners", route.Listeners)
+	}
+
+	// the single listener
+	options.Listeners = options.Listeners[:1]
+	e.composeExtra(options)
+	route = node.Route{}
+	e.readExtra(e.extra, &route)
+	if route.Listeners != nil {
+		t.Fatal("unexpected additional listeners", route.Listeners)
+	}
+
+	// malformed data is ignored
+	if l := readListeners([]byte{2, 0x3a, 0x98, 5, 1}); l != nil {
+		t.Fatal("malformed listeners must be ignored", l)
+	}
+}
+
+func TestResolverRenew(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	// count the connections to the EPMD server
+	var dials int32
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	options := ResolverOptions{
+		EnableServer: true,
+		Host:         "localhost",
+		Port:         port,
+		Dialer:       dialer,
+	}
+	r := CreateResolverWithOptions(ctx, options)
+	if err := r.Register("renew@localhost", 15000, node.ResolverOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	route, err := r.Resolve("renew@localhost")
+	if err != nil || route.Port != 15000 || route.Maintenance {
+		t.Fatal("wrong route", route, err)
+	}
+
+	if err := r.(node.ResolverMaintenance).SetMaintenance(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.(node.ResolverListenPort).SetListenPort(15001); err != nil {
+		t.Fatal(err)
+	}
+	resolves := int32(1)
+	for i := 0; ; i++ {
+		route, err = r.Resolve("renew@localhost")
+		resolves++
+		if err == nil && route.Port == 15001 && route.Maintenance {
+			break
+		}
+		if i == 100 {
+			t.Fatal("registration hasn't been renewed", route, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the registration is renewed keeping the connection, so the node
+	// hasn't been unregistered for a while
+	if n := atomic.LoadInt32(&dials); n != resolves+1 {
+		t.Fatalf("expected %d connections, got %d", resolves+1, n)
+	}
+}
@@ -2,7 +2,9 @@ package tests
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -205,6 +207,24 @@ func TestApplicationBasics(t *testing.T) {
 	}
 	fmt.Println("OK")
 
+	// case 2.4: get application by pid
+	fmt.Printf("... getting application by pid: ")
+	if name, ok := mynode.ApplicationByPid(p.Self()); !ok || name != "testapp1" {
+		t.Fatal("incorrect application of the application process", name, ok)
+	}
+	if name, ok := mynode.ApplicationByPid(gs.Self()); !ok || name != "testapp1" {
+		t.Fatal("incorrect application of the child process", name, ok)
+	}
+	standalone, err := mynode.Spawn("", gen.ProcessOptions{}, &testAppGenServer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := mynode.ApplicationByPid(standalone.Self()); ok {
+		t.Fatal("process is not under any application, but got", name)
+	}
+	standalone.Kill()
+	fmt.Println("OK")
+
 	fmt.Printf("... stopping application: ")
 	if e := mynode.ApplicationStop("testapp1"); e != nil {
 		t.Fatal(e)
@@ -518,3 +538,212 @@ func TestApplicationStop(t *testing.T) {
 	mynode.Stop()
 
 }
+
+type testSyncApplication struct {
+	gen.Application
+}
+
+func (a *testSyncApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	name := args[0].(string)
+	return gen.ApplicationSpec{
+		Name: name,
+		Children: []gen.ApplicationChildSpec{
+			{
+				Child: &testSyncSupervisor{},
+				Name:  name + "Sup",
+				Args:  args,
+			},
+		},
+	}, nil
+}
+
+func (a *testSyncApplication) Start(p gen.Process, args ...etf.Term) {}
+
+type testSyncSupervisor struct {
+	gen.Supervisor
+}
+
+func (ts *testSyncSupervisor) Init(args ...etf.Term) (gen.SupervisorSpec, error) {
+	return gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			{
+				Name:  args[0].(string) + "GS",
+				Child: &testSyncGenServer{},
+				Args:  args[1:],
+			},
+		},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartTemporary,
+		},
+	}, nil
+}
+
+type testSyncGenServer struct {
+	gen.Server
+}
+
+func (gs *testSyncGenServer) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	time.Sleep(args[0].(time.Duration))
+	if failed := args[1].(bool); failed {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func TestApplicationStartSync(t *testing.T) {
+	fmt.Printf("\n=== Test Application start sync\n")
+	mynode, err := ergo.StartNode("nodeTestApplicationStartSync@localhost", "cookies", node.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mynode.Stop()
+
+	fmt.Printf("... waiting for the slow grandchild: ")
+	if _, err := mynode.ApplicationLoad(&testSyncApplication{}, "slowApp", 200*time.Millisecond, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mynode.ApplicationStartSync("slowApp", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if mynode.ProcessByName("slowAppGS") == nil {
+		t.Fatal("grandchild is not started")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping the application started after the timeout: ")
+	if _, err := mynode.ApplicationLoad(&testSyncApplication{}, "timeoutApp", 300*time.Millisecond, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mynode.ApplicationStartSync("timeoutApp", 100*time.Millisecond); err != node.ErrTimeout {
+		t.Fatal("expected ErrTimeout, got", err)
+	}
+	stopped := false
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		info, err := mynode.ApplicationInfo("timeoutApp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.PID == (etf.Pid{}) && mynode.ProcessByName("timeoutAppGS") == nil {
+			stopped = true
+			break
+		}
+	}
+	if !stopped {
+		t.Fatal("application is still running")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... reporting the failing grandchild: ")
+	if _, err := mynode.ApplicationLoad(&testSyncApplication{}, "failedApp", time.Duration(0), true); err != nil {
+		t.Fatal(err)
+	}
+	_, err = mynode.ApplicationStartSync("failedApp", time.Second)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	expected := `can't start application "failedApp": can't start child "failedAppSup": can't start child "failedAppGS": failed`
+	if err.Error() != expected {
+		t.Fatal("expected", expected, "got", err)
+	}
+	if mynode.ProcessByName("failedAppSup") != nil {
+		t.Fatal("supervisor is still running")
+	}
+	fmt.Println("OK")
+}
+
+type testStartApplication struct {
+	gen.Application
+	name    string
+	deps    []string
+	started chan testAppStarted
+}
+
+type testAppStarted struct {
+	name string
+	at   time.Time
+}
+
+func (a *testStartApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	return gen.ApplicationSpec{
+		Name:         a.name,
+		Applications: a.deps,
+	}, nil
+}
+
+func (a *testStartApplication) Start(p gen.Process, args ...etf.Term) {
+	a.started <- testAppStarted{name: a.name, at: time.Now()}
+}
+
+func TestApplicationStartOptions(t *testing.T) {
+	fmt.Printf("\n=== Test Application start options\n")
+	started := make(chan testAppStarted, 10)
+
+	fmt.Printf("... concurrent starts are staggered: ")
+	opts := node.Options{
+		Applications: []gen.ApplicationBehavior{
+			&testStartApplication{name: "app1", started: started},
+			&testStartApplication{name: "app2", started: started},
+			&testStartApplication{name: "app3", started: started},
+		},
+		ApplicationStartDelay:      100 * time.Millisecond,
+		ApplicationStartConcurrent: true,
+	}
+	mynode, err := ergo.StartNode("nodeTestApplicationStartOptions1@localhost", "cookies", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := []time.Time{}
+	for i := 0; i < 3; i++ {
+		times = append(times, (<-started).at)
+	}
+	mynode.Stop()
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d < 90*time.Millisecond {
+			t.Fatal("applications are started with the interval", d)
+		}
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... dependencies are started first: ")
+	opts = node.Options{
+		Applications: []gen.ApplicationBehavior{
+			&testStartApplication{name: "app3", deps: []string{"app2"}, started: started},
+			&testStartApplication{name: "app2", deps: []string{"app1"}, started: started},
+			&testStartApplication{name: "app1", started: started},
+		},
+		ApplicationStartConcurrent: true,
+	}
+	mynode, err = ergo.StartNode("nodeTestApplicationStartOptions2@localhost", "cookies", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"app1", "app2", "app3"} {
+		if app := <-started; app.name != expected {
+			t.Fatal("expected", expected, "got", app.name)
+		}
+	}
+	mynode.Stop()
+	fmt.Println("OK")
+
+	fmt.Printf("... dependency cycle is reported: ")
+	opts = node.Options{
+		Applications: []gen.ApplicationBehavior{
+			&testStartApplication{name: "app1", deps: []string{"app2"}, started: started},
+			&testStartApplication{name: "app2", deps: []string{"app3"}, started: started},
+			&testStartApplication{name: "app3", deps: []string{"app1"}, started: started},
+		},
+		ApplicationStartConcurrent: true,
+	}
+	_, err = ergo.StartNode("nodeTestApplicationStartOptions3@localhost", "cookies", opts)
+	if errors.Is(err, node.ErrAppDependencyCycle) == false {
+		t.Fatal("expected ErrAppDependencyCycle, got", err)
+	}
+	if expected := "app1 -> app2 -> app3 -> app1"; strings.Contains(err.Error(), expected) == false {
+		t.Fatal("expected", expected, "in", err)
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testEvent struct {
+	gen.Event
+}
+
+type testEventHandler struct {
+	name string
+	res  chan interface{}
+}
+
+func (h *testEventHandler) HandleEvent(process *gen.EventProcess, event etf.Term) gen.EventHandlerStatus {
+	h.res <- etf.Tuple{h.name, event}
+	if event == etf.Atom("remove") {
+		return gen.EventHandlerStatusRemove
+	}
+	return gen.EventHandlerStatusOK
+}
+
+func TestEvent(t *testing.T) {
+	fmt.Printf("\n=== Test Event\n")
+	fmt.Printf("Starting node: nodeEvent01@localhost: ")
+	node1, _ := ergo.StartNode("nodeEvent01@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	} else {
+		fmt.Println("OK")
+	}
+	defer node1.Stop()
+
+	fmt.Printf("... starting event manager: ")
+	event := &testEvent{}
+	process, err := node1.Spawn("event", gen.ProcessOptions{}, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	res := make(chan interface{}, 10)
+	h1 := &testEventHandler{name: "h1", res: res}
+	h2 := &testEventHandler{name: "h2", res: res}
+
+	fmt.Printf("... adding handlers h1, h2: ")
+	if err := event.AddHandler(process, "h1", h1); err != nil {
+		t.Fatal(err)
+	}
+	if err := event.AddHandler(process, "h2", h2); err != nil {
+		t.Fatal(err)
+	}
+	if err := event.AddHandler(process, "h1", h1); err != gen.ErrEventHandlerExist {
+		t.Fatal("expected", gen.ErrEventHandlerExist, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... sync notify is handled by h1: ")
+	if err := event.SyncNotify(process, etf.Atom("a")); err != nil {
+		t.Fatal(err)
+	}
+	// both handlers must be invoked before SyncNotify returns
+	if len(res) != 2 {
+		t.Fatal("expected 2 events, got", len(res))
+	}
+	waitForResultWithValue(t, res, etf.Tuple{"h1", etf.Atom("a")})
+	fmt.Printf("... sync notify is handled by h2: ")
+	waitForResultWithValue(t, res, etf.Tuple{"h2", etf.Atom("a")})
+
+	fmt.Printf("... async notify is handled by h1: ")
+	if err := event.Notify(process, etf.Atom("b")); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, res, etf.Tuple{"h1", etf.Atom("b")})
+	fmt.Printf("... async notify is handled by h2: ")
+	waitForResultWithValue(t, res, etf.Tuple{"h2", etf.Atom("b")})
+
+	fmt.Printf("... removing h1: ")
+	if err := event.RemoveHandler(process, "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := event.RemoveHandler(process, "h1"); err != gen.ErrEventHandlerUnknown {
+		t.Fatal("expected", gen.ErrEventHandlerUnknown, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... handler h2 removes itself: ")
+	if err := event.SyncNotify(process, etf.Atom("remove")); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, res, etf.Tuple{"h2", etf.Atom("remove")})
+	fmt.Printf("... no handlers left: ")
+	handlers, err := event.Handlers(process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handlers) != 0 {
+		t.Fatal("expected no handlers, got", handlers)
+	}
+	fmt.Println("OK")
+}
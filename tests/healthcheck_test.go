@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/health"
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestHealthCheck(t *testing.T) {
+	fmt.Printf("\n=== Test HealthCheck\n")
+	fmt.Printf("Starting nodes: nodeHealthCheck01@localhost, nodeHealthCheck02@localhost: ")
+	node1, err := ergo.StartNode("nodeHealthCheck01@localhost", "cookies", node.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Stop()
+	node2, err := ergo.StartNode("nodeHealthCheck02@localhost", "cookies", node.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node2.Stop()
+	fmt.Println("OK")
+
+	hc := &health.HealthCheck{}
+	process, err := node1.Spawn("health", gen.ProcessOptions{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("... local status: ")
+	status, err := hc.Status(process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Node != node1.Name() || status.Alive == false || len(status.Peers) != 0 {
+		t.Fatalf("wrong status %#v", status)
+	}
+	if status.Processes != len(node1.ProcessList()) || len(status.Applications) == 0 {
+		t.Fatalf("wrong status %#v", status)
+	}
+	if status.Metrics.Processes != status.Processes || status.Metrics.Network.Connections != 0 {
+		t.Fatalf("wrong metrics %#v", status.Metrics)
+	}
+	fmt.Println("OK")
+
+	gs := &testServer{res: make(chan interface{}, 2)}
+	p2, err := node2.Spawn("", gen.ProcessOptions{}, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs.res, nil)
+
+	fmt.Printf("... remote call 'health': ")
+	to := gen.ProcessID{Name: "health", Node: node1.Name()}
+	result, err := p2.Direct(makeCall{to: to, message: etf.Atom("health")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, ok := result.(etf.Map)
+	if !ok || remote[etf.Atom("Node")] != node1.Name() || remote[etf.Atom("Alive")] != true {
+		t.Fatalf("wrong status %#v", result)
+	}
+	metrics, ok := remote[etf.Atom("Metrics")].(etf.Map)
+	if !ok {
+		t.Fatalf("wrong status %#v", result)
+	}
+	if network, ok := metrics[etf.Atom("Network")].(etf.Map); !ok || network[etf.Atom("Connections")] != 1 {
+		t.Fatalf("wrong metrics %#v", metrics)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... remote send {health, Pid}: ")
+	if err := p2.Send(to, etf.Tuple{etf.Atom("health"), p2.Self()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case result := <-gs.res:
+		if remote, ok := result.(etf.Map); !ok || remote[etf.Atom("Node")] != node1.Name() {
+			t.Fatalf("wrong status %#v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... peers: ")
+	status, err = hc.Status(process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Peers) != 1 || status.Peers[0] != node2.Name() {
+		t.Fatalf("wrong peers %#v", status.Peers)
+	}
+	if status.Metrics.Network.Connections != 1 {
+		t.Fatalf("wrong metrics %#v", status.Metrics)
+	}
+	fmt.Println("OK")
+}
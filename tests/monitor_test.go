@@ -1,8 +1,10 @@
 package tests
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ergo-services/ergo"
 	"github.com/ergo-services/ergo/etf"
@@ -718,11 +720,11 @@ func TestLinkLocalRemote(t *testing.T) {
 
 	// race conditioned case.
 	// processing of the process termination (on the remote peer) can be done faster than
-	// the link termination there, so MessageExit with "kill" reason will be arrived
+	// the link termination there, so MessageExit with "killed" reason will be arrived
 	// earlier.
 	node2.Stop()
 	result1 := gen.MessageExit{Pid: node2gs2.Self(), Reason: "noconnection"}
-	result2 := gen.MessageExit{Pid: node2gs2.Self(), Reason: "kill"}
+	result2 := gen.MessageExit{Pid: node2gs2.Self(), Reason: "killed"}
 
 	waitForResultWithValueOrValue(t, gs1.v, result1, result2)
 
@@ -772,3 +774,201 @@ func checkLinkPid(p gen.Process, pid etf.Pid) error {
 	}
 	return fmt.Errorf("process %s has no link to %s", p.Self(), pid)
 }
+
+func TestSpawnLinkMonitor(t *testing.T) {
+	fmt.Printf("\n=== Test SpawnLink/SpawnMonitor\n")
+	fmt.Printf("Starting node: nodeM1SpawnLink@localhost: ")
+	node1, _ := ergo.StartNode("nodeM1SpawnLink@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	} else {
+		fmt.Println("OK")
+	}
+	defer node1.Stop()
+
+	gs1 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	gs2 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+
+	fmt.Printf("    wait for start of gs1 on %#v: ", node1.Name())
+	node1gs1, _ := node1.Spawn("gs1", gen.ProcessOptions{}, gs1, nil)
+	waitForResultWithValue(t, gs1.v, node1gs1.Self())
+
+	fmt.Printf("... SpawnMonitor: gs1 -> gs2. terminate: ")
+	node1gs2, ref, err := node1.SpawnMonitor(node1gs1.Self(), "gs2", gen.ProcessOptions{}, gs2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// skip the Init notification
+	<-gs2.v
+	node1gs2.Exit("normal")
+	result := gen.MessageDown{
+		Ref:    ref,
+		Pid:    node1gs2.Self(),
+		Reason: "normal",
+	}
+	waitForResultWithValue(t, gs1.v, result)
+
+	fmt.Printf("... SpawnLink: gs1 -> gs2. terminate: ")
+	node1gs1.SetTrapExit(true)
+	node1gs2, err = node1.SpawnLink(node1gs1.Self(), "gs2", gen.ProcessOptions{}, gs2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-gs2.v
+	node1gs2.Exit("normal")
+	waitForResultWithValue(t, gs1.v, gen.MessageExit{Pid: node1gs2.Self(), Reason: "normal"})
+	if err := checkCleanLinkPid(node1gs1, node1gs2.Self()); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("... SpawnLink: unknown parent: ")
+	if _, err := node1.SpawnLink(etf.Pid{Node: etf.Atom(node1.Name()), ID: 12345}, "", gen.ProcessOptions{}, gs2, nil); err != node.ErrProcessUnknown {
+		t.Fatal("expected", node.ErrProcessUnknown, "got", err)
+	}
+	fmt.Println("OK")
+}
+
+var errTestExit = fmt.Errorf("test exit error")
+
+type testExitErrorGS struct {
+	gen.Server
+}
+
+func (gs *testExitErrorGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	if err, ok := message.(error); ok {
+		return fmt.Errorf("wrapped: %w", err)
+	}
+	return gen.ServerStatusOK
+}
+
+func TestMonitorExitError(t *testing.T) {
+	fmt.Printf("\n=== Test Monitor/Link exit error\n")
+	fmt.Printf("Starting nodes: nodeM1ExitError@localhost, nodeM2ExitError@localhost: ")
+	node1, err := ergo.StartNode("nodeM1ExitError@localhost", "cookies", node.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Stop()
+	node2, err := ergo.StartNode("nodeM2ExitError@localhost", "cookies", node.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node2.Stop()
+	fmt.Println("OK")
+
+	gs1 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	gs3 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	fmt.Printf("    wait for start of gs1 on %#v: ", node1.Name())
+	node1gs1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1, nil)
+	waitForResultWithValue(t, gs1.v, node1gs1.Self())
+	node1gs2, _ := node1.Spawn("gs2", gen.ProcessOptions{}, &testExitErrorGS{})
+	fmt.Printf("    wait for start of gs3 on %#v: ", node2.Name())
+	node2gs3, _ := node2.Spawn("", gen.ProcessOptions{}, gs3, nil)
+	waitForResultWithValue(t, gs3.v, node2gs3.Self())
+
+	node1gs1.SetTrapExit(true)
+	node1gs1.Link(node1gs2.Self())
+	ref1 := node1gs1.MonitorProcess(node1gs2.Self())
+	ref3 := node2gs3.MonitorProcess(node1gs2.Self())
+	// remote monitor is established asynchronously
+	for i := 0; len(node1gs2.MonitoredBy()) < 2; i++ {
+		if i > 100 {
+			t.Fatal("remote monitor is not established")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fmt.Printf("... local monitor and link get the error: ")
+	node1gs1.Send(node1gs2.Self(), errTestExit)
+	reason := "wrapped: test exit error"
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-gs1.v:
+			switch m := v.(type) {
+			case gen.MessageDown:
+				if m.Ref != ref1 || m.Pid != node1gs2.Self() || m.Reason != reason {
+					t.Fatalf("wrong message %#v", m)
+				}
+				if !errors.Is(m.Err, errTestExit) {
+					t.Fatal("expected error chain, got", m.Err)
+				}
+			case gen.MessageExit:
+				if m.Pid != node1gs2.Self() || m.Reason != reason {
+					t.Fatalf("wrong message %#v", m)
+				}
+				if !errors.Is(m.Err, errTestExit) {
+					t.Fatal("expected error chain, got", m.Err)
+				}
+			default:
+				t.Fatalf("unexpected message %#v", v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... remote monitor gets the reason only: ")
+	result := gen.MessageDown{
+		Ref:    ref3,
+		Pid:    node1gs2.Self(),
+		Reason: reason,
+	}
+	waitForResultWithValue(t, gs3.v, result)
+}
+
+func TestLinkKill(t *testing.T) {
+	fmt.Printf("\n=== Test Link Kill\n")
+	fmt.Printf("Starting node: nodeL1Kill@localhost: ")
+	node1, err := ergo.StartNode("nodeL1Kill@localhost", "cookies", node.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+	router := node1.(node.CoreRouter)
+
+	gs1 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	gs2 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	fmt.Printf("    wait for start of gs1 on %#v: ", node1.Name())
+	node1gs1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1, nil)
+	waitForResultWithValue(t, gs1.v, node1gs1.Self())
+	fmt.Printf("    wait for start of gs2 on %#v: ", node1.Name())
+	node1gs2, _ := node1.Spawn("", gen.ProcessOptions{}, gs2, nil)
+	waitForResultWithValue(t, gs2.v, node1gs2.Self())
+
+	node1gs1.SetTrapExit(true)
+	node1gs2.SetTrapExit(true)
+	node1gs1.Link(node1gs2.Self())
+
+	fmt.Printf("... exit signal 'kill' from the link can be trapped: ")
+	router.RouteExit(node1gs2.Self(), node1gs1.Self(), "kill")
+	waitForResultWithValue(t, gs2.v, gen.MessageExit{Pid: node1gs1.Self(), Reason: "kill"})
+	if !node1gs2.IsAlive() {
+		t.Fatal("gs2 must be alive")
+	}
+
+	fmt.Printf("... RouteKill terminates the trapping process, the link gets 'killed': ")
+	if err := router.RouteKill(node1gs2.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.v, gen.MessageExit{Pid: node1gs2.Self(), Reason: "killed"})
+	if node1gs2.IsAlive() {
+		t.Fatal("gs2 must be terminated")
+	}
+	if !node1gs1.IsAlive() {
+		t.Fatal("gs1 must be alive")
+	}
+}
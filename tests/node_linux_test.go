@@ -0,0 +1,101 @@
+//go:build linux
+// +build linux
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestNodeSocketOptions(t *testing.T) {
+	fmt.Printf("\n=== Test Node socket options\n")
+	dialed := make(chan net.Conn, 10)
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		d := net.Dialer{}
+		c, err := d.DialContext(ctx, network, address)
+		if err == nil {
+			dialed <- c
+		}
+		return c, err
+	}
+	opts := node.Options{
+		Dialer:        dialer,
+		TCPNoDelay:    node.TCPNoDelayDisable,
+		TCPReadBuffer: 1 << 17,
+	}
+	node1, e := ergo.StartNode("nodeT1SocketOptions@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2SocketOptions@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	node3, e := ergo.StartNode("nodeT3SocketOptions@localhost", "secret", node.Options{Listen: 25081})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+
+	sockopt := func(c net.Conn, level, opt int) int {
+		raw, err := c.(*net.TCPConn).SyscallConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var value int
+		raw.Control(func(fd uintptr) {
+			value, err = syscall.GetsockoptInt(int(fd), level, opt)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	// drain the connections made to the EPMD server on starting
+	for len(dialed) > 0 {
+		<-dialed
+	}
+
+	fmt.Printf("    node options are applied to the dialed connection: ")
+	if err := node1.Connect(node2.Name()); err != nil {
+		t.Fatal(err)
+	}
+	var conn net.Conn
+	// the last one is the connection to the peer (the first one is made to EPMD)
+	for len(dialed) > 0 {
+		conn = <-dialed
+	}
+	if v := sockopt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 0 {
+		t.Fatal("TCP_NODELAY must be disabled")
+	}
+	if v := sockopt(conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF); v < 1<<17 {
+		t.Fatal("wrong read buffer size", v)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    route options override the node ones: ")
+	conn, err := net.Dial("tcp", "localhost:25081")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.ConnectConn(node3.Name(), conn, node.RouteOptions{TCPNoDelay: node.TCPNoDelayEnable}); err != nil {
+		t.Fatal(err)
+	}
+	if v := sockopt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v == 0 {
+		t.Fatal("TCP_NODELAY must be enabled")
+	}
+	if v := sockopt(conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF); v < 1<<17 {
+		t.Fatal("wrong read buffer size", v)
+	}
+	fmt.Println("OK")
+}
@@ -1,20 +1,31 @@
 package tests
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/md5"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"net"
 	"reflect"
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/ergo-services/ergo"
 	"github.com/ergo-services/ergo/etf"
 	"github.com/ergo-services/ergo/gen"
 	"github.com/ergo-services/ergo/node"
 	"github.com/ergo-services/ergo/node/dist"
+	"github.com/ergo-services/ergo/node/nodetest"
 )
 
 type benchCase struct {
@@ -65,6 +76,483 @@ func TestNode(t *testing.T) {
 	node1.Stop()
 }
 
+func TestNodeProcessInfoAll(t *testing.T) {
+	fmt.Printf("\n=== Test Node ProcessInfoAll\n")
+	node1, e := ergo.StartNode("nodeT1ProcessInfoAll@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	p1, e := node1.Spawn("p1", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p2, e := node1.Spawn("p2", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p1.Link(p2.Self())
+	p1.MonitorProcess(p2.Self())
+	p1.MonitorProcess(gen.ProcessID{Name: "p2", Node: node1.Name()})
+
+	fmt.Printf("    snapshot matches ProcessInfo: ")
+	all := node1.ProcessInfoAll()
+	if len(all) != len(node1.ProcessList()) {
+		t.Fatal("wrong number of processes", len(all))
+	}
+	found := 0
+	for _, info := range all {
+		if info.PID != p1.Self() && info.PID != p2.Self() {
+			continue
+		}
+		found++
+		expected, err := node1.ProcessInfo(info.PID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(info, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, info)
+		}
+	}
+	if found != 2 {
+		t.Fatal("processes not found")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeProcessReductions(t *testing.T) {
+	fmt.Printf("\n=== Test Node Process Reductions\n")
+	node1, e := ergo.StartNode("nodeT1ProcessReductions@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 10)}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-gs1.res
+
+	fmt.Printf("    handled messages and direct requests are counted: ")
+	for i := 0; i < 3; i++ {
+		p1.Send(p1.Self(), i)
+		<-gs1.res
+	}
+	if _, err := p1.Direct("unknown"); err != gen.ErrUnsupportedRequest {
+		t.Fatal("expected ErrUnsupportedRequest, got", err)
+	}
+	info, err := node1.ProcessInfo(p1.Self())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Reductions != 4 {
+		t.Fatal("wrong number of reductions", info.Reductions)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeProcessEnv(t *testing.T) {
+	fmt.Printf("\n=== Test Node Process Env\n")
+	node1, e := ergo.StartNode("nodeT1ProcessEnv@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	opts := gen.ProcessOptions{
+		Env: map[gen.EnvKey]interface{}{"verbose": false},
+	}
+	p1, e := node1.Spawn("", opts, &testServer{res: make(chan interface{}, 2)})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    read and modify the environment of the running process: ")
+	env, err := node1.ProcessEnv(p1.Self())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["verbose"] != false {
+		t.Fatal("wrong env", env)
+	}
+	if err := node1.SetProcessEnv(p1.Self(), "verbose", true); err != nil {
+		t.Fatal(err)
+	}
+	if p1.Env("verbose") != true {
+		t.Fatal("env is not updated")
+	}
+	if err := node1.SetProcessEnv(p1.Self(), "verbose", nil); err != nil {
+		t.Fatal(err)
+	}
+	if env, _ := node1.ProcessEnv(p1.Self()); env["verbose"] != nil {
+		t.Fatal("env is not removed", env)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    terminated process is unknown: ")
+	p1.Kill()
+	if err := p1.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ProcessEnv(p1.Self()); err != node.ErrProcessUnknown {
+		t.Fatal("expected ErrProcessUnknown, got", err)
+	}
+	if err := node1.SetProcessEnv(p1.Self(), "verbose", true); err != node.ErrProcessUnknown {
+		t.Fatal("expected ErrProcessUnknown, got", err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeRawMessages(t *testing.T) {
+	fmt.Printf("\n=== Test Node Raw Messages\n")
+	node1, e := ergo.StartNode("nodeT1RawMessages@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2RawMessages@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	p2, _ := node2.Spawn("relay", gen.ProcessOptions{RawMessages: true}, gs2)
+	<-gs1.res
+	<-gs2.res
+
+	message := etf.Tuple{etf.Atom("hello"), 1, "world"}
+
+	fmt.Printf("    remote message is delivered encoded: ")
+	if err := p1.Send(gen.ProcessID{Name: "relay", Node: node2.Name()}, message); err != nil {
+		t.Fatal(err)
+	}
+	var raw gen.MessageRaw
+	select {
+	case m := <-gs2.res:
+		r, ok := m.(gen.MessageRaw)
+		if !ok {
+			t.Fatalf("expected gen.MessageRaw, got %#v", m)
+		}
+		raw = r
+	case <-time.After(time.Second):
+		t.Fatal("result timeout")
+	}
+	if raw.From != p1.Self() {
+		t.Fatal("wrong sender", raw.From)
+	}
+	decoded, _, err := etf.Decode(raw.Data, []etf.Atom{}, etf.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(decoded, message) == false {
+		t.Fatalf("expected %#v, got %#v", message, decoded)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    forward the encoded message to the remote process: ")
+	if err := p2.SendRaw(p1.Self(), raw.Data); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, message)
+
+	fmt.Printf("    local raw message is delivered as is: ")
+	if err := p2.SendRaw(p2.Self(), raw.Data); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs2.res, gen.MessageRaw{From: p2.Self(), Data: raw.Data})
+}
+
+func TestNodeAllMonitorsLinks(t *testing.T) {
+	fmt.Printf("\n=== Test Node AllMonitors and AllLinks\n")
+	node1, e := ergo.StartNode("nodeT1AllMonitors@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	p1, _ := node1.Spawn("p1", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	p2, _ := node1.Spawn("p2", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	monitors := len(node1.AllMonitors())
+	links := len(node1.AllLinks())
+
+	fmt.Printf("    monitors by pid and by name: ")
+	ref1 := p1.MonitorProcess(p2.Self())
+	ref2 := p1.MonitorProcess(gen.ProcessID{Name: "p2", Node: node1.Name()})
+	all := node1.AllMonitors()
+	if len(all) != monitors+2 {
+		t.Fatal("wrong number of monitors", len(all))
+	}
+	expected := map[etf.Ref]gen.MonitorRecord{
+		ref1: {Ref: ref1, By: p1.Self(), Pid: p2.Self(), Node: node1.Name()},
+		ref2: {Ref: ref2, By: p1.Self(), ProcessID: gen.ProcessID{Name: "p2", Node: node1.Name()}, Node: node1.Name()},
+	}
+	for _, record := range all {
+		e, ok := expected[record.Ref]
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(e, record) {
+			t.Fatalf("expected %#v, got %#v", e, record)
+		}
+		delete(expected, record.Ref)
+	}
+	if len(expected) != 0 {
+		t.Fatal("monitors not found", expected)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    link is listed once: ")
+	p1.Link(p2.Self())
+	all1 := node1.AllLinks()
+	if len(all1) != links+1 {
+		t.Fatal("wrong number of links", all1)
+	}
+	found := false
+	for _, record := range all1 {
+		if record.IsRemote {
+			continue
+		}
+		if (record.A == p1.Self() && record.B == p2.Self()) || (record.A == p2.Self() && record.B == p1.Self()) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("link not found", all1)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    terminated process releases monitors and links: ")
+	p2.Kill()
+	if err := p2.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// p1 is terminated by the link as well
+	if err := p1.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(node1.AllMonitors()); n != monitors {
+		t.Fatal("monitors leaked", node1.AllMonitors())
+	}
+	if n := len(node1.AllLinks()); n != links {
+		t.Fatal("links leaked", node1.AllLinks())
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeGroups(t *testing.T) {
+	fmt.Printf("\n=== Test Node Groups\n")
+	node1, e := ergo.StartNode("nodeT1Groups@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	subscriber := &testServer{res: make(chan interface{}, 2)}
+	sub, _ := node1.Spawn("", gen.ProcessOptions{}, subscriber)
+	waitForResultWithValue(t, subscriber.res, nil)
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	p2, _ := node1.Spawn("", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+
+	fmt.Printf("    subscribe and join the group: ")
+	if err := node1.SubscribeGroup("g", sub.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.JoinGroup("g", p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, subscriber.res, gen.MessageGroupLeader{Group: "g", Leader: p1.Self()})
+	if err := node1.JoinGroup("g", p2.Self()); err != nil {
+		t.Fatal(err)
+	}
+	// leader is not changed
+	waitForTimeout(t, subscriber.res)
+	if err := node1.JoinGroup("g", p2.Self()); err != node.ErrTaken {
+		t.Fatal("expected ErrTaken, got", err)
+	}
+	if node1.GroupLeader("g") != p1.Self() {
+		t.Fatal("wrong leader")
+	}
+	if !reflect.DeepEqual(node1.GroupMembers("g"), []etf.Pid{p1.Self(), p2.Self()}) {
+		t.Fatal("wrong members", node1.GroupMembers("g"))
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    failover on terminating the leader: ")
+	p1.Exit("normal")
+	waitForResultWithValue(t, subscriber.res, gen.MessageGroupLeader{Group: "g", Leader: p2.Self(), Previous: p1.Self()})
+	if node1.GroupLeader("g") != p2.Self() {
+		t.Fatal("wrong leader")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    leave the group: ")
+	if err := node1.LeaveGroup("g", p2.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, subscriber.res, gen.MessageGroupLeader{Group: "g", Previous: p2.Self()})
+	if node1.GroupLeader("g") != (etf.Pid{}) {
+		t.Fatal("group must have no leader")
+	}
+	if err := node1.LeaveGroup("g", p2.Self()); err != node.ErrProcessUnknown {
+		t.Fatal("expected ErrProcessUnknown, got", err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeFlags(t *testing.T) {
+	fmt.Printf("\n=== Test Node Flags\n")
+	fmt.Printf("    default flags: ")
+	node1, e := ergo.StartNode("nodeT1Flags@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	flags := node1.Flags()
+	if flags.Compression || flags.Proxy || flags.TLS || flags.StaticRoutesOnly || flags.Cloud {
+		t.Fatalf("wrong default flags %#v", flags)
+	}
+	if flags.BigCreation == false || flags.HeaderAtomCache == false {
+		t.Fatalf("wrong default flags %#v", flags)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    enabled features: ")
+	opts := node.Options{
+		Compression:      true,
+		ProxyMode:        node.ProxyModeEnabled,
+		TLSMode:          node.TLSModeAuto,
+		StaticRoutesOnly: true,
+		FlowControl:      true,
+	}
+	node2, e := ergo.StartNode("nodeT2Flags@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	flags = node2.Flags()
+	if !flags.Compression || !flags.Proxy || !flags.TLS || flags.TLSStrict ||
+		!flags.StaticRoutesOnly || !flags.FlowControl {
+		t.Fatalf("wrong flags %#v", flags)
+	}
+	fmt.Println("OK")
+}
+
+type testSinkGS struct {
+	gen.Server
+}
+
+func (s *testSinkGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	return gen.ServerStatusOK
+}
+
+func TestNodeSendTerminated(t *testing.T) {
+	fmt.Printf("\n=== Test Node sending to the terminating process\n")
+	node1, e := ergo.StartNode("nodeT1SendTerminated@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	sender, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    concurrent sending and terminating: ")
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		p, e := node1.Spawn("", gen.ProcessOptions{MailboxSize: 10}, &testSinkGS{})
+		if e != nil {
+			t.Fatal(e)
+		}
+		wg := sync.WaitGroup{}
+		for s := 0; s < 4; s++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 100; n++ {
+					err := sender.Send(p.Self(), n)
+					switch err {
+					case nil, node.ErrProcessUnknown, node.ErrProcessTerminated, node.ErrProcessMailboxFull:
+					default:
+						t.Error("unexpected error", err)
+						return
+					}
+				}
+			}()
+		}
+		p.Exit("normal")
+		wg.Wait()
+	}
+
+	// all the terminated processes must release their goroutines
+	deadline := time.Now().Add(3 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine leak: %d before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeTerminatedRetention(t *testing.T) {
+	fmt.Printf("\n=== Test Node terminated processes retention\n")
+	opts := node.Options{
+		TerminatedRetention: 2,
+	}
+	node1, e := ergo.StartNode("nodeT1Terminated@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	fmt.Printf("    keep the last terminated processes: ")
+	pids := []etf.Pid{}
+	for i := 0; i < 3; i++ {
+		p, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+		if e != nil {
+			t.Fatal(e)
+		}
+		p.Exit(fmt.Sprintf("reason%d", i))
+		if err := p.WaitWithTimeout(time.Second); err != nil {
+			t.Fatal(err)
+		}
+		// the record is kept on cleaning up the process, which might be
+		// completed a bit later than the waiting
+		for n := 0; n < 100; n++ {
+			if _, ok := node1.TerminatedProcess(p.Self()); ok {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		pids = append(pids, p.Self())
+	}
+	if _, ok := node1.TerminatedProcess(pids[0]); ok {
+		t.Fatal("the oldest record must be dropped")
+	}
+	tombstone, ok := node1.TerminatedProcess(pids[2])
+	if !ok || tombstone.Reason != "reason2" || tombstone.PID != pids[2] {
+		t.Fatalf("wrong record %#v", tombstone)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    purge: ")
+	if n := node1.PurgeTerminated(); n != 2 {
+		t.Fatal("expected 2 purged records, got", n)
+	}
+	if _, ok := node1.TerminatedProcess(pids[2]); ok {
+		t.Fatal("record must be purged")
+	}
+	fmt.Println("OK")
+}
+
 type testFragmentationGS struct {
 	gen.Server
 }
@@ -239,37 +727,97 @@ func (h *handshakeGenServer) HandleDirect(process *gen.ServerProcess, message in
 	return nil, gen.ErrUnsupportedRequest
 }
 
-func TestNodeDistHandshake(t *testing.T) {
-	fmt.Printf("\n=== Test Node Handshake versions\n")
-
-	nodeOptions5 := node.Options{
-		HandshakeVersion: dist.ProtoHandshake5,
+func TestNodeStaticRouteConnect(t *testing.T) {
+	fmt.Printf("\n=== Test Node static route connecting on demand\n")
+	opts1 := node.Options{
+		Listen: 25077,
 	}
-	nodeOptions6 := node.Options{
-		HandshakeVersion: dist.ProtoHandshake6,
+	node1, e := ergo.StartNode("nodeT1StaticRouteConnect@localhost", "secret", opts1)
+	if e != nil {
+		t.Fatal(e)
 	}
-	nodeOptions5WithTLS := node.Options{
-		HandshakeVersion: dist.ProtoHandshake5,
-		TLSMode:          node.TLSModeAuto,
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2StaticRouteConnect@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
 	}
-	nodeOptions6WithTLS := node.Options{
-		HandshakeVersion: dist.ProtoHandshake6,
-		TLSMode:          node.TLSModeAuto,
+	defer node2.Stop()
+	node3, e := ergo.StartNode("nodeT3StaticRouteConnect@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
 	}
-	hgs := &handshakeGenServer{}
+	defer node3.Stop()
 
-	type Pair struct {
-		name  string
-		nodeA node.Node
-		nodeB node.Node
+	if _, e := node1.Spawn("sink", gen.ProcessOptions{}, &testSinkGS{}); e != nil {
+		t.Fatal(e)
 	}
-	node1, e1 := ergo.StartNode("node1Handshake5@localhost", "secret", nodeOptions5)
-	if e1 != nil {
-		t.Fatal(e1)
+	sink := gen.ProcessID{Name: "sink", Node: node1.Name()}
+
+	fmt.Printf("    connect to the statically routed node on sending (default): ")
+	if err := node2.AddStaticRoute(node1.Name(), 25077, node.RouteOptions{}); err != nil {
+		t.Fatal(err)
 	}
-	node2, e2 := ergo.StartNode("node2Handshake5@localhost", "secret", nodeOptions5)
-	if e2 != nil {
-		t.Fatal(e2)
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if err := p2.Send(sink, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    static route with ManualConnect requires Connect: ")
+	options := node.RouteOptions{ManualConnect: true}
+	if err := node3.AddStaticRoute(node1.Name(), 25077, options); err != nil {
+		t.Fatal(err)
+	}
+	p3, e := node3.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if err := p3.Send(sink, "hi"); err != node.ErrNoRoute {
+		t.Fatal("expected ErrNoRoute, got", err)
+	}
+	if err := node3.Connect(node1.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p3.Send(sink, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeDistHandshake(t *testing.T) {
+	fmt.Printf("\n=== Test Node Handshake versions\n")
+
+	nodeOptions5 := node.Options{
+		HandshakeVersion: dist.ProtoHandshake5,
+	}
+	nodeOptions6 := node.Options{
+		HandshakeVersion: dist.ProtoHandshake6,
+	}
+	nodeOptions5WithTLS := node.Options{
+		HandshakeVersion: dist.ProtoHandshake5,
+		TLSMode:          node.TLSModeAuto,
+	}
+	nodeOptions6WithTLS := node.Options{
+		HandshakeVersion: dist.ProtoHandshake6,
+		TLSMode:          node.TLSModeAuto,
+	}
+	hgs := &handshakeGenServer{}
+
+	type Pair struct {
+		name  string
+		nodeA node.Node
+		nodeB node.Node
+	}
+	node1, e1 := ergo.StartNode("node1Handshake5@localhost", "secret", nodeOptions5)
+	if e1 != nil {
+		t.Fatal(e1)
+	}
+	node2, e2 := ergo.StartNode("node2Handshake5@localhost", "secret", nodeOptions5)
+	if e2 != nil {
+		t.Fatal(e2)
 	}
 	node3, e3 := ergo.StartNode("node3Handshake5@localhost", "secret", nodeOptions5)
 	if e3 != nil {
@@ -364,175 +912,1684 @@ func TestNodeDistHandshake(t *testing.T) {
 	}
 }
 
-func TestNodeRemoteSpawn(t *testing.T) {
-	fmt.Printf("\n=== Test Node Remote Spawn\n")
-	node1, _ := ergo.StartNode("node1remoteSpawn@localhost", "secret", node.Options{})
-	node2, _ := ergo.StartNode("node2remoteSpawn@localhost", "secret", node.Options{})
+func TestNodeHandshakeStats(t *testing.T) {
+	fmt.Printf("\n=== Test Node Handshake stats\n")
+	node1, e1 := ergo.StartNode("node1HandshakeStats@localhost", "secret", node.Options{})
+	if e1 != nil {
+		t.Fatal(e1)
+	}
 	defer node1.Stop()
+	node2, e2 := ergo.StartNode("node2HandshakeStats@localhost", "secret", node.Options{})
+	if e2 != nil {
+		t.Fatal(e2)
+	}
 	defer node2.Stop()
-
-	node2.ProvideRemoteSpawn("remote", &handshakeGenServer{})
-	process, err := node1.Spawn("gs1", gen.ProcessOptions{}, &handshakeGenServer{})
-	if err != nil {
-		t.Fatal(err)
+	node3, e3 := ergo.StartNode("node3HandshakeStats@localhost", "wrong", node.Options{})
+	if e3 != nil {
+		t.Fatal(e3)
 	}
+	defer node3.Stop()
 
-	opts := gen.RemoteSpawnOptions{
-		RegisterName: "remote",
-	}
-	fmt.Printf("    process gs1@node1 requests spawn new process on node2 and register this process with name 'remote': ")
-	_, err = process.RemoteSpawn(node2.Name(), "remote", opts, 1, 2, 3)
-	if err != nil {
+	fmt.Printf("    successful handshake is counted: ")
+	if err := node1.Connect(node2.Name()); err != nil {
 		t.Fatal(err)
 	}
+	stats := node1.NetworkStats().Handshakes
+	if stats.Attempts != 1 || stats.Successes != 1 {
+		t.Fatal("wrong stats", stats)
+	}
 	fmt.Println("OK")
-	fmt.Printf("    process gs1@node1 requests spawn new process on node2 with the same name (must be failed): ")
 
-	_, err = process.RemoteSpawn(node2.Name(), "remote", opts, 1, 2, 3)
-	if err != node.ErrTaken {
-		t.Fatal(err)
+	fmt.Printf("    cookie mismatch is counted: ")
+	if err := node1.Connect(node3.Name()); errors.Is(err, node.ErrHandshakeCookie) == false {
+		t.Fatal("expected ErrHandshakeCookie, got", err)
+	}
+	stats = node1.NetworkStats().Handshakes
+	if stats.Attempts != 2 || stats.Successes != 1 || stats.FailuresCookie != 1 {
+		t.Fatal("wrong stats", stats)
+	}
+	// the digest is validated on the accepting side
+	stats = node3.NetworkStats().Handshakes
+	if stats.Attempts != 1 || stats.FailuresCookie != 1 {
+		t.Fatal("wrong stats", stats)
 	}
 	fmt.Println("OK")
 }
 
-type benchGS struct {
-	gen.Server
-}
-
-func (b *benchGS) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
-	return etf.Atom("ok"), gen.ServerStatusOK
-}
-func (b *benchGS) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
-	switch m := message.(type) {
-	case makeCall:
-		return process.Call(m.to, m.message)
+func TestNodeReconnectCookieMismatch(t *testing.T) {
+	fmt.Printf("\n=== Test Node reconnecting stops on cookie mismatch\n")
+	node1, e := ergo.StartNode("node1ReconnectCookie@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	// the registration at EPMD is kept until the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	node2, e := ergo.StartNodeWithContext(ctx, "node2ReconnectCookie@localhost", "secret", node.Options{Listen: 25078})
+	if e != nil {
+		t.Fatal(e)
+	}
+	node3, e := ergo.StartNodeWithContext(ctx, "node3ReconnectCookie@localhost", "secret", node.Options{Listen: 25079})
+	if e != nil {
+		t.Fatal(e)
 	}
-	return nil, gen.ErrUnsupportedRequest
-}
-
-func BenchmarkNodeSequential(b *testing.B) {
-
-	node1name := fmt.Sprintf("nodeB1_%d@localhost", b.N)
-	node2name := fmt.Sprintf("nodeB2_%d@localhost", b.N)
-	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: false})
-	node2, _ := ergo.StartNode(node2name, "bench", node.Options{})
-
-	bgs := &benchGS{}
 
-	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-	p2, e2 := node2.Spawn("", gen.ProcessOptions{}, bgs)
+	policy := node.ReconnectPolicy{
+		Enable:      true,
+		BackoffBase: 100 * time.Millisecond,
+		BackoffMax:  100 * time.Millisecond,
+	}
+	if err := node1.AddStaticRoute(node3.Name(), 25079, node.RouteOptions{Reconnect: policy}); err != nil {
+		t.Fatal(err)
+	}
+	policy.StopOnCookieMismatch = true
+	if err := node1.AddStaticRoute(node2.Name(), 25078, node.RouteOptions{Reconnect: policy}); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Connect(node2.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Connect(node3.Name()); err != nil {
+		t.Fatal(err)
+	}
 
-	if e1 != nil {
-		b.Fatal(e1)
+	// restart the peers with the other cookie
+	cancel()
+	node2.Stop()
+	node3.Stop()
+	// let EPMD drop the names
+	time.Sleep(300 * time.Millisecond)
+	node2, e = ergo.StartNode("node2ReconnectCookie@localhost", "wrong", node.Options{Listen: 25078})
+	if e != nil {
+		t.Fatal(e)
 	}
-	if e2 != nil {
-		b.Fatal(e2)
+	defer node2.Stop()
+	node3, e = ergo.StartNode("node3ReconnectCookie@localhost", "wrong", node.Options{Listen: 25079})
+	if e != nil {
+		t.Fatal(e)
 	}
+	defer node3.Stop()
 
-	call := makeCall{
-		to:      p2.Self(),
-		message: 1,
+	fmt.Printf("    stop reconnecting with StopOnCookieMismatch: ")
+	stopped := false
+	for i := 0; i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, reconnecting := node1.NetworkStats().Reconnecting[node2.Name()]; !reconnecting {
+			stopped = true
+			break
+		}
 	}
-	if _, e := p1.Direct(call); e != nil {
-		b.Fatal("single ping", e)
+	if stopped == false {
+		t.Fatal("still reconnecting")
 	}
+	if _, err := node1.Connection(node2.Name()); err == nil {
+		t.Fatal("must not be connected")
+	}
+	fmt.Println("OK")
 
-	b.ResetTimer()
-	for _, c := range benchCases() {
-		b.Run(c.name, func(b *testing.B) {
-			for i := 0; i < b.N; i++ {
-				call := makeCall{
-					to:      p2.Self(),
-					message: c.value,
-				}
-				_, e := p1.Direct(call)
-				if e != nil {
-					b.Fatal(e, i)
-				}
-			}
-		})
+	fmt.Printf("    keep reconnecting without StopOnCookieMismatch: ")
+	state, reconnecting := node1.NetworkStats().Reconnecting[node3.Name()]
+	if reconnecting == false {
+		t.Fatal("must be reconnecting")
 	}
+	if errors.Is(state.LastError, node.ErrHandshakeCookie) == false {
+		t.Fatal("expected ErrHandshakeCookie, got", state.LastError)
+	}
+	fmt.Println("OK")
 }
 
-func BenchmarkNodeSequentialSingleNode(b *testing.B) {
+func TestNodeSelfConnect(t *testing.T) {
+	fmt.Printf("\n=== Test Node Self Connect\n")
+	node1, e := ergo.StartNode("nodeT1SelfConnect@localhost", "secret", node.Options{Listen: 25072})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
 
-	node1name := fmt.Sprintf("nodeB1Local_%d@localhost", b.N)
-	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: true})
+	fmt.Printf("    connecting to itself by name: ")
+	if err := node1.Connect(node1.Name()); errors.Is(err, node.ErrSelfConnect) == false {
+		t.Fatal("expected ErrSelfConnect, got", err)
+	}
+	fmt.Println("OK")
 
-	bgs := &benchGS{}
+	fmt.Printf("    static route pointing to itself: ")
+	peer := "nodeT2SelfConnect@localhost"
+	if err := node1.AddStaticRoute(peer, 25072, node.RouteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Connect(peer); errors.Is(err, node.ErrSelfConnect) == false {
+		t.Fatal("expected ErrSelfConnect, got", err)
+	}
+	if len(node1.Nodes()) != 0 {
+		t.Fatal("must be no connections", node1.Nodes())
+	}
+	// both sides of the handshake are made by this node, the accepting one
+	// might be still counting
+	var stats node.HandshakeStats
+	for i := 0; i < 10; i++ {
+		stats = node1.NetworkStats().Handshakes
+		if stats.Attempts == 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if stats.Attempts != 2 || stats.Successes != 0 {
+		t.Fatal("wrong stats", stats)
+	}
+	fmt.Println("OK")
+}
 
-	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-	p2, e2 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+// testCA issues the client certificates for the nodes
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
 
-	if e1 != nil {
-		b.Fatal(e1)
+func newTestCA() (*testCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(crand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
 	}
-	if e2 != nil {
-		b.Fatal(e2)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
 	}
+	return &testCA{cert: cert, key: key}, nil
+}
 
-	call := makeCall{
-		to:      p2.Self(),
-		message: 1,
+func (ca *testCA) issue(name string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
 	}
-	if _, e := p1.Direct(call); e != nil {
-		b.Fatal("single ping", e)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	}
-
-	b.ResetTimer()
-	for _, c := range benchCases() {
-		b.Run(c.name, func(b *testing.B) {
-			for i := 0; i < b.N; i++ {
-				call := makeCall{
-					to:      p2.Self(),
-					message: c.value,
-				}
-				_, e := p1.Direct(call)
-				if e != nil {
-					b.Fatal(e, i)
-				}
-			}
-		})
+	der, err := x509.CreateCertificate(crand.Reader, &template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return tls.Certificate{}, err
 	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
 }
 
-func BenchmarkNodeParallel(b *testing.B) {
-
-	node1name := fmt.Sprintf("nodeB1Parallel_%d@localhost", b.N)
-	node2name := fmt.Sprintf("nodeB2Parallel_%d@localhost", b.N)
-	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: false})
-	node2, _ := ergo.StartNode(node2name, "bench", node.Options{})
+func TestNodeTLSVerifyPeer(t *testing.T) {
+	fmt.Printf("\n=== Test Node TLS Verify Peer\n")
+	ca, err := newTestCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
 
-	bgs := &benchGS{}
+	type verified struct {
+		peername string
+		cert     *x509.Certificate
+	}
+	checks := make(chan verified, 3)
+	verify := func(peername string, cert *x509.Certificate) error {
+		checks <- verified{peername, cert}
+		if peername != "nodeT2TLSVerifyPeer@localhost" {
+			return fmt.Errorf("unexpected node %s", peername)
+		}
+		return nil
+	}
 
-	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-	if e1 != nil {
-		b.Fatal(e1)
+	fmt.Printf("    TLSVerifyPeer requires TLSClientCAs: ")
+	opts1 := node.Options{
+		Listen:        25076,
+		TLSMode:       node.TLSModeAuto,
+		TLSVerifyPeer: verify,
 	}
-	p2, e2 := node2.Spawn("", gen.ProcessOptions{}, bgs)
-	if e2 != nil {
-		b.Fatal(e2)
+	if _, err := ergo.StartNode("nodeT1TLSVerifyPeer@localhost", "secret", opts1); err == nil {
+		t.Fatal("must be refused")
 	}
+	fmt.Println("OK")
 
-	call := makeCall{
-		to:      p2.Self(),
-		message: "hi",
+	opts1.TLSClientCAs = pool
+	node1, e := ergo.StartNode("nodeT1TLSVerifyPeer@localhost", "secret", opts1)
+	if e != nil {
+		t.Fatal(e)
 	}
-	if _, e := p1.Direct(call); e != nil {
-		b.Fatal("single ping", e)
+	defer node1.Stop()
+	opts := node.Options{
+		TLSMode: node.TLSModeAuto,
+	}
+	node2, e := ergo.StartNode("nodeT2TLSVerifyPeer@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	node3, e := ergo.StartNode("nodeT3TLSVerifyPeer@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+	node4, e := ergo.StartNode("nodeT4TLSVerifyPeer@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
 	}
+	defer node4.Stop()
 
-	b.SetParallelism(15)
-	b.RunParallel(func(pb *testing.PB) {
-		p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-		if e1 != nil {
-			b.Fatal(e1)
+	// node2 and node3 present the certificates issued by the CA
+	for _, n := range []node.Node{node2, node3} {
+		cert, err := ca.issue(n.Name())
+		if err != nil {
+			t.Fatal(err)
 		}
-		p2, e2 := node2.Spawn("", gen.ProcessOptions{}, bgs)
-		if e2 != nil {
-			b.Fatal(e2)
+		route := node.RouteOptions{
+			IsErgo:     true,
+			EnabledTLS: true,
+			TLSConfig: &tls.Config{
+				Certificates:       []tls.Certificate{cert},
+				InsecureSkipVerify: true,
+			},
 		}
-		b.ResetTimer()
+		if err := n.AddStaticRoute(node1.Name(), 25076, route); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fmt.Printf("    the peer is verified with its client certificate: ")
+	if err := node2.Connect(node1.Name()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-checks:
+		if v.peername != node2.Name() || v.cert == nil || v.cert.Subject.CommonName != node2.Name() {
+			t.Fatal("wrong peer", v.peername, v.cert)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer is not verified")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    rejected peer is disconnected: ")
+	node3.Connect(node1.Name())
+	select {
+	case v := <-checks:
+		if v.peername != node3.Name() {
+			t.Fatal("wrong peer", v.peername)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer is not verified")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    self-signed certificate is refused: ")
+	if err := node4.Connect(node1.Name()); err == nil {
+		t.Fatal("peer with the self-signed certificate is connected")
+	}
+	select {
+	case v := <-checks:
+		t.Fatal("peer with the self-signed certificate is verified", v.peername)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	var stats node.HandshakeStats
+	for i := 0; i < 10; i++ {
+		stats = node1.NetworkStats().Handshakes
+		if stats.FailuresTLS == 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stats.Successes != 1 || stats.FailuresTLS != 2 {
+		t.Fatal("wrong stats", stats)
+	}
+	if _, err := node1.Connection(node3.Name()); err == nil {
+		t.Fatal("rejected peer is connected")
+	}
+	if _, err := node1.Connection(node4.Name()); err == nil {
+		t.Fatal("peer with the self-signed certificate is connected")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeScheduleInterval(t *testing.T) {
+	fmt.Printf("\n=== Test Node ScheduleInterval\n")
+	node1, e := ergo.StartNode("nodeT1ScheduleInterval@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	ticks := make(chan interface{}, 10)
+	fn := func() {
+		select {
+		case ticks <- "tick":
+		default:
+		}
+	}
+
+	fmt.Printf("    scheduled function is invoked: ")
+	if err := node1.ScheduleInterval("housekeeping", 50*time.Millisecond, fn); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, ticks, "tick")
+
+	fmt.Printf("    duplicate name is not allowed: ")
+	if err := node1.ScheduleInterval("housekeeping", time.Second, fn); err != node.ErrTaken {
+		t.Fatal("expected", node.ErrTaken, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    canceled schedule is not invoked: ")
+	if node1.CancelSchedule("housekeeping") == false {
+		t.Fatal("must be canceled")
+	}
+	if node1.CancelSchedule("housekeeping") == true {
+		t.Fatal("already canceled")
+	}
+	// drain the ticks made before canceling
+	for len(ticks) > 0 {
+		<-ticks
+	}
+	waitForTimeout(t, ticks)
+	fmt.Println("OK")
+}
+
+func TestNodeTimerSource(t *testing.T) {
+	fmt.Printf("\n=== Test Node TimerSource\n")
+	clock := nodetest.NewFakeTimerSource()
+	node1, e := ergo.StartNode("nodeT1TimerSource@localhost", "secret", node.Options{TimerSource: clock})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 10)}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-gs1.res
+
+	fmt.Printf("    SendAfter fires on advancing the clock: ")
+	p1.SendAfter(p1.Self(), "process timer", time.Hour)
+	node1.SendAfter(p1.Self(), p1.Self(), "node timer", 2*time.Hour)
+	clock.Advance(time.Hour - time.Millisecond)
+	waitForTimeout(t, gs1.res)
+	clock.Advance(time.Millisecond)
+	waitForResultWithValue(t, gs1.res, "process timer")
+	fmt.Printf("    ... ")
+	clock.Advance(time.Hour)
+	waitForResultWithValue(t, gs1.res, "node timer")
+
+	fmt.Printf("    canceled timer doesn't fire: ")
+	cancel := p1.SendAfter(p1.Self(), "canceled", time.Hour)
+	cancel()
+	clock.Advance(time.Hour)
+	waitForTimeout(t, gs1.res)
+	fmt.Println("OK")
+
+	fmt.Printf("    ScheduleInterval ticks on advancing the clock: ")
+	ticks := make(chan interface{}, 10)
+	fn := func() {
+		ticks <- "tick"
+	}
+	if err := node1.ScheduleInterval("housekeeping", time.Minute, fn); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	waitForResultWithValue(t, ticks, "tick")
+	fmt.Printf("    ... ")
+	clock.Advance(time.Minute)
+	waitForResultWithValue(t, ticks, "tick")
+	node1.CancelSchedule("housekeeping")
+}
+
+func TestNodeDialer(t *testing.T) {
+	fmt.Printf("\n=== Test Node custom Dialer\n")
+	dialed := make(chan interface{}, 10)
+	epmd := make(chan string, 10)
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed <- network
+		if _, port, _ := net.SplitHostPort(address); port == "4369" {
+			epmd <- address
+		}
+		d := net.Dialer{}
+		return d.DialContext(ctx, network, address)
+	}
+
+	fmt.Printf("    default resolver registers the node with the custom dialer: ")
+	node1, e := ergo.StartNode("nodeT1Dialer@localhost", "secret", node.Options{Dialer: dialer})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	if len(epmd) == 0 {
+		t.Fatal("EPMD server is dialed without the custom dialer")
+	}
+	fmt.Println("OK")
+	node2, e := ergo.StartNode("nodeT2Dialer@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	// drain the connections made to the EPMD server on starting
+	for len(dialed) > 0 {
+		<-dialed
+	}
+
+	fmt.Printf("    connection is made with the custom dialer: ")
+	if err := node1.Connect(node2.Name()); err != nil {
+		t.Fatal(err)
+	}
+	// resolving the peer (EPMD) and connecting to the peer
+	waitForResultWithValue(t, dialed, "tcp")
+	fmt.Printf("    ... ")
+	waitForResultWithValue(t, dialed, "tcp")
+}
+
+func TestNodeDialTimeout(t *testing.T) {
+	fmt.Printf("\n=== Test Node dial timeout\n")
+	// blackholed peer
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	opts := node.Options{
+		Dialer:           dialer,
+		DialTimeout:      100 * time.Millisecond,
+		StaticRoutesOnly: true,
+	}
+	node1, e := ergo.StartNode("nodeT1DialTimeout@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	if err := node1.AddStaticRoute("nodeT2DialTimeout@localhost", 12345, node.RouteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    connecting to the unreachable peer fails on timeout: ")
+	started := time.Now()
+	if err := node1.Connect("nodeT2DialTimeout@localhost"); err == nil {
+		t.Fatal("must be failed")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatal("dial timeout exceeded", elapsed)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeBarrier(t *testing.T) {
+	fmt.Printf("\n=== Test Node Barrier\n")
+	node1, e := ergo.StartNode("nodeT1Barrier@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2Barrier@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	fmt.Printf("    barrier with no connection: ")
+	if err := node1.Barrier(node2.Name()); err != node.ErrNoRoute {
+		t.Fatal("expected ErrNoRoute, got", err)
+	}
+	fmt.Println("OK")
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 100)}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs1.res, nil)
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs2.res, nil)
+
+	fmt.Printf("    messages sent before the barrier are written: ")
+	for i := 0; i < 10; i++ {
+		if err := p1.Send(p2.Self(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := node1.Barrier(node2.Name()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		waitForResultWithValue(t, gs2.res, i)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeConnectConn(t *testing.T) {
+	fmt.Printf("\n=== Test Node ConnectConn\n")
+	node1, e := ergo.StartNode("nodeT1ConnectConn@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2ConnectConn@localhost", "secret", node.Options{Listen: 25071})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	fmt.Printf("    connect over the established connection: ")
+	conn, err := net.Dial("tcp", "localhost:25071")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.ConnectConn(node2.Name(), conn, node.RouteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := node1.Nodes(); len(nodes) != 1 || nodes[0] != node2.Name() {
+		t.Fatal("wrong connected nodes", nodes)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    send message over this connection: ")
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	waitForResultWithValue(t, gs1.res, nil)
+	p2, _ := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	waitForResultWithValue(t, gs2.res, nil)
+	if err := p1.Send(p2.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs2.res, "hi")
+	fmt.Println("OK")
+
+	fmt.Printf("    already connected: ")
+	conn, err = net.Dial("tcp", "localhost:25071")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.ConnectConn(node2.Name(), conn, node.RouteOptions{}); err != node.ErrTaken {
+		t.Fatal("expected ErrTaken, got", err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeAliases(t *testing.T) {
+	fmt.Printf("\n=== Test Node Aliases\n")
+	opts := node.Options{
+		Aliases: []string{"nodeT1AliasesOld@localhost"},
+	}
+	node1, e := ergo.StartNode("nodeT1Aliases@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2Aliases@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	fmt.Printf("    connect to the node by its alias: ")
+	if err := node2.Connect("nodeT1AliasesOld@localhost"); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    send message using the alias: ")
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	node1.Spawn("gs1", gen.ProcessOptions{}, gs1)
+	p2, _ := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	// skip the Init notifications
+	<-gs1.res
+	<-gs2.res
+	to := gen.ProcessID{Name: "gs1", Node: "nodeT1AliasesOld@localhost"}
+	if err := p2.Send(to, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "hi")
+
+	fmt.Printf("    alias with another host: ")
+	opts.Aliases = []string{"nodeT3AliasesOld@otherhost"}
+	if _, err := ergo.StartNode("nodeT3Aliases@localhost", "secret", opts); err == nil {
+		t.Fatal("must be failed")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeCluster(t *testing.T) {
+	fmt.Printf("\n=== Test Node Cluster\n")
+	node1, e := ergo.StartNode("nodeT1Cluster@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2Cluster@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	nodes := []string{"nodeT1Cluster@localhost", "nodeT2Cluster@localhost", "nodeT3Cluster@localhost"}
+	fmt.Printf("    quorum exceeds the number of nodes: ")
+	if err := node1.SetCluster(nodes, 4); err != node.ErrClusterQuorum {
+		t.Fatalf("expected %q, got %v", node.ErrClusterQuorum, err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    cluster isn't ready with this node only: ")
+	if err := node1.SetCluster(nodes, 2); err != nil {
+		t.Fatal(err)
+	}
+	if node1.ClusterReady() {
+		t.Fatal("cluster must not be ready")
+	}
+	fmt.Println("OK")
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-gs1.res
+	if err := node1.SubscribeCluster(p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    cluster is ready on connecting the quorum: ")
+	if err := node1.Connect("nodeT2Cluster@localhost"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, gen.MessageClusterReady{Ready: true, Connected: nodes[:2]})
+	if node1.ClusterReady() == false {
+		t.Fatal("cluster must be ready")
+	}
+
+	fmt.Printf("    cluster isn't ready on losing the quorum: ")
+	node2.Stop()
+	waitForResultWithValue(t, gs1.res, gen.MessageClusterReady{Ready: false, Connected: nodes[:1]})
+	if node1.ClusterReady() {
+		t.Fatal("cluster must not be ready")
+	}
+}
+
+func TestNodeTapProcess(t *testing.T) {
+	fmt.Printf("\n=== Test Node TapProcess\n")
+	node1, e := ergo.StartNode("nodeT1TapProcess@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	collector1 := &testServer{res: make(chan interface{}, 2)}
+	collector2 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	c1, _ := node1.Spawn("", gen.ProcessOptions{}, collector1)
+	c2, _ := node1.Spawn("", gen.ProcessOptions{}, collector2)
+	// skip the Init notifications
+	<-gs1.res
+	<-collector1.res
+	<-collector2.res
+
+	ref1, err := node1.TapProcess(p1.Self(), c1.Self())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref2, err := node1.TapProcess(p1.Self(), c2.Self())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    tapped process receives the message: ")
+	if err := c2.Send(p1.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "hi")
+	fmt.Printf("    every collector gets a copy: ")
+	tap := gen.MessageTap{Ref: ref1, Pid: p1.Self(), From: c2.Self(), Message: "hi"}
+	waitForResultWithValue(t, collector1.res, tap)
+	fmt.Printf("    ... ")
+	tap.Ref = ref2
+	waitForResultWithValue(t, collector2.res, tap)
+
+	fmt.Printf("    untapped collector gets nothing: ")
+	if node1.Untap(ref1) == false {
+		t.Fatal("unknown tap")
+	}
+	if node1.Untap(ref1) {
+		t.Fatal("tap must be removed")
+	}
+	if err := c2.Send(p1.Self(), "bye"); err != nil {
+		t.Fatal(err)
+	}
+	waitForTimeout(t, collector1.res)
+	tap.Message = "bye"
+	waitForResultWithValue(t, collector2.res, tap)
+
+	fmt.Printf("    tap is removed on termination of the tapped process: ")
+	deltas, cancel := node1.Observe()
+	defer cancel()
+	p1.Kill()
+	// the exit signal cancels the context before the process is unregistered
+	for delta := range deltas {
+		if delta.Type == gen.NodeDeltaProcessTerminated && delta.Pid == p1.Self() {
+			break
+		}
+	}
+	if node1.Untap(ref2) {
+		t.Fatal("tap must be removed")
+	}
+	if _, err := node1.TapProcess(p1.Self(), c1.Self()); err != node.ErrProcessUnknown {
+		t.Fatalf("expected %q, got %v", node.ErrProcessUnknown, err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeMetrics(t *testing.T) {
+	fmt.Printf("\n=== Test Node Metrics\n")
+	pushed := make(chan node.NodeMetrics, 10)
+	opts := node.Options{
+		MetricsSink: func(metrics node.NodeMetrics) {
+			select {
+			case pushed <- metrics:
+			default:
+			}
+		},
+		MetricsSinkName: "metricsSink",
+		MetricsInterval: 50 * time.Millisecond,
+		DropLogSample:   2,
+		DropLogRate:     1,
+	}
+	node1, e := ergo.StartNode("nodeT1Metrics@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 10)}
+	p1, e := node1.Spawn("metricsSink", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-gs1.res
+
+	fmt.Printf("    snapshot of the node metrics: ")
+	before := node1.Metrics()
+	if before.Processes == 0 || before.Names == 0 || before.Goroutines == 0 {
+		t.Fatal("wrong metrics", before)
+	}
+	for i := 0; i < 3; i++ {
+		p1.Send(p1.Self(), i)
+		<-gs1.res
+	}
+	if after := node1.Metrics(); after.MessagesRouted < before.MessagesRouted+3 {
+		t.Fatal("wrong number of routed messages", before.MessagesRouted, after.MessagesRouted)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    undelivered messages are counted: ")
+	unknown := p1.Self()
+	unknown.ID += 1000
+	for i := 0; i < 5; i++ {
+		if err := p1.Send(unknown, i); err != node.ErrProcessUnknown {
+			t.Fatal("expected ErrProcessUnknown, got", err)
+		}
+		p1.Send("unknownName", i)
+	}
+	if after := node1.Metrics(); after.MessagesUndelivered != before.MessagesUndelivered+10 {
+		t.Fatal("wrong number of undelivered messages", before.MessagesUndelivered, after.MessagesUndelivered)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    metrics are pushed to the sink function: ")
+	select {
+	case metrics := <-pushed:
+		if metrics.Processes == 0 {
+			t.Fatal("wrong metrics", metrics)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result timeout")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    metrics are pushed to the sink process: ")
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m := <-gs1.res:
+			// skip the messages sent above if the metrics have overtaken them
+			if _, ok := m.(node.NodeMetrics); ok == false {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("result timeout")
+		}
+		break
+	}
+	fmt.Println("OK")
+}
+
+// signingMiddleware wraps the outgoing messages into the tuple {"signed", Message}
+// and accepts the signed incoming messages only
+type signingMiddleware struct{}
+
+func (sm *signingMiddleware) OnSend(from etf.Pid, to etf.Term, message etf.Term) (etf.Term, error) {
+	if message == "secret" {
+		return nil, fmt.Errorf("secret message")
+	}
+	return etf.Tuple{"signed", message}, nil
+}
+
+func (sm *signingMiddleware) OnRecv(from etf.Pid, to etf.Term, message etf.Term) (etf.Term, error) {
+	signed, ok := message.(etf.Tuple)
+	if ok == false || len(signed) != 2 || signed[0] != "signed" {
+		return nil, fmt.Errorf("not signed")
+	}
+	return signed[1], nil
+}
+
+func TestNodeMiddleware(t *testing.T) {
+	fmt.Printf("\n=== Test Node Middleware\n")
+	opts := node.Options{
+		Middleware: []node.MessageMiddleware{&signingMiddleware{}},
+	}
+	node1, e := ergo.StartNode("nodeT1Middleware@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2Middleware@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	node3, e := ergo.StartNode("nodeT3Middleware@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	gs3 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	p2, _ := node2.Spawn("gs2", gen.ProcessOptions{}, gs2)
+	p3, _ := node3.Spawn("", gen.ProcessOptions{}, gs3)
+	<-gs1.res
+	<-gs2.res
+	<-gs3.res
+
+	fmt.Printf("    messages are transformed on sending and receiving: ")
+	if err := p1.Send(p2.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs2.res, "hi")
+	fmt.Printf("    ... by name: ")
+	if err := p1.Send(gen.ProcessID{Name: "gs2", Node: node2.Name()}, "hi by name"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs2.res, "hi by name")
+
+	fmt.Printf("    error on sending drops the message: ")
+	if err := p1.Send(p2.Self(), "secret"); err == nil {
+		t.Fatal("must be dropped")
+	}
+	waitForTimeout(t, gs2.res)
+	fmt.Println("OK")
+
+	fmt.Printf("    error on receiving drops the message: ")
+	if err := p3.Send(p2.Self(), "unsigned"); err != nil {
+		t.Fatal(err)
+	}
+	waitForTimeout(t, gs2.res)
+	fmt.Println("OK")
+
+	fmt.Printf("    peer without middleware gets the transformed message: ")
+	if err := p1.Send(p3.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs3.res, etf.Tuple{"signed", "hi"})
+
+	fmt.Printf("    raw message bypasses the middleware: ")
+	gsRaw := &testServer{res: make(chan interface{}, 2)}
+	pRaw, _ := node2.Spawn("", gen.ProcessOptions{RawMessages: true}, gsRaw)
+	<-gsRaw.res
+	if err := p3.Send(pRaw.Self(), "unsigned"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-gsRaw.res:
+		if _, ok := m.(gen.MessageRaw); !ok {
+			t.Fatalf("expected gen.MessageRaw, got %#v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result timeout")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeMaintenance(t *testing.T) {
+	fmt.Printf("\n=== Test Node Maintenance\n")
+	node1, e := ergo.StartNode("nodeT1Maintenance@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2Maintenance@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	node3, e := ergo.StartNode("nodeT3Maintenance@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+
+	if err := node2.Connect(node1.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	// waits until the connecting to node1 ends with the expected result, since
+	// the peers get the maintenance mode via resolver
+	connect := func(expected error) {
+		var err error
+		for i := 0; i < 100; i++ {
+			err = node3.Connect(node1.Name())
+			if err == expected {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+
+	fmt.Printf("    peers can't connect to the node in maintenance mode: ")
+	if err := node1.SetMaintenance(true); err != nil {
+		t.Fatal(err)
+	}
+	if node1.Maintenance() == false {
+		t.Fatal("must be in maintenance mode")
+	}
+	connect(node.ErrNodeMaintenance)
+	fmt.Println("OK")
+
+	fmt.Printf("    established connection keeps working: ")
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	p2, _ := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	<-gs1.res
+	<-gs2.res
+	if err := p2.Send(p1.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "hi")
+
+	fmt.Printf("    peers can connect once the maintenance is over: ")
+	if err := node1.SetMaintenance(false); err != nil {
+		t.Fatal(err)
+	}
+	connect(nil)
+	fmt.Println("OK")
+}
+
+func TestNodeRelisten(t *testing.T) {
+	fmt.Printf("\n=== Test Node Relisten\n")
+	opts := node.Options{
+		Listen:              25073,
+		RelistenGracePeriod: 100 * time.Millisecond,
+	}
+	node1, e := ergo.StartNode("nodeT1Relisten@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2Relisten@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	node3, e := ergo.StartNode("nodeT3Relisten@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+
+	if err := node2.Connect(node1.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    can't relisten on the taken port: ")
+	taken, err := net.Listen("tcp", "localhost:25074")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Relisten(25074); err == nil {
+		t.Fatal("must be failed")
+	}
+	taken.Close()
+	fmt.Println("OK")
+
+	fmt.Printf("    peers connect to the new port, the established connections are kept: ")
+	if err := node1.Relisten(25074); err != nil {
+		t.Fatal(err)
+	}
+	// the previous listener is closed after the grace period
+	time.Sleep(3 * time.Second)
+	if c, err := net.Dial("tcp", "localhost:25073"); err == nil {
+		c.Close()
+		t.Fatal("previous listener must be closed")
+	}
+	// the node is re-registered on the resolver asynchronously
+	for i := 0; ; i++ {
+		err := node3.Connect(node1.Name())
+		if err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := node1.Connection(node2.Name()); err != nil {
+		t.Fatal("connection is lost")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeAcceptConn(t *testing.T) {
+	fmt.Printf("\n=== Test Node AcceptConn\n")
+	node1, e := ergo.StartNode("nodeT1AcceptConn@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2AcceptConn@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	// custom listener
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan interface{}, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		peername, err := node2.AcceptConn(conn, node.RouteOptions{})
+		if err != nil {
+			accepted <- err
+			return
+		}
+		accepted <- peername
+	}()
+
+	fmt.Printf("    accept connection from the custom listener: ")
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.ConnectConn(node2.Name(), conn, node.RouteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, accepted, node1.Name())
+	fmt.Println("OK")
+
+	fmt.Printf("    send message over this connection: ")
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	waitForResultWithValue(t, gs1.res, nil)
+	p2, _ := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	waitForResultWithValue(t, gs2.res, nil)
+	if err := p2.Send(p1.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "hi")
+	fmt.Println("OK")
+}
+
+func TestNodeRemoteSpawn(t *testing.T) {
+	fmt.Printf("\n=== Test Node Remote Spawn\n")
+	node1, _ := ergo.StartNode("node1remoteSpawn@localhost", "secret", node.Options{})
+	node2, _ := ergo.StartNode("node2remoteSpawn@localhost", "secret", node.Options{})
+	defer node1.Stop()
+	defer node2.Stop()
+
+	node2.ProvideRemoteSpawn("remote", &handshakeGenServer{})
+	process, err := node1.Spawn("gs1", gen.ProcessOptions{}, &handshakeGenServer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := gen.RemoteSpawnOptions{
+		RegisterName: "remote",
+	}
+	fmt.Printf("    process gs1@node1 requests spawn new process on node2 and register this process with name 'remote': ")
+	_, err = process.RemoteSpawn(node2.Name(), "remote", opts, 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+	fmt.Printf("    process gs1@node1 requests spawn new process on node2 with the same name (must be failed): ")
+
+	_, err = process.RemoteSpawn(node2.Name(), "remote", opts, 1, 2, 3)
+	if err != node.ErrTaken {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeRemoteSpawnCancel(t *testing.T) {
+	fmt.Printf("\n=== Test Node Remote Spawn canceling\n")
+	node1, e := ergo.StartNode("nodeT1RemoteSpawnCancel@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2RemoteSpawnCancel@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	gs := &slowInitGS{
+		started: make(chan bool, 2),
+		release: make(chan bool, 2),
+	}
+	if err := node2.ProvideRemoteSpawn("slow", gs); err != nil {
+		t.Fatal(err)
+	}
+	process, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    canceled request returns immediately: ")
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		opts := gen.RemoteSpawnOptions{
+			RegisterName: "abandoned",
+		}
+		_, err := process.RemoteSpawnWithContext(ctx, node2.Name(), "slow", opts)
+		result <- err
+	}()
+	<-gs.started
+	cancel()
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Fatal("expected", context.Canceled, "got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result timeout")
+	}
+	if n := process.PendingReplies(); n != 0 {
+		t.Fatal("pending reply must be removed", n)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    process spawned by the canceled request is terminated: ")
+	gs.release <- true
+	for i := 0; ; i++ {
+		if node2.ProcessByName("abandoned") == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("abandoned process is still alive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    request with the context: ")
+	gs.release <- true
+	pid, err := process.RemoteSpawnWithContext(context.Background(), node2.Name(), "slow", gen.RemoteSpawnOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-gs.started
+	if node2.ProcessByPid(pid) == nil {
+		t.Fatal("process is not spawned")
+	}
+	fmt.Println("OK")
+}
+
+// slowInitGS blocks in Init until it's released
+type slowInitGS struct {
+	gen.Server
+	started chan bool
+	release chan bool
+	res     chan interface{}
+}
+
+func (s *slowInitGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	s.started <- true
+	<-s.release
+	return nil
+}
+
+func (s *slowInitGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	s.res <- message
+	return gen.ServerStatusOK
+}
+
+// blockingPersister blocks in Replay until it's released
+type blockingPersister struct {
+	replaying chan bool
+	release   chan bool
+}
+
+func (bp *blockingPersister) Append(message gen.ProcessMailboxMessage) error {
+	return nil
+}
+
+func (bp *blockingPersister) Replay() []gen.ProcessMailboxMessage {
+	bp.replaying <- true
+	<-bp.release
+	return nil
+}
+
+func (bp *blockingPersister) Ack(n int) {}
+
+// killedOnStart is terminated before its loop signals 'started'
+type killedOnStart struct {
+	done chan string
+}
+
+func (k *killedOnStart) ProcessInit(p gen.Process, args ...etf.Term) (gen.ProcessState, error) {
+	return gen.ProcessState{Process: p}, nil
+}
+
+func (k *killedOnStart) ProcessLoop(ps gen.ProcessState, started chan<- bool) string {
+	ps.Kill()
+	<-ps.Context().Done()
+	// let the spawn give up waiting
+	time.Sleep(100 * time.Millisecond)
+	started <- true
+	k.done <- "kill"
+	return "kill"
+}
+
+func TestNodeSpawnInitWindow(t *testing.T) {
+	fmt.Printf("\n=== Test Node Spawn Init Window\n")
+	node1, e := ergo.StartNode("nodeT1SpawnInitWindow@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	<-gs1.res
+
+	gs := &slowInitGS{
+		started: make(chan bool, 1),
+		release: make(chan bool, 1),
+		res:     make(chan interface{}, 10),
+	}
+	spawned := make(chan error, 1)
+	go func() {
+		_, err := node1.Spawn("slowinit", gen.ProcessOptions{}, gs)
+		spawned <- err
+	}()
+	<-gs.started
+
+	fmt.Printf("    messages sent during the initialization are accepted: ")
+	p := node1.ProcessByName("slowinit")
+	if p == nil {
+		t.Fatal("process is unknown during the initialization")
+	}
+	if err := p1.Send("slowinit", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p1.Send(p.Self(), 2); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    ... and handled in order once the loop is started: ")
+	gs.release <- true
+	if err := <-spawned; err != nil {
+		t.Fatal(err)
+	}
+	if err := p1.Send("slowinit", 3); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 4; i++ {
+		select {
+		case m := <-gs.res:
+			if m != i {
+				t.Fatalf("expected %d, got %#v", i, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    name is registered once the process can take the messages: ")
+	persister := &blockingPersister{
+		replaying: make(chan bool, 1),
+		release:   make(chan bool, 1),
+	}
+	go func() {
+		opts := gen.ProcessOptions{MailboxPersister: persister}
+		_, err := node1.Spawn("persisted", opts, &testServer{res: make(chan interface{}, 2)})
+		spawned <- err
+	}()
+	<-persister.replaying
+	if _, exist := node1.ExportRegistry().Names["persisted"]; exist {
+		t.Fatal("name is registered before the process")
+	}
+	persister.release <- true
+	if err := <-spawned; err != nil {
+		t.Fatal(err)
+	}
+	if err := p1.Send("persisted", 1); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    process terminated before its loop is started: ")
+	k := &killedOnStart{done: make(chan string, 1)}
+	if _, err := node1.Spawn("", gen.ProcessOptions{}, k); err != node.ErrProcessTerminated {
+		t.Fatal("expected ErrProcessTerminated, got", err)
+	}
+	select {
+	case <-k.done:
+	case <-time.After(time.Second):
+		t.Fatal("process loop is not completed")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeRemoteSpawnConcurrency(t *testing.T) {
+	fmt.Printf("\n=== Test Node Remote Spawn Concurrency\n")
+	opts := node.Options{
+		RemoteSpawnConcurrency: 1,
+	}
+	node1, e := ergo.StartNode("nodeT1RemoteSpawnConcurrency@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs := &slowInitGS{
+		started: make(chan bool, 2),
+		release: make(chan bool, 2),
+	}
+	if err := node1.ProvideRemoteSpawn("slow", gs); err != nil {
+		t.Fatal(err)
+	}
+	router := node1.(node.CoreRouter)
+	request := gen.RemoteSpawnRequest{
+		Function: "init",
+		Args:     []etf.Term{1, 2},
+	}
+
+	fmt.Printf("    unknown behavior is rejected: ")
+	if _, err := router.RouteSpawnRequest("unknown", request); err != node.ErrBehaviorUnknown {
+		t.Fatal("expected", node.ErrBehaviorUnknown, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    the request beyond the limit is rejected: ")
+	spawned := make(chan interface{}, 1)
+	go func() {
+		pid, err := router.RouteSpawnRequest("slow", request)
+		if err != nil {
+			spawned <- err
+			return
+		}
+		spawned <- pid
+	}()
+	<-gs.started
+	if stats := node1.NetworkStats(); stats.RemoteSpawnInFlight != 1 || stats.RemoteSpawnConcurrency != 1 {
+		t.Fatal("wrong stats", stats)
+	}
+	if _, err := router.RouteSpawnRequest("slow", request); err != node.ErrRemoteSpawnBusy {
+		t.Fatal("expected", node.ErrRemoteSpawnBusy, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    process is spawned with the request in its environment: ")
+	gs.release <- true
+	var pid etf.Pid
+	select {
+	case result := <-spawned:
+		var ok bool
+		if pid, ok = result.(etf.Pid); ok == false {
+			t.Fatal(result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result timeout")
+	}
+	p := node1.ProcessByPid(pid)
+	if p == nil {
+		t.Fatal("process is not spawned")
+	}
+	if r, ok := p.Env(gen.EnvKeyRemoteSpawn).(gen.RemoteSpawnRequest); ok == false || r.Function != "init" {
+		t.Fatal("wrong environment", p.Env(gen.EnvKeyRemoteSpawn))
+	}
+	if stats := node1.NetworkStats(); stats.RemoteSpawnInFlight != 0 {
+		t.Fatal("wrong stats", stats)
+	}
+	fmt.Println("OK")
+}
+
+type benchGS struct {
+	gen.Server
+}
+
+func (b *benchGS) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
+	return etf.Atom("ok"), gen.ServerStatusOK
+}
+func (b *benchGS) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	switch m := message.(type) {
+	case makeCall:
+		return process.Call(m.to, m.message)
+	}
+	return nil, gen.ErrUnsupportedRequest
+}
+
+func BenchmarkNodeSequential(b *testing.B) {
+
+	node1name := fmt.Sprintf("nodeB1_%d@localhost", b.N)
+	node2name := fmt.Sprintf("nodeB2_%d@localhost", b.N)
+	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: false})
+	node2, _ := ergo.StartNode(node2name, "bench", node.Options{})
+
+	bgs := &benchGS{}
+
+	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+	p2, e2 := node2.Spawn("", gen.ProcessOptions{}, bgs)
+
+	if e1 != nil {
+		b.Fatal(e1)
+	}
+	if e2 != nil {
+		b.Fatal(e2)
+	}
+
+	call := makeCall{
+		to:      p2.Self(),
+		message: 1,
+	}
+	if _, e := p1.Direct(call); e != nil {
+		b.Fatal("single ping", e)
+	}
+
+	b.ResetTimer()
+	for _, c := range benchCases() {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				call := makeCall{
+					to:      p2.Self(),
+					message: c.value,
+				}
+				_, e := p1.Direct(call)
+				if e != nil {
+					b.Fatal(e, i)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNodeSequentialSingleNode(b *testing.B) {
+
+	node1name := fmt.Sprintf("nodeB1Local_%d@localhost", b.N)
+	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: true})
+
+	bgs := &benchGS{}
+
+	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+	p2, e2 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+
+	if e1 != nil {
+		b.Fatal(e1)
+	}
+	if e2 != nil {
+		b.Fatal(e2)
+	}
+
+	call := makeCall{
+		to:      p2.Self(),
+		message: 1,
+	}
+	if _, e := p1.Direct(call); e != nil {
+		b.Fatal("single ping", e)
+	}
+
+	b.ResetTimer()
+	for _, c := range benchCases() {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				call := makeCall{
+					to:      p2.Self(),
+					message: c.value,
+				}
+				_, e := p1.Direct(call)
+				if e != nil {
+					b.Fatal(e, i)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNodeParallel(b *testing.B) {
+
+	node1name := fmt.Sprintf("nodeB1Parallel_%d@localhost", b.N)
+	node2name := fmt.Sprintf("nodeB2Parallel_%d@localhost", b.N)
+	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: false})
+	node2, _ := ergo.StartNode(node2name, "bench", node.Options{})
+
+	bgs := &benchGS{}
+
+	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+	if e1 != nil {
+		b.Fatal(e1)
+	}
+	p2, e2 := node2.Spawn("", gen.ProcessOptions{}, bgs)
+	if e2 != nil {
+		b.Fatal(e2)
+	}
+
+	call := makeCall{
+		to:      p2.Self(),
+		message: "hi",
+	}
+	if _, e := p1.Direct(call); e != nil {
+		b.Fatal("single ping", e)
+	}
+
+	b.SetParallelism(15)
+	b.RunParallel(func(pb *testing.PB) {
+		p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+		if e1 != nil {
+			b.Fatal(e1)
+		}
+		p2, e2 := node2.Spawn("", gen.ProcessOptions{}, bgs)
+		if e2 != nil {
+			b.Fatal(e2)
+		}
+		b.ResetTimer()
+		for pb.Next() {
+			call := makeCall{
+				to:      p2.Self(),
+				message: etf.Atom("ping"),
+			}
+			_, e := p1.Direct(call)
+			if e != nil {
+				b.Fatal(e)
+			}
+		}
+
+	})
+}
+
+func BenchmarkNodeParallelSingleNode(b *testing.B) {
+
+	node1name := fmt.Sprintf("nodeB1ParallelLocal_%d@localhost", b.N)
+	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: false})
+
+	bgs := &benchGS{}
+
+	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+	if e1 != nil {
+		b.Fatal(e1)
+	}
+	p2, e2 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+	if e2 != nil {
+		b.Fatal(e2)
+	}
+
+	call := makeCall{
+		to:      p2.Self(),
+		message: "hi",
+	}
+	if _, e := p1.Direct(call); e != nil {
+		b.Fatal("single ping", e)
+	}
+	b.SetParallelism(15)
+	b.RunParallel(func(pb *testing.PB) {
+		p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+		if e1 != nil {
+			b.Fatal(e1)
+		}
+		p2, e2 := node1.Spawn("", gen.ProcessOptions{}, bgs)
+		if e2 != nil {
+			b.Fatal(e2)
+		}
+		b.ResetTimer()
 		for pb.Next() {
 			call := makeCall{
 				to:      p2.Self(),
@@ -544,67 +2601,792 @@ func BenchmarkNodeParallel(b *testing.B) {
 			}
 		}
 
-	})
+	})
+}
+func benchCases() []benchCase {
+	return []benchCase{
+		{"number", 12345},
+		{"string", "hello world"},
+		{"tuple (PID)",
+			etf.Pid{
+				Node:     "node@localhost",
+				ID:       1000,
+				Creation: 1,
+			},
+		},
+		{"binary 1MB", make([]byte, 1024*1024)},
+	}
+}
+
+func TestNodeStartTLSSilentPeer(t *testing.T) {
+	fmt.Printf("\n=== Test Node StartTLS with the silent peer\n")
+	opts1 := node.Options{
+		Listen:      25075,
+		TLSMode:     node.TLSModeAuto,
+		TLSStartTLS: true,
+	}
+	node1, e := ergo.StartNode("nodeT1StartTLSSilent@localhost", "secret", opts1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2StartTLSSilent@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	fmt.Printf("    the silent peer doesn't block accepting the connections: ")
+	silent, err := net.Dial("tcp", "localhost:25075")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	// make sure the listener has accepted it
+	time.Sleep(100 * time.Millisecond)
+
+	if err := node2.AddStaticRoute(node1.Name(), 25075, node.RouteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	connected := make(chan error, 1)
+	go func() {
+		connected <- node2.Connect(node1.Name())
+	}()
+	select {
+	case err := <-connected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("plaintext connection is blocked by the silent peer")
+	}
+	fmt.Println("OK")
+}
+
+type testPauseGS struct {
+	gen.Server
+	entered  chan bool
+	block    chan bool
+	received chan int
+}
+
+func (s *testPauseGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	switch m := message.(type) {
+	case string:
+		s.entered <- true
+		<-s.block
+	case int:
+		s.received <- m
+	}
+	return gen.ServerStatusOK
+}
+
+func TestNodePauseResume(t *testing.T) {
+	fmt.Printf("\n=== Test Node pause/resume process\n")
+	node1, e := ergo.StartNode("nodeT1PauseResume@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs := &testPauseGS{
+		entered:  make(chan bool, 1),
+		block:    make(chan bool),
+		received: make(chan int, 10),
+	}
+	sender, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p, e := node1.Spawn("", gen.ProcessOptions{MailboxSize: 3}, gs)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// make the process busy and fill up its mailbox
+	if err := sender.Send(p.Self(), "block"); err != nil {
+		t.Fatal(err)
+	}
+	<-gs.entered
+	for i := 1; i < 4; i++ {
+		if err := sender.Send(p.Self(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fmt.Printf("    hold the messages of the paused process: ")
+	if err := node1.PauseProcess(p.Self()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 4; i < 7; i++ {
+		if err := sender.Send(p.Self(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Send(p.Self(), 7); err != node.ErrProcessMailboxFull {
+		t.Fatal("expected ErrProcessMailboxFull, got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    resume doesn't block on the full mailbox: ")
+	resumed := make(chan error, 1)
+	go func() { resumed <- node1.ResumeProcess(p.Self()) }()
+	select {
+	case err := <-resumed:
+		if err != node.ErrProcessMailboxFull {
+			t.Fatal("expected ErrProcessMailboxFull, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ResumeProcess is blocked")
+	}
+	// still paused, so the sender can't overtake the held messages
+	if err := sender.Send(p.Self(), 7); err != node.ErrProcessMailboxFull {
+		t.Fatal("expected ErrProcessMailboxFull, got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    deliver the held messages in order: ")
+	close(gs.block)
+	for i := 1; i < 4; i++ {
+		if m := <-gs.received; m != i {
+			t.Fatalf("expected %d, got %d", i, m)
+		}
+	}
+	if err := node1.ResumeProcess(p.Self()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 4; i < 8; i++ {
+		if i == 5 {
+			// the held messages have taken the whole mailbox, there is room for one more
+			if err := sender.Send(p.Self(), 7); err != nil {
+				t.Fatal(err)
+			}
+		}
+		select {
+		case m := <-gs.received:
+			if m != i {
+				t.Fatalf("expected %d, got %d", i, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	fmt.Println("OK")
+}
+
+type testMigrateGS struct {
+	gen.Server
+}
+
+func (s *testMigrateGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	process.State = 0
+	if len(args) > 0 {
+		// spawned by the migration
+		process.State = args[0].(int)
+	}
+	return nil
+}
+
+func (s *testMigrateGS) HandleCast(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	process.State = process.State.(int) + 1
+	return gen.ServerStatusOK
+}
+
+func (s *testMigrateGS) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
+	return process.State, gen.ServerStatusOK
+}
+
+func (s *testMigrateGS) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	switch m := message.(type) {
+	case gen.MessageDirectInspect:
+		return gen.MessageInspect{Behavior: "counter", State: process.State}, nil
+	case makeCall:
+		return process.Call(m.to, m.message)
+	case makeCast:
+		return nil, process.Cast(m.to, m.message)
+	}
+	return nil, gen.ErrUnsupportedRequest
+}
+
+func TestNodeMigrateProcess(t *testing.T) {
+	fmt.Printf("\n=== Test Node migrate process\n")
+	node1, e := ergo.StartNode("nodeT1MigrateProcess@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2MigrateProcess@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	if err := node2.ProvideRemoteSpawn("counter", &testMigrateGS{}); err != nil {
+		t.Fatal(err)
+	}
+	sender, e := node1.Spawn("", gen.ProcessOptions{}, &testMigrateGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p, e := node1.Spawn("counter", gen.ProcessOptions{}, &testMigrateGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	counter := gen.ProcessID{Name: "counter", Node: node1.Name()}
+
+	fmt.Printf("    migrate process with the held messages: ")
+	for i := 0; i < 3; i++ {
+		if _, err := sender.Direct(makeCast{to: counter, message: "inc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := node1.PauseProcess(p.Self()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := sender.Direct(makeCast{to: counter, message: "inc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrated, err := node1.MigrateProcess(p.Self(), node2.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(migrated.Node) != node2.Name() {
+		t.Fatal("process is spawned on the wrong node", migrated)
+	}
+	if err := p.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal("source process is still alive")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    registered name points to the migrated process: ")
+	if pid, _ := node1.WhereIs("counter"); pid != migrated {
+		t.Fatal("expected", migrated, "got", pid)
+	}
+	value, err := sender.Direct(makeCall{to: counter, message: "get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 5 {
+		t.Fatal("expected 5, got", value)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    process without inspect hook is resumed: ")
+	sink, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, err := node1.MigrateProcess(sink.Self(), node2.Name()); err != gen.ErrUnsupportedRequest {
+		t.Fatal("expected ErrUnsupportedRequest, got", err)
+	}
+	if _, err := sender.Direct(makeCall{to: sink.Self(), message: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+}
+
+type testGlobalRegistry struct {
+	sync.Mutex
+	names map[string]etf.Pid
+}
+
+func (r *testGlobalRegistry) Register(name string, pid etf.Pid) error {
+	r.Lock()
+	defer r.Unlock()
+	if registered, taken := r.names[name]; taken && registered != pid {
+		return node.ErrTaken
+	}
+	r.names[name] = pid
+	return nil
+}
+
+func (r *testGlobalRegistry) Unregister(name string) error {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.names, name)
+	return nil
+}
+
+func (r *testGlobalRegistry) Resolve(name string) (etf.Pid, error) {
+	r.Lock()
+	defer r.Unlock()
+	pid, ok := r.names[name]
+	if !ok {
+		return pid, node.ErrNameUnknown
+	}
+	return pid, nil
+}
+
+func TestNodeGlobalRegistry(t *testing.T) {
+	fmt.Printf("\n=== Test Node GlobalRegistry\n")
+	registry := &testGlobalRegistry{names: make(map[string]etf.Pid)}
+	opts := node.Options{GlobalRegistry: registry}
+	node1, e := ergo.StartNode("node1GlobalRegistry@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("node2GlobalRegistry@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	fmt.Printf("    publish the name registered with RegisterName: ")
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	p1, e := node1.Spawn("local", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs1.res, nil)
+	if err := node1.RegisterName("global", p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := registry.Resolve("global"); err != nil || pid != p1.Self() {
+		t.Fatal("wrong registration", pid, err)
+	}
+	// the names given on spawning are local only
+	if _, err := registry.Resolve("local"); err != node.ErrNameUnknown {
+		t.Fatal("expected ErrNameUnknown, got", err)
+	}
+	if _, e := node2.Spawn("local", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)}); e != nil {
+		t.Fatal(e)
+	}
+	pid2 := node2.ProcessByName("local").Self()
+	if err := node2.RegisterName("global", pid2); err != node.ErrTaken {
+		t.Fatal("expected ErrTaken, got", err)
+	}
+	// failed registration mustn't take away the name of another node
+	if err := node2.UnregisterName("global"); err != node.ErrNameUnknown {
+		t.Fatal("expected ErrNameUnknown, got", err)
+	}
+	if pid, err := registry.Resolve("global"); err != nil || pid != p1.Self() {
+		t.Fatal("wrong registration", pid, err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    resolve the name registered on another node: ")
+	if pid, ok := node2.WhereIs("global"); !ok || pid != p1.Self() {
+		t.Fatal("wrong result", pid, ok)
+	}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs2.res, nil)
+	if err := p2.Send("global", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "hi")
+	fmt.Println("OK")
+
+	fmt.Printf("    unregister the name on termination: ")
+	p1.Kill()
+	if err := p1.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// the name is unregistered right after the process termination
+	for i := 0; i < 10; i++ {
+		if _, err := registry.Resolve("global"); err == node.ErrNameUnknown {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := registry.Resolve("global"); err != node.ErrNameUnknown {
+		t.Fatal("expected ErrNameUnknown, got", err)
+	}
+	if err := p2.Send("global", "hi"); err != node.ErrProcessUnknown {
+		t.Fatal("expected ErrProcessUnknown, got", err)
+	}
+	fmt.Println("OK")
+}
+
+func TestNodeListeners(t *testing.T) {
+	fmt.Printf("\n=== Test Node multiple listeners\n")
+	opts1 := node.Options{
+		Listeners: []node.ListenerSpec{
+			{Listen: 25080},
+			{Listen: 25081, TLSMode: node.TLSModeAuto},
+		},
+	}
+	node1, e := ergo.StartNode("nodeT1Listeners@localhost", "secret", opts1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	dialed := make(chan interface{}, 10)
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if _, port, _ := net.SplitHostPort(address); port != "4369" {
+			dialed <- port
+		}
+		d := net.Dialer{}
+		return d.DialContext(ctx, network, address)
+	}
+
+	fmt.Printf("    peer without TLS connects to the primary listener: ")
+	node2, e := ergo.StartNode("nodeT2Listeners@localhost", "secret", node.Options{Dialer: dialer})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	if err := node2.Connect(node1.Name()); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, dialed, "25080")
+
+	fmt.Printf("    peer with TLS prefers the TLS listener: ")
+	opts3 := node.Options{
+		Dialer:  dialer,
+		TLSMode: node.TLSModeAuto,
+	}
+	node3, e := ergo.StartNode("nodeT3Listeners@localhost", "secret", opts3)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+	if err := node3.Connect(node1.Name()); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, dialed, "25081")
+}
+
+func TestNodeSendWithTTL(t *testing.T) {
+	fmt.Printf("\n=== Test Node sending with TTL\n")
+	node1, e := ergo.StartNode("nodeT1SendWithTTL@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs := &testPauseGS{
+		entered:  make(chan bool, 1),
+		block:    make(chan bool),
+		received: make(chan int, 10),
+	}
+	sender, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	p, e := node1.Spawn("", gen.ProcessOptions{}, gs)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    expired messages are dropped: ")
+	// keep the messages in the mailbox until the short TTL is expired
+	if err := sender.Send(p.Self(), "block"); err != nil {
+		t.Fatal(err)
+	}
+	<-gs.entered
+	ttls := []time.Duration{50 * time.Millisecond, time.Minute, 0, 50 * time.Millisecond, time.Minute}
+	for i, ttl := range ttls {
+		if err := node1.RouteSendWithTTL(sender.Self(), p.Self(), i, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(gs.block)
+	for _, expected := range []int{1, 2, 4} {
+		select {
+		case m := <-gs.received:
+			if m != expected {
+				t.Fatalf("expected %d, got %d", expected, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    messages are handled within TTL: ")
+	if err := node1.RouteSendWithTTL(sender.Self(), p.Self(), 5, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-gs.received:
+		if m != 5 {
+			t.Fatalf("expected 5, got %d", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case m := <-gs.received:
+		t.Fatal("unexpected message", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+	fmt.Println("OK")
 }
 
-func BenchmarkNodeParallelSingleNode(b *testing.B) {
+func TestNodeObserve(t *testing.T) {
+	fmt.Printf("\n=== Test Node Observe\n")
+	node1, e := ergo.StartNode("nodeT1Observe@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
 
-	node1name := fmt.Sprintf("nodeB1ParallelLocal_%d@localhost", b.N)
-	node1, _ := ergo.StartNode(node1name, "bench", node.Options{DisableHeaderAtomCache: false})
+	deltas, cancel := node1.Observe()
+	deltas2, _ := node1.Observe()
+	expect := func(expected gen.NodeDelta) {
+		select {
+		case delta := <-deltas:
+			if delta != expected {
+				t.Fatalf("expected %#v, got %#v", expected, delta)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
 
-	bgs := &benchGS{}
+	fmt.Printf("    spawning the process with the name: ")
+	p, e := node1.Spawn("observed", gen.ProcessOptions{}, &testSinkGS{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	expect(gen.NodeDelta{Type: gen.NodeDeltaProcessSpawned, Pid: p.Self()})
+	expect(gen.NodeDelta{Type: gen.NodeDeltaNameRegistered, Pid: p.Self(), Name: "observed"})
+	fmt.Println("OK")
 
-	p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-	if e1 != nil {
-		b.Fatal(e1)
+	fmt.Printf("    registering and unregistering the name: ")
+	if err := node1.RegisterName("observed2", p.Self()); err != nil {
+		t.Fatal(err)
 	}
-	p2, e2 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-	if e2 != nil {
-		b.Fatal(e2)
+	expect(gen.NodeDelta{Type: gen.NodeDeltaNameRegistered, Pid: p.Self(), Name: "observed2"})
+	if err := node1.UnregisterName("observed2"); err != nil {
+		t.Fatal(err)
 	}
+	expect(gen.NodeDelta{Type: gen.NodeDeltaNameUnregistered, Pid: p.Self(), Name: "observed2"})
+	fmt.Println("OK")
 
-	call := makeCall{
-		to:      p2.Self(),
-		message: "hi",
+	fmt.Printf("    terminating the process: ")
+	p.Kill()
+	expect(gen.NodeDelta{Type: gen.NodeDeltaNameUnregistered, Pid: p.Self(), Name: "observed"})
+	expect(gen.NodeDelta{Type: gen.NodeDeltaProcessTerminated, Pid: p.Self()})
+	fmt.Println("OK")
+
+	fmt.Printf("    canceled observer gets nothing: ")
+	cancel()
+	cancel()
+	if _, e := node1.Spawn("", gen.ProcessOptions{}, &testSinkGS{}); e != nil {
+		t.Fatal(e)
 	}
-	if _, e := p1.Direct(call); e != nil {
-		b.Fatal("single ping", e)
+	if delta, ok := <-deltas; ok {
+		t.Fatal("unexpected event", delta)
 	}
-	b.SetParallelism(15)
-	b.RunParallel(func(pb *testing.PB) {
-		p1, e1 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-		if e1 != nil {
-			b.Fatal(e1)
+	fmt.Println("OK")
+
+	fmt.Printf("    channel is closed on stopping the node: ")
+	node1.Stop()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-deltas2:
+			if ok {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("result timeout")
 		}
-		p2, e2 := node1.Spawn("", gen.ProcessOptions{}, bgs)
-		if e2 != nil {
-			b.Fatal(e2)
+		break
+	}
+	closed, _ := node1.Observe()
+	if _, ok := <-closed; ok {
+		t.Fatal("channel must be closed")
+	}
+	fmt.Println("OK")
+}
+
+func TestNodePeerSupports(t *testing.T) {
+	fmt.Printf("\n=== Test Node PeerSupports\n")
+	node1, e := ergo.StartNode("nodeT1PeerSupports@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2PeerSupports@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	fmt.Printf("    unknown peer: ")
+	if _, err := node1.PeerSupports(node2.Name(), gen.FeatureCompression); err != node.ErrNoRoute {
+		t.Fatalf("expected %q, got %v", node.ErrNoRoute, err)
+	}
+	fmt.Println("OK")
+
+	if err := node1.Connect(node2.Name()); err != nil {
+		t.Fatal(err)
+	}
+	// the accepted connection is registered asynchronously
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("    negotiated features: ")
+	for _, n := range []node.Node{node1, node2} {
+		peer := node2.Name()
+		if n == node2 {
+			peer = node1.Name()
 		}
-		b.ResetTimer()
-		for pb.Next() {
-			call := makeCall{
-				to:      p2.Self(),
-				message: etf.Atom("ping"),
+		for _, feature := range []gen.Feature{gen.FeatureBigCreation, gen.FeatureCompression} {
+			supported, err := n.PeerSupports(peer, feature)
+			if err != nil {
+				t.Fatal(n.Name(), err)
 			}
-			_, e := p1.Direct(call)
-			if e != nil {
-				b.Fatal(e)
+			if supported == false {
+				t.Fatalf("%s: feature %q must be supported by %s", n.Name(), feature, peer)
 			}
 		}
+	}
+	fmt.Println("OK")
+}
 
-	})
+func TestNodeCompressionDictionary(t *testing.T) {
+	fmt.Printf("\n=== Test Node compression with the dictionary\n")
+	dictionary := []byte("temperaturehumiditypressuresensorlocation")
+	opts := node.Options{
+		Compression:           true,
+		CompressionDictionary: dictionary,
+	}
+	node1, e := ergo.StartNode("nodeT1CompressionDictionary@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2CompressionDictionary@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	opts.CompressionDictionary = []byte("anotherdictionary")
+	node3, e := ergo.StartNode("nodeT3CompressionDictionary@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	gs3 := &testServer{res: make(chan interface{}, 2)}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs1.res, nil)
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, gs2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs2.res, nil)
+	p3, e := node3.Spawn("", gen.ProcessOptions{}, gs3)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs3.res, nil)
+
+	message := etf.List{}
+	for i := 0; i < 100; i++ {
+		message = append(message, etf.Tuple{etf.Atom("sensor"), i, etf.Atom("temperature"), 21})
+	}
+
+	fmt.Printf("    sending compressed message with the same dictionary: ")
+	if err := p1.Send(p2.Self(), message); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs2.res, message)
+
+	fmt.Printf("    message compressed with another dictionary is not delivered: ")
+	if err := p3.Send(p2.Self(), message); err != nil {
+		t.Fatal(err)
+	}
+	waitForTimeout(t, gs2.res)
 }
-func benchCases() []benchCase {
-	return []benchCase{
-		{"number", 12345},
-		{"string", "hello world"},
-		{"tuple (PID)",
-			etf.Pid{
-				Node:     "node@localhost",
-				ID:       1000,
-				Creation: 1,
-			},
-		},
-		{"binary 1MB", make([]byte, 1024*1024)},
+
+func TestNodeGroupsCluster(t *testing.T) {
+	fmt.Printf("\n=== Test Node Groups across the nodes\n")
+	node1, e := ergo.StartNode("nodeT1GroupsCluster@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeT2GroupsCluster@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	subscriber := &testServer{res: make(chan interface{}, 2)}
+	sub, _ := node2.Spawn("", gen.ProcessOptions{}, subscriber)
+	waitForResultWithValue(t, subscriber.res, nil)
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	p2, _ := node2.Spawn("", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+	p3, _ := node1.Spawn("", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)})
+
+	waitMembers := func(n node.Node, expected ...etf.Pid) {
+		if expected == nil {
+			expected = []etf.Pid{}
+		}
+		for i := 0; i < 100; i++ {
+			if reflect.DeepEqual(n.GroupMembers("g"), expected) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("wrong members on", n.Name(), n.GroupMembers("g"))
+	}
+
+	fmt.Printf("    remote process can't join the group: ")
+	if err := node2.JoinGroup("g", p1.Self()); err != node.ErrProcessUnknown {
+		t.Fatal("expected ErrProcessUnknown, got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    members are synced on connecting the nodes: ")
+	if err := node2.SubscribeGroup("g", sub.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.JoinGroup("g", p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Connect(node2.Name()); err != nil {
+		t.Fatal(err)
 	}
+	waitForResultWithValue(t, subscriber.res, gen.MessageGroupLeader{Group: "g", Leader: p1.Self()})
+	waitMembers(node2, p1.Self())
+
+	fmt.Printf("    both nodes elect the same leader: ")
+	if err := node2.JoinGroup("g", p2.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.JoinGroup("g", p3.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(node1, p1.Self(), p2.Self(), p3.Self())
+	waitMembers(node2, p1.Self(), p2.Self(), p3.Self())
+	fmt.Println("OK")
+
+	fmt.Printf("    failover on terminating the remote leader: ")
+	p1.Exit("normal")
+	waitForResultWithValue(t, subscriber.res, gen.MessageGroupLeader{Group: "g", Leader: p2.Self(), Previous: p1.Self()})
+	waitMembers(node1, p2.Self(), p3.Self())
+	waitMembers(node2, p2.Self(), p3.Self())
+
+	fmt.Printf("    leaving the group is replicated: ")
+	if err := node1.LeaveGroup("g", p3.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(node2, p2.Self())
+	if err := node1.JoinGroup("g", p3.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(node2, p2.Self(), p3.Self())
+	fmt.Println("OK")
+
+	fmt.Printf("    remote members are removed if the node is down: ")
+	node1.Stop()
+	waitMembers(node2, p2.Self())
+	fmt.Println("OK")
 }
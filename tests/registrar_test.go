@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -221,3 +222,80 @@ func TestRegistrarAlias(t *testing.T) {
 	fmt.Println("OK")
 
 }
+
+func TestRegistrarSnapshot(t *testing.T) {
+	fmt.Printf("\n=== Test Registrar Snapshot\n")
+	node1, _ := ergo.StartNode("nodeR1Snapshot@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	node2, _ := ergo.StartNode("nodeR2Snapshot@localhost", "cookies", node.Options{})
+	if node2 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node2.Stop()
+
+	gs := &TestRegistrarGenserver{}
+	node1gs1, err := node1.Spawn("gs1", gen.ProcessOptions{}, gs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias, err := node1gs1.CreateAlias()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.RegisterBehavior("snapshot", "gs", gs, "data"); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    export the registry: ")
+	snapshot := node1.ExportRegistry()
+	if snapshot.Names["gs1"] != node1gs1.Self() {
+		t.Fatal("name is not exported", snapshot.Names)
+	}
+	if snapshot.Aliases[alias] != node1gs1.Self() {
+		t.Fatal("alias is not exported", snapshot.Aliases)
+	}
+	if rb := snapshot.Behaviors["snapshot"]["gs"]; rb.Behavior != gs || rb.Data != "data" {
+		t.Fatal("behavior is not exported", snapshot.Behaviors)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    import to another node restores the behaviors only: ")
+	if err := node2.ImportRegistry(snapshot); errors.Is(err, node.ErrRegistryImport) == false {
+		t.Fatal("expected", node.ErrRegistryImport, "got", err)
+	}
+	if rb, err := node2.RegisteredBehavior("snapshot", "gs"); err != nil || rb.Data != "data" {
+		t.Fatal("behavior is not imported", rb, err)
+	}
+	if node2.ProcessByName("gs1") != nil || node2.IsAlias(alias) {
+		t.Fatal("pid-scoped entries must be skipped")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    import restores the names and aliases of the alive processes: ")
+	if err := node1.UnregisterName("gs1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1gs1.DeleteAlias(alias); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.UnregisterBehavior("snapshot", "gs"); err != nil {
+		t.Fatal(err)
+	}
+	// the rest of the snapshot is still registered, so it's skipped
+	if err := node1.ImportRegistry(snapshot); errors.Is(err, node.ErrRegistryImport) == false {
+		t.Fatal("expected", node.ErrRegistryImport, "got", err)
+	}
+	if _, err := node1.RegisteredBehavior("snapshot", "gs"); err != nil {
+		t.Fatal("behavior is not imported", err)
+	}
+	if p := node1.ProcessByName("gs1"); p == nil || p.Self() != node1gs1.Self() {
+		t.Fatal("name is not imported")
+	}
+	if node1.ProcessByAlias(alias) == nil {
+		t.Fatal("alias is not imported")
+	}
+	fmt.Println("OK")
+}
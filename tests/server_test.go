@@ -2,7 +2,11 @@ package tests
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -678,6 +682,254 @@ func TestServerMessageFlood(t *testing.T) {
 	waitForResultWithValue(t, gsdest.res, nil)
 }
 
+type sendToSelfGS struct {
+	gen.Server
+	res chan interface{}
+	// the number of messages sent by HandleDirect. Direct returns no value
+	// along with the error
+	sent int
+}
+
+type sendToSelf struct {
+	n int
+}
+
+func (ss *sendToSelfGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	ss.res <- nil
+	return nil
+}
+
+func (ss *sendToSelfGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	ss.res <- message
+	return gen.ServerStatusOK
+}
+
+func (ss *sendToSelfGS) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	switch m := message.(type) {
+	case sendToSelf:
+		// the mailbox isn't being read while this callback is running
+		for ss.sent = 0; ss.sent < m.n; ss.sent++ {
+			if err := process.Send(process.Self(), ss.sent); err != nil {
+				return nil, err
+			}
+		}
+		return ss.sent, nil
+	}
+	return nil, gen.ErrUnsupportedRequest
+}
+
+func TestServerSendToSelf(t *testing.T) {
+	fmt.Printf("\n=== Test Server send to self\n")
+	fmt.Printf("Starting node: nodeGS1SendToSelf@localhost: ")
+	node1, _ := ergo.StartNode("nodeGS1SendToSelf@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start nodes")
+	} else {
+		fmt.Println("OK")
+	}
+	defer node1.Stop()
+
+	gs1 := &sendToSelfGS{
+		res: make(chan interface{}, 10),
+	}
+	dropped := make(chan interface{}, 10)
+	opts := gen.ProcessOptions{
+		MailboxSize: 3,
+		OnMailboxFull: func(from etf.Pid, message etf.Term) {
+			dropped <- message
+		},
+	}
+	fmt.Printf("    wait for start of gs1 on %#v: ", node1.Name())
+	gs1process, _ := node1.Spawn("gs1", opts, gs1, nil)
+	waitForResultWithValue(t, gs1.res, nil)
+
+	fmt.Printf("    process.Send (by Pid) to itself: ")
+	if err := gs1process.Send(gs1process.Self(), etf.Atom("hi")); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, etf.Atom("hi"))
+
+	fmt.Printf("    process.Send to itself with the full mailbox (no deadlock): ")
+	_, err := gs1process.Direct(sendToSelf{n: 4})
+	if err != node.ErrProcessMailboxFull {
+		t.Fatalf("expected %q, got %v", node.ErrProcessMailboxFull, err)
+	}
+	if gs1.sent != 3 {
+		t.Fatalf("expected 3 messages in the mailbox, got %v", gs1.sent)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    OnMailboxFull is invoked for the dropped message: ")
+	waitForResultWithValue(t, dropped, 3)
+
+	for i := 0; i < 3; i++ {
+		fmt.Printf("    message %d sent to itself is handled in order: ", i)
+		waitForResultWithValue(t, gs1.res, i)
+	}
+}
+
+type panicGS struct {
+	gen.Server
+}
+
+func (gs *panicGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	panic(message)
+}
+
+func TestServerPanicPolicy(t *testing.T) {
+	fmt.Printf("\n=== Test Server panic policy\n")
+	fmt.Printf("Starting node: nodeGS3PanicPolicy@localhost: ")
+	handled := make(chan interface{}, 2)
+	opts := node.Options{
+		PanicPolicy: gen.PanicPolicyCallback,
+	}
+	if _, err := ergo.StartNode("nodeGS3PanicPolicy@localhost", "cookies", opts); err == nil {
+		t.Fatal("must be failed: PanicHandler is not defined")
+	}
+	opts.PanicHandler = func(pid etf.Pid, name string, reason interface{}) gen.PanicPolicy {
+		handled <- etf.Tuple{name, reason}
+		return gen.PanicPolicyIsolate
+	}
+	node1, _ := ergo.StartNode("nodeGS3PanicPolicy@localhost", "cookies", opts)
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	process, err := node1.Spawn("gsPanic", gen.ProcessOptions{}, &panicGS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("... panic handler is invoked: ")
+	process.Send(process.Self(), "boom")
+	waitForResultWithValue(t, handled, etf.Tuple{"gsPanic", "boom"})
+
+	fmt.Printf("... process is isolated (terminated): ")
+	if err := process.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !node1.IsAlive() {
+		t.Fatal("node must be alive")
+	}
+	fmt.Println("OK")
+}
+
+// panicLoop resolves the panic of its loop and re-panics if the node must be crashed
+type panicLoop struct{}
+
+func (pl *panicLoop) ProcessInit(p gen.Process, args ...etf.Term) (gen.ProcessState, error) {
+	return gen.ProcessState{Process: p}, nil
+}
+
+func (pl *panicLoop) ProcessLoop(ps gen.ProcessState, started chan<- bool) (reason string) {
+	started <- true
+	defer func() {
+		if r := recover(); r != nil {
+			if ps.PanicPolicy(r) == gen.PanicPolicyCrashNode {
+				panic(r)
+			}
+			reason = "panic"
+		}
+	}()
+	panic("boom")
+}
+
+func TestServerPanicPolicyCrashNode(t *testing.T) {
+	if os.Getenv("ERGO_TEST_CRASH_NODE") != "" {
+		opts := node.Options{
+			PanicPolicy: gen.PanicPolicyCallback,
+			PanicHandler: func(pid etf.Pid, name string, reason interface{}) gen.PanicPolicy {
+				fmt.Println("panic handler is invoked")
+				return gen.PanicPolicyCrashNode
+			},
+		}
+		node1, err := ergo.StartNode("nodeGS3PanicCrashNode@localhost", "cookies", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node1.Spawn("", gen.ProcessOptions{}, &panicLoop{})
+		time.Sleep(time.Second)
+		return
+	}
+
+	fmt.Printf("\n=== Test Server panic policy crashing the node\n")
+	fmt.Printf("... node is crashed, the panic handler is invoked once: ")
+	// the crash can't be recovered, so run it in the child process
+	cmd := exec.Command(os.Args[0], "-test.run=^TestServerPanicPolicyCrashNode$")
+	cmd.Env = append(os.Environ(), "ERGO_TEST_CRASH_NODE=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("node must be crashed")
+	}
+	if n := strings.Count(string(out), "panic handler is invoked"); n != 1 {
+		t.Fatalf("panic handler is invoked %d times:\n%s", n, out)
+	}
+	fmt.Println("OK")
+}
+
+type directboxGS struct {
+	gen.Server
+	entered chan interface{}
+	release chan struct{}
+}
+
+func (gs *directboxGS) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	gs.entered <- message
+	<-gs.release
+	return message, nil
+}
+
+func TestServerDirectbox(t *testing.T) {
+	fmt.Printf("\n=== Test Server DirectboxSize\n")
+	fmt.Printf("Starting node: nodeGS4Directbox@localhost: ")
+	node1, _ := ergo.StartNode("nodeGS4Directbox@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	gs := &directboxGS{
+		entered: make(chan interface{}, 10),
+		release: make(chan struct{}),
+	}
+	process, err := node1.Spawn("", gen.ProcessOptions{DirectboxSize: 1}, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan interface{}, 2)
+	direct := func(n int) {
+		reply, err := process.Direct(n)
+		if err != nil {
+			results <- err
+			return
+		}
+		results <- reply
+	}
+
+	fmt.Printf("... the first request is being handled: ")
+	go direct(1)
+	waitForResultWithValue(t, gs.entered, 1)
+
+	fmt.Printf("... the second request is queued, the third one gets ErrProcessBusy: ")
+	go direct(2)
+	// give it a time to be queued
+	time.Sleep(100 * time.Millisecond)
+	if _, err := process.DirectWithTimeout(3, 1); err != node.ErrProcessBusy {
+		t.Fatal("expected", node.ErrProcessBusy, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... queued requests are replied: ")
+	close(gs.release)
+	waitForResultWithValue(t, results, 1)
+	fmt.Printf("... ")
+	waitForResultWithValue(t, results, 2)
+}
+
 func waitForResult(t *testing.T, w chan error) {
 	select {
 	case e := <-w:
@@ -729,6 +981,429 @@ func waitForResultWithMultiValue(t *testing.T, w chan interface{}, values etf.Li
 	fmt.Println("OK")
 }
 
+func TestServerSendWithReceipt(t *testing.T) {
+	fmt.Printf("\n=== Test Server SendWithReceipt\n")
+	node1, e := ergo.StartNode("nodeGS1Receipt@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("nodeGS2Receipt@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	gs2 := &testServer{res: make(chan interface{}, 2)}
+	gs3 := &testServer{res: make(chan interface{}, 2)}
+	p1, _ := node1.Spawn("", gen.ProcessOptions{}, gs1)
+	waitForResultWithValue(t, gs1.res, nil)
+	p2, _ := node1.Spawn("", gen.ProcessOptions{}, gs2)
+	waitForResultWithValue(t, gs2.res, nil)
+	p3, _ := node2.Spawn("", gen.ProcessOptions{}, gs3)
+	waitForResultWithValue(t, gs3.res, nil)
+
+	fmt.Printf("    receipt for the local message: ")
+	ref, err := p1.SendWithReceipt(p2.Self(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs2.res, "hi")
+	waitForResultWithValue(t, gs1.res, gen.MessageDeliveryReceipt{Ref: ref, To: p2.Self(), Queued: true})
+	fmt.Println("OK")
+
+	fmt.Printf("    receipt for the remote message: ")
+	ref, err = p1.SendWithReceipt(p3.Self(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, gen.MessageDeliveryReceipt{Ref: ref, To: p3.Self(), Queued: true})
+	waitForResultWithValue(t, gs3.res, "hi")
+	fmt.Println("OK")
+
+	fmt.Printf("    receipts for the burst of remote messages: ")
+	gs1.res = make(chan interface{}, 100)
+	gs3.res = make(chan interface{}, 100)
+	refs := make(map[etf.Ref]bool)
+	for i := 0; i < 100; i++ {
+		ref, err := p1.SendWithReceipt(p3.Self(), i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs[ref] = true
+	}
+	for i := 0; i < 100; i++ {
+		select {
+		case r := <-gs1.res:
+			receipt, ok := r.(gen.MessageDeliveryReceipt)
+			if !ok || !refs[receipt.Ref] || receipt.Queued == false {
+				t.Fatal("unexpected receipt", r)
+			}
+			delete(refs, receipt.Ref)
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	for i := 0; i < 100; i++ {
+		waitForResultWithValue(t, gs3.res, i)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    no receipt for the failed sending: ")
+	p2.Kill()
+	if err := p2.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p1.SendWithReceipt(p2.Self(), "hi"); err == nil {
+		t.Fatal("must be failed")
+	}
+	unreachable := etf.Pid{Node: "nodeGS3Receipt@localhost", ID: 1000}
+	if _, err := p1.SendWithReceipt(unreachable, "hi"); err == nil {
+		t.Fatal("must be failed")
+	}
+	waitForTimeout(t, gs1.res)
+	fmt.Println("OK")
+}
+
+type testMailboxPersister struct {
+	sync.Mutex
+	messages []gen.ProcessMailboxMessage
+}
+
+func (tp *testMailboxPersister) Append(message gen.ProcessMailboxMessage) error {
+	tp.Lock()
+	defer tp.Unlock()
+	tp.messages = append(tp.messages, message)
+	return nil
+}
+
+func (tp *testMailboxPersister) Replay() []gen.ProcessMailboxMessage {
+	tp.Lock()
+	defer tp.Unlock()
+	return append([]gen.ProcessMailboxMessage{}, tp.messages...)
+}
+
+func (tp *testMailboxPersister) Ack(n int) {
+	tp.Lock()
+	defer tp.Unlock()
+	tp.messages = tp.messages[n:]
+}
+
+func (tp *testMailboxPersister) persisted() []etf.Term {
+	persisted := []etf.Term{}
+	for _, m := range tp.Replay() {
+		persisted = append(persisted, m.Message)
+	}
+	return persisted
+}
+
+func TestServerMailboxPersister(t *testing.T) {
+	fmt.Printf("\n=== Test Server MailboxPersister\n")
+	node1, e := ergo.StartNode("nodeGS1Persister@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	persister := &testMailboxPersister{}
+	opts := gen.ProcessOptions{
+		MailboxPersister: persister,
+	}
+
+	fmt.Printf("    messages are persisted in the order of delivering: ")
+	gs1 := &testPauseGS{
+		entered:  make(chan bool, 1),
+		block:    make(chan bool),
+		received: make(chan int, 50),
+	}
+	p1, e := node1.Spawn("", opts, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// the message the process is busy with (or crashed on) is trimmed
+	if err := p1.Send(p1.Self(), "block"); err != nil {
+		t.Fatal(err)
+	}
+	<-gs1.entered
+	wg := sync.WaitGroup{}
+	for s := 0; s < 4; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := p1.Send(p1.Self(), s*10+i); err != nil {
+					t.Error(err)
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+	persisted := persister.persisted()
+	if len(persisted) != 40 {
+		t.Fatal("wrong number of persisted messages", len(persisted))
+	}
+	close(gs1.block)
+	for _, m := range persisted {
+		select {
+		case v := <-gs1.received:
+			if v != m {
+				t.Fatalf("expected %v, got %v", m, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	if n := len(persister.persisted()); n != 0 {
+		t.Fatal("handled messages are still persisted", n)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    messages are replayed on spawning: ")
+	gs2 := &testPauseGS{
+		entered:  make(chan bool, 1),
+		block:    make(chan bool),
+		received: make(chan int, 5),
+	}
+	p2, e := node1.Spawn("", opts, gs2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if err := p2.Send(p2.Self(), "block"); err != nil {
+		t.Fatal(err)
+	}
+	<-gs2.entered
+	for i := 1; i < 4; i++ {
+		if err := p2.Send(p2.Self(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p2.Kill()
+	if err := p2.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	close(gs2.block)
+	gs3 := &testServer{res: make(chan interface{}, 5)}
+	if _, e := node1.Spawn("", opts, gs3); e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs3.res, nil)
+	for i := 1; i < 4; i++ {
+		select {
+		case v := <-gs3.res:
+			if v != i {
+				t.Fatalf("expected %v, got %v", i, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	if n := len(persister.persisted()); n != 0 {
+		t.Fatal("handled messages are still persisted", n)
+	}
+
+	fmt.Printf("    persisted messages are kept if the spawning is failed: ")
+	persister.Append(gen.ProcessMailboxMessage{Message: 1})
+	persister.Append(gen.ProcessMailboxMessage{Message: 2})
+	persister.Append(gen.ProcessMailboxMessage{Message: 3})
+	if _, e := node1.Spawn("persisted", gen.ProcessOptions{}, &testServer{res: make(chan interface{}, 2)}); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := node1.Spawn("persisted", opts, &testServer{res: make(chan interface{}, 5)}); e != node.ErrTaken {
+		t.Fatal("expected ErrTaken, got", e)
+	}
+	if n := len(persister.persisted()); n != 3 {
+		t.Fatal("wrong number of persisted messages", n)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    replay the last MailboxSize messages: ")
+	gs4 := &testServer{res: make(chan interface{}, 5)}
+	opts.MailboxSize = 2
+	if _, e := node1.Spawn("", opts, gs4); e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs4.res, nil)
+	waitForResultWithValue(t, gs4.res, 2)
+	waitForResultWithValue(t, gs4.res, 3)
+	if n := len(persister.persisted()); n != 0 {
+		t.Fatal("handled messages are still persisted", n)
+	}
+}
+
+func TestServerDedicatedThread(t *testing.T) {
+	fmt.Printf("\n=== Test Server DedicatedThread\n")
+	node1, e := ergo.StartNode("nodeGS1DedicatedThread@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	fmt.Printf("    process with the dedicated thread: ")
+	gs1 := &testServer{res: make(chan interface{}, 2)}
+	p1, e := node1.Spawn("", gen.ProcessOptions{DedicatedThread: true}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs1.res, nil)
+	if err := p1.Send(p1.Self(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "hi")
+	p1.Exit("normal")
+	if err := p1.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+}
+
+type priorityGS struct {
+	gen.Server
+	res     chan interface{}
+	unblock chan bool
+}
+
+func (gs *priorityGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	gs.res <- nil
+	return nil
+}
+
+func (gs *priorityGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	gs.res <- message
+	if message == "block" {
+		<-gs.unblock
+	}
+	return gen.ServerStatusOK
+}
+
+func TestServerPriority(t *testing.T) {
+	fmt.Printf("\n=== Test Server Priority\n")
+	node1, e := ergo.StartNode("nodeGS1Priority@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &priorityGS{
+		res:     make(chan interface{}, 10),
+		unblock: make(chan bool),
+	}
+	p1, e := node1.Spawn("", gen.ProcessOptions{MailboxSize: 1}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs1.res, nil)
+
+	gsNormal := &testServer{res: make(chan interface{}, 2)}
+	pNormal, e := node1.Spawn("", gen.ProcessOptions{}, gsNormal)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gsNormal.res, nil)
+
+	gsMax := &testServer{res: make(chan interface{}, 2)}
+	pMax, e := node1.Spawn("", gen.ProcessOptions{Priority: gen.ProcessPriorityMax}, gsMax)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gsMax.res, nil)
+
+	fmt.Printf("    process info has the priority: ")
+	if p := pMax.Info().Priority; p != gen.ProcessPriorityMax {
+		t.Fatalf("expected %v, got %v", gen.ProcessPriorityMax, p)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    block the receiver: ")
+	pNormal.Send(p1.Self(), "block")
+	waitForResultWithValue(t, gs1.res, "block")
+	if err := pNormal.Send(p1.Self(), "fill"); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    message from the normal priority process is dropped: ")
+	if err := pNormal.Send(p1.Self(), "normal"); err != node.ErrProcessMailboxFull {
+		t.Fatalf("expected %q, got %v", node.ErrProcessMailboxFull, err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    message from the max priority process waits for the free slot: ")
+	sent := make(chan error, 1)
+	go func() {
+		sent <- pMax.Send(p1.Self(), "max")
+	}()
+	// unblock the receiver while the sender is waiting
+	time.Sleep(5 * time.Millisecond)
+	close(gs1.unblock)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    receiver handles the messages: ")
+	waitForResultWithValue(t, gs1.res, "fill")
+	waitForResultWithValue(t, gs1.res, "max")
+}
+
+func TestServerPriorityPaused(t *testing.T) {
+	fmt.Printf("\n=== Test Server Priority (paused receiver)\n")
+	node1, e := ergo.StartNode("nodeGS1PriorityPaused@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	gs1 := &priorityGS{
+		res:     make(chan interface{}, 10),
+		unblock: make(chan bool),
+	}
+	p1, e := node1.Spawn("", gen.ProcessOptions{MailboxSize: 1}, gs1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gs1.res, nil)
+
+	gsMax := &testServer{res: make(chan interface{}, 2)}
+	pMax, e := node1.Spawn("", gen.ProcessOptions{Priority: gen.ProcessPriorityMax}, gsMax)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, gsMax.res, nil)
+
+	fmt.Printf("    block the receiver: ")
+	pMax.Send(p1.Self(), "block")
+	waitForResultWithValue(t, gs1.res, "block")
+	if err := pMax.Send(p1.Self(), "fill"); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("    waiting message is held once the receiver is paused: ")
+	sent := make(chan error, 1)
+	go func() {
+		sent <- pMax.Send(p1.Self(), "max")
+	}()
+	time.Sleep(2 * time.Millisecond)
+	if err := node1.PauseProcess(p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+	close(gs1.unblock)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "fill")
+	select {
+	case m := <-gs1.res:
+		t.Fatal("paused process received", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	fmt.Printf("    held message is delivered on resume: ")
+	if err := node1.ResumeProcess(p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs1.res, "max")
+}
+
 func waitForResultWithValue(t *testing.T, w chan interface{}, value interface{}) {
 	select {
 	case v := <-w:
@@ -32,6 +32,7 @@ import (
 	"github.com/ergo-services/ergo/etf"
 	"github.com/ergo-services/ergo/gen"
 	"github.com/ergo-services/ergo/node"
+	"github.com/ergo-services/ergo/node/nodetest"
 )
 
 type testSupervisorOneForOne struct {
@@ -343,3 +344,99 @@ func checkExpectedChildrenStatus(children, children1 []etf.Pid, statuses []strin
 	}
 	return true
 }
+
+type testSupervisorBackoff struct {
+	gen.Supervisor
+}
+
+func (ts *testSupervisorBackoff) Init(args ...etf.Term) (gen.SupervisorSpec, error) {
+	ch := args[0].(chan interface{})
+	return gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			{
+				Name:  "testGSBackoff",
+				Child: &testSupervisorGenServer{},
+				Args:  []etf.Term{ch, 0},
+			},
+		},
+		Strategy: gen.SupervisorStrategy{
+			Type:        gen.SupervisorStrategyOneForOne,
+			Intensity:   10,
+			Period:      5,
+			Restart:     gen.SupervisorStrategyRestartBackoff,
+			BackoffBase: 100 * time.Millisecond,
+			BackoffCap:  time.Second,
+		},
+	}, nil
+}
+
+func TestSupervisorRestartBackoff(t *testing.T) {
+	fmt.Printf("\n=== Test Supervisor - restart with backoff\n")
+	// the restarts are scheduled with SendAfter, so the delays are driven by the fake clock
+	clock := nodetest.NewFakeTimerSource()
+	node1, e := ergo.StartNode("nodeSvBackoff@localhost", "cookies", node.Options{TimerSource: clock})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+
+	ch := make(chan interface{}, 10)
+	sv, e := node1.Spawn("testSupervisorBackoff", gen.ProcessOptions{}, &testSupervisorBackoff{}, ch)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	started := func() etf.Pid {
+		for {
+			select {
+			case m := <-ch:
+				if s, ok := m.(testMessageStarted); ok {
+					return s.pid
+				}
+			case <-time.After(time.Second):
+				t.Fatal("child is not started")
+			}
+		}
+	}
+
+	// restartAfter crashes the child and checks it's restarted after the given delay
+	restartAfter := func(pid etf.Pid, delay time.Duration) etf.Pid {
+		pending := clock.Pending()
+		if err := sv.Send(pid, "crash"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; clock.Pending() == pending; i++ {
+			if i > 100 {
+				t.Fatal("restart is not scheduled")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// the child has been terminated before scheduling the restart
+		if m := <-ch; m != (testMessageTerminated{name: "testGSBackoff", pid: pid}) {
+			t.Fatal("unexpected message", m)
+		}
+		clock.Advance(delay - time.Millisecond)
+		select {
+		case m := <-ch:
+			if _, ok := m.(testMessageStarted); ok {
+				t.Fatal("child is restarted too early")
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+		clock.Advance(time.Millisecond)
+		return started()
+	}
+
+	pid := started()
+	fmt.Printf("    delay grows exponentially up to the cap: ")
+	for _, delay := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		pid = restartAfter(pid, delay*time.Millisecond)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    delay is reset if the child has been running longer than the cap: ")
+	time.Sleep(1100 * time.Millisecond)
+	pid = restartAfter(pid, 100*time.Millisecond)
+	pid = restartAfter(pid, 200*time.Millisecond)
+	fmt.Println("OK")
+}